@@ -5,9 +5,11 @@ import (
 	"encoding/json"
 	"flag"
 	"io/ioutil"
+	"net"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -17,6 +19,8 @@ import (
 	"github.com/capella-pw/queue/cluster"
 	"github.com/capella-pw/queue/cluster/cap"
 	"github.com/capella-pw/queue/cluster/http_service"
+	"github.com/capella-pw/queue/cluster/kafka"
+	"github.com/capella-pw/queue/cluster/resp"
 	"github.com/capella-pw/queue/cn"
 	"github.com/capella-pw/queue/compress"
 	"github.com/capella-pw/queue/security/authentication/basic"
@@ -73,10 +77,25 @@ var fTlsKey = flag.String("tls_key", "",
 var fTlsCert = flag.String("tls_cert", "",
 	"tls certificate; example `app/cert.pem`")
 
+var fKafkaListenAddress = flag.String("kafka_l", "",
+	"Kafka protocol listen address and port for example :9092; empty - kafka gateway is disabled")
+
+var fKafkaHost = flag.String("kafka_host", "localhost",
+	"Kafka gateway advertised host")
+
+var fKafkaPartitions = flag.Int("kafka_partitions", 1,
+	"Kafka gateway partitions of topic (partition is segment of message)")
+
+var fRespListenAddress = flag.String("resp_l", "",
+	"RESP (redis streams) listen address and port for example :6379; empty - resp server is disabled")
+
 var storageGenerator *storage.Generator
 var compressor *compress.Generator
 
 var clusterFastHTTPHandler func(ctx *fasthttp.RequestCtx)
+var restFastHTTPHandler func(ctx *fasthttp.RequestCtx)
+var streamFastHTTPHandler func(ctx *fasthttp.RequestCtx)
+var openAPIFastHTTPHandler = http_service.OpenAPIFastHTTPHandler("capella queue cluster API", "1", cap.ClusterMethodPath)
 
 func createCompressGenerator() {
 	compressor = compress.GeneratorCreate(*fCompressDefaultLevel)
@@ -215,16 +234,35 @@ func main() {
 	var c cluster.Cluster
 	c = cl
 
+	clusterService := cluster.ClusterServiceJsonCreate(checkAuth, c, compressor)
+
 	clusterFastHTTPHandler = http_service.FastHTTPHandler(
-		cluster.ClusterServiceJsonCreate(checkAuth, c, compressor),
+		clusterService,
 		func() (ctx context.Context, doOnCompete func()) {
 			return context.WithTimeout(context.Background(), time.Second*5)
 		},
 		addFunc,
 	)
 
+	restFastHTTPHandler = http_service.RestFastHTTPHandler(clusterService, addFunc)
+	streamFastHTTPHandler = http_service.StreamFastHTTPHandler(clusterService)
+
 	// start API
 
+	var kafkaGateway *kafka.Gateway
+	if *fKafkaListenAddress != "" {
+		var er0 error
+		kafkaGateway, er0 = createKafkaGateway(c, checkAuth)
+		if er0 != nil {
+			log.Fatalf("Kafka gateway create fail %v", er0)
+		}
+	}
+
+	var respServer *resp.Server
+	if *fRespListenAddress != "" {
+		respServer = createRespServer(c, checkAuth)
+	}
+
 	api := &fasthttp.Server{
 		Handler: fastHTTPHandler,
 	}
@@ -241,6 +279,24 @@ func main() {
 		}
 	}()
 
+	if kafkaGateway != nil {
+		go func() {
+			log.Infof("Kafka gateway listen and serve %v", *fKafkaListenAddress)
+			if err := kafkaGateway.ListenAndServe(*fKafkaListenAddress); err != nil {
+				serverErrors <- err
+			}
+		}()
+	}
+
+	if respServer != nil {
+		go func() {
+			log.Infof("RESP server listen and serve %v", *fRespListenAddress)
+			if err := respServer.ListenAndServe(*fRespListenAddress); err != nil {
+				serverErrors <- err
+			}
+		}()
+	}
+
 	osSignals := make(chan os.Signal, 1)
 	signal.Notify(osSignals, os.Interrupt, syscall.SIGTERM)
 
@@ -250,6 +306,12 @@ func main() {
 
 	case <-osSignals:
 		log.Infof("Start shutdown...")
+		if kafkaGateway != nil {
+			kafkaGateway.Close()
+		}
+		if respServer != nil {
+			respServer.Close()
+		}
 		go func() {
 			if err := api.Shutdown(); err != nil {
 				log.Infof("Graceful shutdown did not complete in 5s : %v", err)
@@ -260,6 +322,35 @@ func main() {
 	log.Infof("Complete shutdown")
 }
 
+func createKafkaGateway(c cluster.Cluster, checkAuth cluster.CheckAuthFunc) (*kafka.Gateway, error) {
+	_, portStr, err := net.SplitHostPort(*fKafkaListenAddress)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, err
+	}
+
+	g := kafka.GatewayCreate(c, checkAuth, *fKafkaPartitions, *fKafkaHost, int32(port))
+	g.ThrowErrorFunc = func(err *mft.Error) bool {
+		log.Debugln(err)
+		return true
+	}
+
+	return g, nil
+}
+
+func createRespServer(c cluster.Cluster, checkAuth cluster.CheckAuthFunc) *resp.Server {
+	s := resp.ServerCreate(c, checkAuth)
+	s.ThrowErrorFunc = func(err *mft.Error) bool {
+		log.Debugln(err)
+		return true
+	}
+
+	return s
+}
+
 func fastHTTPHandler(ctx *fasthttp.RequestCtx) {
 	path := string(ctx.Request.URI().Path())
 	log.Tracef("http call path %v", path)
@@ -273,6 +364,23 @@ func fastHTTPHandler(ctx *fasthttp.RequestCtx) {
 	} else if path == "/ping" {
 		ping(ctx)
 		return
+	} else if path == http_service.OpenAPIPath {
+		openAPIFastHTTPHandler(ctx)
+		return
+	} else if http_service.IsStreamPath(path) {
+		if streamFastHTTPHandler != nil {
+			streamFastHTTPHandler(ctx)
+			return
+		}
+		unknownInternalError(ctx)
+		return
+	} else if http_service.IsRestPath(path) {
+		if restFastHTTPHandler != nil {
+			restFastHTTPHandler(ctx)
+			return
+		}
+		unknownInternalError(ctx)
+		return
 	}
 	notFound(ctx)
 }
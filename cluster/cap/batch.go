@@ -0,0 +1,143 @@
+package cap
+
+import (
+	"context"
+
+	"github.com/capella-pw/queue/cluster"
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/queue"
+	"github.com/myfantasy/mft"
+)
+
+// Batch - client-side batch of cluster requests sent in one /cluster round trip
+// Do can be used as doFunc of ConGroup.FuncDO and ConGroup.FuncDOName
+type Batch struct {
+	Parallel    bool
+	StopOnError bool
+
+	requests   []*cluster.RequestBody
+	onResponce []func(responce *cluster.ResponceBody) (err *mft.Error)
+}
+
+// BatchCreate - create batch
+func BatchCreate(parallel bool, stopOnError bool) *Batch {
+	return &Batch{
+		Parallel:    parallel,
+		StopOnError: stopOnError,
+	}
+}
+
+// Len - count of requests in batch
+func (b *Batch) Len() int {
+	return len(b.requests)
+}
+
+// Add - add request into batch; onResponce is called with responce of request (can be nil)
+func (b *Batch) Add(request *cluster.RequestBody,
+	onResponce func(responce *cluster.ResponceBody) (err *mft.Error),
+) *Batch {
+	b.requests = append(b.requests, request)
+	b.onResponce = append(b.onResponce, onResponce)
+
+	return b
+}
+
+func (b *Batch) addQueue(queueName string, action string, v interface{},
+	onResponce func(responce *cluster.ResponceBody) (err *mft.Error),
+) *Batch {
+	request := cluster.MarshalRequestMust(nil, action, v)
+	request.ObjectName = queueName
+
+	return b.Add(request, onResponce)
+}
+
+// QueueGet - add q_get request
+func (b *Batch) QueueGet(queueName string, idStart int64, cntLimit int,
+	doOnOk func(messages []*queue.MessageWithMeta),
+) *Batch {
+	return b.addQueue(queueName, cn.OpQueueGet, cluster.QueueGetRequest{
+		IdStart:  idStart,
+		CntLimit: cntLimit,
+	}, func(responce *cluster.ResponceBody) (err *mft.Error) {
+		var messages queue.MessagesWithMeta
+		err = responce.UnmarshalInnerObject(&messages)
+		if err == nil && doOnOk != nil {
+			doOnOk(messages)
+		}
+		return err
+	})
+}
+
+// QueueAddUniqueList - add q_add_unique_list request
+func (b *Batch) QueueAddUniqueList(queueName string, messages []queue.Message, saveMode cn.SaveMode,
+	doOnOk func(ids []int64),
+) *Batch {
+	return b.addQueue(queueName, cn.OpQueueAddUniqueList, cluster.QueueAddListRequest{
+		Messages: messages,
+		SaveMode: saveMode,
+	}, func(responce *cluster.ResponceBody) (err *mft.Error) {
+		var ids []int64
+		err = responce.UnmarshalInnerObject(&ids)
+		if err == nil && doOnOk != nil {
+			doOnOk(ids)
+		}
+		return err
+	})
+}
+
+// QueueSubscriberGetLastRead - add q_subs_get_last request
+func (b *Batch) QueueSubscriberGetLastRead(queueName string, subscriber string,
+	doOnOk func(id int64),
+) *Batch {
+	return b.addQueue(queueName, cn.OpQueueSubscriberGetLastRead, subscriber,
+		func(responce *cluster.ResponceBody) (err *mft.Error) {
+			var id int64
+			err = responce.UnmarshalInnerObject(&id)
+			if err == nil && doOnOk != nil {
+				doOnOk(id)
+			}
+			return err
+		})
+}
+
+// QueueSubscriberSetLastRead - add q_subs_set_last request
+func (b *Batch) QueueSubscriberSetLastRead(queueName string, subscriber string, id int64, saveMode cn.SaveMode) *Batch {
+	return b.addQueue(queueName, cn.OpQueueSubscriberSetLastRead, cluster.QueueSubscriberSetLastReadRequest{
+		Subscriber: subscriber,
+		Id:         id,
+		SaveMode:   saveMode,
+	}, nil)
+}
+
+// Do - send batch into cluster; returns first error of requests (onResponce is called for every responce)
+func (b *Batch) Do(ctx context.Context, cl *cluster.ExternalAbstractCluster) (err *mft.Error) {
+	if len(b.requests) == 0 {
+		return nil
+	}
+
+	resp, err := cl.Batch(ctx, nil, cluster.BatchRequest{
+		Requests:    b.requests,
+		Parallel:    b.Parallel,
+		StopOnError: b.StopOnError,
+	})
+	if err != nil {
+		return GenerateErrorE(10191300, err, len(b.requests))
+	}
+	if len(resp.Responces) != len(b.requests) {
+		return GenerateError(10191301, len(resp.Responces), len(b.requests))
+	}
+
+	for i, responce := range resp.Responces {
+		var errItem *mft.Error
+		if b.onResponce[i] != nil {
+			errItem = b.onResponce[i](responce)
+		} else {
+			errItem = responce.Err
+		}
+		if errItem != nil && err == nil {
+			err = GenerateErrorE(10191302, errItem, i, b.requests[i].Action, b.requests[i].ObjectName)
+		}
+	}
+
+	return err
+}
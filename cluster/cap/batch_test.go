@@ -0,0 +1,74 @@
+package cap
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/queue"
+)
+
+func TestBatch_Do(t *testing.T) {
+	tn := testNodeCreate("q1")
+	ctx := context.Background()
+
+	var ids []int64
+	var lastRead int64 = -1
+	err := BatchCreate(false, true).
+		QueueAddUniqueList("q1", []queue.Message{{Message: []byte("a"), ExternalID: 1}, {Message: []byte("b"), ExternalID: 2}},
+			cn.SaveMarkSaveMode, func(out []int64) { ids = out }).
+		QueueSubscriberSetLastRead("q1", "s1", 0, cn.SaveMarkSaveMode).
+		QueueSubscriberGetLastRead("q1", "s1", func(id int64) { lastRead = id }).
+		Do(ctx, tn.external())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls := atomic.LoadInt32(&tn.calls); calls != 1 {
+		t.Errorf("Batch.Do should send requests in 1 call not %v", calls)
+	}
+	if len(ids) != 2 || lastRead != 0 {
+		t.Fatalf("Batch.Do should call onResponce of requests: ids %v last read %v", ids, lastRead)
+	}
+
+	var messages []*queue.MessageWithMeta
+	err = BatchCreate(true, false).
+		QueueSubscriberSetLastRead("q1", "s1", ids[0], cn.SaveMarkSaveMode).
+		QueueGet("q1", 0, 10, func(out []*queue.MessageWithMeta) { messages = out }).
+		Do(ctx, tn.external())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || messages[0].ID != ids[0] || string(messages[1].Message) != "b" {
+		t.Errorf("Batch.Do QueueGet should return messages of queue")
+	}
+
+	// error of request
+	called := false
+	err = BatchCreate(false, true).
+		QueueGet("q2", 0, 10, nil).
+		QueueSubscriberGetLastRead("q1", "s1", func(id int64) { called = true }).
+		Do(ctx, tn.external())
+	if err == nil || err.Code != 10191302 || err.InternalError == nil {
+		t.Fatalf("Batch.Do should fail with 10191302 not %v", err)
+	}
+	if called {
+		t.Errorf("Batch.Do with StopOnError should not call onResponce of skipped request")
+	}
+
+	// empty batch is not sent
+	calls := atomic.LoadInt32(&tn.calls)
+	if err := BatchCreate(false, false).Do(ctx, tn.external()); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&tn.calls) != calls {
+		t.Errorf("Batch.Do should not send empty batch")
+	}
+
+	// call fail
+	atomic.StoreInt32(&tn.down, 1)
+	err = BatchCreate(false, false).QueueGet("q1", 0, 10, nil).Do(ctx, tn.external())
+	if err == nil || err.Code != 10191300 {
+		t.Errorf("Batch.Do should fail with 10191300 not %v", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"sync"
+	"time"
 
 	"github.com/capella-pw/queue/cluster"
 	"github.com/capella-pw/queue/cn"
@@ -22,7 +23,16 @@ type ConGroup struct {
 
 	PriorityGroups map[string]*PriorityGroup `json:"priority_groups"`
 
-	mx sync.Mutex
+	// HealthCheckSettings - settings of StartHealthCheck and circuit breakers (nil - defaults)
+	HealthCheckSettings *HealthCheckSettings `json:"health_check,omitempty"`
+	// Health - circuit breakers of connections (filled by Ping, StartHealthCheck and ReportResult)
+	Health map[string]*ConHealth `json:"-"`
+	// OnStateChange - transitions of circuit breakers
+	OnStateChange func(conName string, from CircuitState, to CircuitState, err *mft.Error) `json:"-"`
+
+	mx         sync.Mutex
+	healthStop chan struct{}
+	healthDone chan struct{}
 }
 
 type PriorityGroupStep struct {
@@ -89,18 +99,9 @@ func (cg *ConGroup) AddConnection(name string, connection *ClusterConnection) *C
 
 func (cg *ConGroup) Ping(ctx context.Context, errFunc func(err *mft.Error)) {
 	for cn, c := range cg.Clusters {
-		err := c.Ping(ctx, nil)
-		if err != nil {
-			cg.mx.Lock()
-			cg.HealthCheck[cn] = false
-			cg.mx.Unlock()
-			if errFunc != nil {
-				errFunc(err)
-			}
-		} else {
-			cg.mx.Lock()
-			cg.HealthCheck[cn] = true
-			cg.mx.Unlock()
+		err := cg.pingConnection(ctx, cn, c, 0)
+		if err != nil && errFunc != nil {
+			errFunc(err)
 		}
 	}
 }
@@ -147,17 +148,26 @@ func (cg *ConGroup) FuncDO(ctx context.Context, pgName string,
 		moveCnt := 0
 		idx := pgs.NextIndex
 
+		// round robin order from NextIndex; steps with health check prefer connections with less latency
+		conNames := make([]string, 0, len(pgs.ConNames))
+		for i := range pgs.ConNames {
+			conNames = append(conNames, pgs.ConNames[(idx+i)%len(pgs.ConNames)])
+		}
+		if !pgs.IgnoreHealthCheck {
+			cg.sortByLatency(conNames)
+		}
+
 		var wg sync.WaitGroup
 
 		ch := make(chan bool, 2)
 
+		// acquire of semaphore is cancelled when MinSuccess is reached (successful calls do not release semaphore)
+		ctxAcquire, cancelAcquire := context.WithCancel(ctx)
+
 		wg.Add(1)
 
-		for moveCnt < len(pgs.ConNames) && cntOk < pg.MinSuccess {
-			if idx >= len(pgs.ConNames) {
-				idx = 0
-			}
-			cn := pgs.ConNames[idx]
+		for moveCnt < len(conNames) && cntOk < pg.MinSuccess {
+			cn := conNames[moveCnt]
 			idx++
 			moveCnt++
 
@@ -168,28 +178,33 @@ func (cg *ConGroup) FuncDO(ctx context.Context, pgName string,
 			}
 			mx.Unlock()
 
-			if !pgs.IgnoreHealthCheck {
-				cg.mx.Lock()
-				isHealth, okHealth := cg.HealthCheck[cn]
-				cg.mx.Unlock()
-
-				if okHealth && !isHealth {
-					continue
-				}
+			if !pgs.IgnoreHealthCheck && !cg.isAvailable(cn) {
+				continue
 			}
 
 			c, okCluster := cg.Clusters[cn]
 			if !okCluster {
+				cancelAcquire()
 				return GenerateError(10191104, cn, cntOk, pg.MinSuccess)
 			}
 
-			if er0 := sem.Acquire(ctx, 1); er0 != nil {
+			if er0 := sem.Acquire(ctxAcquire, 1); er0 != nil {
+				cg.probeDone(cn)
+				mx.Lock()
+				done := cntOk >= pg.MinSuccess
+				mx.Unlock()
+				if done {
+					break
+				}
+				cancelAcquire()
 				return GenerateErrorE(10191101, er0, cntOk, pg.MinSuccess)
 			}
 
 			wg.Add(1)
 			go func() {
+				start := time.Now()
 				errStep := doFunc(ctx, c)
+				cg.reportCall(cn, time.Since(start), errStep)
 				if errStep == nil {
 					mx.Lock()
 					_, ok := sended[cn]
@@ -199,6 +214,7 @@ func (cg *ConGroup) FuncDO(ctx context.Context, pgName string,
 						cntOk++
 
 						if cntOk == pg.MinSuccess {
+							cancelAcquire()
 							ch <- true
 						}
 					}
@@ -241,8 +257,11 @@ func (cg *ConGroup) FuncDO(ctx context.Context, pgName string,
 		select {
 		case <-ch:
 		}
+		cancelAcquire()
 
-		pgs.NextIndex = idx
+		if len(pgs.ConNames) > 0 {
+			pgs.NextIndex = idx % len(pgs.ConNames)
+		}
 
 		step++
 	}
@@ -0,0 +1,391 @@
+package cap
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/capella-pw/queue/cluster"
+	"github.com/myfantasy/mft"
+)
+
+// CircuitState - state of circuit breaker of connection
+type CircuitState int
+
+const (
+	// CircuitClosed - connection is used
+	CircuitClosed CircuitState = 0
+	// CircuitOpen - connection is not used until HealthCheckSettings.OpenTimeout
+	CircuitOpen CircuitState = 1
+	// CircuitHalfOpen - connection is used by one call at a time (probe); first fail opens circuit, SuccessThreshold successes close it
+	CircuitHalfOpen CircuitState = 2
+)
+
+func (cs CircuitState) String() string {
+	switch cs {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// MarshalText - json name of state
+func (cs CircuitState) MarshalText() ([]byte, error) {
+	return []byte(cs.String()), nil
+}
+
+var (
+	// HealthCheckIntervalDefault - interval of ping of connections
+	HealthCheckIntervalDefault = time.Second * 5
+	// HealthCheckTimeoutDefault - timeout of ping
+	HealthCheckTimeoutDefault = time.Second * 2
+	// HealthCheckFailureThresholdDefault - count of fails in a row that opens circuit
+	HealthCheckFailureThresholdDefault = 3
+	// HealthCheckSuccessThresholdDefault - count of successes in a row that closes half-open circuit
+	HealthCheckSuccessThresholdDefault = 2
+	// HealthCheckOpenTimeoutDefault - time of open circuit before half-open
+	HealthCheckOpenTimeoutDefault = time.Second * 30
+	// HealthCheckLatencyWeightDefault - weight of last measurement in average latency
+	HealthCheckLatencyWeightDefault = 0.3
+)
+
+// HealthCheckSettings - settings of health check and circuit breakers of connections
+type HealthCheckSettings struct {
+	Interval         time.Duration `json:"interval"`
+	Timeout          time.Duration `json:"timeout"`
+	FailureThreshold int           `json:"failure_threshold"`
+	SuccessThreshold int           `json:"success_threshold"`
+	OpenTimeout      time.Duration `json:"open_timeout"`
+	// LatencyWeight - weight of last measurement in average latency (0..1]
+	LatencyWeight float64 `json:"latency_weight"`
+	// CountCallErrors - errors of FuncDO calls are counted by circuit breaker (not only ping errors)
+	CountCallErrors bool `json:"count_call_errors"`
+}
+
+// HealthCheckSettingsDefault - default settings of health check
+func HealthCheckSettingsDefault() *HealthCheckSettings {
+	return &HealthCheckSettings{
+		Interval:         HealthCheckIntervalDefault,
+		Timeout:          HealthCheckTimeoutDefault,
+		FailureThreshold: HealthCheckFailureThresholdDefault,
+		SuccessThreshold: HealthCheckSuccessThresholdDefault,
+		OpenTimeout:      HealthCheckOpenTimeoutDefault,
+		LatencyWeight:    HealthCheckLatencyWeightDefault,
+	}
+}
+
+// ConHealth - health of connection
+type ConHealth struct {
+	State                CircuitState `json:"state"`
+	ConsecutiveFailures  int          `json:"consecutive_failures"`
+	ConsecutiveSuccesses int          `json:"consecutive_successes"`
+	// Latency - average latency of pings and calls (0 - not measured)
+	Latency   time.Duration `json:"latency"`
+	LastCheck time.Time     `json:"last_check"`
+	LastError *mft.Error    `json:"last_error,omitempty"`
+	// StateChanged - time of last transition
+	StateChanged time.Time `json:"state_changed"`
+
+	// probing - call of half-open connection is in flight (probe is released after OpenTimeout when result is not reported)
+	probing    bool
+	probeStart time.Time
+}
+
+// healthSettings - settings with defaults; cg.mx should be locked
+func (cg *ConGroup) healthSettings() HealthCheckSettings {
+	s := *HealthCheckSettingsDefault()
+	if cg.HealthCheckSettings == nil {
+		return s
+	}
+	hs := *cg.HealthCheckSettings
+	if hs.Interval <= 0 {
+		hs.Interval = s.Interval
+	}
+	if hs.Timeout <= 0 {
+		hs.Timeout = s.Timeout
+	}
+	if hs.FailureThreshold <= 0 {
+		hs.FailureThreshold = s.FailureThreshold
+	}
+	if hs.SuccessThreshold <= 0 {
+		hs.SuccessThreshold = s.SuccessThreshold
+	}
+	if hs.OpenTimeout <= 0 {
+		hs.OpenTimeout = s.OpenTimeout
+	}
+	if hs.LatencyWeight <= 0 || hs.LatencyWeight > 1 {
+		hs.LatencyWeight = s.LatencyWeight
+	}
+	return hs
+}
+
+// health - health of connection; cg.mx should be locked
+func (cg *ConGroup) health(conName string) (h *ConHealth, isNew bool) {
+	if cg.Health == nil {
+		cg.Health = make(map[string]*ConHealth)
+	}
+	if cg.HealthCheck == nil {
+		cg.HealthCheck = make(map[string]bool)
+	}
+	h, ok := cg.Health[conName]
+	if !ok {
+		h = &ConHealth{StateChanged: time.Now()}
+		cg.Health[conName] = h
+	}
+	return h, !ok
+}
+
+// setState - transition of circuit; cg.mx should be locked; returns func that reports transition
+func (cg *ConGroup) setState(conName string, h *ConHealth, state CircuitState) (report func()) {
+	if h.State == state {
+		return nil
+	}
+	from := h.State
+	h.State = state
+	h.StateChanged = time.Now()
+	h.ConsecutiveFailures = 0
+	h.ConsecutiveSuccesses = 0
+	h.probing = false
+	cg.HealthCheck[conName] = state != CircuitOpen
+
+	onChange := cg.OnStateChange
+	if onChange == nil {
+		return nil
+	}
+	err := h.LastError
+	return func() {
+		onChange(conName, from, state, err)
+	}
+}
+
+// isAvailable - connection can be used by steps with health check
+// (open circuit becomes half-open after OpenTimeout; half-open connection is available for one call at a time,
+// result of call should be reported by reportCall or probe should be released by probeDone)
+func (cg *ConGroup) isAvailable(conName string) bool {
+	cg.mx.Lock()
+	h, ok := cg.Health[conName]
+	if !ok {
+		isHealth, okHealth := cg.HealthCheck[conName]
+		cg.mx.Unlock()
+		return !okHealth || isHealth
+	}
+
+	hs := cg.healthSettings()
+	var report func()
+	if h.State == CircuitOpen && time.Since(h.StateChanged) >= hs.OpenTimeout {
+		report = cg.setState(conName, h, CircuitHalfOpen)
+	}
+	available := h.State != CircuitOpen
+	if h.State == CircuitHalfOpen {
+		if h.probing && time.Since(h.probeStart) < hs.OpenTimeout {
+			available = false
+		} else {
+			h.probing = true
+			h.probeStart = time.Now()
+		}
+	}
+	cg.mx.Unlock()
+
+	if report != nil {
+		report()
+	}
+
+	return available
+}
+
+// probeDone - release probe of half-open connection
+func (cg *ConGroup) probeDone(conName string) {
+	cg.mx.Lock()
+	defer cg.mx.Unlock()
+
+	if h, ok := cg.Health[conName]; ok {
+		h.probing = false
+	}
+}
+
+// latency - average latency of connection (0 - not measured)
+func (cg *ConGroup) latency(conName string) time.Duration {
+	cg.mx.Lock()
+	defer cg.mx.Unlock()
+
+	if h, ok := cg.Health[conName]; ok {
+		return h.Latency
+	}
+	return 0
+}
+
+// sortByLatency - sort connections by latency (not measured connections are first); order of equal is kept
+func (cg *ConGroup) sortByLatency(conNames []string) {
+	latencies := make(map[string]time.Duration, len(conNames))
+	for _, conName := range conNames {
+		latencies[conName] = cg.latency(conName)
+	}
+	sort.SliceStable(conNames, func(i, j int) bool {
+		return latencies[conNames[i]] < latencies[conNames[j]]
+	})
+}
+
+// ReportResult - result of ping or call of connection for circuit breaker
+func (cg *ConGroup) ReportResult(conName string, latency time.Duration, err *mft.Error) {
+	cg.mx.Lock()
+	hs := cg.healthSettings()
+	h, isNew := cg.health(conName)
+
+	h.LastCheck = time.Now()
+	h.probing = false
+	var report func()
+	if err == nil {
+		if h.Latency == 0 {
+			h.Latency = latency
+		} else {
+			h.Latency = time.Duration(hs.LatencyWeight*float64(latency) + (1-hs.LatencyWeight)*float64(h.Latency))
+		}
+		h.ConsecutiveFailures = 0
+		h.ConsecutiveSuccesses++
+		switch h.State {
+		case CircuitHalfOpen:
+			if h.ConsecutiveSuccesses >= hs.SuccessThreshold {
+				report = cg.setState(conName, h, CircuitClosed)
+			}
+		case CircuitOpen:
+			if time.Since(h.StateChanged) >= hs.OpenTimeout {
+				report = cg.setState(conName, h, CircuitHalfOpen)
+			}
+		default:
+			cg.HealthCheck[conName] = true
+		}
+	} else {
+		h.LastError = err
+		h.ConsecutiveSuccesses = 0
+		h.ConsecutiveFailures++
+		switch h.State {
+		case CircuitHalfOpen:
+			report = cg.setState(conName, h, CircuitOpen)
+		case CircuitClosed:
+			// connection that fails first check is not used until OpenTimeout
+			if isNew || h.ConsecutiveFailures >= hs.FailureThreshold {
+				report = cg.setState(conName, h, CircuitOpen)
+			}
+		}
+	}
+	cg.mx.Unlock()
+
+	if report != nil {
+		report()
+	}
+}
+
+// reportCall - result of call of FuncDO
+func (cg *ConGroup) reportCall(conName string, latency time.Duration, err *mft.Error) {
+	cg.mx.Lock()
+	countErrors := cg.HealthCheckSettings != nil && cg.HealthCheckSettings.CountCallErrors
+	cg.mx.Unlock()
+
+	if err != nil && !countErrors {
+		cg.probeDone(conName)
+		return
+	}
+	cg.ReportResult(conName, latency, err)
+}
+
+// ConnectionsHealth - health of connections
+func (cg *ConGroup) ConnectionsHealth() map[string]ConHealth {
+	cg.mx.Lock()
+	defer cg.mx.Unlock()
+
+	res := make(map[string]ConHealth, len(cg.Health))
+	for n, h := range cg.Health {
+		res[n] = *h
+	}
+	return res
+}
+
+// pingConnection - ping connection and report result
+func (cg *ConGroup) pingConnection(ctx context.Context, conName string, c *cluster.ExternalAbstractCluster,
+	timeout time.Duration) (err *mft.Error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err = c.Ping(ctx, nil)
+	if err != nil {
+		err = GenerateErrorE(10191140, err, conName)
+	}
+	cg.ReportResult(conName, time.Since(start), err)
+
+	return err
+}
+
+// StartHealthCheck - start background ping of connections (HealthCheckSettings are used)
+func (cg *ConGroup) StartHealthCheck(errFunc func(err *mft.Error)) (err *mft.Error) {
+	cg.mx.Lock()
+	if cg.healthStop != nil {
+		cg.mx.Unlock()
+		return GenerateError(10191141)
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	cg.healthStop = stop
+	cg.healthDone = done
+	cg.mx.Unlock()
+
+	go func() {
+		defer close(done)
+		for {
+			cg.mx.Lock()
+			hs := cg.healthSettings()
+			cg.mx.Unlock()
+
+			cg.pingAll(hs.Timeout, errFunc)
+
+			t := time.NewTimer(hs.Interval)
+			select {
+			case <-t.C:
+			case <-stop:
+				t.Stop()
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// StopHealthCheck - stop background ping of connections
+func (cg *ConGroup) StopHealthCheck() {
+	cg.mx.Lock()
+	stop, done := cg.healthStop, cg.healthDone
+	cg.healthStop = nil
+	cg.healthDone = nil
+	cg.mx.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+// pingAll - ping all connections in parallel
+func (cg *ConGroup) pingAll(timeout time.Duration, errFunc func(err *mft.Error)) {
+	done := make(chan struct{}, len(cg.Clusters))
+	for conName, c := range cg.Clusters {
+		go func(conName string, c *cluster.ExternalAbstractCluster) {
+			err := cg.pingConnection(context.Background(), conName, c, timeout)
+			if err != nil && errFunc != nil {
+				errFunc(err)
+			}
+			done <- struct{}{}
+		}(conName, c)
+	}
+	for range cg.Clusters {
+		<-done
+	}
+}
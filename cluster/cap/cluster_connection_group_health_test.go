@@ -0,0 +1,225 @@
+package cap
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/myfantasy/mft"
+)
+
+func (tn *testNode) Ping(ctx context.Context, user cn.CapUser) (err *mft.Error) {
+	return nil
+}
+
+type testTransitions struct {
+	mx     sync.Mutex
+	states []CircuitState
+}
+
+func (tt *testTransitions) onStateChange(conName string, from CircuitState, to CircuitState, err *mft.Error) {
+	if conName != "n0" {
+		return
+	}
+	tt.mx.Lock()
+	defer tt.mx.Unlock()
+	if len(tt.states) == 0 {
+		tt.states = append(tt.states, from)
+	}
+	tt.states = append(tt.states, to)
+}
+
+func (tt *testTransitions) get() []CircuitState {
+	tt.mx.Lock()
+	defer tt.mx.Unlock()
+	return append([]CircuitState(nil), tt.states...)
+}
+
+func testState(t *testing.T, cg *ConGroup, state CircuitState) {
+	if h := cg.ConnectionsHealth()["n0"]; h.State != state {
+		t.Fatalf("circuit of n0 should be %v not %v", state, h.State)
+	}
+}
+
+func TestConGroup_CircuitBreaker(t *testing.T) {
+	tn0 := testNodeCreate("q1")
+	tn1 := testNodeCreate("q1")
+
+	tt := &testTransitions{}
+	cg := testConGroup(tn0, tn1)
+	cg.PriorityGroups["pg"].Steps[0].IgnoreHealthCheck = false
+	cg.HealthCheckSettings = &HealthCheckSettings{
+		FailureThreshold: 2,
+		SuccessThreshold: 2,
+		OpenTimeout:      50 * time.Millisecond,
+	}
+	cg.OnStateChange = tt.onStateChange
+
+	ctx := context.Background()
+	add := func() {
+		err := cg.FuncDO(ctx, "pg", QueueAddUniqueList("q1", nil, cn.SaveMarkSaveMode, nil), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// closed
+	cg.Ping(ctx, nil)
+	testState(t, cg, CircuitClosed)
+
+	// closed -> open after FailureThreshold fails
+	atomic.StoreInt32(&tn0.down, 1)
+	cg.Ping(ctx, nil)
+	testState(t, cg, CircuitClosed)
+	cg.Ping(ctx, nil)
+	testState(t, cg, CircuitOpen)
+
+	// open connection is not used
+	calls := atomic.LoadInt32(&tn0.calls)
+	add()
+	if atomic.LoadInt32(&tn0.calls) != calls || atomic.LoadInt32(&tn1.calls) == 0 {
+		t.Errorf("ConGroup.FuncDO should not call connection with open circuit")
+	}
+
+	// open -> half-open after OpenTimeout; fail of half-open -> open
+	time.Sleep(60 * time.Millisecond)
+	if !cg.isAvailable("n0") {
+		t.Fatalf("circuit should be half-open after OpenTimeout")
+	}
+	testState(t, cg, CircuitHalfOpen)
+	if cg.isAvailable("n0") {
+		t.Fatalf("half-open circuit should allow one probe at a time")
+	}
+	cg.Ping(ctx, nil)
+	testState(t, cg, CircuitOpen)
+
+	// open -> half-open -> closed after SuccessThreshold successes
+	atomic.StoreInt32(&tn0.down, 0)
+	time.Sleep(60 * time.Millisecond)
+	cg.Ping(ctx, nil)
+	testState(t, cg, CircuitHalfOpen)
+
+	// only one call of half-open connection is in flight
+	if !cg.isAvailable("n0") || cg.isAvailable("n0") {
+		t.Fatalf("half-open circuit should allow one probe at a time")
+	}
+	calls = atomic.LoadInt32(&tn0.calls)
+	add()
+	if atomic.LoadInt32(&tn0.calls) != calls {
+		t.Errorf("ConGroup.FuncDO should not call half-open connection while probe is in flight")
+	}
+	cg.probeDone("n0")
+
+	var wg sync.WaitGroup
+	var probes int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if cg.isAvailable("n0") {
+				atomic.AddInt32(&probes, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if probes != 1 {
+		t.Fatalf("half-open circuit should allow 1 probe not %v", probes)
+	}
+
+	// result of probe releases it
+	cg.Ping(ctx, nil)
+	testState(t, cg, CircuitHalfOpen)
+	if !cg.isAvailable("n0") {
+		t.Fatalf("half-open circuit should allow probe after result of previous probe")
+	}
+	cg.Ping(ctx, nil)
+	testState(t, cg, CircuitClosed)
+
+	calls = atomic.LoadInt32(&tn0.calls)
+	add()
+	add()
+	if atomic.LoadInt32(&tn0.calls) == calls {
+		t.Errorf("ConGroup.FuncDO should call connection with closed circuit")
+	}
+
+	expected := []CircuitState{CircuitClosed, CircuitOpen, CircuitHalfOpen, CircuitOpen, CircuitHalfOpen, CircuitClosed}
+	states := tt.get()
+	if len(states) != len(expected) {
+		t.Fatalf("OnStateChange transitions %v should be %v", states, expected)
+	}
+	for i := range expected {
+		if states[i] != expected[i] {
+			t.Fatalf("OnStateChange transitions %v should be %v", states, expected)
+		}
+	}
+}
+
+func TestConGroup_CountCallErrors(t *testing.T) {
+	tn0 := testNodeCreate("q1")
+	tn1 := testNodeCreate("q1")
+
+	// n0 is called first by each FuncDO
+	cg := testConGroup(tn0, tn1)
+	cg.PriorityGroups["pg"].Steps = []PriorityGroupStep{
+		{StepCallCount: 1, ConNames: []string{"n0"}},
+		{StepCallCount: 1, ConNames: []string{"n1"}},
+	}
+	cg.HealthCheckSettings = &HealthCheckSettings{FailureThreshold: 2, CountCallErrors: true}
+
+	ctx := context.Background()
+	cg.Ping(ctx, nil)
+
+	atomic.StoreInt32(&tn0.down, 1)
+	for i := 0; i < 2; i++ {
+		testState(t, cg, CircuitClosed)
+		err := cg.FuncDO(ctx, "pg", QueueAddUniqueList("q1", nil, cn.SaveMarkSaveMode, nil), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	testState(t, cg, CircuitOpen)
+}
+
+func TestConGroup_StartHealthCheck(t *testing.T) {
+	tn0 := testNodeCreate("q1")
+	tn1 := testNodeCreate("q1")
+
+	cg := testConGroup(tn0, tn1)
+	cg.HealthCheckSettings = &HealthCheckSettings{
+		Interval:         10 * time.Millisecond,
+		FailureThreshold: 2,
+		SuccessThreshold: 2,
+		OpenTimeout:      30 * time.Millisecond,
+	}
+
+	waitState := func(state CircuitState) {
+		deadline := time.Now().Add(5 * time.Second)
+		for cg.ConnectionsHealth()["n0"].State != state {
+			if time.Now().After(deadline) {
+				t.Fatalf("health check should set circuit of n0 %v", state)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	atomic.StoreInt32(&tn0.down, 1)
+	if err := cg.StartHealthCheck(nil); err != nil {
+		t.Fatal(err)
+	}
+	defer cg.StopHealthCheck()
+
+	if err := cg.StartHealthCheck(nil); err == nil || err.Code != 10191141 {
+		t.Errorf("second StartHealthCheck should fail with 10191141 not %v", err)
+	}
+
+	waitState(CircuitOpen)
+	if h := cg.ConnectionsHealth()["n1"]; h.State != CircuitClosed || h.Latency == 0 {
+		t.Errorf("health check should measure n1 %+v", h)
+	}
+
+	atomic.StoreInt32(&tn0.down, 0)
+	waitState(CircuitClosed)
+}
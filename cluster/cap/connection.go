@@ -104,3 +104,23 @@ func (c *Connection) DoRawQuery(queryWait time.Duration, path string, headersIn
 
 	return body, headersOut, resp.StatusCode, nil
 }
+
+// DoStreamQuery do query with streamed responce (responce body should be closed)
+// query is canceled by ctx only
+func (c *Connection) DoStreamQuery(ctx context.Context, path string, headersIn map[string]string, query []byte) (resp *http.Response, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Server+path, bytes.NewBuffer(query))
+	if err != nil {
+		return nil, GenerateErrorE(10190001, err, c.Server)
+	}
+
+	for k, v := range headersIn {
+		req.Header.Add(k, v)
+	}
+
+	resp, err = c.client.Do(req)
+	if err != nil {
+		return nil, GenerateErrorE(10190002, err, c.Server)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,535 @@
+package cap
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/capella-pw/queue/cluster"
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/queue"
+	"github.com/myfantasy/mft"
+	"github.com/myfantasy/segment"
+)
+
+var (
+	// ConsumerBatchSizeDefault - max count of messages of handler call
+	ConsumerBatchSizeDefault = 100
+	// ConsumerParallelDefault - count of handler calls in progress
+	ConsumerParallelDefault = 1
+	// ConsumerPollIntervalDefault - pause of polling when queue has no new messages
+	ConsumerPollIntervalDefault = time.Second
+	// ConsumerErrorPauseDefault - pause after error of handler or cluster call
+	ConsumerErrorPauseDefault = time.Second
+	// ConsumerCallTimeoutDefault - timeout of one cluster call
+	ConsumerCallTimeoutDefault = time.Second * 30
+	// ConsumerLagCntLimitDefault - max count of messages scanned by Lag
+	ConsumerLagCntLimitDefault = 10000
+)
+
+// ConsumerHandler - handler of messages; messages are committed when handler returns nil
+// (handler is called again with same messages when it returns error)
+type ConsumerHandler func(ctx context.Context, messages []*queue.MessageWithMeta) (err *mft.Error)
+
+// Consumer - at-least-once consumer of queue: reads messages of subscriber (by polling of Cluster
+// or by streaming subscription of Connection), calls Handler and sets last read id of subscriber
+// after success of handler; up to Parallel handler calls are in progress, commits are in order of messages
+type Consumer struct {
+	Cluster cluster.Cluster
+	// Connection - when is set messages are received by streaming subscription (long polling)
+	Connection *ClusterConnection
+
+	QueueName  string
+	Subscriber string
+	// Segments - only messages of segments are handled (nil - all messages)
+	Segments *segment.Segments
+	Handler  ConsumerHandler
+
+	BatchSize    int
+	Parallel     int
+	PollInterval time.Duration
+	ErrorPause   time.Duration
+	CallTimeout  time.Duration
+	SaveMode     cn.SaveMode
+	LagCntLimit  int
+
+	// ErrFunc - errors of handler, reading and commits (consumer continues work after them)
+	ErrFunc func(err *mft.Error)
+
+	mx        sync.Mutex
+	started   bool
+	stop      chan struct{}
+	done      chan struct{}
+	cancel    context.CancelFunc
+	received  int64
+	committed int64
+	inFlight  int
+	lastError *mft.Error
+}
+
+// ConsumerLag - state of consumer
+type ConsumerLag struct {
+	// Committed - last read id of subscriber set by consumer
+	Committed int64 `json:"committed"`
+	// Received - last received id
+	Received int64 `json:"received"`
+	// InFlight - count of messages that are received and not committed
+	InFlight int `json:"in_flight"`
+	// Pending - count of messages of queue after Committed (not more then LagCntLimit)
+	Pending int `json:"pending"`
+	// OldestPendingDt - time of first message after Committed (zero when Pending == 0)
+	OldestPendingDt time.Time `json:"oldest_pending_dt"`
+}
+
+type consumerTask struct {
+	messages []*queue.MessageWithMeta
+	lastId   int64
+	// stream - stream of messages (commit returns credit of stream)
+	stream *Stream
+	ok     bool
+	done   chan struct{}
+}
+
+// ConsumerCreate - consumer that polls queue of cl
+func ConsumerCreate(cl cluster.Cluster, queueName string, subscriber string,
+	segments *segment.Segments, handler ConsumerHandler) *Consumer {
+	return &Consumer{
+		Cluster:      cl,
+		QueueName:    queueName,
+		Subscriber:   subscriber,
+		Segments:     segments,
+		Handler:      handler,
+		BatchSize:    ConsumerBatchSizeDefault,
+		Parallel:     ConsumerParallelDefault,
+		PollInterval: ConsumerPollIntervalDefault,
+		ErrorPause:   ConsumerErrorPauseDefault,
+		CallTimeout:  ConsumerCallTimeoutDefault,
+		SaveMode:     cn.SaveMarkSaveMode,
+		LagCntLimit:  ConsumerLagCntLimitDefault,
+	}
+}
+
+// ConsumerCreateStream - consumer that receives messages of queue by streaming subscription of cc
+func ConsumerCreateStream(cc *ClusterConnection, queueName string, subscriber string,
+	segments *segment.Segments, handler ConsumerHandler) *Consumer {
+	c := ConsumerCreate(cc.Cluster(), queueName, subscriber, segments, handler)
+	c.Connection = cc
+	return c
+}
+
+// Start - start consumer
+func (c *Consumer) Start() (err *mft.Error) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if c.started {
+		return GenerateError(10191500, c.QueueName, c.Subscriber)
+	}
+
+	c.started = true
+	c.stop = make(chan struct{})
+	c.done = make(chan struct{})
+
+	var ctx context.Context
+	ctx, c.cancel = context.WithCancel(context.Background())
+
+	go c.run(ctx)
+
+	return nil
+}
+
+// Stop - stop reading of messages, wait handler calls in progress and commit them;
+// when ctx is done handler calls are cancelled (not committed messages are handled again after next start)
+func (c *Consumer) Stop(ctx context.Context) (err *mft.Error) {
+	c.mx.Lock()
+	if !c.started {
+		c.mx.Unlock()
+		return nil
+	}
+	stop, done, cancel := c.stop, c.done, c.cancel
+	select {
+	case <-stop:
+	default:
+		close(stop)
+	}
+	c.mx.Unlock()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		cancel()
+		<-done
+		err = GenerateErrorE(10191508, ctx.Err(), c.QueueName, c.Subscriber)
+	}
+
+	c.mx.Lock()
+	c.started = false
+	c.mx.Unlock()
+
+	cancel()
+
+	return err
+}
+
+// LastError - last error of consumer
+func (c *Consumer) LastError() (err *mft.Error) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.lastError
+}
+
+// Lag - state of consumer and count of messages of queue after last commit
+func (c *Consumer) Lag(ctx context.Context) (lag ConsumerLag, err *mft.Error) {
+	c.mx.Lock()
+	lag.Committed, lag.Received, lag.InFlight = c.committed, c.received, c.inFlight
+	c.mx.Unlock()
+
+	q, err := c.queue(ctx)
+	if err != nil {
+		return lag, err
+	}
+
+	idStart := lag.Committed
+	if idStart == 0 {
+		idStart, err = q.SubscriberGetLastRead(ctx, nil, c.Subscriber)
+		if err != nil {
+			return lag, GenerateErrorE(10191503, err, c.QueueName, c.Subscriber)
+		}
+	}
+
+	var messages []*queue.MessageWithMeta
+	if c.Segments == nil {
+		messages, err = q.Get(ctx, nil, idStart, c.LagCntLimit)
+	} else {
+		messages, _, err = q.GetSegment(ctx, nil, idStart, c.LagCntLimit, c.Segments)
+	}
+	if err != nil {
+		return lag, GenerateErrorE(10191504, err, c.QueueName)
+	}
+
+	lag.Pending = len(messages)
+	if len(messages) > 0 {
+		lag.OldestPendingDt = messages[0].Dt
+	}
+
+	return lag, nil
+}
+
+func (c *Consumer) throwError(err *mft.Error) {
+	c.mx.Lock()
+	c.lastError = err
+	c.mx.Unlock()
+
+	if c.ErrFunc != nil {
+		c.ErrFunc(err)
+	}
+}
+
+// pause - wait d or stop; returns false on stop
+func (c *Consumer) pause(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-c.stop:
+		return false
+	}
+}
+
+func (c *Consumer) queue(ctx context.Context) (q queue.Queue, err *mft.Error) {
+	ctx, cancel := context.WithTimeout(ctx, c.CallTimeout)
+	defer cancel()
+
+	q, exists, err := c.Cluster.GetQueue(ctx, nil, c.QueueName)
+	if err != nil {
+		return nil, GenerateErrorE(10191502, err, c.QueueName)
+	}
+	if !exists {
+		return nil, GenerateError(10191501, c.QueueName)
+	}
+	return q, nil
+}
+
+// run - reading of messages; tasks are passed to commit loop in order of messages
+func (c *Consumer) run(ctx context.Context) {
+	defer close(c.done)
+
+	if c.Parallel <= 0 {
+		c.Parallel = ConsumerParallelDefault
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = ConsumerBatchSizeDefault
+	}
+
+	tasks := make(chan *consumerTask, c.Parallel)
+	sem := make(chan struct{}, c.Parallel)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.commitLoop(ctx, tasks, sem)
+	}()
+
+	if c.Connection != nil {
+		c.readStream(ctx, tasks, sem)
+	} else {
+		c.readPoll(ctx, tasks, sem)
+	}
+
+	close(tasks)
+	wg.Wait()
+}
+
+// acquire - take place of handler call; returns false on stop
+func (c *Consumer) acquire(sem chan struct{}) bool {
+	select {
+	case sem <- struct{}{}:
+		return true
+	case <-c.stop:
+		return false
+	}
+}
+
+// dispatch - call handler of messages until success or stop
+func (c *Consumer) dispatch(ctx context.Context, tasks chan *consumerTask,
+	messages []*queue.MessageWithMeta, lastId int64, s *Stream) {
+
+	t := &consumerTask{
+		messages: messages,
+		lastId:   lastId,
+		stream:   s,
+		done:     make(chan struct{}),
+	}
+
+	c.mx.Lock()
+	c.received = lastId
+	c.inFlight += len(messages)
+	c.mx.Unlock()
+
+	tasks <- t
+
+	if len(messages) == 0 {
+		t.ok = true
+		close(t.done)
+		return
+	}
+
+	go func() {
+		defer close(t.done)
+		for {
+			err := c.Handler(ctx, messages)
+			if err == nil {
+				t.ok = true
+				return
+			}
+			c.throwError(GenerateErrorE(10191505, err, c.QueueName, messages[0].ID, lastId))
+			if ctx.Err() != nil || !c.pause(c.ErrorPause) {
+				return
+			}
+		}
+	}()
+}
+
+func (c *Consumer) readPoll(ctx context.Context, tasks chan *consumerTask, sem chan struct{}) {
+	var q queue.Queue
+	var err *mft.Error
+	lastId := int64(-1)
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		default:
+		}
+
+		if q == nil {
+			q, err = c.queue(ctx)
+			if err != nil {
+				c.throwError(err)
+				if !c.pause(c.ErrorPause) {
+					return
+				}
+				continue
+			}
+		}
+
+		if lastId < 0 {
+			ctxCall, cancel := context.WithTimeout(ctx, c.CallTimeout)
+			lastId, err = q.SubscriberGetLastRead(ctxCall, nil, c.Subscriber)
+			cancel()
+			if err != nil {
+				lastId = -1
+				q = nil
+				c.throwError(GenerateErrorE(10191503, err, c.QueueName, c.Subscriber))
+				if !c.pause(c.ErrorPause) {
+					return
+				}
+				continue
+			}
+		}
+
+		if !c.acquire(sem) {
+			return
+		}
+
+		var messages []*queue.MessageWithMeta
+		nextId := lastId
+		ctxCall, cancel := context.WithTimeout(ctx, c.CallTimeout)
+		if c.Segments == nil {
+			messages, err = q.Get(ctxCall, nil, lastId, c.BatchSize)
+			if len(messages) > 0 {
+				nextId = messages[len(messages)-1].ID
+			}
+		} else {
+			messages, nextId, err = q.GetSegment(ctxCall, nil, lastId, c.BatchSize, c.Segments)
+		}
+		cancel()
+
+		if err != nil || nextId <= lastId {
+			<-sem
+			if err != nil {
+				q = nil
+				c.throwError(GenerateErrorE(10191504, err, c.QueueName))
+				if !c.pause(c.ErrorPause) {
+					return
+				}
+			} else if !c.pause(c.PollInterval) {
+				return
+			}
+			continue
+		}
+
+		c.dispatch(ctx, tasks, messages, nextId, nil)
+		lastId = nextId
+	}
+}
+
+func (c *Consumer) readStream(ctx context.Context, tasks chan *consumerTask, sem chan struct{}) {
+	for {
+		s, err := c.Connection.Subscribe(ctx, c.QueueName, cluster.StreamSubscribeRequest{
+			Subscriber: c.Subscriber,
+			Segments:   c.Segments,
+			Credit:     c.BatchSize * c.Parallel,
+			CntLimit:   c.BatchSize,
+		})
+		if err != nil {
+			c.throwError(GenerateErrorE(10191507, err, c.QueueName))
+			if !c.pause(c.ErrorPause) {
+				return
+			}
+			continue
+		}
+
+		// Next is blocked until message; stream is closed on stop
+		var closeOnce sync.Once
+		stopped := make(chan struct{})
+		go func() {
+			select {
+			case <-c.stop:
+				closeOnce.Do(func() { s.Close() })
+			case <-stopped:
+			}
+		}()
+
+		err = c.readStreamFrames(ctx, s, tasks, sem)
+		close(stopped)
+		closeOnce.Do(func() { s.Close() })
+
+		select {
+		case <-c.stop:
+			return
+		default:
+		}
+
+		c.throwError(GenerateErrorE(10191504, err, c.QueueName))
+		if !c.pause(c.ErrorPause) {
+			return
+		}
+	}
+}
+
+func (c *Consumer) readStreamFrames(ctx context.Context, s *Stream,
+	tasks chan *consumerTask, sem chan struct{}) (err *mft.Error) {
+	for {
+		if !c.acquire(sem) {
+			return nil
+		}
+
+		var messages []*queue.MessageWithMeta
+		var lastId int64
+		messages, lastId, err = s.Next()
+		if err != nil {
+			<-sem
+			return err
+		}
+
+		// credit of stream is returned by ack on commit
+		c.dispatch(ctx, tasks, messages, lastId, s)
+	}
+}
+
+// commitLoop - commit tasks in order; commit stops on first not handled task
+func (c *Consumer) commitLoop(ctx context.Context, tasks chan *consumerTask, sem chan struct{}) {
+	failed := false
+	for t := range tasks {
+		<-t.done
+		<-sem
+
+		c.mx.Lock()
+		c.inFlight -= len(t.messages)
+		c.mx.Unlock()
+
+		if failed || !t.ok {
+			failed = true
+			continue
+		}
+
+		c.commit(t)
+	}
+}
+
+// commit - set last read id of subscriber (by ack of stream when stream is alive);
+// ids less then committed (messages of previous stream) are skipped
+func (c *Consumer) commit(t *consumerTask) {
+	id := t.lastId
+
+	c.mx.Lock()
+	committed := c.committed
+	c.mx.Unlock()
+
+	if t.stream != nil {
+		if id <= committed {
+			id = 0
+		}
+		if t.stream.Ack(id, len(t.messages), c.SaveMode) == nil {
+			if id > 0 {
+				c.mx.Lock()
+				c.committed = id
+				c.mx.Unlock()
+			}
+			return
+		}
+	}
+	if id <= committed {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.CallTimeout)
+	defer cancel()
+
+	q, err := c.queue(ctx)
+	if err == nil {
+		err = q.SubscriberSetLastRead(ctx, nil, c.Subscriber, id, c.SaveMode)
+	}
+	if err != nil {
+		c.throwError(GenerateErrorE(10191506, err, c.QueueName, c.Subscriber, id))
+		return
+	}
+
+	c.mx.Lock()
+	c.committed = id
+	c.mx.Unlock()
+}
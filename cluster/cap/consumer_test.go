@@ -0,0 +1,148 @@
+package cap
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/queue"
+	"github.com/myfantasy/mft"
+)
+
+func testConsumerQueue(t *testing.T, cnt int) (tn *testNode, ids []int64) {
+	tn = testNodeCreate("q1")
+	for i := 0; i < cnt; i++ {
+		id, err := tn.queues["q1"].Add(context.Background(), nil, []byte("msg"), 0, 0, "", 0, cn.SaveMarkSaveMode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	return tn, ids
+}
+
+func testLastRead(t *testing.T, tn *testNode) int64 {
+	id, err := tn.queues["q1"].SubscriberGetLastRead(context.Background(), nil, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// testWaitLastRead - wait last read id of subscriber `s1`
+func testWaitLastRead(t *testing.T, tn *testNode, id int64) {
+	deadline := time.Now().Add(5 * time.Second)
+	for testLastRead(t, tn) != id {
+		if time.Now().After(deadline) {
+			t.Fatalf("Consumer should commit %v; last read id %v", id, testLastRead(t, tn))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConsumer_CommitOrder(t *testing.T) {
+	tn, ids := testConsumerQueue(t, 3)
+
+	release := make(chan struct{})
+	handled := make(chan int64, 3)
+	c := ConsumerCreate(tn, "q1", "s1", nil, func(ctx context.Context, messages []*queue.MessageWithMeta) *mft.Error {
+		if messages[0].ID == ids[0] {
+			<-release
+		}
+		handled <- messages[0].ID
+		return nil
+	})
+	c.BatchSize = 1
+	c.Parallel = 3
+	c.PollInterval = 10 * time.Millisecond
+
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop(context.Background())
+
+	// handlers of second and third messages finish before first
+	for i := 0; i < 2; i++ {
+		select {
+		case id := <-handled:
+			if id == ids[0] {
+				t.Fatalf("first handler should wait release")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Consumer should call handlers in parallel")
+		}
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if id := testLastRead(t, tn); id != 0 {
+		t.Fatalf("Consumer should not commit messages after not handled message: last read id %v", id)
+	}
+	lag, err := c.Lag(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lag.Committed != 0 || lag.Received != ids[2] || lag.InFlight != 3 {
+		t.Errorf("Consumer.Lag wrong state %+v", lag)
+	}
+
+	close(release)
+	testWaitLastRead(t, tn, ids[2])
+}
+
+func TestConsumer_CommitOrderHandlerError(t *testing.T) {
+	tn, ids := testConsumerQueue(t, 2)
+
+	var fails int32 = 1
+	release := make(chan struct{})
+	handled := make(chan int64, 2)
+	c := ConsumerCreate(tn, "q1", "s1", nil, func(ctx context.Context, messages []*queue.MessageWithMeta) *mft.Error {
+		if messages[0].ID == ids[0] && atomic.AddInt32(&fails, -1) >= 0 {
+			<-release
+			return mft.ErrorE(errors.New("handler fail"))
+		}
+		handled <- messages[0].ID
+		return nil
+	})
+	c.BatchSize = 1
+	c.Parallel = 2
+	c.PollInterval = 10 * time.Millisecond
+	c.ErrorPause = 10 * time.Millisecond
+
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop(context.Background())
+
+	select {
+	case id := <-handled:
+		if id != ids[1] {
+			t.Fatalf("second message should be handled first not %v", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Consumer should call handlers in parallel")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if id := testLastRead(t, tn); id != 0 {
+		t.Fatalf("Consumer should not commit messages after not handled message: last read id %v", id)
+	}
+
+	// first handler fails after second is handled; commit waits retry of first
+	close(release)
+	select {
+	case id := <-handled:
+		if id != ids[0] {
+			t.Fatalf("first message should be handled again not %v", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Consumer should retry failed handler")
+	}
+	if c.LastError() == nil || c.LastError().Code != 10191505 {
+		t.Errorf("Consumer.LastError should be handler error not %v", c.LastError())
+	}
+
+	testWaitLastRead(t, tn, ids[1])
+}
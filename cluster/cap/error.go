@@ -3,6 +3,7 @@ package cap
 import (
 	"fmt"
 
+	"github.com/capella-pw/queue/cluster"
 	"github.com/myfantasy/mft"
 )
 
@@ -19,7 +20,7 @@ var Errors map[int]string = map[int]string{
 	10190102: "ClusterConnection.CallFunc: Send request fail",
 	10190103: "ClusterConnection.CallFunc: Responce code is not 200 responce code is: %v body: %v",
 	10190104: "ClusterConnection.CallFunc: Restore responce fail",
-	10190106: "ClusterConnection.CallFunc: Unmarshal responce fail",
+	10190105: "ClusterConnection.CallFunc: Unmarshal responce fail",
 
 	10190200: "ClusterConnection.ToJson: marshal error",
 
@@ -35,6 +36,17 @@ var Errors map[int]string = map[int]string{
 	10190401: "HttpExternalClusterLoadGenerator: connection should be set (ClusterConnection.Connection) ec.name: %v",
 	10190402: "HttpExternalClusterLoadGenerator: decrypt AuthentificationInfo fail ec.name: %v",
 
+	10190500: "ClusterConnection.Subscribe: send request fail queue: %v",
+	10190501: "ClusterConnection.Subscribe: queue: %v responce code is: %v",
+	10190502: "ClusterConnection.Subscribe: read first frame fail queue: %v",
+
+	10190510: "Stream.Next: read frame fail stream: %v",
+	10190511: "Stream.Next: stream %v fail",
+
+	10190520: "Stream.Ack: marshal fail stream: %v",
+	10190521: "Stream.Ack: send request fail stream: %v",
+	10190522: "Stream.Ack: stream: %v responce code is: %v",
+
 	10191000: "ConGroup.ToJson: marshal error",
 
 	10191010: "ConGroupFromJson: unmarshal error",
@@ -47,6 +59,9 @@ var Errors map[int]string = map[int]string{
 
 	10191130: "ConGroup.FuncDOName: Cluster with name %v does not exists",
 
+	10191140: "ConGroup.HealthCheck: ping of connection %v fail",
+	10191141: "ConGroup.StartHealthCheck: health check is already started",
+
 	10191200: "QueueAddUnique: Queue `%v` does not exists",
 	10191201: "QueueAddUnique: Queue `%v` get error",
 	10191202: "QueueAddUnique: Queue `%v` AddUnique error",
@@ -54,6 +69,41 @@ var Errors map[int]string = map[int]string{
 	10191210: "QueueAddUniqueList: Queue `%v` does not exists",
 	10191211: "QueueAddUniqueList: Queue `%v` get error",
 	10191212: "QueueAddUniqueList: Queue `%v` AddUnique error",
+
+	10191300: "Batch.Do: call batch of %v requests fail",
+	10191301: "Batch.Do: count of responces %v is not equal to count of requests %v",
+	10191302: "Batch.Do: request %v action `%v` object `%v` fail",
+
+	10191400: "Producer: send into queue `%v` fail after %v attempts",
+	10191401: "Producer: send into queue `%v` interrupted by Close after %v attempts",
+	10191402: "Producer: send into queue `%v` after Close",
+	10191403: "Producer: wait fail",
+
+	10191500: "Consumer.Start: consumer of queue `%v` subscriber `%v` is already started",
+	10191501: "Consumer: queue `%v` does not exists",
+	10191502: "Consumer: queue `%v` get error",
+	10191503: "Consumer: queue `%v` subscriber `%v` get last read error",
+	10191504: "Consumer: queue `%v` read messages error",
+	10191505: "Consumer: handler of queue `%v` messages %v-%v fail",
+	10191506: "Consumer: queue `%v` subscriber `%v` commit %v fail",
+	10191507: "Consumer: subscribe to queue `%v` fail",
+	10191508: "Consumer.Stop: queue `%v` subscriber `%v` wait fail",
+}
+
+// QueueNotExistsErrors - codes of errors when queue does not exist
+var QueueNotExistsErrors = map[int]struct{}{
+	10191200: {}, 10191210: {}, 10191501: {},
+}
+
+// IsQueueNotExists - err or one of internal errors of err is queue does not exist error
+// (QueueNotExistsErrors or cluster.QueueNotExistsErrors)
+func IsQueueNotExists(err *mft.Error) bool {
+	for e := err; e != nil; e = e.InternalError {
+		if _, ok := QueueNotExistsErrors[e.Code]; ok {
+			return true
+		}
+	}
+	return cluster.IsQueueNotExists(err)
 }
 
 // GenerateError -
@@ -7,6 +7,7 @@ import (
 
 	"github.com/capella-pw/queue/cluster"
 	"github.com/capella-pw/queue/compress"
+	"github.com/myfantasy/mft"
 )
 
 const (
@@ -22,8 +23,10 @@ type ClusterConnection struct {
 	AuthentificationType string `json:"auth_type"`
 	AuthentificationInfo []byte `json:"auth_info"`
 	UserName             string `json:"user_name"`
-	PreferContentType    string `json:"prefer_content_type"`
-	SendContentType      string `json:"send_content_type"`
+	// PreferContentType - content type of responce `encoding+compression` (`bin+gzip`, `compact+gzip`, `gzip`)
+	PreferContentType string `json:"prefer_content_type"`
+	// SendContentType - content type of request `encoding+compression` (`bin+gzip`, `gzip`)
+	SendContentType string `json:"send_content_type"`
 	// ReplaceNameForce: replace username in request to UserName
 	ReplaceNameForce bool `json:"replace_name_force"`
 
@@ -81,33 +84,11 @@ func (cc *ClusterConnection) CallFunc() func(ctx context.Context,
 	return func(ctx context.Context,
 		request *cluster.RequestBody) (responce *cluster.ResponceBody) {
 
-		currentTime := time.Now()
 		waitDuration := cc.Connection.QueryWait
 
-		sreq := cluster.ServiceRequest{
-			AuthentificationType: cc.AuthentificationType,
-			AuthentificationInfo: cc.AuthentificationInfoDecrypt,
-			UserName:             cc.UserName,
-
-			WaitDuration: waitDuration,
-			CurrentTime:  currentTime.UnixNano(),
-
-			PreferContentType: cc.PreferContentType,
-
-			ReplaceNameForce: cc.ReplaceNameForce,
-
-			Request: request,
-		}
-
-		bodyOut, er0 := json.Marshal(sreq)
-		if er0 != nil {
-			return &cluster.ResponceBody{Err: GenerateErrorE(10190100, er0)}
-		}
-
-		algorithmUsed, resultOut, err :=
-			cc.Compressor.Compress(ctx, false, cc.SendContentType, bodyOut, nil)
+		algorithmUsed, resultOut, err := cc.marshalServiceRequest(ctx, waitDuration, request)
 		if err != nil {
-			return &cluster.ResponceBody{Err: GenerateErrorE(10190101, err)}
+			return &cluster.ResponceBody{Err: err}
 		}
 
 		bodyIn, headersOut, statusCode, er0 := cc.Connection.DoRawQuery(waitDuration, ClusterMethodPath,
@@ -126,17 +107,48 @@ func (cc *ClusterConnection) CallFunc() func(ctx context.Context,
 			return &cluster.ResponceBody{Err: GenerateErrorE(10190104, err)}
 		}
 
-		clusterResponce := cluster.ServiceResponce{}
-
-		er0 = json.Unmarshal(resultIn, &clusterResponce)
-		if er0 != nil {
-			return &cluster.ResponceBody{Err: GenerateErrorE(10190105, er0)}
+		clusterResponce, err := cluster.UnmarshalServiceResponce(resultIn)
+		if err != nil {
+			return &cluster.ResponceBody{Err: GenerateErrorE(10190105, err)}
 		}
 
 		return &clusterResponce.Responce
 	}
 }
 
+// marshalServiceRequest - ServiceRequest with authentication of connection; body is compressed
+func (cc *ClusterConnection) marshalServiceRequest(ctx context.Context, waitDuration time.Duration,
+	request *cluster.RequestBody) (algorithmUsed string, body []byte, err *mft.Error) {
+	sreq := cluster.ServiceRequest{
+		AuthentificationType: cc.AuthentificationType,
+		AuthentificationInfo: cc.AuthentificationInfoDecrypt,
+		UserName:             cc.UserName,
+
+		WaitDuration: waitDuration,
+		CurrentTime:  time.Now().UnixNano(),
+
+		PreferContentType: cc.PreferContentType,
+
+		ReplaceNameForce: cc.ReplaceNameForce,
+
+		Request: request,
+	}
+
+	sendEncoding, sendCompression := cluster.SplitContentType(cc.SendContentType)
+
+	bodyOut, err := cluster.MarshalServiceRequest(sendEncoding, sreq)
+	if err != nil {
+		return "", nil, GenerateErrorE(10190100, err)
+	}
+
+	algorithmUsed, body, err = cc.Compressor.Compress(ctx, false, sendCompression, bodyOut, nil)
+	if err != nil {
+		return "", nil, GenerateErrorE(10190101, err)
+	}
+
+	return algorithmUsed, body, nil
+}
+
 func (cc *ClusterConnection) Cluster() *cluster.ExternalAbstractCluster {
 	clusterOut := &cluster.ExternalAbstractCluster{
 		CallTimeout: cc.Connection.QueryWait,
@@ -0,0 +1,460 @@
+package cap
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/capella-pw/queue/cluster"
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/queue"
+	"github.com/myfantasy/mft"
+)
+
+var (
+	// ProducerBatchSizeDefault - count of messages of batch
+	ProducerBatchSizeDefault = 100
+	// ProducerBatchBytesDefault - size of messages of batch
+	ProducerBatchBytesDefault = 1024 * 1024
+	// ProducerLingerDefault - max time of waiting of batch filling
+	ProducerLingerDefault = time.Millisecond * 10
+	// ProducerPendingBatchesDefault - count of batches of queue waiting for send (Send waits while it is exceeded)
+	ProducerPendingBatchesDefault = 16
+	// ProducerRetriesDefault - count of retries of batch send
+	ProducerRetriesDefault = 5
+	// ProducerRetryBackoffDefault - first pause between retries (pause is doubled up to ProducerRetryBackoffMaxDefault)
+	ProducerRetryBackoffDefault = time.Millisecond * 100
+	// ProducerRetryBackoffMaxDefault - max pause between retries
+	ProducerRetryBackoffMaxDefault = time.Second * 5
+	// ProducerCallTimeoutDefault - timeout of one send of batch
+	ProducerCallTimeoutDefault = time.Second * 30
+)
+
+// Producer - buffered sender of messages into queues through ConGroup priority group
+// messages are sent by AddUniqueList: ExternalID (and ExternalDt) is assigned on Send,
+// so retries and failover to other cluster of priority group do not duplicate messages;
+// batches of one queue are sent in order of Send;
+// callbacks of queue are called in order by separate goroutine, so callback may call Send
+type Producer struct {
+	CG            *ConGroup
+	PriorityGroup string
+	// Source - source of messages; ExternalID is unique within source, so source should be unique for producer
+	Source string
+
+	BatchSize      int
+	BatchBytes     int
+	Linger         time.Duration
+	PendingBatches int
+	SaveMode       cn.SaveMode
+
+	Retries         int
+	RetryBackoff    time.Duration
+	RetryBackoffMax time.Duration
+	CallTimeout     time.Duration
+	// IsTransient - error of send to cluster may be retried; default is ProducerIsTransient
+	IsTransient func(err *mft.Error) bool
+	// ErrFunc - errors of clusters of priority group (see ConGroup.FuncDO)
+	ErrFunc func(err *mft.Error)
+
+	// IDGenerator - generator of ExternalID
+	IDGenerator *mft.G
+
+	mx     sync.Mutex
+	queues map[string]*producerQueue
+	closed bool
+	wg     sync.WaitGroup
+	stop   chan struct{}
+}
+
+// Delivery - result of send of message
+type Delivery struct {
+	done     chan struct{}
+	id       int64
+	err      *mft.Error
+	callback func(id int64, err *mft.Error)
+}
+
+type producerBatch struct {
+	messages   []queue.Message
+	deliveries []*Delivery
+	size       int
+	timer      *time.Timer
+	done       chan struct{}
+
+	ids []int64
+	err *mft.Error
+}
+
+type producerQueue struct {
+	name string
+
+	// mx protects fields below; cond is signaled on change of pending, sent and closed
+	mx      sync.Mutex
+	cond    *sync.Cond
+	current *producerBatch
+	last    *producerBatch
+	// pending - batches waiting for send
+	pending []*producerBatch
+	// sent - sent batches waiting for complete of deliveries
+	sent       []*producerBatch
+	closed     bool
+	senderDone bool
+}
+
+// ProducerCreate - producer into queues of priority group of cg
+func ProducerCreate(cg *ConGroup, priorityGroup string, source string) *Producer {
+	return &Producer{
+		CG:              cg,
+		PriorityGroup:   priorityGroup,
+		Source:          source,
+		BatchSize:       ProducerBatchSizeDefault,
+		BatchBytes:      ProducerBatchBytesDefault,
+		Linger:          ProducerLingerDefault,
+		PendingBatches:  ProducerPendingBatchesDefault,
+		SaveMode:        cn.SaveMarkSaveMode,
+		Retries:         ProducerRetriesDefault,
+		RetryBackoff:    ProducerRetryBackoffDefault,
+		RetryBackoffMax: ProducerRetryBackoffMaxDefault,
+		CallTimeout:     ProducerCallTimeoutDefault,
+		IsTransient:     ProducerIsTransient,
+		IDGenerator:     &mft.G{},
+		queues:          make(map[string]*producerQueue),
+		stop:            make(chan struct{}),
+	}
+}
+
+// ProducerIsTransient - all errors except absent queue and denied permission may be retried
+func ProducerIsTransient(err *mft.Error) bool {
+	return !IsQueueNotExists(err) && !cluster.IsPermissionDenied(err)
+}
+
+// Done - closed when message is sent or send is failed
+func (d *Delivery) Done() <-chan struct{} {
+	return d.done
+}
+
+// Result - id of message in queue or error; valid after Done
+func (d *Delivery) Result() (id int64, err *mft.Error) {
+	return d.id, d.err
+}
+
+// Wait - wait send of message
+func (d *Delivery) Wait(ctx context.Context) (id int64, err *mft.Error) {
+	select {
+	case <-d.done:
+		return d.id, d.err
+	case <-ctx.Done():
+		return 0, GenerateErrorE(10191403, ctx.Err())
+	}
+}
+
+func (d *Delivery) complete(id int64, err *mft.Error) {
+	d.id, d.err = id, err
+	close(d.done)
+	if d.callback != nil {
+		d.callback(id, err)
+	}
+}
+
+// Send - add message into buffer of queue
+func (p *Producer) Send(queueName string, message []byte) *Delivery {
+	return p.SendMessage(queueName, queue.Message{Message: message}, nil)
+}
+
+// SendMessage - add message into buffer of queue; callback (when is set) is called after send
+// ExternalID, ExternalDt and Source are set when they are empty
+func (p *Producer) SendMessage(queueName string, message queue.Message,
+	callback func(id int64, err *mft.Error)) *Delivery {
+
+	d := &Delivery{
+		done:     make(chan struct{}),
+		callback: callback,
+	}
+
+	if message.Source == "" {
+		message.Source = p.Source
+	}
+	if message.ExternalID == 0 {
+		message.ExternalID = p.IDGenerator.RvGetPart()
+	}
+	if message.ExternalDt == 0 {
+		message.ExternalDt = time.Now().Unix()
+	}
+
+	p.mx.Lock()
+	if p.closed {
+		p.mx.Unlock()
+		d.complete(0, GenerateError(10191402, queueName))
+		return d
+	}
+	pq := p.queue(queueName)
+	p.mx.Unlock()
+
+	pq.mx.Lock()
+	if pq.closed {
+		pq.mx.Unlock()
+		d.complete(0, GenerateError(10191402, queueName))
+		return d
+	}
+
+	if pq.current == nil {
+		b := &producerBatch{done: make(chan struct{})}
+		pq.current = b
+		if p.Linger > 0 {
+			b.timer = time.AfterFunc(p.Linger, func() {
+				pq.mx.Lock()
+				defer pq.mx.Unlock()
+				if pq.current == b {
+					pq.enqueue()
+				}
+			})
+		}
+	}
+
+	b := pq.current
+	b.messages = append(b.messages, message)
+	b.deliveries = append(b.deliveries, d)
+	b.size += len(message.Message)
+
+	if len(b.messages) >= p.BatchSize || b.size >= p.BatchBytes || p.Linger <= 0 {
+		pq.enqueue()
+	}
+
+	pendingBatches := p.PendingBatches
+	if pendingBatches <= 0 {
+		pendingBatches = ProducerPendingBatchesDefault
+	}
+	for len(pq.pending) > pendingBatches && !pq.closed {
+		pq.cond.Wait()
+	}
+	pq.mx.Unlock()
+
+	return d
+}
+
+// queue - buffer of queue; p.mx should be locked
+func (p *Producer) queue(name string) *producerQueue {
+	pq, ok := p.queues[name]
+	if ok {
+		return pq
+	}
+
+	pq = &producerQueue{name: name}
+	pq.cond = sync.NewCond(&pq.mx)
+	p.queues[name] = pq
+
+	p.wg.Add(2)
+	go p.sender(pq)
+	go p.completer(pq)
+
+	return pq
+}
+
+// enqueue - pass current batch to sender; pq.mx should be locked
+func (pq *producerQueue) enqueue() {
+	b := pq.current
+	if b == nil {
+		return
+	}
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	pq.current = nil
+	pq.last = b
+	pq.pending = append(pq.pending, b)
+	pq.cond.Broadcast()
+}
+
+// sender - sends batches of queue in order
+func (p *Producer) sender(pq *producerQueue) {
+	defer p.wg.Done()
+
+	for {
+		pq.mx.Lock()
+		for len(pq.pending) == 0 && !pq.closed {
+			pq.cond.Wait()
+		}
+		if len(pq.pending) == 0 {
+			pq.senderDone = true
+			pq.cond.Broadcast()
+			pq.mx.Unlock()
+			return
+		}
+		b := pq.pending[0]
+		pq.pending[0] = nil
+		pq.pending = pq.pending[1:]
+		pq.cond.Broadcast()
+		pq.mx.Unlock()
+
+		b.ids, b.err = p.sendBatch(pq.name, b)
+
+		pq.mx.Lock()
+		pq.sent = append(pq.sent, b)
+		pq.cond.Broadcast()
+		pq.mx.Unlock()
+	}
+}
+
+// completer - completes deliveries of sent batches of queue in order
+// (callbacks are not called by sender: callback may wait in Send for send of pending batches)
+func (p *Producer) completer(pq *producerQueue) {
+	defer p.wg.Done()
+
+	for {
+		pq.mx.Lock()
+		for len(pq.sent) == 0 && !pq.senderDone {
+			pq.cond.Wait()
+		}
+		if len(pq.sent) == 0 {
+			pq.mx.Unlock()
+			return
+		}
+		b := pq.sent[0]
+		pq.sent[0] = nil
+		pq.sent = pq.sent[1:]
+		pq.mx.Unlock()
+
+		for i, d := range b.deliveries {
+			if b.err != nil {
+				d.complete(0, b.err)
+			} else {
+				d.complete(b.ids[i], nil)
+			}
+		}
+		close(b.done)
+	}
+}
+
+// sendBatch - send batch with retries
+func (p *Producer) sendBatch(queueName string, b *producerBatch) (ids []int64, err *mft.Error) {
+	isTransient := p.IsTransient
+	if isTransient == nil {
+		isTransient = ProducerIsTransient
+	}
+
+	backoff := p.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		var mx sync.Mutex
+		var errs []*mft.Error
+		var sent []int64
+
+		ctx, cancel := context.WithTimeout(context.Background(), p.CallTimeout)
+		err = p.CG.FuncDO(ctx, p.PriorityGroup,
+			func(ctx context.Context, cl *cluster.ExternalAbstractCluster) (err *mft.Error) {
+				err = QueueAddUniqueList(queueName, b.messages, p.SaveMode, func(ids []int64) {
+					mx.Lock()
+					if sent == nil {
+						sent = ids
+					}
+					mx.Unlock()
+				})(ctx, cl)
+				if err != nil {
+					mx.Lock()
+					errs = append(errs, err)
+					mx.Unlock()
+				}
+				return err
+			}, p.ErrFunc)
+		cancel()
+
+		mx.Lock()
+		if err == nil && len(sent) == len(b.messages) {
+			ids = sent
+			mx.Unlock()
+			return ids, nil
+		}
+		transient := len(errs) == 0
+		for _, e := range errs {
+			if isTransient(e) {
+				transient = true
+			}
+		}
+		mx.Unlock()
+
+		if attempt >= p.Retries || !transient {
+			return nil, GenerateErrorE(10191400, err, queueName, attempt+1)
+		}
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-t.C:
+		case <-p.stop:
+			t.Stop()
+			return nil, GenerateErrorE(10191401, err, queueName, attempt+1)
+		}
+
+		backoff *= 2
+		if backoff > p.RetryBackoffMax {
+			backoff = p.RetryBackoffMax
+		}
+	}
+}
+
+// Flush - send buffered messages and wait sending of all messages
+func (p *Producer) Flush(ctx context.Context) (err *mft.Error) {
+	var wait []*producerBatch
+	for _, pq := range p.queueList() {
+		pq.mx.Lock()
+		pq.enqueue()
+		if pq.last != nil {
+			wait = append(wait, pq.last)
+		}
+		pq.mx.Unlock()
+	}
+
+	for _, b := range wait {
+		select {
+		case <-b.done:
+		case <-ctx.Done():
+			return GenerateErrorE(10191403, ctx.Err())
+		}
+	}
+
+	return nil
+}
+
+// Close - send buffered messages and stop producer;
+// when ctx is done retries are interrupted and not sent messages are failed
+func (p *Producer) Close(ctx context.Context) (err *mft.Error) {
+	p.mx.Lock()
+	if p.closed {
+		p.mx.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.mx.Unlock()
+
+	for _, pq := range p.queueList() {
+		pq.mx.Lock()
+		pq.enqueue()
+		pq.closed = true
+		pq.cond.Broadcast()
+		pq.mx.Unlock()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		close(p.stop)
+		<-done
+		return GenerateErrorE(10191403, ctx.Err())
+	}
+}
+
+// queueList - buffers of all queues
+func (p *Producer) queueList() (queues []*producerQueue) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	for _, pq := range p.queues {
+		queues = append(queues, pq)
+	}
+	return queues
+}
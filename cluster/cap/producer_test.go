@@ -0,0 +1,355 @@
+package cap
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/capella-pw/queue/cluster"
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/queue"
+	"github.com/capella-pw/queue/storage"
+	"github.com/myfantasy/mft"
+)
+
+// testNode - cluster with queues in memory behind ExternalAbstractCluster
+type testNode struct {
+	cluster.Cluster
+
+	queues map[string]queue.Queue
+
+	// down - calls fail; failCalls - count of next calls that fail;
+	// loseResponceCalls - count of next calls that are done but responce is lost
+	down              int32
+	failCalls         int32
+	loseResponceCalls int32
+	calls             int32
+}
+
+func testNodeCreate(queueNames ...string) *testNode {
+	tn := &testNode{queues: make(map[string]queue.Queue)}
+	for _, name := range queueNames {
+		tn.queues[name] = queue.CreateSimpleQueue(100, 0, 0, storage.CreateMapSorage(), nil, nil, nil)
+	}
+	return tn
+}
+
+func (tn *testNode) GetQueue(ctx context.Context, user cn.CapUser, name string) (q queue.Queue, exists bool, err *mft.Error) {
+	q, exists = tn.queues[name]
+	return q, exists, nil
+}
+
+func (tn *testNode) external() *cluster.ExternalAbstractCluster {
+	return &cluster.ExternalAbstractCluster{
+		CallTimeout: time.Second * 5,
+		CallFunc: func(ctx context.Context, request *cluster.RequestBody) (responce *cluster.ResponceBody) {
+			atomic.AddInt32(&tn.calls, 1)
+			if atomic.LoadInt32(&tn.down) > 0 || atomic.AddInt32(&tn.failCalls, -1) >= 0 {
+				return &cluster.ResponceBody{Err: GenerateErrorE(10190102, errors.New("connection refused"))}
+			}
+			responce = cluster.CallFuncInCluster(ctx, tn, request, nil)
+			if atomic.AddInt32(&tn.loseResponceCalls, -1) >= 0 {
+				return &cluster.ResponceBody{Err: GenerateErrorE(10190102, errors.New("connection reset"))}
+			}
+			return responce
+		},
+	}
+}
+
+func (tn *testNode) messages(t *testing.T, queueName string) []*queue.MessageWithMeta {
+	messages, err := tn.queues[queueName].Get(context.Background(), nil, 0, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return messages
+}
+
+// testConGroup - priority group `pg` of nodes (in order of nodes) with MinSuccess 1
+func testConGroup(nodes ...*testNode) *ConGroup {
+	cg := ConGroupGenerate()
+	step := PriorityGroupStep{StepCallCount: 1, IgnoreHealthCheck: true}
+	for i, tn := range nodes {
+		name := "n" + strconv.Itoa(i)
+		cg.Clusters[name] = tn.external()
+		step.ConNames = append(step.ConNames, name)
+	}
+	cg.PriorityGroups["pg"] = &PriorityGroup{MinSuccess: 1, Steps: []PriorityGroupStep{step}}
+	return cg
+}
+
+func testProducer(cg *ConGroup) *Producer {
+	p := ProducerCreate(cg, "pg", "test")
+	p.RetryBackoff = time.Millisecond
+	p.CallTimeout = time.Second * 5
+	return p
+}
+
+func testWait(t *testing.T, d *Delivery) int64 {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	id, err := d.Wait(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestProducer_Retry(t *testing.T) {
+	tn := testNodeCreate("q1")
+	tn.failCalls = 2
+	tn.loseResponceCalls = 1
+
+	p := testProducer(testConGroup(tn))
+	p.Linger = 0
+	defer p.Close(context.Background())
+
+	id := testWait(t, p.Send("q1", []byte("a")))
+
+	// 2 fails, 1 lost responce and success
+	if calls := atomic.LoadInt32(&tn.calls); calls != 4 {
+		t.Errorf("Producer should retry send: %v calls", calls)
+	}
+	messages := tn.messages(t, "q1")
+	if len(messages) != 1 || messages[0].ID != id {
+		t.Errorf("Producer retry should not duplicate message: %v messages", len(messages))
+	}
+}
+
+func TestProducer_Failover(t *testing.T) {
+	tn0 := testNodeCreate("q1")
+	tn1 := testNodeCreate("q1")
+	atomic.StoreInt32(&tn0.down, 1)
+
+	var mx sync.Mutex
+	var errs []*mft.Error
+	p := testProducer(testConGroup(tn0, tn1))
+	p.Linger = 0
+	p.ErrFunc = func(err *mft.Error) {
+		mx.Lock()
+		errs = append(errs, err)
+		mx.Unlock()
+	}
+	defer p.Close(context.Background())
+
+	testWait(t, p.Send("q1", []byte("a")))
+
+	if len(tn0.messages(t, "q1")) != 0 || len(tn1.messages(t, "q1")) != 1 {
+		t.Errorf("Producer should send message into available node")
+	}
+	mx.Lock()
+	if len(errs) != 1 {
+		t.Errorf("Producer should report error of failed node: %v", errs)
+	}
+	mx.Unlock()
+}
+
+func TestProducer_NotTransient(t *testing.T) {
+	tn := testNodeCreate("q1")
+
+	p := testProducer(testConGroup(tn))
+	p.Linger = 0
+	defer p.Close(context.Background())
+
+	_, err := p.Send("q2", []byte("a")).Wait(context.Background())
+	if err == nil || err.Code != 10191400 {
+		t.Fatalf("Producer should fail send into absent queue: %v", err)
+	}
+	if calls := atomic.LoadInt32(&tn.calls); calls != 1 {
+		t.Errorf("Producer should not retry send into absent queue: %v calls", calls)
+	}
+
+	if ProducerIsTransient(GenerateErrorE(10191212, cluster.GenerateError(10111100, "q1"), "q1")) {
+		t.Errorf("ProducerIsTransient should be false for permission denied")
+	}
+	if !ProducerIsTransient(GenerateErrorE(10190102, errors.New("connection refused"))) {
+		t.Errorf("ProducerIsTransient should be true for send fail")
+	}
+}
+
+func TestProducer_FlushBySize(t *testing.T) {
+	tn := testNodeCreate("q1")
+
+	p := testProducer(testConGroup(tn))
+	p.BatchSize = 3
+	p.BatchBytes = 10
+	p.Linger = time.Hour
+	defer p.Close(context.Background())
+
+	// batch is sent when BatchSize is reached
+	ds := []*Delivery{p.Send("q1", []byte("a")), p.Send("q1", []byte("b")), p.Send("q1", []byte("c"))}
+	for _, d := range ds {
+		testWait(t, d)
+	}
+
+	// batch is sent when BatchBytes is reached
+	ds = []*Delivery{p.Send("q1", []byte("d")), p.Send("q1", []byte("0123456789"))}
+	for _, d := range ds {
+		testWait(t, d)
+	}
+
+	if calls := atomic.LoadInt32(&tn.calls); calls != 2 {
+		t.Errorf("Producer should send 2 batches not %v", calls)
+	}
+
+	// not full batch waits Linger or Flush
+	d := p.Send("q1", []byte("e"))
+	select {
+	case <-d.Done():
+		t.Fatalf("Producer should not send not full batch before Linger")
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := p.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-d.Done():
+	default:
+		t.Fatalf("Producer.Flush should send buffered messages")
+	}
+}
+
+func TestProducer_FlushByTime(t *testing.T) {
+	tn := testNodeCreate("q1")
+
+	p := testProducer(testConGroup(tn))
+	p.Linger = time.Millisecond * 50
+	defer p.Close(context.Background())
+
+	start := time.Now()
+	d1 := p.Send("q1", []byte("a"))
+	d2 := p.Send("q1", []byte("b"))
+	testWait(t, d1)
+	testWait(t, d2)
+
+	if time.Since(start) < p.Linger {
+		t.Errorf("Producer should wait Linger before send of not full batch")
+	}
+	if calls := atomic.LoadInt32(&tn.calls); calls != 1 {
+		t.Errorf("Producer should send messages of Linger in 1 batch not %v", calls)
+	}
+}
+
+func TestProducer_Order(t *testing.T) {
+	tn := testNodeCreate("q1", "q2")
+	tn.failCalls = 1
+
+	p := testProducer(testConGroup(tn))
+	p.BatchSize = 3
+	p.Linger = time.Millisecond
+
+	var mx sync.Mutex
+	callbackIDs := make([]int64, 0)
+	ds := make([]*Delivery, 0)
+	for i := 0; i < 20; i++ {
+		queueName := "q1"
+		if i%4 == 0 {
+			queueName = "q2"
+		}
+		ds = append(ds, p.SendMessage(queueName, queue.Message{Message: []byte(strconv.Itoa(i))},
+			func(id int64, err *mft.Error) {
+				if queueName == "q1" {
+					mx.Lock()
+					callbackIDs = append(callbackIDs, id)
+					mx.Unlock()
+				}
+			}))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := p.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, queueName := range []string{"q1", "q2"} {
+		messages := tn.messages(t, queueName)
+		var lastID int64
+		for i, n := 0, 0; i < len(ds); i++ {
+			if (i%4 == 0) != (queueName == "q2") {
+				continue
+			}
+			id, err := ds[i].Result()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id <= lastID {
+				t.Errorf("Producer results of queue %v should be ordered as Send: %v after %v", queueName, id, lastID)
+			}
+			lastID = id
+			if n >= len(messages) || messages[n].ID != id || string(messages[n].Message) != strconv.Itoa(i) {
+				t.Fatalf("Producer should add messages into queue %v in order of Send", queueName)
+			}
+			n++
+		}
+	}
+
+	for i := 1; i < len(callbackIDs); i++ {
+		if callbackIDs[i] <= callbackIDs[i-1] {
+			t.Errorf("Producer callbacks should be called in order of Send: %v", callbackIDs)
+			break
+		}
+	}
+	if len(callbackIDs) != 15 {
+		t.Errorf("Producer should call 15 callbacks not %v", len(callbackIDs))
+	}
+}
+
+func TestProducer_CallbackSend(t *testing.T) {
+	tn := testNodeCreate("q1", "q2")
+	tn.failCalls = 2
+
+	p := testProducer(testConGroup(tn))
+	p.BatchSize = 1
+	p.PendingBatches = 1
+
+	// callback sends more messages than pending batches of queue while sender retries
+	resent := make(chan []*Delivery, 1)
+	first := p.SendMessage("q1", queue.Message{Message: []byte("first")},
+		func(id int64, err *mft.Error) {
+			var ds []*Delivery
+			for i := 0; i < 5; i++ {
+				ds = append(ds, p.Send("q1", []byte("resent "+strconv.Itoa(i))))
+			}
+			resent <- ds
+		})
+	testWait(t, first)
+
+	var ds []*Delivery
+	select {
+	case ds = <-resent:
+	case <-time.After(time.Second * 5):
+		t.Fatalf("Send from callback should not be blocked by full pending batches of queue")
+	}
+
+	// queue with full pending batches does not block Send into other queue
+	other := make(chan int64, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		id, _ := p.Send("q2", []byte("other")).Wait(ctx)
+		other <- id
+	}()
+	if id := <-other; id == 0 {
+		t.Fatalf("Send into other queue should be done")
+	}
+
+	for _, d := range ds {
+		testWait(t, d)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := p.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if messages := tn.messages(t, "q1"); len(messages) != 6 || string(messages[5].Message) != "resent 4" {
+		t.Fatalf("Producer should add messages of callback into queue: %v messages", len(messages))
+	}
+}
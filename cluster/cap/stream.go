@@ -0,0 +1,180 @@
+package cap
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/capella-pw/queue/cluster"
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/queue"
+	"github.com/myfantasy/mft"
+)
+
+const (
+	StreamSubscribePath = "/stream/subscribe"
+	StreamAckPath       = "/stream/ack"
+)
+
+// Stream - streaming subscription to queue (see cluster.StreamSubscribeAction)
+// messages are pushed by server while credit of stream > 0; Ack returns credit
+type Stream struct {
+	ID string
+
+	cc      *ClusterConnection
+	body    io.ReadCloser
+	decoder *json.Decoder
+	cancel  context.CancelFunc
+
+	mx     sync.Mutex
+	lastId int64
+}
+
+// Subscribe - subscribe to queue; stream is alive until Close or ctx is done
+func (cc *ClusterConnection) Subscribe(ctx context.Context, queueName string,
+	req cluster.StreamSubscribeRequest) (s *Stream, err *mft.Error) {
+
+	request := cluster.MarshalRequestMust(nil, cluster.StreamSubscribeAction, req)
+	request.ObjectName = queueName
+
+	algorithmUsed, body, err := cc.marshalServiceRequest(ctx, cc.Connection.QueryWait, request)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	resp, er0 := cc.Connection.DoStreamQuery(ctx, StreamSubscribePath,
+		map[string]string{CompressTypeHeader: algorithmUsed}, body)
+	if er0 != nil {
+		cancel()
+		return nil, GenerateErrorE(10190500, er0, queueName)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer cancel()
+		return nil, streamResponceError(resp, 10190501, queueName)
+	}
+
+	s = &Stream{
+		cc:      cc,
+		body:    resp.Body,
+		decoder: json.NewDecoder(resp.Body),
+		cancel:  cancel,
+	}
+
+	var frame cluster.StreamFrame
+	er0 = s.decoder.Decode(&frame)
+	if er0 != nil {
+		s.Close()
+		return nil, GenerateErrorE(10190502, er0, queueName)
+	}
+	if frame.Err != nil {
+		s.Close()
+		return nil, GenerateErrorE(10190502, frame.Err, queueName)
+	}
+
+	s.ID = frame.Stream
+	s.lastId = frame.LastId
+
+	return s, nil
+}
+
+// LastId - last read id of stream (id of last received message or last id checked by segments)
+func (s *Stream) LastId() int64 {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	return s.lastId
+}
+
+// Next - wait next messages (heartbeats are skipped)
+// messages can be empty when lastId is moved by segments
+func (s *Stream) Next() (messages []*queue.MessageWithMeta, lastId int64, err *mft.Error) {
+	for {
+		var frame cluster.StreamFrame
+		er0 := s.decoder.Decode(&frame)
+		if er0 != nil {
+			return nil, s.LastId(), GenerateErrorE(10190510, er0, s.ID)
+		}
+		if frame.Err != nil {
+			return nil, s.LastId(), GenerateErrorE(10190511, frame.Err, s.ID)
+		}
+		if frame.LastId == 0 && len(frame.Messages) == 0 {
+			// heartbeat
+			continue
+		}
+
+		s.mx.Lock()
+		s.lastId = frame.LastId
+		s.mx.Unlock()
+
+		return frame.Messages, frame.LastId, nil
+	}
+}
+
+// Ack - set last read id of subscriber (id == 0 - is not changed) and add credit
+func (s *Stream) Ack(id int64, credit int, saveMode cn.SaveMode) (err *mft.Error) {
+	return s.ack(cluster.StreamAckRequest{
+		Stream:   s.ID,
+		Id:       id,
+		SaveMode: saveMode,
+		Credit:   credit,
+	})
+}
+
+// Close - close stream
+func (s *Stream) Close() (err *mft.Error) {
+	if s.ID != "" {
+		err = s.ack(cluster.StreamAckRequest{
+			Stream: s.ID,
+			Close:  true,
+		})
+	}
+	s.cancel()
+	s.body.Close()
+
+	return err
+}
+
+func (s *Stream) ack(req cluster.StreamAckRequest) (err *mft.Error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.cc.Connection.QueryWait)
+	defer cancel()
+
+	request := cluster.MarshalRequestMust(nil, cluster.StreamAckAction, req)
+
+	algorithmUsed, body, err := s.cc.marshalServiceRequest(ctx, s.cc.Connection.QueryWait, request)
+	if err != nil {
+		return GenerateErrorE(10190520, err, s.ID)
+	}
+
+	resp, er0 := s.cc.Connection.DoStreamQuery(ctx, StreamAckPath,
+		map[string]string{CompressTypeHeader: algorithmUsed}, body)
+	if er0 != nil {
+		return GenerateErrorE(10190521, er0, s.ID)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return streamResponceError(resp, 10190522, s.ID)
+	}
+
+	return nil
+}
+
+// streamResponceError - error of not 200 responce (body is ResponceBody)
+func streamResponceError(resp *http.Response, code int, name string) (err *mft.Error) {
+	body, er0 := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if er0 != nil {
+		return GenerateErrorE(code, er0, name, resp.StatusCode)
+	}
+
+	var responce cluster.ResponceBody
+	if json.Unmarshal(body, &responce) == nil && responce.Err != nil {
+		return GenerateErrorE(code, responce.Err, name, resp.StatusCode)
+	}
+
+	return GenerateError(code, name, resp.StatusCode)
+}
@@ -69,6 +69,9 @@ type Cluster interface {
 
 	CheckPermission(ctx context.Context, user cn.CapUser, objectType string, action string, objectName string) (allowed bool, err *mft.Error)
 
+	// RestoreArchive - restore messages from archives of queue into target queue
+	RestoreArchive(ctx context.Context, user cn.CapUser, req ArchiveRestoreRequest) (resp ArchiveRestoreResponce, err *mft.Error)
+
 	GetFullStruct(ctx context.Context, user cn.CapUser) (data json.RawMessage, err *mft.Error)
 	LoadFullStruct(ctx context.Context, user cn.CapUser, data json.RawMessage) (err *mft.Error)
 
@@ -90,3 +93,8 @@ type Handler interface {
 	LastError(ctx context.Context) (err *mft.Error)
 	IsStarted(ctx context.Context) (isStarted bool, err *mft.Error)
 }
+
+// HandlerReporter - handler that reports what it did on last runs
+type HandlerReporter interface {
+	LastReport(ctx context.Context) (report json.RawMessage, err *mft.Error)
+}
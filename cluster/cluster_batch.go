@@ -0,0 +1,172 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/myfantasy/mft"
+)
+
+// BatchRequestLimit - max count of requests in BatchRequest
+var BatchRequestLimit = 1000
+
+// BatchRequest - ordered list of requests called in one ServiceRequest (cn.OpBatch)
+// every request is called by the user of batch request (RequestBody.User of items is replaced)
+type BatchRequest struct {
+	Requests []*RequestBody `json:"requests"`
+	// Parallel - requests are called in parallel (otherwise sequentially in order)
+	Parallel bool `json:"parallel,omitempty"`
+	// StopOnError - sequential call skips requests after first error (skipped requests have error 10124002)
+	StopOnError bool `json:"stop_on_error,omitempty"`
+}
+
+// BatchResponce - responces of BatchRequest in order of requests
+type BatchResponce struct {
+	Responces []*ResponceBody `json:"responces"`
+}
+
+// Binary format of BatchResponce (all numbers are little endian, strings and bytes are uint32 length-prefixed)
+//
+//	magic     [4]byte "CQRB"
+//	version   uint16
+//	count     int64
+//	responces:
+//	  encoding  string
+//	  body      bytes
+//	  error     bytes (json of mft.Error, empty when no error)
+const (
+	batchResponceBinaryMagic = "CQRB"
+)
+
+func callBatch(ctx context.Context, cluster Cluster, request *RequestBody,
+	addFunc []AdditionalCallFuncInClusterFunc) (responce *ResponceBody) {
+	var req BatchRequest
+
+	err := request.UnmarshalInnerObject(&req)
+	if err != nil {
+		return MarshalResponceCtxMust(ctx, nil, err)
+	}
+
+	if len(req.Requests) > BatchRequestLimit {
+		return MarshalResponceCtxMust(ctx, nil, GenerateError(10124000, len(req.Requests), BatchRequestLimit))
+	}
+
+	for i, r := range req.Requests {
+		if r == nil {
+			return MarshalResponceCtxMust(ctx, nil, GenerateError(10124006, i))
+		}
+		if r.Action == cn.OpBatch {
+			return MarshalResponceCtxMust(ctx, nil, GenerateError(10124001, i))
+		}
+		r.User = request.User
+	}
+
+	resp := BatchResponce{
+		Responces: make([]*ResponceBody, len(req.Requests)),
+	}
+
+	if req.Parallel {
+		var wg sync.WaitGroup
+		for i, r := range req.Requests {
+			wg.Add(1)
+			go func(i int, r *RequestBody) {
+				defer wg.Done()
+				resp.Responces[i] = CallFuncInCluster(ctx, cluster, r, addFunc)
+			}(i, r)
+		}
+		wg.Wait()
+
+		return MarshalResponceCtxMust(ctx, resp, nil)
+	}
+
+	failIndex := -1
+	for i, r := range req.Requests {
+		if failIndex >= 0 {
+			resp.Responces[i] = MarshalResponceCtxMust(ctx, nil, GenerateError(10124002, i, failIndex))
+			continue
+		}
+
+		resp.Responces[i] = CallFuncInCluster(ctx, cluster, r, addFunc)
+		if req.StopOnError && resp.Responces[i].Err != nil {
+			failIndex = i
+		}
+	}
+
+	return MarshalResponceCtxMust(ctx, resp, nil)
+}
+
+// MarshalBinary - implements encoding.BinaryMarshaler
+func (resp BatchResponce) MarshalBinary() (body []byte, err error) {
+	w := &binaryWriter{}
+	w.header(batchResponceBinaryMagic)
+	w.int64(int64(len(resp.Responces)))
+	for _, r := range resp.Responces {
+		if r == nil {
+			r = &ResponceBody{}
+		}
+		var errBody []byte
+		if r.Err != nil {
+			var er0 error
+			errBody, er0 = json.Marshal(r.Err)
+			if er0 != nil {
+				return nil, GenerateErrorE(10124005, er0)
+			}
+		}
+		w.string(r.Encoding)
+		w.bytes(r.Body)
+		w.bytes(errBody)
+	}
+
+	return w.buf, nil
+}
+
+// UnmarshalBinary - implements encoding.BinaryUnmarshaler
+func (resp *BatchResponce) UnmarshalBinary(body []byte) (err error) {
+	r := &binaryReader{body: body}
+	if !r.header(batchResponceBinaryMagic) {
+		return GenerateError(10124004, 0)
+	}
+	if r.version != serviceBinaryVersion {
+		return GenerateError(10124003, r.version)
+	}
+
+	cnt := r.int64()
+	if cnt < 0 || cnt > int64(len(body)) {
+		return GenerateError(10124004, r.pos)
+	}
+
+	responces := make([]*ResponceBody, 0, cnt)
+	for i := int64(0); i < cnt && !r.broken; i++ {
+		rb := &ResponceBody{
+			Encoding: r.string(),
+			Body:     r.bytes(),
+		}
+		if errBody := r.bytes(); len(errBody) > 0 {
+			rb.Err = &mft.Error{}
+			er0 := json.Unmarshal(errBody, rb.Err)
+			if er0 != nil {
+				return GenerateErrorE(10124004, er0, r.pos)
+			}
+		}
+		responces = append(responces, rb)
+	}
+
+	if r.broken {
+		return GenerateError(10124004, r.pos)
+	}
+
+	resp.Responces = responces
+
+	return nil
+}
+
+// Batch - call requests in one request to cluster
+func (eac *ExternalAbstractCluster) Batch(ctx context.Context, user cn.CapUser, req BatchRequest) (resp BatchResponce, err *mft.Error) {
+	request := MarshalRequestMust(user, cn.OpBatch, req)
+	responce := eac.Call(request)
+	err = responce.UnmarshalInnerObject(&resp)
+
+	return resp, err
+}
@@ -0,0 +1,257 @@
+package cluster
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/queue"
+	"github.com/capella-pw/queue/storage"
+	"github.com/myfantasy/mft"
+)
+
+// testBatchCluster - cluster with queues `q1`, `q2`; users of permission checks are collected
+type testBatchCluster struct {
+	*SimpleCluster
+
+	mx    sync.Mutex
+	users map[string]struct{}
+}
+
+func testBatchClusterCreate() *testBatchCluster {
+	tc := &testBatchCluster{users: make(map[string]struct{})}
+	tc.SimpleCluster = &SimpleCluster{
+		Queues: map[string]*QueueLoadDescription{
+			"q1": {Name: "q1", Queue: queue.CreateSimpleQueue(100, 0, 0, storage.CreateMapSorage(), nil, nil, nil)},
+			"q2": {Name: "q2", Queue: queue.CreateSimpleQueue(100, 0, 0, storage.CreateMapSorage(), nil, nil, nil)},
+		},
+		CheckPermissionFunc: func(ctx context.Context, user cn.CapUser, objectType string, action string, objectName string) (allowed bool, err *mft.Error) {
+			tc.mx.Lock()
+			tc.users[GetUserName(user)] = struct{}{}
+			tc.mx.Unlock()
+			return true, nil
+		},
+	}
+	return tc
+}
+
+func testBatchQueueRequest(queueName string, action string, v interface{}) *RequestBody {
+	request := MarshalRequestMust(cn.CapUserName("other"), action, v)
+	request.ObjectName = queueName
+	return request
+}
+
+func testBatchAdd(queueName string, message string) *RequestBody {
+	return testBatchQueueRequest(queueName, cn.OpQueueAdd, QueueAddRequest{
+		Message:  queue.Message{Message: []byte(message)},
+		SaveMode: cn.SaveMarkSaveMode,
+	})
+}
+
+func testBatchGet(queueName string) *RequestBody {
+	return testBatchQueueRequest(queueName, cn.OpQueueGet, QueueGetRequest{CntLimit: 100})
+}
+
+func testCallBatch(t *testing.T, ctx context.Context, tc *testBatchCluster, req BatchRequest) BatchResponce {
+	request := MarshalRequestMust(cn.CapUserName("u1"), cn.OpBatch, req)
+	responce := CallFuncInCluster(ctx, tc, request, nil)
+
+	var resp BatchResponce
+	err := responce.UnmarshalInnerObject(&resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Responces) != len(req.Requests) {
+		t.Fatalf("batch should return %v responces not %v", len(req.Requests), len(resp.Responces))
+	}
+	return resp
+}
+
+func testBatchMessages(t *testing.T, responce *ResponceBody) (messages []string) {
+	var msgs []*queue.MessageWithMeta
+	err := responce.UnmarshalInnerObject(&msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range msgs {
+		messages = append(messages, string(m.Message))
+	}
+	return messages
+}
+
+func TestCallBatch_Sequential(t *testing.T) {
+	for _, stopOnError := range []bool{false, true} {
+		tc := testBatchClusterCreate()
+
+		resp := testCallBatch(t, context.Background(), tc, BatchRequest{
+			Requests: []*RequestBody{
+				testBatchAdd("q1", "a"),
+				testBatchGet("q1"),
+				testBatchAdd("q3", "x"),
+				testBatchAdd("q1", "b"),
+			},
+			StopOnError: stopOnError,
+		})
+
+		// requests are called in order: get sees message of previous add
+		if resp.Responces[0].Err != nil || resp.Responces[1].Err != nil {
+			t.Fatalf("batch requests should be done: %v %v", resp.Responces[0].Err, resp.Responces[1].Err)
+		}
+		if messages := testBatchMessages(t, resp.Responces[1]); len(messages) != 1 || messages[0] != "a" {
+			t.Errorf("batch get should return message of previous add not %v", messages)
+		}
+		if resp.Responces[2].Err == nil {
+			t.Errorf("batch add into absent queue should fail")
+		}
+
+		messages := testBatchMessages(t, testCallBatch(t, context.Background(), tc, BatchRequest{
+			Requests: []*RequestBody{testBatchGet("q1")},
+		}).Responces[0])
+
+		if stopOnError {
+			if resp.Responces[3].Err == nil || resp.Responces[3].Err.Code != 10124002 {
+				t.Errorf("batch with StopOnError should skip request after error with 10124002 not %v", resp.Responces[3].Err)
+			}
+			if len(messages) != 1 {
+				t.Errorf("batch with StopOnError should not add message after error: %v", messages)
+			}
+		} else {
+			if resp.Responces[3].Err != nil {
+				t.Errorf("batch without StopOnError should call request after error: %v", resp.Responces[3].Err)
+			}
+			if len(messages) != 2 || messages[1] != "b" {
+				t.Errorf("batch without StopOnError should add message after error: %v", messages)
+			}
+		}
+
+		// user of batch request is used for every request
+		tc.mx.Lock()
+		if _, ok := tc.users["other"]; ok || len(tc.users) != 1 {
+			t.Errorf("batch requests should be called by user of batch not %v", tc.users)
+		}
+		tc.mx.Unlock()
+	}
+}
+
+func TestCallBatch_Parallel(t *testing.T) {
+	tc := testBatchClusterCreate()
+	ctx := context.Background()
+
+	testCallBatch(t, ctx, tc, BatchRequest{
+		Requests: []*RequestBody{testBatchAdd("q1", "a"), testBatchAdd("q2", "b")},
+	})
+
+	requests := []*RequestBody{testBatchAdd("q3", "x")}
+	for i := 0; i < 20; i++ {
+		if i%2 == 0 {
+			requests = append(requests, testBatchGet("q1"))
+		} else {
+			requests = append(requests, testBatchGet("q2"))
+		}
+	}
+
+	resp := testCallBatch(t, ctx, tc, BatchRequest{
+		Requests:    requests,
+		Parallel:    true,
+		StopOnError: true,
+	})
+
+	if resp.Responces[0].Err == nil {
+		t.Errorf("batch add into absent queue should fail")
+	}
+	// responces are in order of requests; parallel batch does not skip requests after error
+	for i, responce := range resp.Responces[1:] {
+		if responce.Err != nil {
+			t.Fatalf("parallel batch request %v should be done: %v", i+1, responce.Err)
+		}
+		expected := "a"
+		if i%2 == 1 {
+			expected = "b"
+		}
+		if messages := testBatchMessages(t, responce); len(messages) != 1 || messages[0] != expected {
+			t.Errorf("parallel batch responce %v should be %v not %v", i+1, expected, messages)
+		}
+	}
+}
+
+func TestCallBatch_errors(t *testing.T) {
+	tc := testBatchClusterCreate()
+	ctx := context.Background()
+
+	limit := BatchRequestLimit
+	BatchRequestLimit = 2
+	defer func() { BatchRequestLimit = limit }()
+
+	tests := []struct {
+		name     string
+		requests []*RequestBody
+		code     int
+	}{
+		{"limit", []*RequestBody{testBatchGet("q1"), testBatchGet("q1"), testBatchGet("q1")}, 10124000},
+		{"nested", []*RequestBody{testBatchGet("q1"), MarshalRequestMust(nil, cn.OpBatch, BatchRequest{})}, 10124001},
+		{"null", []*RequestBody{testBatchGet("q1"), nil}, 10124006},
+	}
+
+	for _, tt := range tests {
+		request := MarshalRequestMust(cn.CapUserName("u1"), cn.OpBatch, BatchRequest{Requests: tt.requests})
+		responce := CallFuncInCluster(ctx, tc, request, nil)
+		if responce.Err == nil || responce.Err.Code != tt.code {
+			t.Errorf("%v: batch should fail with %v not %v", tt.name, tt.code, responce.Err)
+		}
+	}
+}
+
+func TestBatchResponce_binary(t *testing.T) {
+	ctx := context.WithValue(context.Background(), CtxEncodingName, EncodingBinary)
+
+	resp := BatchResponce{
+		Responces: []*ResponceBody{
+			MarshalResponceMust([]int64{1, 2}, nil),
+			MarshalResponceCtxMust(ctx, QueueGetSegmentResponce{LastId: 12}, nil),
+			MarshalResponceMust(nil, GenerateError(10124002, 2, 1)),
+			nil,
+		},
+	}
+
+	responce := MarshalResponceCtxMust(ctx, resp, nil)
+	if responce.Encoding != EncodingBinary {
+		t.Fatalf("BatchResponce should be encoded in binary")
+	}
+
+	var out BatchResponce
+	err := responce.UnmarshalInnerObject(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Responces) != 4 {
+		t.Fatalf("BatchResponce binary should contain 4 responces not %v", len(out.Responces))
+	}
+
+	var ids []int64
+	if err := out.Responces[0].UnmarshalInnerObject(&ids); err != nil || len(ids) != 2 || ids[1] != 2 {
+		t.Errorf("BatchResponce binary json responce is different %v %v", ids, err)
+	}
+
+	var segment QueueGetSegmentResponce
+	if out.Responces[1].Encoding != EncodingBinary {
+		t.Errorf("BatchResponce binary should keep encoding of responce")
+	}
+	if err := out.Responces[1].UnmarshalInnerObject(&segment); err != nil || segment.LastId != 12 {
+		t.Errorf("BatchResponce binary binary responce is different %+v %v", segment, err)
+	}
+
+	if out.Responces[2].Err == nil || out.Responces[2].Err.Code != 10124002 {
+		t.Errorf("BatchResponce binary should keep error of responce not %v", out.Responces[2].Err)
+	}
+	if out.Responces[3].Err != nil || len(out.Responces[3].Body) != 0 {
+		t.Errorf("BatchResponce binary null responce should be empty")
+	}
+
+	// broken body
+	for _, body := range [][]byte{responce.Body[:len(responce.Body)-3], []byte("CQRX"), nil} {
+		if er0 := out.UnmarshalBinary(body); er0 == nil {
+			t.Errorf("BatchResponce.UnmarshalBinary should fail on broken body %q", body)
+		}
+	}
+}
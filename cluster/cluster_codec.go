@@ -0,0 +1,485 @@
+package cluster
+
+import (
+	"context"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/capella-pw/queue/queue"
+	"github.com/myfantasy/mft"
+)
+
+// Encodings of ServiceRequest and ServiceResponce
+// content type (PreferContentType, SendContentType) is `encoding+compression` (`bin+gzip`)
+// or compression only (`gzip`) for json encoding
+const (
+	// EncodingJSON - json with indented inner body (default)
+	EncodingJSON = ""
+	// EncodingCompact - json without indent
+	EncodingCompact = "compact"
+	// EncodingBinary - length-prefixed binary frames
+	// inner body that implements encoding.BinaryMarshaler is binary too
+	// (all responces with messages: queue.MessagesWithMeta, QueueGetSegmentResponce, QueueGetByExternalIDResponce)
+	EncodingBinary = "bin"
+
+	ContentTypeSeparator = "+"
+
+	CtxEncodingName = "ctx_encoding"
+)
+
+// IsEncodingAllowed - encoding is known
+func IsEncodingAllowed(enc string) bool {
+	return enc == EncodingJSON || enc == EncodingCompact || enc == EncodingBinary
+}
+
+// SplitContentType - split content type into encoding and compression algorithm
+func SplitContentType(contentType string) (enc string, compression string) {
+	if idx := strings.Index(contentType, ContentTypeSeparator); idx > 0 && IsEncodingAllowed(contentType[:idx]) {
+		return contentType[:idx], contentType[idx+len(ContentTypeSeparator):]
+	}
+	if contentType != EncodingJSON && IsEncodingAllowed(contentType) {
+		return contentType, ""
+	}
+
+	return EncodingJSON, contentType
+}
+
+// JoinContentType - content type from encoding and compression algorithm
+func JoinContentType(enc string, compression string) string {
+	if enc == EncodingJSON {
+		return compression
+	}
+	if compression == "" {
+		return enc
+	}
+
+	return enc + ContentTypeSeparator + compression
+}
+
+// EncodingFromCtx - encoding of responce (ClusterService.Call sets it from PreferContentType)
+func EncodingFromCtx(ctx context.Context) string {
+	if ctx == nil {
+		return EncodingJSON
+	}
+	enc, _ := ctx.Value(CtxEncodingName).(string)
+	return enc
+}
+
+// MarshalResponceCtxMust - MarshalResponceMust with encoding from ctx
+func MarshalResponceCtxMust(ctx context.Context, v interface{}, err *mft.Error) *ResponceBody {
+	enc := EncodingFromCtx(ctx)
+	if enc == EncodingJSON || v == nil {
+		return MarshalResponceMust(v, err)
+	}
+
+	responce := &ResponceBody{
+		Err: err,
+	}
+
+	if messages, ok := v.([]*queue.MessageWithMeta); ok {
+		v = queue.MessagesWithMeta(messages)
+	}
+
+	if m, ok := v.(encoding.BinaryMarshaler); ok && enc == EncodingBinary {
+		b, er0 := m.MarshalBinary()
+		if er0 != nil {
+			panic(GenerateErrorE(10107005, er0))
+		}
+
+		responce.Body = b
+		responce.Encoding = EncodingBinary
+		return responce
+	}
+
+	b, er0 := json.Marshal(v)
+	if er0 != nil {
+		panic(GenerateErrorE(10107005, er0))
+	}
+	responce.Body = b
+
+	return responce
+}
+
+// Binary format of QueueGetSegmentResponce
+//
+//	magic     [4]byte "CQSG"
+//	version   uint16
+//	last_id   int64
+//	messages  bytes (binary of queue.MessagesWithMeta)
+//
+// Binary format of QueueGetByExternalIDResponce
+//
+//	magic     [4]byte "CQEX"
+//	version   uint16
+//	exists    uint8
+//	messages  bytes (binary of queue.MessagesWithMeta with 0 or 1 message)
+const (
+	segmentResponceBinaryMagic    = "CQSG"
+	externalIDResponceBinaryMagic = "CQEX"
+)
+
+// MarshalBinary - implements encoding.BinaryMarshaler
+func (resp QueueGetSegmentResponce) MarshalBinary() (body []byte, err error) {
+	messages, err := queue.MessagesWithMeta(resp.Messages).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &binaryWriter{}
+	w.header(segmentResponceBinaryMagic)
+	w.int64(resp.LastId)
+	w.bytes(messages)
+
+	return w.buf, nil
+}
+
+// UnmarshalBinary - implements encoding.BinaryUnmarshaler
+func (resp *QueueGetSegmentResponce) UnmarshalBinary(body []byte) (err error) {
+	r, err := binaryInnerReader(body, segmentResponceBinaryMagic)
+	if err != nil {
+		return err
+	}
+
+	resp.LastId = r.int64()
+	messages := r.bytes()
+	if r.broken {
+		return GenerateError(10122003, r.pos)
+	}
+
+	var msgs queue.MessagesWithMeta
+	err = msgs.UnmarshalBinary(messages)
+	if err != nil {
+		return err
+	}
+	resp.Messages = msgs
+
+	return nil
+}
+
+// MarshalBinary - implements encoding.BinaryMarshaler
+func (resp QueueGetByExternalIDResponce) MarshalBinary() (body []byte, err error) {
+	msgs := queue.MessagesWithMeta{}
+	if resp.Message != nil {
+		msgs = append(msgs, resp.Message)
+	}
+	messages, err := msgs.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &binaryWriter{}
+	w.header(externalIDResponceBinaryMagic)
+	w.bool(resp.Exists)
+	w.bytes(messages)
+
+	return w.buf, nil
+}
+
+// UnmarshalBinary - implements encoding.BinaryUnmarshaler
+func (resp *QueueGetByExternalIDResponce) UnmarshalBinary(body []byte) (err error) {
+	r, err := binaryInnerReader(body, externalIDResponceBinaryMagic)
+	if err != nil {
+		return err
+	}
+
+	resp.Exists = r.bool()
+	messages := r.bytes()
+	if r.broken {
+		return GenerateError(10122003, r.pos)
+	}
+
+	var msgs queue.MessagesWithMeta
+	err = msgs.UnmarshalBinary(messages)
+	if err != nil {
+		return err
+	}
+	resp.Message = nil
+	if len(msgs) > 0 {
+		resp.Message = msgs[0]
+	}
+
+	return nil
+}
+
+// binaryInnerReader - checks header of binary inner body
+func binaryInnerReader(body []byte, magic string) (r *binaryReader, err error) {
+	r = &binaryReader{body: body}
+	if !r.header(magic) {
+		return nil, GenerateError(10122004, magic)
+	}
+	if r.version != serviceBinaryVersion {
+		return nil, GenerateError(10122002, r.version)
+	}
+	return r, nil
+}
+
+// Binary format of ServiceRequest (all numbers are little endian, strings and bytes are uint32 length-prefixed)
+//
+//	magic                [4]byte "CQRQ"
+//	version              uint16
+//	auth_type            string
+//	user_name            string
+//	auth_info            bytes
+//	wait                 int64
+//	current_time         int64
+//	prefer_content_type  string
+//	replace_name_force   uint8
+//	has_request          uint8
+//	request (has_request == 1):
+//	  name, user, action string
+//	  body               bytes
+//	  object_name        string
+//
+// Binary format of ServiceResponce
+//
+//	magic                [4]byte "CQRS"
+//	version              uint16
+//	start, finish        int64
+//	encoding             string
+//	body                 bytes
+//	error                bytes (json of mft.Error, empty when no error)
+const (
+	serviceRequestBinaryMagic  = "CQRQ"
+	serviceResponceBinaryMagic = "CQRS"
+	serviceBinaryVersion       = 1
+)
+
+// MarshalServiceRequest - marshal ServiceRequest with encoding
+func MarshalServiceRequest(enc string, serviceRequest ServiceRequest) (body []byte, err *mft.Error) {
+	if enc != EncodingBinary {
+		b, er0 := json.Marshal(serviceRequest)
+		if er0 != nil {
+			return nil, GenerateErrorE(10122000, er0)
+		}
+		return b, nil
+	}
+
+	w := &binaryWriter{}
+	w.header(serviceRequestBinaryMagic)
+	w.string(serviceRequest.AuthentificationType)
+	w.string(serviceRequest.UserName)
+	w.bytes(serviceRequest.AuthentificationInfo)
+	w.int64(int64(serviceRequest.WaitDuration))
+	w.int64(serviceRequest.CurrentTime)
+	w.string(serviceRequest.PreferContentType)
+	w.bool(serviceRequest.ReplaceNameForce)
+	w.bool(serviceRequest.Request != nil)
+	if serviceRequest.Request != nil {
+		w.string(serviceRequest.Request.Name)
+		w.string(serviceRequest.Request.User)
+		w.string(serviceRequest.Request.Action)
+		w.bytes(serviceRequest.Request.Body)
+		w.string(serviceRequest.Request.ObjectName)
+	}
+
+	return w.buf, nil
+}
+
+// UnmarshalServiceRequest - unmarshal ServiceRequest (encoding is detected by header)
+func UnmarshalServiceRequest(body []byte) (serviceRequest ServiceRequest, err *mft.Error) {
+	r := &binaryReader{body: body}
+	if !r.header(serviceRequestBinaryMagic) {
+		er0 := json.Unmarshal(body, &serviceRequest)
+		if er0 != nil {
+			return serviceRequest, GenerateErrorE(10122001, er0)
+		}
+		return serviceRequest, nil
+	}
+	if r.version != serviceBinaryVersion {
+		return serviceRequest, GenerateError(10122002, r.version)
+	}
+
+	serviceRequest.AuthentificationType = r.string()
+	serviceRequest.UserName = r.string()
+	serviceRequest.AuthentificationInfo = r.bytes()
+	serviceRequest.WaitDuration = time.Duration(r.int64())
+	serviceRequest.CurrentTime = r.int64()
+	serviceRequest.PreferContentType = r.string()
+	serviceRequest.ReplaceNameForce = r.bool()
+	if r.bool() {
+		serviceRequest.Request = &RequestBody{
+			Name:       r.string(),
+			User:       r.string(),
+			Action:     r.string(),
+			Body:       r.bytes(),
+			ObjectName: r.string(),
+		}
+	}
+
+	if r.broken {
+		return serviceRequest, GenerateError(10122003, r.pos)
+	}
+
+	return serviceRequest, nil
+}
+
+// MarshalServiceResponce - marshal ServiceResponce with encoding
+func MarshalServiceResponce(enc string, serviceResponce ServiceResponce) (body []byte, err *mft.Error) {
+	if enc != EncodingBinary {
+		b, er0 := json.Marshal(serviceResponce)
+		if er0 != nil {
+			return nil, GenerateErrorE(10122000, er0)
+		}
+		return b, nil
+	}
+
+	var errBody []byte
+	if serviceResponce.Responce.Err != nil {
+		var er0 error
+		errBody, er0 = json.Marshal(serviceResponce.Responce.Err)
+		if er0 != nil {
+			return nil, GenerateErrorE(10122000, er0)
+		}
+	}
+
+	w := &binaryWriter{}
+	w.header(serviceResponceBinaryMagic)
+	w.int64(serviceResponce.TimeStart)
+	w.int64(serviceResponce.TimeFinish)
+	w.string(serviceResponce.Responce.Encoding)
+	w.bytes(serviceResponce.Responce.Body)
+	w.bytes(errBody)
+
+	return w.buf, nil
+}
+
+// UnmarshalServiceResponce - unmarshal ServiceResponce (encoding is detected by header)
+func UnmarshalServiceResponce(body []byte) (serviceResponce ServiceResponce, err *mft.Error) {
+	r := &binaryReader{body: body}
+	if !r.header(serviceResponceBinaryMagic) {
+		er0 := json.Unmarshal(body, &serviceResponce)
+		if er0 != nil {
+			return serviceResponce, GenerateErrorE(10122001, er0)
+		}
+		return serviceResponce, nil
+	}
+	if r.version != serviceBinaryVersion {
+		return serviceResponce, GenerateError(10122002, r.version)
+	}
+
+	serviceResponce.TimeStart = r.int64()
+	serviceResponce.TimeFinish = r.int64()
+	serviceResponce.Responce.Encoding = r.string()
+	serviceResponce.Responce.Body = r.bytes()
+	errBody := r.bytes()
+
+	if r.broken {
+		return serviceResponce, GenerateError(10122003, r.pos)
+	}
+
+	if len(errBody) > 0 {
+		serviceResponce.Responce.Err = &mft.Error{}
+		er0 := json.Unmarshal(errBody, serviceResponce.Responce.Err)
+		if er0 != nil {
+			return serviceResponce, GenerateErrorE(10122001, er0)
+		}
+	}
+
+	return serviceResponce, nil
+}
+
+type binaryWriter struct {
+	buf []byte
+	b8  [8]byte
+}
+
+func (w *binaryWriter) header(magic string) {
+	w.buf = append(w.buf, magic...)
+	binary.LittleEndian.PutUint16(w.b8[:2], serviceBinaryVersion)
+	w.buf = append(w.buf, w.b8[:2]...)
+}
+func (w *binaryWriter) int64(v int64) {
+	binary.LittleEndian.PutUint64(w.b8[:], uint64(v))
+	w.buf = append(w.buf, w.b8[:]...)
+}
+func (w *binaryWriter) bool(v bool) {
+	if v {
+		w.buf = append(w.buf, 1)
+	} else {
+		w.buf = append(w.buf, 0)
+	}
+}
+func (w *binaryWriter) bytes(v []byte) {
+	binary.LittleEndian.PutUint32(w.b8[:4], uint32(len(v)))
+	w.buf = append(w.buf, w.b8[:4]...)
+	w.buf = append(w.buf, v...)
+}
+func (w *binaryWriter) string(v string) {
+	binary.LittleEndian.PutUint32(w.b8[:4], uint32(len(v)))
+	w.buf = append(w.buf, w.b8[:4]...)
+	w.buf = append(w.buf, v...)
+}
+
+// binaryReader - reads values while body is not broken (broken reader returns zero values)
+type binaryReader struct {
+	body    []byte
+	pos     int
+	version uint16
+	broken  bool
+}
+
+func (r *binaryReader) next(n int) []byte {
+	if r.broken || n < 0 || n > len(r.body)-r.pos {
+		r.broken = true
+		return nil
+	}
+	b := r.body[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+func (r *binaryReader) header(magic string) bool {
+	if len(r.body) < len(magic)+2 || string(r.body[:len(magic)]) != magic {
+		return false
+	}
+	r.pos = len(magic)
+	r.version = binary.LittleEndian.Uint16(r.next(2))
+	return true
+}
+func (r *binaryReader) int64() int64 {
+	b := r.next(8)
+	if b == nil {
+		return 0
+	}
+	return int64(binary.LittleEndian.Uint64(b))
+}
+func (r *binaryReader) bool() bool {
+	b := r.next(1)
+	return b != nil && b[0] != 0
+}
+func (r *binaryReader) bytes() []byte {
+	b := r.next(4)
+	if b == nil {
+		return nil
+	}
+	v := r.next(int(binary.LittleEndian.Uint32(b)))
+	if len(v) == 0 {
+		return nil
+	}
+	res := make([]byte, len(v))
+	copy(res, v)
+	return res
+}
+func (r *binaryReader) string() string {
+	b := r.next(4)
+	if b == nil {
+		return ""
+	}
+	return string(r.next(int(binary.LittleEndian.Uint32(b))))
+}
+
+// unmarshalBinaryInnerObject - unmarshal binary body into v (v should implement encoding.BinaryUnmarshaler)
+func unmarshalBinaryInnerObject(body []byte, v interface{}) (err *mft.Error) {
+	u, ok := v.(encoding.BinaryUnmarshaler)
+	if !ok {
+		return GenerateError(10107006, fmt.Sprintf("%T", v))
+	}
+	er0 := u.UnmarshalBinary(body)
+	if er0 != nil {
+		return GenerateErrorE(10107002, er0)
+	}
+	return nil
+}
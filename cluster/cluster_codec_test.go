@@ -0,0 +1,72 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/capella-pw/queue/queue"
+)
+
+func TestMarshalResponceCtxMust_binary(t *testing.T) {
+	ctx := context.WithValue(context.Background(), CtxEncodingName, EncodingBinary)
+
+	msg := &queue.MessageWithMeta{
+		ID:      10,
+		Dt:      time.Unix(100, 0),
+		Message: []byte("text"),
+		Source:  "src",
+		Segment: 3,
+	}
+
+	// segment responce
+	{
+		responce := MarshalResponceCtxMust(ctx, QueueGetSegmentResponce{
+			Messages: []*queue.MessageWithMeta{msg},
+			LastId:   12,
+		}, nil)
+		if responce.Encoding != EncodingBinary {
+			t.Fatalf("QueueGetSegmentResponce should be encoded in binary")
+		}
+
+		var resp QueueGetSegmentResponce
+		err := responce.UnmarshalInnerObject(&resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.LastId != 12 || len(resp.Messages) != 1 || resp.Messages[0].ID != msg.ID ||
+			string(resp.Messages[0].Message) != "text" || resp.Messages[0].Source != "src" {
+			t.Errorf("QueueGetSegmentResponce binary is different %+v", resp)
+		}
+	}
+
+	// external id responce
+	{
+		responce := MarshalResponceCtxMust(ctx, QueueGetByExternalIDResponce{
+			Message: msg,
+			Exists:  true,
+		}, nil)
+		if responce.Encoding != EncodingBinary {
+			t.Fatalf("QueueGetByExternalIDResponce should be encoded in binary")
+		}
+
+		var resp QueueGetByExternalIDResponce
+		err := responce.UnmarshalInnerObject(&resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !resp.Exists || resp.Message == nil || resp.Message.ID != msg.ID || resp.Message.Segment != 3 {
+			t.Errorf("QueueGetByExternalIDResponce binary is different %+v", resp)
+		}
+
+		responce = MarshalResponceCtxMust(ctx, QueueGetByExternalIDResponce{}, nil)
+		resp = QueueGetByExternalIDResponce{}
+		err = responce.UnmarshalInnerObject(&resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Exists || resp.Message != nil {
+			t.Errorf("QueueGetByExternalIDResponce binary should not contain message")
+		}
+	}
+}
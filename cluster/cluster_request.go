@@ -24,6 +24,8 @@ type RequestBody struct {
 type ResponceBody struct {
 	Body json.RawMessage `json:"body"`
 	Err  *mft.Error      `json:"error"`
+	// Encoding - encoding of Body (EncodingBinary when Body is not json)
+	Encoding string `json:"enc,omitempty"`
 }
 
 func (rb *RequestBody) GetName() string {
@@ -37,6 +39,9 @@ func (responce *ResponceBody) UnmarshalInnerObject(v interface{}) (err *mft.Erro
 	if len(responce.Body) == 0 {
 		return nil
 	}
+	if responce.Encoding == EncodingBinary {
+		return unmarshalBinaryInnerObject(responce.Body, v)
+	}
 	er0 := json.Unmarshal(responce.Body, v)
 	if er0 != nil {
 		return GenerateErrorE(10107002, er0)
@@ -63,7 +68,7 @@ func MarshalRequestMust(user cn.CapUser, action string, v interface{}) *RequestB
 		Action: action,
 	}
 	if v != nil {
-		b, er0 := json.MarshalIndent(v, "", "  ")
+		b, er0 := json.Marshal(v)
 		if er0 != nil {
 			panic(GenerateErrorE(10107004, er0))
 		}
@@ -94,17 +99,17 @@ func UnmarshalInnerObjectAndFindQueue(ctx context.Context,
 	cluster Cluster, request *RequestBody, v interface{}) (queue queue.Queue, responce *ResponceBody, ok bool) {
 	err := request.UnmarshalInnerObject(v)
 	if err != nil {
-		responce = MarshalResponceMust(nil, err)
+		responce = MarshalResponceCtxMust(ctx, nil, err)
 		return nil, responce, false
 	}
 
 	queue, exists, err := cluster.GetQueue(ctx, request, request.ObjectName)
 	if err != nil {
-		responce = MarshalResponceMust(nil, err)
+		responce = MarshalResponceCtxMust(ctx, nil, err)
 		return nil, responce, false
 	}
 	if !exists {
-		responce = MarshalResponceMust(nil, GenerateError(10107101, request.ObjectName))
+		responce = MarshalResponceCtxMust(ctx, nil, GenerateError(10107101, request.ObjectName))
 		return nil, responce, false
 	}
 
@@ -115,17 +120,17 @@ func UnmarshalInnerObjectAndFindHandler(ctx context.Context,
 	cluster Cluster, request *RequestBody, v interface{}) (handler Handler, responce *ResponceBody, ok bool) {
 	err := request.UnmarshalInnerObject(v)
 	if err != nil {
-		responce = MarshalResponceMust(nil, err)
+		responce = MarshalResponceCtxMust(ctx, nil, err)
 		return nil, responce, false
 	}
 
 	handler, exists, err := cluster.GetHandler(ctx, request, request.ObjectName)
 	if err != nil {
-		responce = MarshalResponceMust(nil, err)
+		responce = MarshalResponceCtxMust(ctx, nil, err)
 		return nil, responce, false
 	}
 	if !exists {
-		responce = MarshalResponceMust(nil, GenerateError(10107103, request.ObjectName))
+		responce = MarshalResponceCtxMust(ctx, nil, GenerateError(10107103, request.ObjectName))
 		return nil, responce, false
 	}
 
@@ -140,7 +145,7 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 	if request.Action == cn.OpGetName {
 		name, err := cluster.GetName(ctx, request)
 
-		responce = MarshalResponceMust(name, err)
+		responce = MarshalResponceCtxMust(ctx, name, err)
 		return responce
 	}
 	if request.Action == cn.OpSetName {
@@ -148,26 +153,26 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 
 		err := request.UnmarshalInnerObject(&name)
 		if err != nil {
-			responce = MarshalResponceMust(nil, err)
+			responce = MarshalResponceCtxMust(ctx, nil, err)
 			return responce
 		}
 
 		err = cluster.SetName(ctx, request, name)
 
-		responce = MarshalResponceMust(nil, err)
+		responce = MarshalResponceCtxMust(ctx, nil, err)
 		return responce
 	}
 
 	if request.Action == cn.OpPing {
 		err := cluster.Ping(ctx, request)
 
-		responce = MarshalResponceMust(nil, err)
+		responce = MarshalResponceCtxMust(ctx, nil, err)
 		return responce
 	}
 	if request.Action == cn.OpGetNextId {
 		id, err := cluster.GetNextId(ctx, request)
 
-		responce = MarshalResponceMust(id, err)
+		responce = MarshalResponceCtxMust(ctx, id, err)
 		return responce
 	}
 	if request.Action == cn.OpGetNextIds {
@@ -175,13 +180,28 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 
 		err := request.UnmarshalInnerObject(&cnt)
 		if err != nil {
-			responce = MarshalResponceMust(nil, err)
+			responce = MarshalResponceCtxMust(ctx, nil, err)
 			return responce
 		}
 
 		ids, err := cluster.GetNextIds(ctx, request, cnt)
 
-		responce = MarshalResponceMust(ids, err)
+		responce = MarshalResponceCtxMust(ctx, ids, err)
+		return responce
+	}
+
+	if request.Action == cn.OpRestoreArchive {
+		var req ArchiveRestoreRequest
+
+		err := request.UnmarshalInnerObject(&req)
+		if err != nil {
+			responce = MarshalResponceCtxMust(ctx, nil, err)
+			return responce
+		}
+
+		resp, err := cluster.RestoreArchive(ctx, request, req)
+
+		responce = MarshalResponceCtxMust(ctx, resp, err)
 		return responce
 	}
 
@@ -190,13 +210,13 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 
 		err := request.UnmarshalInnerObject(&queueDescription)
 		if err != nil {
-			responce = MarshalResponceMust(nil, err)
+			responce = MarshalResponceCtxMust(ctx, nil, err)
 			return responce
 		}
 
 		err = cluster.AddQueue(ctx, request, queueDescription)
 
-		responce = MarshalResponceMust(nil, err)
+		responce = MarshalResponceCtxMust(ctx, nil, err)
 		return responce
 	}
 	if request.Action == cn.OpDropQueue {
@@ -204,13 +224,13 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 
 		err := request.UnmarshalInnerObject(&name)
 		if err != nil {
-			responce = MarshalResponceMust(nil, err)
+			responce = MarshalResponceCtxMust(ctx, nil, err)
 			return responce
 		}
 
 		err = cluster.DropQueue(ctx, request, name)
 
-		responce = MarshalResponceMust(nil, err)
+		responce = MarshalResponceCtxMust(ctx, nil, err)
 		return responce
 	}
 	if request.Action == cn.OpGetQueueDescription {
@@ -218,19 +238,19 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 
 		err := request.UnmarshalInnerObject(&name)
 		if err != nil {
-			responce = MarshalResponceMust(nil, err)
+			responce = MarshalResponceCtxMust(ctx, nil, err)
 			return responce
 		}
 
 		queueDescription, err := cluster.GetQueueDescription(ctx, request, name)
 
-		responce = MarshalResponceMust(queueDescription, err)
+		responce = MarshalResponceCtxMust(ctx, queueDescription, err)
 		return responce
 	}
 	if request.Action == cn.OpGetQueuesList {
 		names, err := cluster.GetQueuesList(ctx, request)
 
-		responce = MarshalResponceMust(names, err)
+		responce = MarshalResponceCtxMust(ctx, names, err)
 		return responce
 	}
 
@@ -239,13 +259,13 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 
 		err := request.UnmarshalInnerObject(&clusterParams)
 		if err != nil {
-			responce = MarshalResponceMust(nil, err)
+			responce = MarshalResponceCtxMust(ctx, nil, err)
 			return responce
 		}
 
 		err = cluster.AddExternalCluster(ctx, request, clusterParams)
 
-		responce = MarshalResponceMust(nil, err)
+		responce = MarshalResponceCtxMust(ctx, nil, err)
 		return responce
 	}
 	if request.Action == cn.OpDropExternalCluster {
@@ -253,13 +273,13 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 
 		err := request.UnmarshalInnerObject(&name)
 		if err != nil {
-			responce = MarshalResponceMust(nil, err)
+			responce = MarshalResponceCtxMust(ctx, nil, err)
 			return responce
 		}
 
 		err = cluster.DropExternalCluster(ctx, request, name)
 
-		responce = MarshalResponceMust(nil, err)
+		responce = MarshalResponceCtxMust(ctx, nil, err)
 		return responce
 	}
 	if request.Action == cn.OpGetExternalClusterDescription {
@@ -267,19 +287,19 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 
 		err := request.UnmarshalInnerObject(&name)
 		if err != nil {
-			responce = MarshalResponceMust(nil, err)
+			responce = MarshalResponceCtxMust(ctx, nil, err)
 			return responce
 		}
 
 		clusterParams, err := cluster.GetExternalClusterDescription(ctx, request, name)
 
-		responce = MarshalResponceMust(clusterParams, err)
+		responce = MarshalResponceCtxMust(ctx, clusterParams, err)
 		return responce
 	}
 	if request.Action == cn.OpGetExternalClustersList {
 		names, err := cluster.GetExternalClustersList(ctx, request)
 
-		responce = MarshalResponceMust(names, err)
+		responce = MarshalResponceCtxMust(ctx, names, err)
 		return responce
 	}
 
@@ -288,13 +308,13 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 
 		err := request.UnmarshalInnerObject(&handlerParams)
 		if err != nil {
-			responce = MarshalResponceMust(nil, err)
+			responce = MarshalResponceCtxMust(ctx, nil, err)
 			return responce
 		}
 
 		err = cluster.AddHandler(ctx, request, handlerParams)
 
-		responce = MarshalResponceMust(nil, err)
+		responce = MarshalResponceCtxMust(ctx, nil, err)
 		return responce
 	}
 	if request.Action == cn.OpDropHandler {
@@ -302,13 +322,13 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 
 		err := request.UnmarshalInnerObject(&name)
 		if err != nil {
-			responce = MarshalResponceMust(nil, err)
+			responce = MarshalResponceCtxMust(ctx, nil, err)
 			return responce
 		}
 
 		err = cluster.DropHandler(ctx, request, name)
 
-		responce = MarshalResponceMust(nil, err)
+		responce = MarshalResponceCtxMust(ctx, nil, err)
 		return responce
 	}
 	if request.Action == cn.OpGetHandlerDescription {
@@ -316,19 +336,19 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 
 		err := request.UnmarshalInnerObject(&name)
 		if err != nil {
-			responce = MarshalResponceMust(nil, err)
+			responce = MarshalResponceCtxMust(ctx, nil, err)
 			return responce
 		}
 
 		handlerParams, err := cluster.GetHandlerDescription(ctx, request, name)
 
-		responce = MarshalResponceMust(handlerParams, err)
+		responce = MarshalResponceCtxMust(ctx, handlerParams, err)
 		return responce
 	}
 	if request.Action == cn.OpGetHandlersList {
 		names, err := cluster.GetHandlersList(ctx, request)
 
-		responce = MarshalResponceMust(names, err)
+		responce = MarshalResponceCtxMust(ctx, names, err)
 		return responce
 	}
 
@@ -337,20 +357,20 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 
 		err := request.UnmarshalInnerObject(&params)
 		if err != nil {
-			responce = MarshalResponceMust(nil, err)
+			responce = MarshalResponceCtxMust(ctx, nil, err)
 			return responce
 		}
 
 		allowed, err := cluster.CheckPermission(ctx, request, params.ObjectType, params.Action, params.ObjectName)
 
-		responce = MarshalResponceMust(allowed, err)
+		responce = MarshalResponceCtxMust(ctx, allowed, err)
 		return responce
 	}
 
 	if request.Action == cn.OpGetFullStruct {
 		data, err := cluster.GetFullStruct(ctx, request)
 
-		responce = MarshalResponceMust(data, err)
+		responce = MarshalResponceCtxMust(ctx, data, err)
 		return responce
 	}
 	if request.Action == cn.OpLoadFullStruct {
@@ -358,13 +378,13 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 
 		err := request.UnmarshalInnerObject(&data)
 		if err != nil {
-			responce = MarshalResponceMust(nil, err)
+			responce = MarshalResponceCtxMust(ctx, nil, err)
 			return responce
 		}
 
 		err = cluster.LoadFullStruct(ctx, request, data)
 
-		responce = MarshalResponceMust(nil, err)
+		responce = MarshalResponceCtxMust(ctx, nil, err)
 		return responce
 	}
 
@@ -382,7 +402,7 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 
 		id, err := queue.Add(ctx, request, qReq.Message.Message, qReq.Message.ExternalID, qReq.Message.ExternalDt, qReq.Message.Source, qReq.Message.Segment, qReq.SaveMode)
 
-		responce = MarshalResponceMust(id, err)
+		responce = MarshalResponceCtxMust(ctx, id, err)
 		return responce
 	}
 	if request.Action == cn.OpQueueAddList {
@@ -395,7 +415,7 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 
 		ids, err := queue.AddList(ctx, request, qReq.Messages, qReq.SaveMode)
 
-		responce = MarshalResponceMust(ids, err)
+		responce = MarshalResponceCtxMust(ctx, ids, err)
 		return responce
 	}
 
@@ -409,7 +429,7 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 
 		messages, err := queue.Get(ctx, request, qReq.IdStart, qReq.CntLimit)
 
-		responce = MarshalResponceMust(messages, err)
+		responce = MarshalResponceCtxMust(ctx, messages, err)
 		return responce
 	}
 
@@ -423,13 +443,72 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 
 		messages, lastId, err := queue.GetSegment(ctx, request, qReq.IdStart, qReq.CntLimit, qReq.Segments)
 
-		responce = MarshalResponceMust(QueueGetSegmentResponce{
+		responce = MarshalResponceCtxMust(ctx, QueueGetSegmentResponce{
 			Messages: messages,
 			LastId:   lastId,
 		}, err)
 		return responce
 	}
 
+	if request.Action == cn.OpQueueGetFromTime {
+		var qReq QueueGetFromTimeRequest
+
+		queue, responce, ok := UnmarshalInnerObjectAndFindQueue(ctx, cluster, request, &qReq)
+		if !ok {
+			return responce
+		}
+
+		messages, err := queue.GetFromTime(ctx, request, qReq.Dt, qReq.CntLimit)
+
+		responce = MarshalResponceCtxMust(ctx, messages, err)
+		return responce
+	}
+
+	if request.Action == cn.OpQueueGetByIDs {
+		var qReq QueueGetByIDsRequest
+
+		queue, responce, ok := UnmarshalInnerObjectAndFindQueue(ctx, cluster, request, &qReq)
+		if !ok {
+			return responce
+		}
+
+		messages, err := queue.GetByIDs(ctx, request, qReq.IDs)
+
+		responce = MarshalResponceCtxMust(ctx, messages, err)
+		return responce
+	}
+
+	if request.Action == cn.OpQueueGetByExtID {
+		var qReq QueueGetByExternalIDRequest
+
+		queue, responce, ok := UnmarshalInnerObjectAndFindQueue(ctx, cluster, request, &qReq)
+		if !ok {
+			return responce
+		}
+
+		message, exists, err := queue.GetByExternalID(ctx, request, qReq.Source, qReq.ExternalID)
+
+		responce = MarshalResponceCtxMust(ctx, QueueGetByExternalIDResponce{
+			Message: message,
+			Exists:  exists,
+		}, err)
+		return responce
+	}
+
+	if request.Action == cn.OpQueueErase {
+		var qReq QueueEraseRequest
+
+		queue, responce, ok := UnmarshalInnerObjectAndFindQueue(ctx, cluster, request, &qReq)
+		if !ok {
+			return responce
+		}
+
+		erased, err := queue.Erase(ctx, request, qReq.IDs, qReq.Reason)
+
+		responce = MarshalResponceCtxMust(ctx, erased, err)
+		return responce
+	}
+
 	if request.Action == cn.OpQueueSaveAll {
 		queue, responce, ok := UnmarshalInnerObjectAndFindQueue(ctx, cluster, request, nil)
 		if !ok {
@@ -438,7 +517,7 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 
 		err := queue.SaveAll(ctx, request)
 
-		responce = MarshalResponceMust(nil, err)
+		responce = MarshalResponceCtxMust(ctx, nil, err)
 		return responce
 	}
 
@@ -452,7 +531,7 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 
 		id, err := queue.AddUnique(ctx, request, qReq.Message.Message, qReq.Message.ExternalID, qReq.Message.ExternalDt, qReq.Message.Source, qReq.Message.Segment, qReq.SaveMode)
 
-		responce = MarshalResponceMust(id, err)
+		responce = MarshalResponceCtxMust(ctx, id, err)
 		return responce
 	}
 	if request.Action == cn.OpQueueAddUniqueList {
@@ -465,7 +544,7 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 
 		ids, err := queue.AddUniqueList(ctx, request, qReq.Messages, qReq.SaveMode)
 
-		responce = MarshalResponceMust(ids, err)
+		responce = MarshalResponceCtxMust(ctx, ids, err)
 		return responce
 	}
 
@@ -479,7 +558,7 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 
 		err := queue.SubscriberSetLastRead(ctx, request, qReq.Subscriber, qReq.Id, qReq.SaveMode)
 
-		responce = MarshalResponceMust(nil, err)
+		responce = MarshalResponceCtxMust(ctx, nil, err)
 		return responce
 	}
 	if request.Action == cn.OpQueueSubscriberGetLastRead {
@@ -492,7 +571,42 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 
 		id, err := queue.SubscriberGetLastRead(ctx, request, subscriber)
 
-		responce = MarshalResponceMust(id, err)
+		responce = MarshalResponceCtxMust(ctx, id, err)
+		return responce
+	}
+
+	if request.Action == cn.OpQueueSubscriberSeekTime {
+		var qReq QueueSubscriberSeekTimeRequest
+
+		queue, responce, ok := UnmarshalInnerObjectAndFindQueue(ctx, cluster, request, &qReq)
+		if !ok {
+			return responce
+		}
+
+		id, err := queue.SubscriberSeekTime(ctx, request, qReq.Subscriber, qReq.Dt, qReq.SaveMode)
+
+		responce = MarshalResponceCtxMust(ctx, id, err)
+		return responce
+	}
+
+	if request.Action == cn.OpQueueMirrorTranslate {
+		var qReq QueueMirrorTranslateRequest
+
+		q, responce, ok := UnmarshalInnerObjectAndFindQueue(ctx, cluster, request, &qReq)
+		if !ok {
+			return responce
+		}
+
+		var id int64
+		var err *mft.Error
+		if qReq.Subscriber != "" {
+			id, err = queue.MirrorSubscriberSetLastRead(ctx, q, request, qReq.MirrorSource,
+				qReq.Subscriber, qReq.SrcID, qReq.SaveMode)
+		} else {
+			id, err = queue.MirrorTranslateIDFrom(ctx, q, request, qReq.MirrorSource, qReq.SrcID, qReq.KnownID)
+		}
+
+		responce = MarshalResponceCtxMust(ctx, id, err)
 		return responce
 	}
 
@@ -506,7 +620,7 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 
 		err := queue.SubscriberAddReplicaMember(ctx, request, subscriber)
 
-		responce = MarshalResponceMust(nil, err)
+		responce = MarshalResponceCtxMust(ctx, nil, err)
 		return responce
 	}
 
@@ -520,7 +634,7 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 
 		err := queue.SubscriberRemoveReplicaMember(ctx, request, subscriber)
 
-		responce = MarshalResponceMust(nil, err)
+		responce = MarshalResponceCtxMust(ctx, nil, err)
 		return responce
 	}
 
@@ -534,7 +648,7 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 
 		cnt, err := queue.SubscriberGetReplicaCount(ctx, request, id)
 
-		responce = MarshalResponceMust(cnt, err)
+		responce = MarshalResponceCtxMust(ctx, cnt, err)
 		return responce
 	}
 
@@ -549,7 +663,7 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 
 		err := handler.Start(ctx)
 
-		responce = MarshalResponceMust(nil, err)
+		responce = MarshalResponceCtxMust(ctx, nil, err)
 		return responce
 	}
 	if request.Action == cn.OpHandlerStop {
@@ -560,7 +674,7 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 
 		err := handler.Stop(ctx)
 
-		responce = MarshalResponceMust(nil, err)
+		responce = MarshalResponceCtxMust(ctx, nil, err)
 		return responce
 	}
 	if request.Action == cn.OpHandlerLastError {
@@ -571,7 +685,7 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 
 		err := handler.LastError(ctx)
 
-		responce = MarshalResponceMust(nil, err)
+		responce = MarshalResponceCtxMust(ctx, nil, err)
 		return responce
 	}
 	if request.Action == cn.OpHandlerLastComplete {
@@ -582,7 +696,7 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 
 		lastComplete, err := handler.LastComplete(ctx)
 
-		responce = MarshalResponceMust(lastComplete, err)
+		responce = MarshalResponceCtxMust(ctx, lastComplete, err)
 		return responce
 	}
 	if request.Action == cn.OpHandlerIsStarted {
@@ -593,7 +707,25 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 
 		isStarted, err := handler.IsStarted(ctx)
 
-		responce = MarshalResponceMust(isStarted, err)
+		responce = MarshalResponceCtxMust(ctx, isStarted, err)
+		return responce
+	}
+
+	if request.Action == cn.OpHandlerLastReport {
+		handler, responce, ok := UnmarshalInnerObjectAndFindHandler(ctx, cluster, request, nil)
+		if !ok {
+			return responce
+		}
+
+		reporter, ok := handler.(HandlerReporter)
+		if !ok {
+			responce = MarshalResponceCtxMust(ctx, nil, GenerateError(10107104, request.ObjectName))
+			return responce
+		}
+
+		report, err := reporter.LastReport(ctx)
+
+		responce = MarshalResponceCtxMust(ctx, report, err)
 		return responce
 	}
 
@@ -602,17 +734,17 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 
 		err := request.UnmarshalInnerObject(&requestNest)
 		if err != nil {
-			responce = MarshalResponceMust(nil, err)
+			responce = MarshalResponceCtxMust(ctx, nil, err)
 			return responce
 		}
 
 		clusterNext, exists, err := cluster.GetExternalCluster(ctx, request, request.ObjectName)
 		if err != nil {
-			responce = MarshalResponceMust(nil, err)
+			responce = MarshalResponceCtxMust(ctx, nil, err)
 			return responce
 		}
 		if !exists {
-			responce = MarshalResponceMust(nil, GenerateError(10107102, request.ObjectName))
+			responce = MarshalResponceCtxMust(ctx, nil, GenerateError(10107102, request.ObjectName))
 			return responce
 		}
 
@@ -620,6 +752,11 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 		return responce
 	}
 
+	if request.Action == cn.OpBatch {
+		responce = callBatch(ctx, cluster, request, addFunc)
+		return responce
+	}
+
 	for _, f := range addFunc {
 		responce, ok := f(ctx, cluster, request)
 		if ok {
@@ -627,7 +764,7 @@ func CallFuncInCluster(ctx context.Context, cluster Cluster, request *RequestBod
 		}
 	}
 
-	responce = MarshalResponceMust(nil, GenerateError(10107100, request.Action))
+	responce = MarshalResponceCtxMust(ctx, nil, GenerateError(10107100, request.Action))
 	return responce
 }
 
@@ -692,6 +829,15 @@ func (eac *ExternalAbstractCluster) GetNextIds(ctx context.Context, user cn.CapU
 	return ids, err
 }
 
+func (eac *ExternalAbstractCluster) RestoreArchive(ctx context.Context, user cn.CapUser, req ArchiveRestoreRequest) (resp ArchiveRestoreResponce, err *mft.Error) {
+	request := MarshalRequestMust(user, cn.OpRestoreArchive, req)
+	responce := eac.Call(request)
+
+	err = responce.UnmarshalInnerObject(&resp)
+
+	return resp, err
+}
+
 func (eac *ExternalAbstractCluster) ThrowError(err *mft.Error) bool {
 	if eac.ThrowErrorFunc != nil {
 		return eac.ThrowErrorFunc(err)
@@ -930,9 +1076,10 @@ func (eac *ExternalAbstractQueue) Get(ctx context.Context, user cn.CapUser, idSt
 		})
 	responce := eac.CallFunc(ctx, request)
 
-	err = responce.UnmarshalInnerObject(&messages)
+	var resp queue.MessagesWithMeta
+	err = responce.UnmarshalInnerObject(&resp)
 
-	return messages, err
+	return resp, err
 }
 
 type QueueGetSegmentRequest struct {
@@ -964,6 +1111,85 @@ func (eac *ExternalAbstractQueue) GetSegment(ctx context.Context, user cn.CapUse
 	return resp.Messages, resp.LastId, err
 }
 
+type QueueGetFromTimeRequest struct {
+	Dt       time.Time `json:"dt"`
+	CntLimit int       `json:"cnt_limit"`
+}
+
+func (eac *ExternalAbstractQueue) GetFromTime(ctx context.Context, user cn.CapUser, dt time.Time, cntLimit int) (messages []*queue.MessageWithMeta, err *mft.Error) {
+	request := eac.MarshalRequestMust(user,
+		cn.OpQueueGetFromTime, QueueGetFromTimeRequest{
+			Dt:       dt,
+			CntLimit: cntLimit,
+		})
+	responce := eac.CallFunc(ctx, request)
+
+	var resp queue.MessagesWithMeta
+	err = responce.UnmarshalInnerObject(&resp)
+
+	return resp, err
+}
+
+type QueueGetByIDsRequest struct {
+	IDs []int64 `json:"ids"`
+}
+
+func (eac *ExternalAbstractQueue) GetByIDs(ctx context.Context, user cn.CapUser, ids []int64) (messages []*queue.MessageWithMeta, err *mft.Error) {
+	request := eac.MarshalRequestMust(user,
+		cn.OpQueueGetByIDs, QueueGetByIDsRequest{
+			IDs: ids,
+		})
+	responce := eac.CallFunc(ctx, request)
+
+	var resp queue.MessagesWithMeta
+	err = responce.UnmarshalInnerObject(&resp)
+
+	return resp, err
+}
+
+type QueueGetByExternalIDRequest struct {
+	Source     string `json:"src"`
+	ExternalID int64  `json:"eid"`
+}
+
+type QueueGetByExternalIDResponce struct {
+	Message *queue.MessageWithMeta `json:"msg"`
+	Exists  bool                   `json:"exists"`
+}
+
+func (eac *ExternalAbstractQueue) GetByExternalID(ctx context.Context, user cn.CapUser, source string, extID int64) (message *queue.MessageWithMeta, exists bool, err *mft.Error) {
+	var resp QueueGetByExternalIDResponce
+
+	request := eac.MarshalRequestMust(user,
+		cn.OpQueueGetByExtID, QueueGetByExternalIDRequest{
+			Source:     source,
+			ExternalID: extID,
+		})
+	responce := eac.CallFunc(ctx, request)
+
+	err = responce.UnmarshalInnerObject(&resp)
+
+	return resp.Message, resp.Exists, err
+}
+
+type QueueEraseRequest struct {
+	IDs    []int64 `json:"ids"`
+	Reason string  `json:"reason,omitempty"`
+}
+
+func (eac *ExternalAbstractQueue) Erase(ctx context.Context, user cn.CapUser, ids []int64, reason string) (erased []*queue.MessageOnlyMeta, err *mft.Error) {
+	request := eac.MarshalRequestMust(user,
+		cn.OpQueueErase, QueueEraseRequest{
+			IDs:    ids,
+			Reason: reason,
+		})
+	responce := eac.CallFunc(ctx, request)
+
+	err = responce.UnmarshalInnerObject(&erased)
+
+	return erased, err
+}
+
 func (eac *ExternalAbstractQueue) SaveAll(ctx context.Context, user cn.CapUser) (err *mft.Error) {
 	request := eac.MarshalRequestMust(user,
 		cn.OpQueueSaveAll, nil)
@@ -1037,6 +1263,54 @@ func (eac *ExternalAbstractQueue) SubscriberGetLastRead(ctx context.Context, use
 	return id, err
 }
 
+type QueueSubscriberSeekTimeRequest struct {
+	Subscriber string      `json:"sbscr"`
+	Dt         time.Time   `json:"dt"`
+	SaveMode   cn.SaveMode `json:"sm"`
+}
+
+func (eac *ExternalAbstractQueue) SubscriberSeekTime(ctx context.Context, user cn.CapUser,
+	subscriber string, dt time.Time, saveMode cn.SaveMode) (id int64, err *mft.Error) {
+	request := eac.MarshalRequestMust(user,
+		cn.OpQueueSubscriberSeekTime, QueueSubscriberSeekTimeRequest{
+			Subscriber: subscriber,
+			Dt:         dt,
+			SaveMode:   saveMode,
+		})
+	responce := eac.CallFunc(ctx, request)
+
+	err = responce.UnmarshalInnerObject(&id)
+
+	return id, err
+}
+
+// QueueMirrorTranslateRequest - translate id of source message into id of mirror (see queue.MirrorTranslateIDFrom);
+// when Subscriber is set last read of subscriber of mirror is set to translated id (see queue.MirrorSubscriberSetLastRead)
+type QueueMirrorTranslateRequest struct {
+	MirrorSource string      `json:"mirror_src"`
+	SrcID        int64       `json:"src_id"`
+	KnownID      int64       `json:"known_id,omitempty"`
+	Subscriber   string      `json:"sbscr,omitempty"`
+	SaveMode     cn.SaveMode `json:"sm,omitempty"`
+}
+
+// MirrorTranslate - id of mirror (this queue) by id of source message; subscriber of mirror is set when subscriber != ""
+func (eac *ExternalAbstractQueue) MirrorTranslate(ctx context.Context, user cn.CapUser,
+	mirrorSource string, srcID int64, subscriber string, saveMode cn.SaveMode) (id int64, err *mft.Error) {
+	request := eac.MarshalRequestMust(user,
+		cn.OpQueueMirrorTranslate, QueueMirrorTranslateRequest{
+			MirrorSource: mirrorSource,
+			SrcID:        srcID,
+			Subscriber:   subscriber,
+			SaveMode:     saveMode,
+		})
+	responce := eac.CallFunc(ctx, request)
+
+	err = responce.UnmarshalInnerObject(&id)
+
+	return id, err
+}
+
 func (eac *ExternalAbstractQueue) SubscriberAddReplicaMember(ctx context.Context, user cn.CapUser,
 	subscriber string) (err *mft.Error) {
 	request := eac.MarshalRequestMust(user,
@@ -1109,6 +1383,14 @@ func (eah *ExternalAbstractHandler) LastError(ctx context.Context) (err *mft.Err
 
 	return responce.Err
 }
+func (eah *ExternalAbstractHandler) LastReport(ctx context.Context) (report json.RawMessage, err *mft.Error) {
+	request := eah.MarshalRequestMust(cn.OpHandlerLastReport, nil)
+	responce := eah.CallFunc(ctx, request)
+
+	err = responce.UnmarshalInnerObject(&report)
+
+	return report, err
+}
 func (eah *ExternalAbstractHandler) IsStarted(ctx context.Context) (isStarted bool, err *mft.Error) {
 	request := eah.MarshalRequestMust(cn.OpHandlerIsStarted, nil)
 	responce := eah.CallFunc(ctx, request)
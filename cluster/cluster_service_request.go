@@ -21,6 +21,7 @@ type ServiceRequest struct {
 	WaitDuration time.Duration `json:"wait"`
 	CurrentTime  int64         `json:"current_time"`
 
+	// PreferContentType - content type of responce `encoding+compression` (see SplitContentType)
 	PreferContentType string `json:"prefer_content_type"`
 
 	ReplaceNameForce bool `json:"replace_name_force"`
@@ -76,6 +77,8 @@ func CheckAuthFuncEmpty(ctx context.Context, serviceRequest *ServiceRequest) (ok
 	return true, failResponce
 }
 
+// ClusterServiceJsonCreate - cluster service with json, compact json and binary encoding
+// encoding of request is detected by body; encoding of responce is set by PreferContentType
 func ClusterServiceJsonCreate(checkAuth CheckAuthFunc, cluster Cluster, compressor *compress.Generator) (sc *ClusterService) {
 	sc = &ClusterService{
 		CheckAuth: checkAuth,
@@ -84,12 +87,14 @@ func ClusterServiceJsonCreate(checkAuth CheckAuthFunc, cluster Cluster, compress
 		Marshal: func(ctx context.Context, contentType string, serviceResponce ServiceResponce) (body []byte,
 			outContentType string, htmlCode int) {
 
-			respBody, er0 := json.Marshal(serviceResponce)
-			if er0 != nil {
-				return CompressErrorJson(serviceResponce, GenerateErrorE(10120100, er0)), "", HtmlCodeInternalError
+			enc, compression := SplitContentType(contentType)
+
+			respBody, err := MarshalServiceResponce(enc, serviceResponce)
+			if err != nil {
+				return CompressErrorJson(serviceResponce, GenerateErrorE(10120100, err)), "", HtmlCodeInternalError
 			}
 
-			algorithmUsed, result, err := compressor.Compress(ctx, false, contentType, respBody, nil)
+			algorithmUsed, result, err := compressor.Compress(ctx, false, compression, respBody, nil)
 			if err != nil {
 				return CompressErrorJson(serviceResponce, GenerateErrorE(10120101, err)), "", HtmlCodeInternalError
 			}
@@ -104,9 +109,9 @@ func ClusterServiceJsonCreate(checkAuth CheckAuthFunc, cluster Cluster, compress
 				return serviceRequest, false, failResponce
 			}
 
-			er0 := json.Unmarshal(result, &serviceRequest)
-			if er0 != nil {
-				failResponce.Err = GenerateErrorE(10120103, er0, contentType, algorithmUsed)
+			serviceRequest, err = UnmarshalServiceRequest(result)
+			if err != nil {
+				failResponce.Err = GenerateErrorE(10120103, err, contentType, algorithmUsed)
 				return serviceRequest, false, failResponce
 			}
 
@@ -130,10 +135,44 @@ func (sc *ClusterService) Call(prepareCtx context.Context,
 		return sc.Marshal(prepareCtx, "", sr)
 	}
 
+	sr, called, _ := sc.CallRequest(startTime, &serviceRequest, addFunc)
+	if !called {
+		return sc.Marshal(prepareCtx, "", sr)
+	}
+
+	return sc.Marshal(prepareCtx, serviceRequest.PreferContentType, sr)
+}
+
+// CallRequest - checks time and authentication of request and calls cluster
+// called is false when request is rejected before call of cluster (authFail - rejected by CheckAuth)
+func (sc *ClusterService) CallRequest(startTime time.Time, serviceRequest *ServiceRequest,
+	addFunc []AdditionalCallFuncInClusterFunc,
+) (sr ServiceResponce, called bool, authFail bool) {
+	ctx, cancel, sr, ok, authFail := sc.CheckRequest(startTime, serviceRequest)
+	if !ok {
+		return sr, false, authFail
+	}
+	defer cancel()
+
+	clusterResponce := CallFuncInCluster(ctx, sc.Cluster, serviceRequest.Request, addFunc)
+
+	sr.TimeFinish = time.Now().UnixNano()
+	sr.Responce = *clusterResponce
+
+	return sr, true, false
+}
+
+// CheckRequest - checks time and authentication of request
+// ok is true: ctx is context of request with deadline of request (cancel should be called)
+// ok is false: sr contains error (authFail - rejected by CheckAuth)
+func (sc *ClusterService) CheckRequest(startTime time.Time, serviceRequest *ServiceRequest,
+) (ctx context.Context, cancel context.CancelFunc, sr ServiceResponce, ok bool, authFail bool) {
+	sr.TimeStart = startTime.UnixNano()
+
 	if serviceRequest.CurrentTime > sr.TimeStart {
 		sr.TimeFinish = time.Now().UnixNano()
 		sr.Responce.Err = GenerateError(10120000, sr.TimeStart, serviceRequest.CurrentTime)
-		return sc.Marshal(prepareCtx, "", sr)
+		return nil, nil, sr, false, false
 	}
 
 	ctxFinishTime := time.Unix(0, serviceRequest.CurrentTime).Add(serviceRequest.WaitDuration).Add(-sc.ResponceDuration)
@@ -141,25 +180,22 @@ func (sc *ClusterService) Call(prepareCtx context.Context,
 	if ctxFinishTime.Before(startTime) {
 		sr.TimeFinish = time.Now().UnixNano()
 		sr.Responce.Err = GenerateError(10120001, sr.TimeStart, serviceRequest.CurrentTime, serviceRequest.WaitDuration, -sc.ResponceDuration)
-		return sc.Marshal(prepareCtx, "", sr)
+		return nil, nil, sr, false, false
 	}
 
-	ctx := context.WithValue(context.Background(), CtxStopTimeName, ctxFinishTime)
-	ctx, cancel := context.WithDeadline(ctx, ctxFinishTime)
-	defer cancel()
+	ctx = context.WithValue(context.Background(), CtxStopTimeName, ctxFinishTime)
+	enc, _ := SplitContentType(serviceRequest.PreferContentType)
+	ctx = context.WithValue(ctx, CtxEncodingName, enc)
+	ctx, cancel = context.WithDeadline(ctx, ctxFinishTime)
 
-	ok, failResponce = sc.CheckAuth(ctx, &serviceRequest)
+	ok, failResponce := sc.CheckAuth(ctx, serviceRequest)
 	if !ok {
+		cancel()
 		sr.TimeFinish = time.Now().UnixNano()
 		sr.Responce = failResponce
 
-		return sc.Marshal(ctx, "", sr)
+		return nil, nil, sr, false, true
 	}
 
-	clusterResponce := CallFuncInCluster(ctx, sc.Cluster, serviceRequest.Request, addFunc)
-
-	sr.TimeFinish = time.Now().UnixNano()
-	sr.Responce = *clusterResponce
-
-	return sc.Marshal(ctx, serviceRequest.PreferContentType, sr)
+	return ctx, cancel, sr, true, false
 }
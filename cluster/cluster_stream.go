@@ -0,0 +1,58 @@
+package cluster
+
+import (
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/queue"
+	"github.com/myfantasy/mft"
+	"github.com/myfantasy/segment"
+)
+
+// Streaming subscription
+//
+// subscribe: POST of ServiceRequest (same authentication and content type as /cluster)
+// with RequestBody.Action = StreamSubscribeAction, RequestBody.ObjectName = queue name and body StreamSubscribeRequest
+// responce is stream of json StreamFrame separated by new line:
+// first frame contains stream id, next frames contain messages (not more then credit) and heartbeats (empty frame)
+//
+// ack: POST of ServiceRequest with RequestBody.Action = StreamAckAction and body StreamAckRequest;
+// stream id is the key of stream; stream can be acked only by user of subscribe
+// ack sets last read id of subscriber (ack with id less then acked id is ignored) and adds credit
+const (
+	StreamSubscribeAction = "q_stream"
+	StreamAckAction       = "q_stream_ack"
+)
+
+// StreamSubscribeRequest - subscribe to queue
+type StreamSubscribeRequest struct {
+	Subscriber string `json:"sbscr"`
+	// IdStart - messages with id > IdStart are sent (0 - last read id of subscriber)
+	IdStart int64 `json:"id_start,omitempty"`
+	// Segments - only messages of segments are sent (nil - all messages)
+	Segments *segment.Segments `json:"segments,omitempty"`
+	// Credit - count of messages that can be sent before ack (0 - default)
+	Credit int `json:"credit,omitempty"`
+	// CntLimit - max count of messages in frame (0 - default)
+	CntLimit int `json:"cnt_limit,omitempty"`
+}
+
+// StreamAckRequest - ack of stream
+type StreamAckRequest struct {
+	Stream string `json:"stream"`
+	// Id - last processed id; last read id of subscriber is set (0 - last read id is not changed)
+	Id       int64       `json:"id,omitempty"`
+	SaveMode cn.SaveMode `json:"sm,omitempty"`
+	// Credit - count of messages added to credit of stream
+	Credit int `json:"credit,omitempty"`
+	// Close - close stream
+	Close bool `json:"close,omitempty"`
+}
+
+// StreamFrame - frame of stream
+type StreamFrame struct {
+	// Stream - id of stream (first frame only)
+	Stream   string                   `json:"stream,omitempty"`
+	Messages []*queue.MessageWithMeta `json:"msgs,omitempty"`
+	// LastId - last read id of stream (id of last message or last id checked by segments)
+	LastId int64      `json:"last_id,omitempty"`
+	Err    *mft.Error `json:"error,omitempty"`
+}
@@ -49,6 +49,7 @@ var Errors map[int]string = map[int]string{
 	10105003: "SimppleQueueNewGenerator: subscriber storage create error queue:%v",
 	10105004: "SimppleQueueNewGenerator: block storage create error queue:%v block:%v",
 	10105005: "SimppleQueueNewGenerator: queue first save error queue: %v",
+	10105006: "SimppleQueueNewGenerator: unknown block format `%v`",
 
 	10105100: "SimpleQueueParams.ToJson: marshal error",
 
@@ -58,6 +59,7 @@ var Errors map[int]string = map[int]string{
 	10106003: "SimppleQueueLoadGenerator: subscriber storage create error queue:%v",
 	10106004: "SimppleQueueLoadGenerator: block storage create error queue:%v block:%v",
 	10106005: "SimppleQueueLoadGenerator: queue load error queue:%v",
+	10106006: "SimppleQueueLoadGenerator: unknown block format `%v`",
 
 	10107000: "ResponceBody.MustMarshal: Fail marshal",
 	10107001: "ResponceBodySoftUnmarshal: Fail unmarshal",
@@ -65,11 +67,13 @@ var Errors map[int]string = map[int]string{
 	10107003: "RequestBody.UnmarshalInnerObject: Fail unmarshal",
 	10107004: "MarshalRequestMust: Fail marshal",
 	10107005: "MarshalResponceMust: Fail marshal",
+	10107006: "ResponceBody.UnmarshalInnerObject: binary body can not be unmarshaled into %v",
 
 	10107100: "CallFuncInCluster: Unknown operation %v",
 	10107101: "UnmarshalInnerObjectAndFindQueue: Queue is not exists %v",
 	10107102: "CallFuncInCluster: Cluster is not exists %v",
 	10107103: "UnmarshalInnerObjectAndFindHandler: Handler is not exists %v",
+	10107104: "CallFuncInCluster: Handler `%v` does not support report",
 
 	10108000: "SimpleCluster.DropQueue: Permission denied",
 	10108001: "SimpleCluster.DropQueue: Queue `%v` does not exists",
@@ -83,6 +87,7 @@ var Errors map[int]string = map[int]string{
 	10111001: "SimpleCluster.GetQueue: Get subcluster `%v` fail (queue: `%v`)",
 	10111002: "SimpleCluster.GetQueue: Subcluster `%v` does not exist (queue: `%v`)",
 	10111003: "SimpleCluster.GetQueue: Subcluster `%v` fail get GetQueue `%v`",
+	10111100: "SimpleCluster.setQueueEraseCheck: Queue `%v` erase permission denied",
 
 	10112000: "SimpleCluster.AddExternalCluster: Permission denied",
 	10112001: "SimpleCluster.AddExternalCluster: not exists external cluster type: %v",
@@ -136,6 +141,8 @@ var Errors map[int]string = map[int]string{
 	10117901: "CopyUniqueNewGenerator: unmarhal params error",
 	10117902: "CopyUniqueNewGenerator: Interval: %v should be >0",
 	10117903: "CopyUniqueNewGenerator: Wait: %v should be >0",
+	10117904: "CopyUniqueNewGenerator: mirror_source and mirror_subscribers require mirror",
+	10117905: "CopyUniqueNewGenerator: checkpoint requires effectively_once",
 
 	10118000: "CopyUniqueHandler.Start: SRC Queue `%v` get error",
 	10118001: "CopyUniqueHandler.Start: SRC Queue `%v` does not exists",
@@ -144,6 +151,8 @@ var Errors map[int]string = map[int]string{
 	10118005: "CopyUniqueHandler.Start.go: Copy error SrcQueue `%v` DstQueue `%v` Name `%v`",
 	10118006: "CopyUniqueHandler.Start: Save cluster fail on %v",
 	10118007: "CopyUniqueHandler.Stop: Save cluster fail on %v",
+	10118008: "CopyUniqueHandler.mirrorSubscribers: get last read of subscriber `%v` fail",
+	10118009: "CopyUniqueHandler.mirrorSubscribers: set last read of mirror subscriber `%v` fail",
 
 	10118100: "CopyUniqueLoadGenerator: len(QueueNames): %v != 2",
 	10118101: "CopyUniqueLoadGenerator: unmarhal params error",
@@ -211,14 +220,197 @@ var Errors map[int]string = map[int]string{
 
 	10118460: "BlockMarkHandler.ToJson: marshal error",
 
+	10118500: "RetentionHandler.Start.go: Queue `%v` get error",
+	10118501: "RetentionHandler.Start.go: Queue `%v` does not exists",
+	10118502: "RetentionHandler.Start.go: Queue `%v` queue is not queue.SimpleQueue",
+	10118503: "RetentionHandler.Start.go: Queue `%v` SetDeleteByRetention fail",
+	10118504: "RetentionHandler.Start.go: Queue `%v` DeleteBlocks fail",
+	10118505: "RetentionHandler.Start: Save cluster fail on %v",
+	10118506: "RetentionHandler.Stop: Save cluster fail on %v",
+
+	10118520: "RetentionHandler: len(QueueNames): %v should be >0",
+	10118521: "RetentionHandler: unmarhal params error",
+	10118522: "RetentionHandler: Interval: %v should be >0",
+	10118523: "RetentionHandler: WaitMark: %v should be >0",
+	10118524: "RetentionHandler: WaitDelete: %v should be >0",
+	10118525: "RetentionHandler: LimitDelete: %v should be >=0",
+	10118526: "RetentionHandler: Queue `%v` policy has no limits",
+	10118527: "RetentionHandler: Queue `%v` policy is set but queue is not in QueueNames",
+
+	10118540: "RetentionHandler: len(QueueNames): %v should be >0",
+	10118541: "RetentionHandler: unmarhal params error",
+
+	10118560: "RetentionHandler.ToJson: marshal error",
+	10118561: "RetentionHandler.LastReport: marshal error",
+
+	10118600: "ArchiveHandler.archive: Queue `%v` cluster is not SimpleCluster",
+	10118601: "ArchiveHandler.archive: Queue `%v` get error",
+	10118602: "ArchiveHandler.archive: Queue `%v` does not exists",
+	10118603: "ArchiveHandler.archive: Queue `%v` queue is not queue.SimpleQueue",
+	10118604: "ArchiveHandler.archive: Queue `%v` create storage fail mount: %v",
+	10118605: "ArchiveHandler.archive: Queue `%v` SetArchive fail",
+	10118606: "ArchiveHandler.archive: Queue `%v` SetDelete fail",
+	10118607: "ArchiveHandler.archive: Queue `%v` DeleteBlocks fail",
+	10118608: "ArchiveHandler.Start: Save cluster fail on %v",
+	10118609: "ArchiveHandler.Stop: Save cluster fail on %v",
+	10118610: "ArchiveHandler.archive: Queue `%v` save after SetArchive fail",
+
+	10118620: "ArchiveHandler: len(QueueNames): %v != 1",
+	10118621: "ArchiveHandler: unmarhal params error",
+	10118622: "ArchiveHandler: Interval: %v should be >0",
+	10118623: "ArchiveHandler: Wait: %v should be >0",
+	10118624: "ArchiveHandler: LimitArchive: %v should be >0",
+	10118625: "ArchiveHandler: ArchiveTime: %v should be >=0",
+	10118626: "ArchiveHandler: Mount should be set",
+
+	10118640: "ArchiveHandler: len(QueueNames): %v != 1",
+	10118641: "ArchiveHandler: unmarhal params error",
+
+	10118660: "ArchiveHandler.ToJson: marshal error",
+
+	10118700: "ArchiveEncode: marshal message %v fail",
+	10118701: "ArchiveEncode: compress fail alg: %v",
+	10118702: "ArchiveEncode: cluster encrypt data is not set",
+	10118703: "ArchiveEncode: encrypt fail alg: %v",
+
+	10118720: "ArchiveDecode: cluster decrypt data is not set or DecryptAlg != %v",
+	10118721: "ArchiveDecode: decrypt fail alg: %v",
+	10118722: "ArchiveDecode: restore fail alg: %v",
+	10118723: "ArchiveDecode: unmarshal message fail",
+	10118724: "ArchiveDecode: read line fail",
+
+	10118800: "ReconcileHandler: len(QueueNames): %v should be 2 or 3",
+	10118801: "ReconcileHandler: unmarhal params error",
+	10118802: "ReconcileHandler: Interval: %v should be >0",
+	10118803: "ReconcileHandler: Wait: %v should be >0",
+	10118804: "ReconcileHandler: Window: %v and Delay: %v should be >=0",
+
+	10118820: "ReconcileHandler: len(QueueNames): %v should be 2 or 3",
+	10118821: "ReconcileHandler: unmarhal params error",
+
+	10118840: "ReconcileHandler.ToJson: marshal error",
+	10118841: "ReconcileHandler.LastReport: marshal error",
+
+	10118860: "ReconcileHandler.reconcile: Queue `%v` get error",
+	10118861: "ReconcileHandler.reconcile: Queue `%v` does not exists",
+	10118862: "ReconcileHandler.reconcile: reconcile SrcQueue `%v` DstQueue `%v` fail",
+	10118863: "ReconcileHandler.reconcile: copy missing messages SrcQueue `%v` DstQueue `%v` fail",
+	10118864: "ReconcileHandler.reconcile: marshal report error",
+	10118865: "ReconcileHandler.reconcile: add report into Queue `%v` fail",
+	10118866: "ReconcileHandler.Start.go: reconcile error Name `%v`",
+	10118867: "ReconcileHandler.Start: Save cluster fail on %v",
+	10118868: "ReconcileHandler.Stop: Save cluster fail on %v",
+
+	10118900: "CopyTransformNewGenerator: len(QueueNames): %v != 2",
+	10118901: "CopyTransformNewGenerator: unmarhal params error",
+	10118902: "CopyTransformNewGenerator: Interval: %v should be >0",
+	10118903: "CopyTransformNewGenerator: Wait: %v should be >0",
+	10118904: "CopyTransformNewGenerator: transform is not valid",
+
+	10118920: "CopyTransformLoadGenerator: len(QueueNames): %v != 2",
+	10118921: "CopyTransformLoadGenerator: unmarhal params error",
+
+	10118940: "CopyTransformHandlerParams.ToJson: marshal error",
+
+	10118960: "CopyTransformHandler.Start: SRC Queue `%v` get error",
+	10118961: "CopyTransformHandler.Start: SRC Queue `%v` does not exists",
+	10118962: "CopyTransformHandler.Start: DST Queue `%v` get error",
+	10118963: "CopyTransformHandler.Start: DST Queue `%v` does not exists",
+	10118964: "CopyTransformHandler.Start.go: Copy error SrcQueue `%v` DstQueue `%v` Name `%v`",
+	10118965: "CopyTransformHandler.Start: Save cluster fail on %v",
+	10118966: "CopyTransformHandler.Stop: Save cluster fail on %v",
+
+	10119000: "FanOutNewGenerator: len(QueueNames): %v should be >=2",
+	10119001: "FanOutNewGenerator: unmarhal params error",
+	10119002: "FanOutNewGenerator: Interval: %v should be >0",
+	10119003: "FanOutNewGenerator: Wait: %v should be >0",
+	10119004: "FanOutNewGenerator: DST Queue `%v` is set twice",
+	10119005: "FanOutNewGenerator: route of Queue `%v` is set but queue is not destination",
+	10119006: "FanOutNewGenerator: route of Queue `%v` is not valid",
+
+	10119020: "FanOutLoadGenerator: len(QueueNames): %v should be >=2",
+	10119021: "FanOutLoadGenerator: unmarhal params error",
+
+	10119040: "FanOutHandlerParams.ToJson: marshal error",
+	10119041: "FanOutHandler.LastReport: marshal error",
+
+	10119060: "FanOutHandler.destination: DST Queue `%v` get error",
+	10119061: "FanOutHandler.destination: DST Queue `%v` does not exists",
+	10119062: "FanOutHandler.destination: Copy error SrcQueue `%v` DstQueue `%v` Name `%v`",
+	10119063: "FanOutHandler.Start: SRC Queue `%v` get error",
+	10119064: "FanOutHandler.Start: SRC Queue `%v` does not exists",
+	10119065: "FanOutHandler.Start: Save cluster fail on %v",
+	10119066: "FanOutHandler.Stop: Save cluster fail on %v",
+
 	// ----
 	10120000: "ClusterService.Call: Current server time less then client time. Server:%v client:%v",
 	10120001: "ClusterService.Call: Current server time more then client time + duration. server:%v client:%v duration:%v responce_duration:%v",
 
-	10120100: "ClusterServiceJsonCreate.Marshal: marshal to json fail",
+	10120100: "ClusterServiceJsonCreate.Marshal: marshal fail",
 	10120101: "ClusterServiceJsonCreate.Marshal: compress fail",
 	10120102: "ClusterServiceJsonCreate.Unmarshal: restore fail alg: %v alg_set: %v",
 	10120103: "ClusterServiceJsonCreate.Unmarshal: unmarshal fail. ct: %v, au: %v",
+
+	10121000: "SimpleCluster.RestoreArchive: Permission denied",
+	10121001: "SimpleCluster.RestoreArchive: Queue `%v` get error",
+	10121002: "SimpleCluster.RestoreArchive: Queue `%v` does not exists",
+	10121003: "SimpleCluster.RestoreArchive: Queue `%v` queue is not queue.SimpleQueue",
+	10121004: "SimpleCluster.RestoreArchive: Queue `%v` get archives fail",
+	10121005: "SimpleCluster.RestoreArchive: create storage fail mount: %v path: %v",
+	10121006: "SimpleCluster.RestoreArchive: read archive %v fail",
+	10121007: "SimpleCluster.RestoreArchive: decode archive %v fail",
+	10121008: "SimpleCluster.RestoreArchive: add messages from archive %v into queue `%v` fail",
+	10121009: "SimpleCluster.RestoreArchive: erase tombstones from archive %v in queue `%v` fail",
+
+	10122000: "MarshalService: marshal fail",
+	10122001: "UnmarshalService: json unmarshal fail",
+	10122002: "UnmarshalService: binary version %v is not supported",
+	10122003: "UnmarshalService: binary body is broken at %v",
+	10122004: "UnmarshalService: binary body has no header %v",
+
+	10123000: "OpenAPI.JSON: marshal fail",
+
+	10124000: "CallFuncInCluster: batch count of requests %v is more then limit %v",
+	10124001: "CallFuncInCluster: batch request %v is batch; nested batch is not allowed",
+	10124002: "CallFuncInCluster: batch request %v is skipped because request %v failed",
+	10124003: "BatchResponce.UnmarshalBinary: binary version %v is not supported",
+	10124004: "BatchResponce.UnmarshalBinary: binary body is broken at %v",
+	10124005: "BatchResponce.MarshalBinary: marshal error fail",
+	10124006: "CallFuncInCluster: batch request %v is null",
+}
+
+// PermissionDeniedErrors - codes of errors when user does not have permission
+var PermissionDeniedErrors = map[int]struct{}{
+	10100000: {}, 10101000: {}, 10101010: {}, 10101020: {}, 10101030: {},
+	10102000: {}, 10103000: {}, 10104000: {}, 10108000: {}, 10109000: {},
+	10110000: {}, 10111000: {}, 10111100: {}, 10112000: {}, 10113000: {},
+	10114000: {}, 10115000: {}, 10116000: {}, 10117000: {}, 10117100: {},
+	10117200: {}, 10117300: {}, 10117800: {}, 10121000: {},
+}
+
+// IsPermissionDenied - err or one of internal errors of err is permission denied error (PermissionDeniedErrors)
+func IsPermissionDenied(err *mft.Error) bool {
+	for ; err != nil; err = err.InternalError {
+		if _, ok := PermissionDeniedErrors[err.Code]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// QueueNotExistsErrors - codes of errors when queue does not exist
+var QueueNotExistsErrors = map[int]struct{}{
+	10107101: {}, 10108001: {}, 10109001: {},
+}
+
+// IsQueueNotExists - err or one of internal errors of err is queue does not exist error (QueueNotExistsErrors)
+func IsQueueNotExists(err *mft.Error) bool {
+	for ; err != nil; err = err.InternalError {
+		if _, ok := QueueNotExistsErrors[err.Code]; ok {
+			return true
+		}
+	}
+	return false
 }
 
 // GenerateError -
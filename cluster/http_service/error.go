@@ -0,0 +1,39 @@
+package http_service
+
+import (
+	"fmt"
+
+	"github.com/myfantasy/mft"
+)
+
+// Errors codes and description
+var Errors map[int]string = map[int]string{
+	10192000: "RestFastHTTPHandler: method %v is not allowed for path %v",
+	10192001: "RestFastHTTPHandler: query param `%v` value `%v` is not correct",
+	10192002: "RestFastHTTPHandler: body unmarshal fail",
+	10192003: "RestFastHTTPHandler: authorization header is not correct",
+	10192004: "RestFastHTTPHandler: responce marshal fail",
+
+	10192100: "StreamFastHTTPHandler: action `%v` is not `%v`",
+	10192101: "StreamFastHTTPHandler: queue `%v` does not exists",
+	10192102: "StreamFastHTTPHandler: subscriber should be set",
+	10192103: "StreamFastHTTPHandler: stream `%v` does not exists",
+	10192104: "StreamFastHTTPHandler: ack id %v is more then last sent id %v",
+	10192105: "StreamFastHTTPHandler: stream `%v` is not subscribed by user `%v`",
+}
+
+// GenerateError -
+func GenerateError(key int, a ...interface{}) *mft.Error {
+	if text, ok := Errors[key]; ok {
+		return mft.ErrorCS(key, fmt.Sprintf(text, a...))
+	}
+	panic(fmt.Sprintf("http_service.GenerateError, error not found code:%v", key))
+}
+
+// GenerateErrorE -
+func GenerateErrorE(key int, err error, a ...interface{}) *mft.Error {
+	if text, ok := Errors[key]; ok {
+		return mft.ErrorCSE(key, fmt.Sprintf(text, a...), err)
+	}
+	panic(fmt.Sprintf("http_service.GenerateErrorE, error not found code:%v error:%v", key, err))
+}
@@ -0,0 +1,40 @@
+package http_service
+
+import (
+	"sync"
+
+	"github.com/capella-pw/queue/cluster"
+	"github.com/myfantasy/mft"
+	"github.com/valyala/fasthttp"
+)
+
+// OpenAPIPath - path of OpenAPI document
+const OpenAPIPath = "/openapi.json"
+
+// OpenAPIFastHTTPHandler - fasthttp handler of OpenAPI document of cluster endpoint
+// document is generated on first call
+func OpenAPIFastHTTPHandler(title string, version string, clusterPath string) func(ctx *fasthttp.RequestCtx) {
+	var once sync.Once
+	var body []byte
+	var errBody []byte
+
+	return func(ctx *fasthttp.RequestCtx) {
+		once.Do(func() {
+			var err *mft.Error
+			body, err = cluster.OpenAPIGenerate(title, version, clusterPath).JSON()
+			if err != nil {
+				errBody = []byte(err.Error())
+			}
+		})
+
+		if errBody != nil {
+			ctx.Response.SetStatusCode(500)
+			ctx.Response.SetBody(errBody)
+			return
+		}
+
+		ctx.Response.Header.SetContentType("application/json")
+		ctx.Response.SetStatusCode(200)
+		ctx.Response.SetBody(body)
+	}
+}
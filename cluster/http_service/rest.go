@@ -0,0 +1,351 @@
+package http_service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/capella-pw/queue/cluster"
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/queue"
+	"github.com/myfantasy/mft"
+	"github.com/valyala/fasthttp"
+)
+
+// REST API paths
+//
+//	GET  /queues                            - list of queues
+//	GET  /queues/{name}                     - queue description
+//	POST /queues/{name}/messages            - add message (body is message)
+//	                                          or messages (Content-Type: application/json; body is [{"msg":"base64",...}])
+//	                                          query: save_mode, ext_id, ext_dt, source, segment
+//	GET  /queues/{name}/messages            - get messages; query: from, limit
+//	GET  /queues/{name}/subscribers/{sub}   - last read id of subscriber
+//	PUT  /queues/{name}/subscribers/{sub}   - set last read id of subscriber; body {"id":1,"sm":2} or query: id, save_mode
+//	GET  /handlers                          - list of handlers
+//	GET  /handlers/{name}                   - handler description
+//	POST /handlers/{name}/start             - start handler
+//	POST /handlers/{name}/stop              - stop handler
+//
+// authentication: `Authorization: Basic` header (user name and password of basic authentication)
+// or `Auth-Type`, `Auth-User` and `Auth-Info` (json) headers
+// query `wait` - duration of request (RestWaitDefault by default)
+const (
+	RestQueuesPath   = "queues"
+	RestHandlersPath = "handlers"
+
+	RestAuthTypeHeader = "Auth-Type"
+	RestAuthUserHeader = "Auth-User"
+	RestAuthInfoHeader = "Auth-Info"
+
+	RestAuthTypeBasic = "basic"
+
+	RestGetLimitDefault = 100
+)
+
+// RestWaitDefault - default duration of rest request
+var RestWaitDefault = time.Second * 5
+
+// restCall - cluster request of rest path
+type restCall struct {
+	action     string
+	objectName string
+	body       interface{}
+}
+
+// IsRestPath - path is rest path
+func IsRestPath(path string) bool {
+	parts := restPathParts(path)
+	return len(parts) > 0 && (parts[0] == RestQueuesPath || parts[0] == RestHandlersPath)
+}
+
+func restPathParts(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+// RestFastHTTPHandler - fasthttp REST handler
+// requests are called in cluster by ClusterService with the same authentication and permission checks as /cluster requests
+func RestFastHTTPHandler(sc *cluster.ClusterService,
+	addFunc []cluster.AdditionalCallFuncInClusterFunc,
+) func(ctx *fasthttp.RequestCtx) {
+	return func(ctx *fasthttp.RequestCtx) {
+		startTime := time.Now()
+
+		call, found, err := restRoute(ctx)
+		if !found {
+			ctx.Response.SetStatusCode(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			statusCode := http.StatusBadRequest
+			if err.Code == 10192000 {
+				statusCode = http.StatusMethodNotAllowed
+			}
+			restWriteError(ctx, statusCode, err)
+			return
+		}
+
+		serviceRequest, err := restServiceRequest(ctx, startTime)
+		if err != nil {
+			restWriteError(ctx, http.StatusUnauthorized, err)
+			return
+		}
+
+		serviceRequest.Request = cluster.MarshalRequestMust(nil, call.action, call.body)
+		serviceRequest.Request.ObjectName = call.objectName
+
+		sr, _, authFail := sc.CallRequest(startTime, serviceRequest, addFunc)
+		if authFail {
+			restWriteError(ctx, http.StatusUnauthorized, sr.Responce.Err)
+			return
+		}
+		if sr.Responce.Err != nil {
+			restWriteError(ctx, restStatusCode(sr.Responce.Err), sr.Responce.Err)
+			return
+		}
+
+		ctx.Response.SetStatusCode(http.StatusOK)
+		ctx.Response.Header.SetContentType("application/json")
+		if len(sr.Responce.Body) == 0 {
+			ctx.Response.SetBodyString("null")
+			return
+		}
+		ctx.Response.SetBody(sr.Responce.Body)
+	}
+}
+
+// restServiceRequest - ServiceRequest with authentication from headers
+func restServiceRequest(ctx *fasthttp.RequestCtx, startTime time.Time) (serviceRequest *cluster.ServiceRequest, err *mft.Error) {
+	serviceRequest = &cluster.ServiceRequest{
+		WaitDuration:      RestWaitDefault,
+		CurrentTime:       startTime.UnixNano(),
+		PreferContentType: cluster.EncodingCompact,
+	}
+
+	if wait := string(ctx.QueryArgs().Peek("wait")); wait != "" {
+		d, er0 := time.ParseDuration(wait)
+		if er0 != nil || d <= 0 {
+			return nil, GenerateError(10192001, "wait", wait)
+		}
+		serviceRequest.WaitDuration = d
+	}
+
+	if user, pwd, ok := restBasicAuth(string(ctx.Request.Header.Peek(fasthttp.HeaderAuthorization))); ok {
+		info, er0 := json.Marshal(pwd)
+		if er0 != nil {
+			return nil, GenerateErrorE(10192003, er0)
+		}
+		serviceRequest.AuthentificationType = RestAuthTypeBasic
+		serviceRequest.UserName = user
+		serviceRequest.AuthentificationInfo = info
+	} else if len(ctx.Request.Header.Peek(fasthttp.HeaderAuthorization)) > 0 {
+		return nil, GenerateError(10192003)
+	}
+
+	if authType := ctx.Request.Header.Peek(RestAuthTypeHeader); len(authType) > 0 {
+		serviceRequest.AuthentificationType = string(authType)
+		serviceRequest.UserName = string(ctx.Request.Header.Peek(RestAuthUserHeader))
+		serviceRequest.AuthentificationInfo = append([]byte(nil), ctx.Request.Header.Peek(RestAuthInfoHeader)...)
+	}
+
+	return serviceRequest, nil
+}
+
+func restBasicAuth(header string) (user string, pwd string, ok bool) {
+	const prefix = "Basic "
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", "", false
+	}
+	b, er0 := base64.StdEncoding.DecodeString(header[len(prefix):])
+	if er0 != nil {
+		return "", "", false
+	}
+	idx := strings.IndexByte(string(b), ':')
+	if idx < 0 {
+		return "", "", false
+	}
+	return string(b[:idx]), string(b[idx+1:]), true
+}
+
+// restRoute - cluster request by method and path
+func restRoute(ctx *fasthttp.RequestCtx) (call restCall, found bool, err *mft.Error) {
+	method := string(ctx.Method())
+	path := string(ctx.Path())
+	parts := restPathParts(path)
+
+	notAllowed := func() (restCall, bool, *mft.Error) {
+		return call, true, GenerateError(10192000, method, path)
+	}
+
+	switch {
+	case len(parts) == 1 && parts[0] == RestQueuesPath:
+		if method != http.MethodGet {
+			return notAllowed()
+		}
+		return restCall{action: cn.OpGetQueuesList}, true, nil
+
+	case len(parts) == 2 && parts[0] == RestQueuesPath:
+		if method != http.MethodGet {
+			return notAllowed()
+		}
+		return restCall{action: cn.OpGetQueueDescription, body: parts[1]}, true, nil
+
+	case len(parts) == 3 && parts[0] == RestQueuesPath && parts[2] == "messages":
+		call.objectName = parts[1]
+		switch method {
+		case http.MethodPost:
+			return restAddMessages(ctx, call)
+		case http.MethodGet:
+			from, err := restQueryInt(ctx, "from", 0)
+			if err != nil {
+				return call, true, err
+			}
+			limit, err := restQueryInt(ctx, "limit", RestGetLimitDefault)
+			if err != nil {
+				return call, true, err
+			}
+			call.action = cn.OpQueueGet
+			call.body = cluster.QueueGetRequest{IdStart: from, CntLimit: int(limit)}
+			return call, true, nil
+		}
+		return notAllowed()
+
+	case len(parts) == 4 && parts[0] == RestQueuesPath && parts[2] == "subscribers":
+		call.objectName = parts[1]
+		switch method {
+		case http.MethodGet:
+			call.action = cn.OpQueueSubscriberGetLastRead
+			call.body = parts[3]
+			return call, true, nil
+		case http.MethodPut:
+			req := cluster.QueueSubscriberSetLastReadRequest{}
+			if body := ctx.Request.Body(); len(body) > 0 {
+				er0 := json.Unmarshal(body, &req)
+				if er0 != nil {
+					return call, true, GenerateErrorE(10192002, er0)
+				}
+			}
+			id, err := restQueryInt(ctx, "id", req.Id)
+			if err != nil {
+				return call, true, err
+			}
+			saveMode, err := restQueryInt(ctx, "save_mode", int64(req.SaveMode))
+			if err != nil {
+				return call, true, err
+			}
+			req.Subscriber = parts[3]
+			req.Id = id
+			req.SaveMode = cn.SaveMode(saveMode)
+
+			call.action = cn.OpQueueSubscriberSetLastRead
+			call.body = req
+			return call, true, nil
+		}
+		return notAllowed()
+
+	case len(parts) == 1 && parts[0] == RestHandlersPath:
+		if method != http.MethodGet {
+			return notAllowed()
+		}
+		return restCall{action: cn.OpGetHandlersList}, true, nil
+
+	case len(parts) == 2 && parts[0] == RestHandlersPath:
+		if method != http.MethodGet {
+			return notAllowed()
+		}
+		return restCall{action: cn.OpGetHandlerDescription, body: parts[1]}, true, nil
+
+	case len(parts) == 3 && parts[0] == RestHandlersPath && (parts[2] == "start" || parts[2] == "stop"):
+		if method != http.MethodPost {
+			return notAllowed()
+		}
+		call.objectName = parts[1]
+		call.action = cn.OpHandlerStart
+		if parts[2] == "stop" {
+			call.action = cn.OpHandlerStop
+		}
+		return call, true, nil
+	}
+
+	return call, false, nil
+}
+
+// restAddMessages - POST /queues/{name}/messages
+func restAddMessages(ctx *fasthttp.RequestCtx, call restCall) (restCall, bool, *mft.Error) {
+	saveMode, err := restQueryInt(ctx, "save_mode", int64(cn.QueueSetDefaultMode))
+	if err != nil {
+		return call, true, err
+	}
+
+	if strings.HasPrefix(string(ctx.Request.Header.ContentType()), "application/json") {
+		var messages []queue.Message
+		er0 := json.Unmarshal(ctx.Request.Body(), &messages)
+		if er0 != nil {
+			return call, true, GenerateErrorE(10192002, er0)
+		}
+		call.action = cn.OpQueueAddList
+		call.body = cluster.QueueAddListRequest{Messages: messages, SaveMode: cn.SaveMode(saveMode)}
+		return call, true, nil
+	}
+
+	msg := queue.Message{
+		Message: append([]byte(nil), ctx.Request.Body()...),
+		Source:  string(ctx.QueryArgs().Peek("source")),
+	}
+	if msg.ExternalID, err = restQueryInt(ctx, "ext_id", 0); err != nil {
+		return call, true, err
+	}
+	if msg.ExternalDt, err = restQueryInt(ctx, "ext_dt", 0); err != nil {
+		return call, true, err
+	}
+	if msg.Segment, err = restQueryInt(ctx, "segment", 0); err != nil {
+		return call, true, err
+	}
+
+	call.action = cn.OpQueueAdd
+	call.body = cluster.QueueAddRequest{Message: msg, SaveMode: cn.SaveMode(saveMode)}
+	return call, true, nil
+}
+
+func restQueryInt(ctx *fasthttp.RequestCtx, name string, defaultValue int64) (v int64, err *mft.Error) {
+	s := string(ctx.QueryArgs().Peek(name))
+	if s == "" {
+		return defaultValue, nil
+	}
+	v, er0 := strconv.ParseInt(s, 10, 64)
+	if er0 != nil {
+		return 0, GenerateError(10192001, name, s)
+	}
+	return v, nil
+}
+
+// restStatusCode - http status code by error of cluster
+func restStatusCode(err *mft.Error) int {
+	switch err.Code {
+	case 10107101, 10107103:
+		// queue or handler does not exists
+		return http.StatusNotFound
+	case 10107003:
+		// request unmarshal fail
+		return http.StatusBadRequest
+	}
+	if cluster.IsPermissionDenied(err) {
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+func restWriteError(ctx *fasthttp.RequestCtx, statusCode int, err *mft.Error) {
+	body, er0 := json.Marshal(cluster.ResponceBody{Err: err})
+	if er0 != nil {
+		statusCode = http.StatusInternalServerError
+		body = []byte(`{"error":{"code":10192004}}`)
+	}
+
+	ctx.Response.SetStatusCode(statusCode)
+	ctx.Response.Header.SetContentType("application/json")
+	ctx.Response.SetBody(body)
+}
@@ -0,0 +1,252 @@
+package http_service
+
+import (
+	"encoding/base64"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/capella-pw/queue/cluster"
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/queue"
+	"github.com/myfantasy/mft"
+	"github.com/valyala/fasthttp"
+)
+
+func testRestCtx(method string, uri string, contentType string, body string) *fasthttp.RequestCtx {
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.Header.SetMethod(method)
+	ctx.Request.SetRequestURI(uri)
+	if contentType != "" {
+		ctx.Request.Header.SetContentType(contentType)
+	}
+	if body != "" {
+		ctx.Request.SetBodyString(body)
+	}
+	return ctx
+}
+
+func TestRestRoute(t *testing.T) {
+	tests := []struct {
+		name   string
+		ctx    *fasthttp.RequestCtx
+		result restCall
+	}{
+		{
+			name:   "queues",
+			ctx:    testRestCtx(http.MethodGet, "/queues", "", ""),
+			result: restCall{action: cn.OpGetQueuesList},
+		},
+		{
+			name:   "queue",
+			ctx:    testRestCtx(http.MethodGet, "/queues/q1/", "", ""),
+			result: restCall{action: cn.OpGetQueueDescription, body: "q1"},
+		},
+		{
+			name: "add message",
+			ctx:  testRestCtx(http.MethodPost, "/queues/q1/messages?ext_id=5&source=src&save_mode=2", "text/plain", "msg"),
+			result: restCall{action: cn.OpQueueAdd, objectName: "q1", body: cluster.QueueAddRequest{
+				Message:  queue.Message{Message: []byte("msg"), ExternalID: 5, Source: "src"},
+				SaveMode: cn.SaveMode(2),
+			}},
+		},
+		{
+			name: "add messages",
+			ctx:  testRestCtx(http.MethodPost, "/queues/q1/messages", "application/json; charset=utf-8", `[{"msg":"bXNn"},{"msg":"bXNnMg=="}]`),
+			result: restCall{action: cn.OpQueueAddList, objectName: "q1", body: cluster.QueueAddListRequest{
+				Messages: []queue.Message{{Message: []byte("msg")}, {Message: []byte("msg2")}},
+				SaveMode: cn.QueueSetDefaultMode,
+			}},
+		},
+		{
+			name:   "get messages",
+			ctx:    testRestCtx(http.MethodGet, "/queues/q1/messages?from=10", "", ""),
+			result: restCall{action: cn.OpQueueGet, objectName: "q1", body: cluster.QueueGetRequest{IdStart: 10, CntLimit: RestGetLimitDefault}},
+		},
+		{
+			name:   "get subscriber",
+			ctx:    testRestCtx(http.MethodGet, "/queues/q1/subscribers/s1", "", ""),
+			result: restCall{action: cn.OpQueueSubscriberGetLastRead, objectName: "q1", body: "s1"},
+		},
+		{
+			name: "set subscriber",
+			ctx:  testRestCtx(http.MethodPut, "/queues/q1/subscribers/s1?id=7", "application/json", `{"id":3,"sm":2}`),
+			result: restCall{action: cn.OpQueueSubscriberSetLastRead, objectName: "q1", body: cluster.QueueSubscriberSetLastReadRequest{
+				Subscriber: "s1", Id: 7, SaveMode: cn.SaveMode(2),
+			}},
+		},
+		{
+			name:   "handlers",
+			ctx:    testRestCtx(http.MethodGet, "/handlers", "", ""),
+			result: restCall{action: cn.OpGetHandlersList},
+		},
+		{
+			name:   "handler",
+			ctx:    testRestCtx(http.MethodGet, "/handlers/h1", "", ""),
+			result: restCall{action: cn.OpGetHandlerDescription, body: "h1"},
+		},
+		{
+			name:   "handler start",
+			ctx:    testRestCtx(http.MethodPost, "/handlers/h1/start", "", ""),
+			result: restCall{action: cn.OpHandlerStart, objectName: "h1"},
+		},
+		{
+			name:   "handler stop",
+			ctx:    testRestCtx(http.MethodPost, "/handlers/h1/stop", "", ""),
+			result: restCall{action: cn.OpHandlerStop, objectName: "h1"},
+		},
+	}
+
+	for _, tt := range tests {
+		call, found, err := restRoute(tt.ctx)
+		if err != nil {
+			t.Errorf("%v: restRoute error %v", tt.name, err)
+			continue
+		}
+		if !found {
+			t.Errorf("%v: restRoute should find path", tt.name)
+			continue
+		}
+		if !reflect.DeepEqual(call, tt.result) {
+			t.Errorf("%v: restRoute call %+v should be %+v", tt.name, call, tt.result)
+		}
+	}
+}
+
+func TestRestRoute_errors(t *testing.T) {
+	notFound := []*fasthttp.RequestCtx{
+		testRestCtx(http.MethodGet, "/", "", ""),
+		testRestCtx(http.MethodGet, "/queues/q1/other", "", ""),
+		testRestCtx(http.MethodGet, "/queues/q1/subscribers", "", ""),
+		testRestCtx(http.MethodPost, "/handlers/h1/restart", "", ""),
+	}
+	for _, ctx := range notFound {
+		_, found, err := restRoute(ctx)
+		if found || err != nil {
+			t.Errorf("restRoute %v should not find path: %v", string(ctx.Path()), err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		ctx  *fasthttp.RequestCtx
+		code int
+	}{
+		{"queues method", testRestCtx(http.MethodPost, "/queues", "", ""), 10192000},
+		{"messages method", testRestCtx(http.MethodDelete, "/queues/q1/messages", "", ""), 10192000},
+		{"subscriber method", testRestCtx(http.MethodPost, "/queues/q1/subscribers/s1", "", ""), 10192000},
+		{"handler start method", testRestCtx(http.MethodGet, "/handlers/h1/start", "", ""), 10192000},
+		{"query int", testRestCtx(http.MethodGet, "/queues/q1/messages?limit=ten", "", ""), 10192001},
+		{"save mode", testRestCtx(http.MethodPost, "/queues/q1/messages?save_mode=x", "", "msg"), 10192001},
+		{"messages json", testRestCtx(http.MethodPost, "/queues/q1/messages", "application/json", "{"), 10192002},
+		{"subscriber json", testRestCtx(http.MethodPut, "/queues/q1/subscribers/s1", "application/json", "["), 10192002},
+	}
+	for _, tt := range tests {
+		_, found, err := restRoute(tt.ctx)
+		if !found {
+			t.Errorf("%v: restRoute should find path", tt.name)
+			continue
+		}
+		if err == nil || err.Code != tt.code {
+			t.Errorf("%v: restRoute should return error %v not %v", tt.name, tt.code, err)
+		}
+	}
+}
+
+func TestRestServiceRequest(t *testing.T) {
+	startTime := time.Now()
+
+	// basic authentication
+	{
+		ctx := testRestCtx(http.MethodGet, "/queues?wait=1s", "", "")
+		ctx.Request.Header.Set(fasthttp.HeaderAuthorization, "Basic "+base64.StdEncoding.EncodeToString([]byte("admin:p:wd")))
+		sr, err := restServiceRequest(ctx, startTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sr.AuthentificationType != RestAuthTypeBasic || sr.UserName != "admin" || string(sr.AuthentificationInfo) != `"p:wd"` {
+			t.Errorf("restServiceRequest wrong basic authentication %v %v %v", sr.AuthentificationType, sr.UserName, string(sr.AuthentificationInfo))
+		}
+		if sr.WaitDuration != time.Second || sr.CurrentTime != startTime.UnixNano() {
+			t.Errorf("restServiceRequest wrong wait %v", sr.WaitDuration)
+		}
+	}
+
+	// authentication headers
+	{
+		ctx := testRestCtx(http.MethodGet, "/queues", "", "")
+		ctx.Request.Header.Set(RestAuthTypeHeader, "token")
+		ctx.Request.Header.Set(RestAuthUserHeader, "u1")
+		ctx.Request.Header.Set(RestAuthInfoHeader, `"tkn"`)
+		sr, err := restServiceRequest(ctx, startTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sr.AuthentificationType != "token" || sr.UserName != "u1" || string(sr.AuthentificationInfo) != `"tkn"` {
+			t.Errorf("restServiceRequest wrong authentication headers %v %v %v", sr.AuthentificationType, sr.UserName, string(sr.AuthentificationInfo))
+		}
+		if sr.WaitDuration != RestWaitDefault {
+			t.Errorf("restServiceRequest wait should be RestWaitDefault not %v", sr.WaitDuration)
+		}
+	}
+
+	// wrong authorization
+	{
+		ctx := testRestCtx(http.MethodGet, "/queues", "", "")
+		ctx.Request.Header.Set(fasthttp.HeaderAuthorization, "Bearer xxx")
+		_, err := restServiceRequest(ctx, startTime)
+		if err == nil || err.Code != 10192003 {
+			t.Errorf("restServiceRequest should return error 10192003 not %v", err)
+		}
+	}
+
+	// wrong wait
+	{
+		ctx := testRestCtx(http.MethodGet, "/queues?wait=-1s", "", "")
+		_, err := restServiceRequest(ctx, startTime)
+		if err == nil || err.Code != 10192001 {
+			t.Errorf("restServiceRequest should return error 10192001 not %v", err)
+		}
+	}
+}
+
+func TestRestBasicAuth(t *testing.T) {
+	user, pwd, ok := restBasicAuth("basic " + base64.StdEncoding.EncodeToString([]byte("u:p")))
+	if !ok || user != "u" || pwd != "p" {
+		t.Errorf("restBasicAuth wrong result %v %v %v", user, pwd, ok)
+	}
+
+	for _, header := range []string{
+		"",
+		"Basic",
+		"Basic !!!",
+		"Basic " + base64.StdEncoding.EncodeToString([]byte("up")),
+		"Bearer " + base64.StdEncoding.EncodeToString([]byte("u:p")),
+	} {
+		if _, _, ok := restBasicAuth(header); ok {
+			t.Errorf("restBasicAuth should fail on %q", header)
+		}
+	}
+}
+
+func TestRestStatusCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    *mft.Error
+		status int
+	}{
+		{"queue not exists", cluster.GenerateError(10107101, "q1"), http.StatusNotFound},
+		{"handler not exists", cluster.GenerateError(10107103, "h1"), http.StatusNotFound},
+		{"unmarshal", cluster.GenerateError(10107003), http.StatusBadRequest},
+		{"permission denied", cluster.GenerateErrorForClusterUser(cn.CapUserName("u"), 10111100, "q1"), http.StatusForbidden},
+		{"internal permission denied", cluster.GenerateErrorE(10121009, cluster.GenerateError(10121000)), http.StatusForbidden},
+		{"other", cluster.GenerateErrorE(10121009, mft.ErrorS("Permission denied")), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		if status := restStatusCode(tt.err); status != tt.status {
+			t.Errorf("%v: restStatusCode should be %v not %v", tt.name, tt.status, status)
+		}
+	}
+}
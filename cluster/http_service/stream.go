@@ -0,0 +1,382 @@
+package http_service
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/capella-pw/queue/cluster"
+	"github.com/capella-pw/queue/cluster/cap"
+	"github.com/capella-pw/queue/queue"
+	"github.com/myfantasy/mft"
+	"github.com/myfantasy/segment"
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	// StreamCreditDefault - credit of stream when StreamSubscribeRequest.Credit is not set
+	StreamCreditDefault = 100
+	// StreamCntLimitDefault - max count of messages in frame when StreamSubscribeRequest.CntLimit is not set
+	StreamCntLimitDefault = 100
+	// StreamHeartbeat - interval of heartbeat frames
+	StreamHeartbeat = time.Second * 5
+	// StreamPollInterval - interval of checking of queue that does not implement queue.AppendNotifier
+	StreamPollInterval = time.Second
+	// StreamCallTimeout - timeout of queue calls of stream
+	StreamCallTimeout = time.Second * 5
+)
+
+// IsStreamPath - path is stream path
+//
+//	POST cap.StreamSubscribePath - ServiceRequest with StreamSubscribeRequest; responce is stream of StreamFrame (one json per line)
+//	POST cap.StreamAckPath       - ServiceRequest with StreamAckRequest; responce is ResponceBody
+func IsStreamPath(path string) bool {
+	return path == cap.StreamSubscribePath || path == cap.StreamAckPath
+}
+
+type streamSession struct {
+	id         string
+	queue      queue.Queue
+	user       *cluster.RequestBody
+	subscriber string
+	segments   *segment.Segments
+	cntLimit   int
+
+	mx       sync.Mutex
+	credit   int
+	lastSent int64
+	closed   bool
+
+	// ackMx - acks set last read id one by one; lastAck - max acked id
+	ackMx   sync.Mutex
+	lastAck int64
+
+	signal chan struct{}
+}
+
+type streamServer struct {
+	sc *cluster.ClusterService
+
+	mx       sync.Mutex
+	sessions map[string]*streamSession
+}
+
+// StreamFastHTTPHandler - fasthttp handler of streaming subscription
+// subscribe and ack requests are checked by ClusterService with the same authentication as /cluster requests
+// (subscribe with the same permission checks); stream can be acked only by user of subscribe
+func StreamFastHTTPHandler(sc *cluster.ClusterService) func(ctx *fasthttp.RequestCtx) {
+	return newStreamServer(sc).handler
+}
+
+func newStreamServer(sc *cluster.ClusterService) *streamServer {
+	return &streamServer{
+		sc:       sc,
+		sessions: make(map[string]*streamSession),
+	}
+}
+
+func (ss *streamServer) handler(ctx *fasthttp.RequestCtx) {
+	if !ctx.IsPost() {
+		restWriteError(ctx, http.StatusMethodNotAllowed, GenerateError(10192000, string(ctx.Method()), string(ctx.Path())))
+		return
+	}
+
+	switch string(ctx.Path()) {
+	case cap.StreamSubscribePath:
+		ss.subscribe(ctx)
+	case cap.StreamAckPath:
+		ss.ack(ctx)
+	default:
+		ctx.Response.SetStatusCode(http.StatusNotFound)
+	}
+}
+
+// request - authenticated request with action; error is written to ctx when ok is false
+func (ss *streamServer) request(ctx *fasthttp.RequestCtx, action string,
+) (reqCtx context.Context, cancel context.CancelFunc, request *cluster.RequestBody, ok bool) {
+	startTime := time.Now()
+
+	decompressAlg := string(ctx.Request.Header.Peek(cap.CompressTypeHeader))
+	serviceRequest, ok, failResponce := ss.sc.Unmarshal(context.Background(), decompressAlg, ctx.Request.Body())
+	if !ok {
+		restWriteError(ctx, http.StatusBadRequest, failResponce.Err)
+		return nil, nil, nil, false
+	}
+	if serviceRequest.Request == nil {
+		restWriteError(ctx, http.StatusBadRequest, GenerateError(10192100, "", action))
+		return nil, nil, nil, false
+	}
+
+	reqCtx, cancel, sr, ok, authFail := ss.sc.CheckRequest(startTime, &serviceRequest)
+	if !ok {
+		statusCode := http.StatusBadRequest
+		if authFail {
+			statusCode = http.StatusUnauthorized
+		}
+		restWriteError(ctx, statusCode, sr.Responce.Err)
+		return nil, nil, nil, false
+	}
+
+	request = serviceRequest.Request
+	if request.Action != action {
+		cancel()
+		restWriteError(ctx, http.StatusBadRequest, GenerateError(10192100, request.Action, action))
+		return nil, nil, nil, false
+	}
+
+	return reqCtx, cancel, request, true
+}
+
+func (ss *streamServer) subscribe(ctx *fasthttp.RequestCtx) {
+	reqCtx, cancel, request, ok := ss.request(ctx, cluster.StreamSubscribeAction)
+	if !ok {
+		return
+	}
+	defer cancel()
+
+	var req cluster.StreamSubscribeRequest
+	err := request.UnmarshalInnerObject(&req)
+	if err != nil {
+		restWriteError(ctx, http.StatusBadRequest, err)
+		return
+	}
+	if req.Subscriber == "" {
+		restWriteError(ctx, http.StatusBadRequest, GenerateError(10192102))
+		return
+	}
+
+	q, exists, err := ss.sc.Cluster.GetQueue(reqCtx, request, request.ObjectName)
+	if err != nil {
+		restWriteError(ctx, restStatusCode(err), err)
+		return
+	}
+	if !exists {
+		restWriteError(ctx, http.StatusNotFound, GenerateError(10192101, request.ObjectName))
+		return
+	}
+
+	if req.IdStart == 0 {
+		req.IdStart, err = q.SubscriberGetLastRead(reqCtx, request, req.Subscriber)
+		if err != nil {
+			restWriteError(ctx, restStatusCode(err), err)
+			return
+		}
+	}
+
+	s := &streamSession{
+		id:         streamID(),
+		queue:      q,
+		user:       request,
+		subscriber: req.Subscriber,
+		segments:   req.Segments,
+		cntLimit:   req.CntLimit,
+		credit:     req.Credit,
+		lastSent:   req.IdStart,
+		lastAck:    req.IdStart,
+		signal:     make(chan struct{}, 1),
+	}
+	if s.cntLimit <= 0 {
+		s.cntLimit = StreamCntLimitDefault
+	}
+	if s.credit <= 0 {
+		s.credit = StreamCreditDefault
+	}
+
+	ss.mx.Lock()
+	ss.sessions[s.id] = s
+	ss.mx.Unlock()
+
+	ctx.Response.SetStatusCode(http.StatusOK)
+	ctx.Response.Header.SetContentType("application/x-ndjson")
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer func() {
+			ss.mx.Lock()
+			delete(ss.sessions, s.id)
+			ss.mx.Unlock()
+		}()
+
+		s.run(w)
+	})
+}
+
+// ack - sets last read id (ack with id less or equal then acked id does not change last read id) and adds credit
+func (ss *streamServer) ack(ctx *fasthttp.RequestCtx) {
+	reqCtx, cancel, request, ok := ss.request(ctx, cluster.StreamAckAction)
+	if !ok {
+		return
+	}
+	defer cancel()
+
+	var req cluster.StreamAckRequest
+	err := request.UnmarshalInnerObject(&req)
+	if err != nil {
+		restWriteError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	ss.mx.Lock()
+	s, ok := ss.sessions[req.Stream]
+	ss.mx.Unlock()
+	if !ok {
+		restWriteError(ctx, http.StatusNotFound, GenerateError(10192103, req.Stream))
+		return
+	}
+	if request.User != s.user.User {
+		restWriteError(ctx, http.StatusForbidden, GenerateError(10192105, req.Stream, request.User))
+		return
+	}
+
+	if req.Id != 0 {
+		s.mx.Lock()
+		lastSent := s.lastSent
+		s.mx.Unlock()
+		if req.Id > lastSent {
+			restWriteError(ctx, http.StatusBadRequest, GenerateError(10192104, req.Id, lastSent))
+			return
+		}
+
+		s.ackMx.Lock()
+		if req.Id > s.lastAck {
+			err = s.queue.SubscriberSetLastRead(reqCtx, s.user, s.subscriber, req.Id, req.SaveMode)
+			if err == nil {
+				s.lastAck = req.Id
+			}
+		}
+		s.ackMx.Unlock()
+		if err != nil {
+			restWriteError(ctx, restStatusCode(err), err)
+			return
+		}
+	}
+
+	s.mx.Lock()
+	if req.Credit > 0 {
+		s.credit += req.Credit
+	}
+	if req.Close {
+		s.closed = true
+	}
+	s.mx.Unlock()
+
+	select {
+	case s.signal <- struct{}{}:
+	default:
+	}
+
+	ctx.Response.SetStatusCode(http.StatusOK)
+	ctx.Response.Header.SetContentType("application/json")
+	ctx.Response.SetBodyString(`{"body":null,"error":null}`)
+}
+
+// run - sends frames while connection is alive and stream is not closed
+func (s *streamSession) run(w *bufio.Writer) {
+	enc := json.NewEncoder(w)
+	write := func(frame cluster.StreamFrame) bool {
+		if enc.Encode(frame) != nil {
+			return false
+		}
+		return w.Flush() == nil
+	}
+
+	if !write(cluster.StreamFrame{Stream: s.id, LastId: s.lastSent}) {
+		return
+	}
+
+	heartbeat := time.NewTicker(StreamHeartbeat)
+	defer heartbeat.Stop()
+
+	notifier, hasNotifier := s.queue.(queue.AppendNotifier)
+
+	for {
+		// notify channel is got before read to not miss append between read and wait
+		var notify <-chan struct{}
+		if hasNotifier {
+			notify = notifier.AppendNotify()
+		}
+
+		s.mx.Lock()
+		credit, lastSent, closed := s.credit, s.lastSent, s.closed
+		s.mx.Unlock()
+
+		if closed {
+			return
+		}
+
+		if credit > 0 {
+			cnt := credit
+			if cnt > s.cntLimit {
+				cnt = s.cntLimit
+			}
+
+			messages, lastId, err := s.get(lastSent, cnt)
+			if err != nil {
+				write(cluster.StreamFrame{Err: err})
+				return
+			}
+
+			if len(messages) > 0 || lastId > lastSent {
+				s.mx.Lock()
+				s.credit -= len(messages)
+				s.lastSent = lastId
+				s.mx.Unlock()
+
+				if !write(cluster.StreamFrame{Messages: messages, LastId: lastId}) {
+					return
+				}
+				continue
+			}
+		}
+
+		var poll *time.Timer
+		var pollC <-chan time.Time
+		if !hasNotifier {
+			poll = time.NewTimer(StreamPollInterval)
+			pollC = poll.C
+		}
+
+		select {
+		case <-notify:
+		case <-pollC:
+		case <-s.signal:
+		case <-heartbeat.C:
+			if !write(cluster.StreamFrame{}) {
+				return
+			}
+		}
+
+		if poll != nil {
+			poll.Stop()
+		}
+	}
+}
+
+func (s *streamSession) get(idStart int64, cnt int) (messages []*queue.MessageWithMeta, lastId int64, err *mft.Error) {
+	ctx, cancel := context.WithTimeout(context.Background(), StreamCallTimeout)
+	defer cancel()
+
+	if s.segments != nil {
+		return s.queue.GetSegment(ctx, s.user, idStart, cnt, s.segments)
+	}
+
+	messages, err = s.queue.Get(ctx, s.user, idStart, cnt)
+	lastId = idStart
+	if len(messages) > 0 {
+		lastId = messages[len(messages)-1].ID
+	}
+
+	return messages, lastId, err
+}
+
+func streamID() string {
+	b := make([]byte, 16)
+	_, er0 := rand.Read(b)
+	if er0 != nil {
+		panic(er0)
+	}
+	return hex.EncodeToString(b)
+}
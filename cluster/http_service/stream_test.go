@@ -0,0 +1,299 @@
+package http_service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/capella-pw/queue/cluster"
+	"github.com/capella-pw/queue/cluster/cap"
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/compress"
+	"github.com/capella-pw/queue/queue"
+	"github.com/capella-pw/queue/storage"
+	"github.com/myfantasy/mft"
+	"github.com/valyala/fasthttp"
+)
+
+// testCluster - cluster with queues only
+type testCluster struct {
+	cluster.Cluster
+
+	queues map[string]queue.Queue
+}
+
+func (tc *testCluster) GetQueue(ctx context.Context, user cn.CapUser, name string) (q queue.Queue, exists bool, err *mft.Error) {
+	q, exists = tc.queues[name]
+	return q, exists, nil
+}
+
+// testStreamServer - stream server with queue `q1` (10 messages) for users `u1` and `u2`
+func testStreamServer(t *testing.T) (ss *streamServer, q queue.Queue, ids []int64, addr string) {
+	q = queue.CreateSimpleQueue(5, 0, 0, storage.CreateMapSorage(), nil, nil, nil)
+	for i := 0; i < 10; i++ {
+		id, err := q.Add(context.Background(), nil, []byte("msg"), 0, 0, "", 0, cn.SaveMarkSaveMode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	checkAuth := func(ctx context.Context, serviceRequest *cluster.ServiceRequest) (ok bool, failResponce cluster.ResponceBody) {
+		if serviceRequest.UserName != "u1" && serviceRequest.UserName != "u2" {
+			failResponce.Err = mft.ErrorS("unknown user")
+			return false, failResponce
+		}
+		serviceRequest.Request.User = serviceRequest.UserName
+		return true, failResponce
+	}
+
+	tc := &testCluster{queues: map[string]queue.Queue{"q1": q}}
+	ss = newStreamServer(cluster.ClusterServiceJsonCreate(checkAuth, tc, compress.GeneratorCreate(7)))
+
+	ln, er0 := net.Listen("tcp", "127.0.0.1:0")
+	if er0 != nil {
+		t.Fatal(er0)
+	}
+	go fasthttp.Serve(ln, ss.handler)
+	t.Cleanup(func() { ln.Close() })
+
+	return ss, q, ids, "http://" + ln.Addr().String()
+}
+
+func testStreamConnection(addr string, user string) *cap.ClusterConnection {
+	cc := cap.CreateClusterConnection(compress.GeneratorCreate(7),
+		cap.CreateConnection(addr, false, time.Second*5, 5, time.Second*5),
+		"test", user, nil, "", "", false)
+	cc.Init()
+	return cc
+}
+
+func (ss *streamServer) sessionsCnt() int {
+	ss.mx.Lock()
+	defer ss.mx.Unlock()
+	return len(ss.sessions)
+}
+
+func TestStream_Credit(t *testing.T) {
+	_, _, ids, addr := testStreamServer(t)
+
+	st, err := testStreamConnection(addr, "u1").Subscribe(context.Background(), "q1",
+		cluster.StreamSubscribeRequest{Subscriber: "s1", Credit: 3, CntLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	received := make([]int64, 0)
+	for len(received) < 3 {
+		messages, _, err := st.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(messages) > 2 {
+			t.Errorf("Stream frame should contain not more then CntLimit messages not %v", len(messages))
+		}
+		for _, m := range messages {
+			received = append(received, m.ID)
+		}
+	}
+	if len(received) != 3 {
+		t.Fatalf("Stream should send not more then credit messages: %v", received)
+	}
+
+	next := make(chan []*queue.MessageWithMeta, 1)
+	go func() {
+		messages, _, err := st.Next()
+		if err != nil {
+			t.Error(err)
+		}
+		next <- messages
+	}()
+
+	select {
+	case messages := <-next:
+		t.Fatalf("Stream should not send messages when credit is exhausted: %v", len(messages))
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if err := st.Ack(0, 2, cn.SaveMarkSaveMode); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case messages := <-next:
+		for _, m := range messages {
+			received = append(received, m.ID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Stream should send messages after ack with credit")
+	}
+
+	for i, id := range received {
+		if id != ids[i] {
+			t.Fatalf("Stream should send messages in order: %v", received)
+		}
+	}
+	if len(received) != 5 {
+		t.Errorf("Stream should send 5 messages not %v", len(received))
+	}
+}
+
+func TestStream_Ack(t *testing.T) {
+	_, q, ids, addr := testStreamServer(t)
+
+	st, err := testStreamConnection(addr, "u1").Subscribe(context.Background(), "q1",
+		cluster.StreamSubscribeRequest{Subscriber: "s1", Credit: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	for st.LastId() < ids[4] {
+		if _, _, err := st.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lastRead := func() int64 {
+		id, err := q.SubscriberGetLastRead(context.Background(), nil, "s1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	if err := st.Ack(ids[3], 0, cn.SaveMarkSaveMode); err != nil {
+		t.Fatal(err)
+	}
+	if lastRead() != ids[3] {
+		t.Errorf("Stream.Ack should set last read id %v not %v", ids[3], lastRead())
+	}
+
+	// late ack does not move last read id back
+	if err := st.Ack(ids[1], 0, cn.SaveMarkSaveMode); err != nil {
+		t.Fatal(err)
+	}
+	if lastRead() != ids[3] {
+		t.Errorf("Stream.Ack with less id should not change last read id %v", lastRead())
+	}
+
+	// not sent id
+	err = st.Ack(ids[7], 0, cn.SaveMarkSaveMode)
+	if err == nil || err.InternalError == nil || err.InternalError.Code != 10192104 {
+		t.Errorf("Stream.Ack of not sent id should fail with 10192104 not %v", err)
+	}
+	if lastRead() != ids[3] {
+		t.Errorf("Stream.Ack of not sent id should not change last read id %v", lastRead())
+	}
+}
+
+func TestStream_AckOwner(t *testing.T) {
+	_, q, ids, addr := testStreamServer(t)
+
+	st1, err := testStreamConnection(addr, "u1").Subscribe(context.Background(), "q1",
+		cluster.StreamSubscribeRequest{Subscriber: "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st1.Close()
+	for st1.LastId() < ids[9] {
+		if _, _, err := st1.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	st2, err := testStreamConnection(addr, "u2").Subscribe(context.Background(), "q1",
+		cluster.StreamSubscribeRequest{Subscriber: "s2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st2.Close()
+
+	// ack of stream of other user
+	id2 := st2.ID
+	st2.ID = st1.ID
+	err = st2.Ack(ids[5], 0, cn.SaveMarkSaveMode)
+	st2.ID = id2
+	if err == nil || err.InternalError == nil || err.InternalError.Code != 10192105 {
+		t.Errorf("Stream.Ack of stream of other user should fail with 10192105 not %v", err)
+	}
+	if lastRead, _ := q.SubscriberGetLastRead(context.Background(), nil, "s1"); lastRead != 0 {
+		t.Errorf("Stream.Ack of other user should not set last read id %v", lastRead)
+	}
+
+	// ack without authentication
+	for _, tt := range []struct {
+		body   interface{}
+		status int
+	}{
+		{cluster.StreamAckRequest{Stream: st1.ID, Id: ids[5]}, http.StatusBadRequest},
+		{cluster.ServiceRequest{
+			UserName:     "u3",
+			WaitDuration: time.Second * 5,
+			CurrentTime:  time.Now().UnixNano(),
+			Request:      cluster.MarshalRequestMust(nil, cluster.StreamAckAction, cluster.StreamAckRequest{Stream: st1.ID, Id: ids[5]}),
+		}, http.StatusUnauthorized},
+	} {
+		b, er0 := json.Marshal(tt.body)
+		if er0 != nil {
+			t.Fatal(er0)
+		}
+		resp, er0 := http.Post(addr+cap.StreamAckPath, "application/json", bytes.NewReader(b))
+		if er0 != nil {
+			t.Fatal(er0)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("ack without authentication should fail with %v not %v", tt.status, resp.StatusCode)
+		}
+	}
+	if lastRead, _ := q.SubscriberGetLastRead(context.Background(), nil, "s1"); lastRead != 0 {
+		t.Errorf("ack without authentication should not set last read id %v", lastRead)
+	}
+}
+
+func TestStream_Disconnect(t *testing.T) {
+	heartbeat := StreamHeartbeat
+	StreamHeartbeat = 20 * time.Millisecond
+	defer func() { StreamHeartbeat = heartbeat }()
+
+	ss, _, _, addr := testStreamServer(t)
+	cc := testStreamConnection(addr, "u1")
+
+	// closed by ack
+	st, err := cc.Subscribe(context.Background(), "q1", cluster.StreamSubscribeRequest{Subscriber: "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ss.sessionsCnt() != 1 {
+		t.Fatalf("stream session should be registered")
+	}
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+	testWaitSessions(t, ss)
+
+	// connection is closed without ack
+	st, err = cc.Subscribe(context.Background(), "q1", cluster.StreamSubscribeRequest{Subscriber: "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.ID = ""
+	st.Close()
+	testWaitSessions(t, ss)
+}
+
+func testWaitSessions(t *testing.T, ss *streamServer) {
+	deadline := time.Now().Add(5 * time.Second)
+	for ss.sessionsCnt() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("stream session should be removed after disconnect")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,41 @@
+package kafka
+
+import (
+	"fmt"
+
+	"github.com/myfantasy/mft"
+)
+
+// Errors codes and description
+var Errors map[int]string = map[int]string{
+	10193000: "Gateway.ListenAndServe: listen `%v` fail",
+	10193001: "Gateway.Serve: accept fail",
+	10193002: "Gateway: request size %v is not correct",
+	10193003: "Gateway: api key %v version %v is not supported",
+	10193004: "Gateway: request of api key %v version %v is broken",
+	10193005: "Gateway: api key %v is not allowed before authentication",
+	10193006: "Gateway: sasl authentication of user `%v` fail",
+	10193007: "Gateway: sasl plain token is not correct",
+	10193008: "Gateway: write responce fail",
+
+	10193100: "decodeRecordBatches: record batch is broken at %v",
+	10193101: "decodeRecordBatches: magic %v is not supported",
+	10193102: "decodeRecordBatches: crc check fail",
+	10193103: "decodeRecordBatches: compression %v is not supported",
+}
+
+// GenerateError -
+func GenerateError(key int, a ...interface{}) *mft.Error {
+	if text, ok := Errors[key]; ok {
+		return mft.ErrorCS(key, fmt.Sprintf(text, a...))
+	}
+	panic(fmt.Sprintf("kafka.GenerateError, error not found code:%v", key))
+}
+
+// GenerateErrorE -
+func GenerateErrorE(key int, err error, a ...interface{}) *mft.Error {
+	if text, ok := Errors[key]; ok {
+		return mft.ErrorCSE(key, fmt.Sprintf(text, a...), err)
+	}
+	panic(fmt.Sprintf("kafka.GenerateErrorE, error not found code:%v error:%v", key, err))
+}
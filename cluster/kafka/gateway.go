@@ -0,0 +1,1081 @@
+package kafka
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/capella-pw/queue/cluster"
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/queue"
+	"github.com/myfantasy/mft"
+)
+
+var (
+	// FetchCntLimitDefault - max count of messages of partition in fetch responce when Gateway.FetchCntLimit is not set
+	FetchCntLimitDefault = 1000
+	// FetchScanLimitDefault - max count of messages checked for one partition of fetch when Gateway.FetchScanLimit is not set
+	FetchScanLimitDefault = 10000
+	// CallTimeoutDefault - timeout of cluster calls when Gateway.CallTimeout is not set
+	CallTimeoutDefault = time.Second * 30
+	// MaxRequestSizeDefault - max size of request when Gateway.MaxRequestSize is not set
+	MaxRequestSizeDefault int32 = 100 * 1024 * 1024
+	// FetchPollInterval - interval of checking of queues that do not implement queue.AppendNotifier
+	FetchPollInterval = time.Millisecond * 100
+)
+
+const (
+	// SaslMechanismPlain - the only supported sasl mechanism
+	SaslMechanismPlain = "PLAIN"
+
+	offsetLatest   = -1
+	offsetEarliest = -2
+)
+
+// Gateway - listener that speaks subset of kafka wire protocol
+// (ApiVersions, Metadata, Produce, Fetch, ListOffsets, OffsetCommit, OffsetFetch, FindCoordinator and SASL PLAIN)
+//
+//	topic          - queue
+//	partition      - segment of message (0 when Partitions == 1)
+//	offset         - id of message
+//	consumer group - subscriber of queue (see SubscriberName)
+//
+// consumer group membership (JoinGroup, SyncGroup, Heartbeat) is not supported:
+// consumers should assign partitions and commit offsets; producers should set enable.idempotence=false
+type Gateway struct {
+	Cluster cluster.Cluster
+	// CheckAuth - clients should authenticate with SASL PLAIN; when is not set all connections are rejected
+	CheckAuth cluster.CheckAuthFunc
+
+	// Partitions - count of partitions of each topic
+	Partitions int
+	// NodeID, Host, Port - advertised broker
+	NodeID int32
+	Host   string
+	Port   int32
+
+	FetchCntLimit int
+	// FetchScanLimit - max count of messages checked for one partition of fetch (Partitions > 1);
+	// fetch without messages of partition returns empty record batch to move consumer offset after checked messages
+	FetchScanLimit int
+	CallTimeout    time.Duration
+	MaxRequestSize int32
+
+	ThrowErrorFunc func(err *mft.Error) bool
+
+	mx     sync.Mutex
+	ln     net.Listener
+	conns  map[net.Conn]struct{}
+	closed bool
+}
+
+// GatewayCreate - gateway of cluster advertised as host:port
+func GatewayCreate(cl cluster.Cluster, checkAuth cluster.CheckAuthFunc,
+	partitions int, host string, port int32) *Gateway {
+	if partitions <= 0 {
+		partitions = 1
+	}
+	return &Gateway{
+		Cluster:    cl,
+		CheckAuth:  checkAuth,
+		Partitions: partitions,
+		Host:       host,
+		Port:       port,
+	}
+}
+
+// SubscriberName - subscriber of queue that stores offset of consumer group
+func (g *Gateway) SubscriberName(group string, partition int32) string {
+	if g.Partitions <= 1 {
+		return group
+	}
+	return group + "-" + strconv.Itoa(int(partition))
+}
+
+// ListenAndServe - listen tcp addr and serve connections until Close
+func (g *Gateway) ListenAndServe(addr string) (err *mft.Error) {
+	ln, er0 := net.Listen("tcp", addr)
+	if er0 != nil {
+		return GenerateErrorE(10193000, er0, addr)
+	}
+	return g.Serve(ln)
+}
+
+// Serve - serve connections of listener until Close
+func (g *Gateway) Serve(ln net.Listener) (err *mft.Error) {
+	g.mx.Lock()
+	if g.closed {
+		g.mx.Unlock()
+		ln.Close()
+		return nil
+	}
+	g.ln = ln
+	if g.conns == nil {
+		g.conns = make(map[net.Conn]struct{})
+	}
+	g.mx.Unlock()
+
+	for {
+		conn, er0 := ln.Accept()
+		if er0 != nil {
+			g.mx.Lock()
+			closed := g.closed
+			g.mx.Unlock()
+			if closed {
+				return nil
+			}
+			return GenerateErrorE(10193001, er0)
+		}
+
+		g.mx.Lock()
+		if g.closed {
+			g.mx.Unlock()
+			conn.Close()
+			return nil
+		}
+		g.conns[conn] = struct{}{}
+		g.mx.Unlock()
+
+		go g.serveConn(conn)
+	}
+}
+
+// Close - stop listener and close connections
+func (g *Gateway) Close() {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+
+	g.closed = true
+	if g.ln != nil {
+		g.ln.Close()
+	}
+	for conn := range g.conns {
+		conn.Close()
+	}
+}
+
+func (g *Gateway) throwError(err *mft.Error) {
+	if g.ThrowErrorFunc != nil {
+		g.ThrowErrorFunc(err)
+	}
+}
+
+func (g *Gateway) callTimeout() time.Duration {
+	if g.CallTimeout > 0 {
+		return g.CallTimeout
+	}
+	return CallTimeoutDefault
+}
+
+func (g *Gateway) fetchCntLimit() int {
+	if g.FetchCntLimit > 0 {
+		return g.FetchCntLimit
+	}
+	return FetchCntLimitDefault
+}
+
+func (g *Gateway) fetchScanLimit() int {
+	if g.FetchScanLimit > 0 {
+		return g.FetchScanLimit
+	}
+	return FetchScanLimitDefault
+}
+
+func (g *Gateway) partitions() int32 {
+	if g.Partitions <= 0 {
+		return 1
+	}
+	return int32(g.Partitions)
+}
+
+// gatewayConn - state of client connection
+type gatewayConn struct {
+	g    *Gateway
+	conn net.Conn
+
+	user          cn.CapUser
+	authenticated bool
+	handshake     bool
+	closeAfter    bool
+}
+
+func (g *Gateway) serveConn(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		g.mx.Lock()
+		delete(g.conns, conn)
+		g.mx.Unlock()
+	}()
+
+	c := &gatewayConn{
+		g:    g,
+		conn: conn,
+	}
+
+	maxSize := g.MaxRequestSize
+	if maxSize <= 0 {
+		maxSize = MaxRequestSizeDefault
+	}
+
+	br := bufio.NewReader(conn)
+	var sizeBuf [4]byte
+	for {
+		if _, er0 := io.ReadFull(br, sizeBuf[:]); er0 != nil {
+			return
+		}
+		size := int32(binary.BigEndian.Uint32(sizeBuf[:]))
+		if size < 8 || size > maxSize {
+			g.throwError(GenerateError(10193002, size))
+			return
+		}
+		// body is not reused: produced messages refer to it
+		body := make([]byte, size)
+		if _, er0 := io.ReadFull(br, body); er0 != nil {
+			return
+		}
+
+		resp, ok := c.handle(body)
+		if !ok {
+			return
+		}
+		if resp != nil {
+			out := make([]byte, 4, 4+len(resp))
+			binary.BigEndian.PutUint32(out, uint32(len(resp)))
+			out = append(out, resp...)
+			if _, er0 := conn.Write(out); er0 != nil {
+				g.throwError(GenerateErrorE(10193008, er0))
+				return
+			}
+		}
+		if c.closeAfter {
+			return
+		}
+	}
+}
+
+// handle - responce of request (nil when responce is not needed); ok == false - connection should be closed
+func (c *gatewayConn) handle(body []byte) (resp []byte, ok bool) {
+	r := &reader{body: body}
+	apiKey := r.int16()
+	apiVersion := r.int16()
+	correlationID := r.int32()
+	r.nullableString() // client_id
+	if r.broken {
+		c.g.throwError(GenerateError(10193004, apiKey, apiVersion))
+		return nil, false
+	}
+
+	w := &writer{}
+	w.int32(correlationID)
+
+	if apiKey == ApiKeyApiVersions {
+		c.apiVersions(w, apiVersion)
+		return w.buf, true
+	}
+
+	if !isSupported(apiKey, apiVersion) {
+		c.g.throwError(GenerateError(10193003, apiKey, apiVersion))
+		return nil, false
+	}
+
+	if !c.authenticated && apiKey != ApiKeySaslHandshake && apiKey != ApiKeySaslAuthenticate {
+		c.g.throwError(GenerateError(10193005, apiKey))
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.g.callTimeout())
+	defer cancel()
+
+	noResponce := false
+	switch apiKey {
+	case ApiKeyMetadata:
+		c.metadata(ctx, r, w, apiVersion)
+	case ApiKeyProduce:
+		noResponce = c.produce(ctx, r, w, apiVersion)
+	case ApiKeyFetch:
+		c.fetch(ctx, r, w, apiVersion)
+	case ApiKeyListOffsets:
+		c.listOffsets(ctx, r, w, apiVersion)
+	case ApiKeyOffsetCommit:
+		c.offsetCommit(ctx, r, w, apiVersion)
+	case ApiKeyOffsetFetch:
+		c.offsetFetch(ctx, r, w, apiVersion)
+	case ApiKeyFindCoordinator:
+		c.findCoordinator(r, w, apiVersion)
+	case ApiKeySaslHandshake:
+		c.saslHandshake(r, w)
+	case ApiKeySaslAuthenticate:
+		c.saslAuthenticate(ctx, r, w, apiVersion)
+	}
+
+	if r.broken {
+		c.g.throwError(GenerateError(10193004, apiKey, apiVersion))
+		return nil, false
+	}
+	if noResponce {
+		return nil, true
+	}
+
+	return w.buf, true
+}
+
+// errorCode - kafka error code of cluster error
+func errorCode(err *mft.Error) int16 {
+	if cluster.IsPermissionDenied(err) {
+		return ErrTopicAuthorizationFailed
+	}
+	return ErrUnknownServerError
+}
+
+// topicQueue - queue of topic and kafka error code when queue is not available
+func (c *gatewayConn) topicQueue(ctx context.Context, cache map[string]queue.Queue, name string) (q queue.Queue, code int16) {
+	if q, ok := cache[name]; ok {
+		return q, ErrNone
+	}
+
+	q, exists, err := c.g.Cluster.GetQueue(ctx, c.user, name)
+	if err != nil {
+		c.g.throwError(err)
+		return nil, errorCode(err)
+	}
+	if !exists {
+		return nil, ErrUnknownTopicOrPartition
+	}
+
+	cache[name] = q
+	return q, ErrNone
+}
+
+func (c *gatewayConn) validPartition(partition int32) bool {
+	return partition >= 0 && partition < c.g.partitions()
+}
+
+func (c *gatewayConn) apiVersions(w *writer, version int16) {
+	// unsupported version is answered with v0 responce (client retries with supported version)
+	if !isSupported(ApiKeyApiVersions, version) {
+		w.int16(ErrUnsupportedVersion)
+		version = 0
+	} else {
+		w.int16(ErrNone)
+	}
+
+	w.arrayLen(len(SupportedApiVersions))
+	for _, v := range SupportedApiVersions {
+		w.int16(v.Key)
+		w.int16(v.Min)
+		w.int16(v.Max)
+	}
+	if version >= 1 {
+		w.int32(0) // throttle_time_ms
+	}
+}
+
+func (c *gatewayConn) metadata(ctx context.Context, r *reader, w *writer, version int16) {
+	var names []string
+	all := false
+
+	n := r.int32()
+	if n < 0 || (n == 0 && version == 0) {
+		all = true
+	} else {
+		for i := int32(0); i < n && !r.broken; i++ {
+			names = append(names, r.string())
+		}
+	}
+	if version >= 4 {
+		r.bool() // allow_auto_topic_creation
+	}
+	if r.broken {
+		return
+	}
+
+	if all {
+		var err *mft.Error
+		names, err = c.g.Cluster.GetQueuesList(ctx, c.user)
+		if err != nil {
+			c.g.throwError(err)
+			names = nil
+		}
+	}
+
+	if version >= 3 {
+		w.int32(0) // throttle_time_ms
+	}
+
+	w.arrayLen(1)
+	w.int32(c.g.NodeID)
+	w.string(c.g.Host)
+	w.int32(c.g.Port)
+	if version >= 1 {
+		w.nullableString(nil) // rack
+	}
+	if version >= 2 {
+		w.nullableString(nil) // cluster_id
+	}
+	if version >= 1 {
+		w.int32(c.g.NodeID) // controller_id
+	}
+
+	cache := make(map[string]queue.Queue)
+	w.arrayLen(len(names))
+	for _, name := range names {
+		_, code := c.topicQueue(ctx, cache, name)
+		w.int16(code)
+		w.string(name)
+		if version >= 1 {
+			w.bool(false) // is_internal
+		}
+		if code != ErrNone {
+			w.arrayLen(0)
+			continue
+		}
+
+		w.arrayLen(int(c.g.partitions()))
+		for p := int32(0); p < c.g.partitions(); p++ {
+			w.int16(ErrNone)
+			w.int32(p)
+			w.int32(c.g.NodeID) // leader_id
+			if version >= 7 {
+				w.int32(0) // leader_epoch
+			}
+			w.arrayLen(1)
+			w.int32(c.g.NodeID) // replica_nodes
+			w.arrayLen(1)
+			w.int32(c.g.NodeID) // isr_nodes
+			if version >= 5 {
+				w.arrayLen(0) // offline_replicas
+			}
+		}
+	}
+}
+
+// produce - returns noResponce == true when acks == 0
+func (c *gatewayConn) produce(ctx context.Context, r *reader, w *writer, version int16) (noResponce bool) {
+	r.nullableString() // transactional_id
+	acks := r.int16()
+	r.int32() // timeout_ms
+
+	saveMode := cn.SaveMarkSaveMode
+	if acks == -1 {
+		saveMode = cn.SaveWaitSaveMode
+	}
+
+	cache := make(map[string]queue.Queue)
+
+	topicCnt := r.arrayLen()
+	w.arrayLen(topicCnt)
+	for i := 0; i < topicCnt && !r.broken; i++ {
+		name := r.string()
+		w.string(name)
+
+		partitionCnt := r.arrayLen()
+		w.arrayLen(partitionCnt)
+		for j := 0; j < partitionCnt && !r.broken; j++ {
+			partition := r.int32()
+			records := r.bytes()
+
+			baseOffset, code := c.produceRecords(ctx, cache, name, partition, records, saveMode)
+
+			w.int32(partition)
+			w.int16(code)
+			w.int64(baseOffset)
+			w.int64(-1) // log_append_time_ms
+			if version >= 5 {
+				w.int64(0) // log_start_offset
+			}
+		}
+	}
+	w.int32(0) // throttle_time_ms
+
+	return acks == 0
+}
+
+func (c *gatewayConn) produceRecords(ctx context.Context, cache map[string]queue.Queue,
+	name string, partition int32, records []byte, saveMode cn.SaveMode) (baseOffset int64, code int16) {
+
+	if !c.validPartition(partition) {
+		return -1, ErrUnknownTopicOrPartition
+	}
+	q, code := c.topicQueue(ctx, cache, name)
+	if code != ErrNone {
+		return -1, code
+	}
+
+	produced, code, err := decodeRecordBatches(records)
+	if err != nil {
+		c.g.throwError(err)
+		return -1, code
+	}
+	if len(produced) == 0 {
+		return -1, ErrNone
+	}
+
+	messages := make([]queue.Message, len(produced))
+	for i, record := range produced {
+		messages[i] = queue.Message{
+			Message: record.Value,
+			Source:  string(record.Key),
+			Segment: int64(partition),
+		}
+		if record.Timestamp > 0 {
+			messages[i].ExternalDt = record.Timestamp / 1000
+		}
+	}
+
+	ids, err := q.AddList(ctx, c.user, messages, saveMode)
+	if err != nil {
+		c.g.throwError(err)
+		return -1, errorCode(err)
+	}
+	if len(ids) == 0 {
+		return -1, ErrNone
+	}
+
+	return ids[0], ErrNone
+}
+
+// get - messages of partition with id > idStart; lastId - id of last checked message
+// messages are filtered by segment here (segment.Segments.In fails on keys after last segment);
+// queue is read until any message of partition is found or scanLimit messages are checked
+func (c *gatewayConn) get(ctx context.Context, q queue.Queue, partition int32, idStart int64, cnt int, scanLimit int,
+) (messages []*queue.MessageWithMeta, lastId int64, err *mft.Error) {
+	lastId = idStart
+	scanned := 0
+	for {
+		got, err := q.Get(ctx, c.user, lastId, cnt)
+		if err != nil {
+			return nil, lastId, err
+		}
+		if len(got) == 0 {
+			return messages, lastId, nil
+		}
+		lastId = got[len(got)-1].ID
+
+		if c.g.partitions() == 1 {
+			return got, lastId, nil
+		}
+		for _, msg := range got {
+			if msg.Segment == int64(partition) {
+				messages = append(messages, msg)
+			}
+		}
+		scanned += len(got)
+		if len(messages) > 0 || scanned >= scanLimit {
+			return messages, lastId, nil
+		}
+	}
+}
+
+type fetchPartition struct {
+	partition int32
+	offset    int64
+	maxBytes  int32
+
+	code    int16
+	hw      int64
+	records []byte
+}
+
+type fetchTopic struct {
+	name       string
+	partitions []*fetchPartition
+}
+
+func (c *gatewayConn) fetch(ctx context.Context, r *reader, w *writer, version int16) {
+	r.int32() // replica_id
+	maxWait := r.int32()
+	r.int32() // min_bytes
+	maxBytes := r.int32()
+	r.int8() // isolation_level
+	if version >= 7 {
+		r.int32() // session_id
+		r.int32() // session_epoch
+	}
+
+	var topics []*fetchTopic
+	topicCnt := r.arrayLen()
+	for i := 0; i < topicCnt && !r.broken; i++ {
+		t := &fetchTopic{name: r.string()}
+		partitionCnt := r.arrayLen()
+		for j := 0; j < partitionCnt && !r.broken; j++ {
+			p := &fetchPartition{partition: r.int32()}
+			if version >= 9 {
+				r.int32() // current_leader_epoch
+			}
+			p.offset = r.int64()
+			if version >= 5 {
+				r.int64() // log_start_offset
+			}
+			p.maxBytes = r.int32()
+			t.partitions = append(t.partitions, p)
+		}
+		topics = append(topics, t)
+	}
+	if version >= 7 {
+		forgottenCnt := r.arrayLen()
+		for i := 0; i < forgottenCnt && !r.broken; i++ {
+			r.string()
+			n := r.arrayLen()
+			for j := 0; j < n && !r.broken; j++ {
+				r.int32()
+			}
+		}
+	}
+	if version >= 11 {
+		r.string() // rack_id
+	}
+	if r.broken {
+		return
+	}
+
+	cache := make(map[string]queue.Queue)
+	deadline := time.Now().Add(time.Duration(maxWait) * time.Millisecond)
+	for {
+		// notify channels are got before read to not miss append between read and wait
+		var notify []<-chan struct{}
+		for _, t := range topics {
+			q, code := c.topicQueue(ctx, cache, t.name)
+			if code != ErrNone {
+				continue
+			}
+			if notifier, ok := q.(queue.AppendNotifier); ok {
+				notify = append(notify, notifier.AppendNotify())
+			}
+		}
+
+		if c.fetchRead(ctx, cache, topics, maxBytes) {
+			break
+		}
+
+		wait := time.Until(deadline)
+		if wait <= 0 || ctx.Err() != nil {
+			break
+		}
+		waitAny(ctx, notify, wait)
+	}
+
+	w.int32(0) // throttle_time_ms
+	if version >= 7 {
+		w.int16(ErrNone)
+		w.int32(0) // session_id
+	}
+	w.arrayLen(len(topics))
+	for _, t := range topics {
+		w.string(t.name)
+		w.arrayLen(len(t.partitions))
+		for _, p := range t.partitions {
+			w.int32(p.partition)
+			w.int16(p.code)
+			w.int64(p.hw)
+			w.int64(p.hw) // last_stable_offset
+			if version >= 5 {
+				w.int64(0) // log_start_offset
+			}
+			w.arrayLen(-1) // aborted_transactions
+			if version >= 11 {
+				w.int32(-1) // preferred_read_replica
+			}
+			w.bytes(p.records)
+		}
+	}
+}
+
+// fetchRead - read messages of all partitions; returns true when any records are read or any partition has error
+func (c *gatewayConn) fetchRead(ctx context.Context, cache map[string]queue.Queue, topics []*fetchTopic, maxBytes int32) (done bool) {
+	budget := int(maxBytes)
+	for _, t := range topics {
+		for _, p := range t.partitions {
+			p.records = nil
+			p.hw = p.offset
+
+			if !c.validPartition(p.partition) {
+				p.code = ErrUnknownTopicOrPartition
+				done = true
+				continue
+			}
+			q, code := c.topicQueue(ctx, cache, t.name)
+			if code != ErrNone {
+				p.code = code
+				done = true
+				continue
+			}
+
+			idStart := p.offset - 1
+			if idStart < 0 {
+				idStart = 0
+			}
+			messages, lastId, err := c.get(ctx, q, p.partition, idStart, c.g.fetchCntLimit(), c.g.fetchScanLimit())
+			if err != nil {
+				c.g.throwError(err)
+				p.code = errorCode(err)
+				done = true
+				continue
+			}
+			p.code = ErrNone
+
+			// at least one message is returned to not block consumer with small limits
+			size := 0
+			for i, msg := range messages {
+				size += len(msg.Message) + len(msg.Source) + 32
+				if i > 0 && (size > int(p.maxBytes) || size > budget) {
+					messages = messages[:i]
+					lastId = messages[i-1].ID
+					break
+				}
+			}
+			budget -= size
+
+			if lastId+1 > p.hw {
+				p.hw = lastId + 1
+			}
+			if len(messages) > 0 {
+				p.records = encodeRecordBatches(messages)
+				done = true
+			} else if lastId > idStart {
+				// checked messages are of other partitions; consumer continues after them
+				p.records = encodeEmptyRecordBatch(lastId)
+				done = true
+			}
+		}
+	}
+	return done
+}
+
+// waitAny - wait any of channels or timeout
+func waitAny(ctx context.Context, chs []<-chan struct{}, timeout time.Duration) {
+	if len(chs) == 0 && timeout > FetchPollInterval {
+		timeout = FetchPollInterval
+	}
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	signal := make(chan struct{}, 1)
+	for _, ch := range chs {
+		go func(ch <-chan struct{}) {
+			select {
+			case <-ch:
+				select {
+				case signal <- struct{}{}:
+				default:
+				}
+			case <-stop:
+			}
+		}(ch)
+	}
+
+	select {
+	case <-signal:
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+func (c *gatewayConn) listOffsets(ctx context.Context, r *reader, w *writer, version int16) {
+	r.int32() // replica_id
+	if version >= 2 {
+		r.int8() // isolation_level
+	}
+	if version >= 2 {
+		w.int32(0) // throttle_time_ms
+	}
+
+	cache := make(map[string]queue.Queue)
+
+	topicCnt := r.arrayLen()
+	w.arrayLen(topicCnt)
+	for i := 0; i < topicCnt && !r.broken; i++ {
+		name := r.string()
+		w.string(name)
+
+		partitionCnt := r.arrayLen()
+		w.arrayLen(partitionCnt)
+		for j := 0; j < partitionCnt && !r.broken; j++ {
+			partition := r.int32()
+			if version >= 4 {
+				r.int32() // current_leader_epoch
+			}
+			timestamp := r.int64()
+
+			ts, offset, code := c.offsetOf(ctx, cache, name, partition, timestamp)
+
+			w.int32(partition)
+			w.int16(code)
+			w.int64(ts)
+			w.int64(offset)
+			if version >= 4 {
+				w.int32(0) // leader_epoch
+			}
+		}
+	}
+}
+
+// offsetOf - offset of partition by timestamp (offsetLatest, offsetEarliest or unix ms)
+func (c *gatewayConn) offsetOf(ctx context.Context, cache map[string]queue.Queue,
+	name string, partition int32, timestamp int64) (ts int64, offset int64, code int16) {
+
+	if !c.validPartition(partition) {
+		return -1, -1, ErrUnknownTopicOrPartition
+	}
+	q, code := c.topicQueue(ctx, cache, name)
+	if code != ErrNone {
+		return -1, -1, code
+	}
+
+	switch {
+	case timestamp == offsetEarliest:
+		messages, lastId, err := c.get(ctx, q, partition, 0, c.g.fetchCntLimit(), c.g.fetchScanLimit())
+		if err != nil {
+			c.g.throwError(err)
+			return -1, -1, errorCode(err)
+		}
+		if len(messages) > 0 {
+			return -1, messages[0].ID, ErrNone
+		}
+		if lastId > 0 {
+			// checked messages are of other partitions
+			return -1, lastId + 1, ErrNone
+		}
+	case timestamp >= 0:
+		messages, err := q.GetFromTime(ctx, c.user, time.Unix(0, timestamp*int64(time.Millisecond)), c.g.fetchCntLimit())
+		if err != nil {
+			c.g.throwError(err)
+			return -1, -1, errorCode(err)
+		}
+		for _, msg := range messages {
+			if c.g.partitions() == 1 || msg.Segment == int64(partition) {
+				return timestampOf(msg), msg.ID, ErrNone
+			}
+		}
+	}
+
+	// latest: next id is more then ids of all messages of cluster
+	offset, err := c.g.Cluster.GetNextId(ctx, c.user)
+	if err != nil {
+		c.g.throwError(err)
+		return -1, -1, errorCode(err)
+	}
+	return -1, offset, ErrNone
+}
+
+func (c *gatewayConn) offsetCommit(ctx context.Context, r *reader, w *writer, version int16) {
+	group := r.string()
+	r.int32()  // generation_id
+	r.string() // member_id
+	if version >= 7 {
+		r.nullableString() // group_instance_id
+	}
+	if version <= 4 {
+		r.int64() // retention_time_ms
+	}
+	if version >= 3 {
+		w.int32(0) // throttle_time_ms
+	}
+
+	cache := make(map[string]queue.Queue)
+
+	topicCnt := r.arrayLen()
+	w.arrayLen(topicCnt)
+	for i := 0; i < topicCnt && !r.broken; i++ {
+		name := r.string()
+		w.string(name)
+
+		partitionCnt := r.arrayLen()
+		w.arrayLen(partitionCnt)
+		for j := 0; j < partitionCnt && !r.broken; j++ {
+			partition := r.int32()
+			offset := r.int64()
+			if version >= 6 {
+				r.int32() // committed_leader_epoch
+			}
+			r.nullableString() // committed_metadata
+
+			w.int32(partition)
+			w.int16(c.commit(ctx, cache, group, name, partition, offset))
+		}
+	}
+}
+
+// commit - committed offset is next offset to read so last read id of subscriber is offset - 1
+func (c *gatewayConn) commit(ctx context.Context, cache map[string]queue.Queue,
+	group string, name string, partition int32, offset int64) (code int16) {
+
+	if !c.validPartition(partition) {
+		return ErrUnknownTopicOrPartition
+	}
+	q, code := c.topicQueue(ctx, cache, name)
+	if code != ErrNone {
+		return code
+	}
+
+	lastRead := offset - 1
+	if lastRead < 0 {
+		lastRead = 0
+	}
+	err := q.SubscriberSetLastRead(ctx, c.user, c.g.SubscriberName(group, partition), lastRead, cn.SaveMarkSaveMode)
+	if err != nil {
+		c.g.throwError(err)
+		return errorCode(err)
+	}
+
+	return ErrNone
+}
+
+func (c *gatewayConn) offsetFetch(ctx context.Context, r *reader, w *writer, version int16) {
+	group := r.string()
+	if version >= 3 {
+		w.int32(0) // throttle_time_ms
+	}
+
+	cache := make(map[string]queue.Queue)
+
+	// null topics (all topics of group) can not be listed: subscribers are not linked to groups
+	topicCnt := r.int32()
+	if topicCnt < 0 {
+		topicCnt = 0
+	}
+	w.arrayLen(int(topicCnt))
+	for i := int32(0); i < topicCnt && !r.broken; i++ {
+		name := r.string()
+		w.string(name)
+
+		partitionCnt := r.arrayLen()
+		w.arrayLen(partitionCnt)
+		for j := 0; j < partitionCnt && !r.broken; j++ {
+			partition := r.int32()
+			offset, code := c.committed(ctx, cache, group, name, partition)
+
+			w.int32(partition)
+			w.int64(offset)
+			if version >= 5 {
+				w.int32(-1) // committed_leader_epoch
+			}
+			empty := ""
+			w.nullableString(&empty) // metadata
+			w.int16(code)
+		}
+	}
+	if version >= 2 {
+		w.int16(ErrNone)
+	}
+}
+
+// committed - committed offset of group (-1 when there is no offset)
+func (c *gatewayConn) committed(ctx context.Context, cache map[string]queue.Queue,
+	group string, name string, partition int32) (offset int64, code int16) {
+
+	if !c.validPartition(partition) {
+		return -1, ErrUnknownTopicOrPartition
+	}
+	q, code := c.topicQueue(ctx, cache, name)
+	if code != ErrNone {
+		return -1, code
+	}
+
+	lastRead, err := q.SubscriberGetLastRead(ctx, c.user, c.g.SubscriberName(group, partition))
+	if err != nil {
+		c.g.throwError(err)
+		return -1, errorCode(err)
+	}
+	if lastRead <= 0 {
+		return -1, ErrNone
+	}
+
+	return lastRead + 1, ErrNone
+}
+
+func (c *gatewayConn) findCoordinator(r *reader, w *writer, version int16) {
+	r.string() // key
+	if version >= 1 {
+		r.int8()   // key_type
+		w.int32(0) // throttle_time_ms
+	}
+	w.int16(ErrNone)
+	if version >= 1 {
+		w.nullableString(nil) // error_message
+	}
+	w.int32(c.g.NodeID)
+	w.string(c.g.Host)
+	w.int32(c.g.Port)
+}
+
+func (c *gatewayConn) saslHandshake(r *reader, w *writer) {
+	mechanism := r.string()
+	if mechanism == SaslMechanismPlain && c.g.CheckAuth != nil {
+		c.handshake = true
+		w.int16(ErrNone)
+	} else {
+		w.int16(ErrUnsupportedSaslMechanism)
+	}
+	w.arrayLen(1)
+	w.string(SaslMechanismPlain)
+}
+
+// saslAuthenticate - PLAIN token is `authzid \0 authcid \0 password`;
+// authzid is user of requests (impersonation is checked by CheckAuth)
+// connection is closed after fail
+func (c *gatewayConn) saslAuthenticate(ctx context.Context, r *reader, w *writer, version int16) {
+	token := r.bytes()
+	if r.broken {
+		return
+	}
+
+	code, err := c.authenticate(ctx, token)
+	w.int16(code)
+	if err != nil {
+		c.g.throwError(err)
+		msg := err.Error()
+		w.nullableString(&msg)
+		c.closeAfter = true
+	} else {
+		w.nullableString(nil)
+	}
+	w.bytes([]byte{}) // auth_bytes
+	if version >= 1 {
+		w.int64(0) // session_lifetime_ms
+	}
+}
+
+func (c *gatewayConn) authenticate(ctx context.Context, token []byte) (code int16, err *mft.Error) {
+	if !c.handshake || c.authenticated {
+		return ErrIllegalSaslState, GenerateError(10193006, "")
+	}
+
+	parts := bytes.Split(token, []byte{0})
+	if len(parts) != 3 {
+		return ErrSaslAuthenticationFailed, GenerateError(10193007)
+	}
+
+	pwd, er0 := json.Marshal(string(parts[2]))
+	if er0 != nil {
+		return ErrSaslAuthenticationFailed, GenerateErrorE(10193007, er0)
+	}
+
+	sr := &cluster.ServiceRequest{
+		UserName:             string(parts[1]),
+		AuthentificationInfo: pwd,
+		Request:              &cluster.RequestBody{User: string(parts[0])},
+	}
+	ok, failResponce := c.g.CheckAuth(ctx, sr)
+	if !ok {
+		if failResponce.Err == nil {
+			return ErrSaslAuthenticationFailed, GenerateError(10193006, sr.UserName)
+		}
+		return ErrSaslAuthenticationFailed, GenerateErrorE(10193006, failResponce.Err, sr.UserName)
+	}
+
+	c.user = sr.Request
+	c.authenticated = true
+
+	return ErrNone, nil
+}
@@ -0,0 +1,609 @@
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/capella-pw/queue/cluster"
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/queue"
+	"github.com/capella-pw/queue/storage"
+	"github.com/myfantasy/mft"
+)
+
+// testCluster - cluster with queues only
+type testCluster struct {
+	cluster.Cluster
+
+	gen    *mft.G
+	queues map[string]queue.Queue
+}
+
+func (tc *testCluster) GetQueuesList(ctx context.Context, user cn.CapUser) (names []string, err *mft.Error) {
+	for name := range tc.queues {
+		names = append(names, name)
+	}
+	return names, nil
+}
+func (tc *testCluster) GetQueue(ctx context.Context, user cn.CapUser, name string) (q queue.Queue, exists bool, err *mft.Error) {
+	q, exists = tc.queues[name]
+	return q, exists, nil
+}
+func (tc *testCluster) GetNextId(ctx context.Context, user cn.CapUser) (id int64, err *mft.Error) {
+	return tc.gen.RvGetPart(), nil
+}
+
+// testClient - in-process kafka client
+type testClient struct {
+	t             *testing.T
+	conn          net.Conn
+	correlationID int32
+}
+
+func testGateway(t *testing.T, checkAuth cluster.CheckAuthFunc) (g *Gateway, tc *testCluster, addr string) {
+	tc = &testCluster{
+		gen:    &mft.G{},
+		queues: make(map[string]queue.Queue),
+	}
+	tc.queues["q1"] = queue.CreateSimpleQueue(5, 0, 0, storage.CreateMapSorage(), nil, nil, tc.gen)
+
+	ln, er0 := net.Listen("tcp", "127.0.0.1:0")
+	if er0 != nil {
+		t.Fatal(er0)
+	}
+
+	g = GatewayCreate(tc, checkAuth, 2, "127.0.0.1", int32(ln.Addr().(*net.TCPAddr).Port))
+	g.ThrowErrorFunc = func(err *mft.Error) bool {
+		t.Log(err)
+		return true
+	}
+	go g.Serve(ln)
+
+	return g, tc, ln.Addr().String()
+}
+
+func testDial(t *testing.T, addr string) *testClient {
+	conn, er0 := net.Dial("tcp", addr)
+	if er0 != nil {
+		t.Fatal(er0)
+	}
+	return &testClient{t: t, conn: conn}
+}
+
+// testCheckAuth - any user is authenticated
+func testCheckAuth(ctx context.Context, serviceRequest *cluster.ServiceRequest) (ok bool, failResponce cluster.ResponceBody) {
+	serviceRequest.Request.User = serviceRequest.UserName
+	return true, failResponce
+}
+
+// testDialAuth - connection authenticated as `test`
+func testDialAuth(t *testing.T, addr string) *testClient {
+	c := testDial(t, addr)
+	if code := c.saslHandshake(); code != ErrNone {
+		t.Fatalf("SaslHandshake error code %v", code)
+	}
+	if code := c.saslAuthenticate("\x00test\x00"); code != ErrNone {
+		t.Fatalf("SaslAuthenticate error code %v", code)
+	}
+	return c
+}
+
+func (c *testClient) saslHandshake() int16 {
+	r := c.call(ApiKeySaslHandshake, 1, func(w *writer) { w.string(SaslMechanismPlain) })
+	return r.int16()
+}
+
+func (c *testClient) saslAuthenticate(token string) int16 {
+	r := c.call(ApiKeySaslAuthenticate, 1, func(w *writer) { w.bytes([]byte(token)) })
+	return r.int16()
+}
+
+// call - send request and read responce; returns nil when connection is closed
+func (c *testClient) call(apiKey int16, version int16, body func(w *writer)) *reader {
+	c.correlationID++
+
+	w := &writer{}
+	w.int32(0) // size
+	w.int16(apiKey)
+	w.int16(version)
+	w.int32(c.correlationID)
+	clientID := "test"
+	w.nullableString(&clientID)
+	body(w)
+	binary.BigEndian.PutUint32(w.buf, uint32(len(w.buf)-4))
+
+	if _, er0 := c.conn.Write(w.buf); er0 != nil {
+		return nil
+	}
+
+	c.conn.SetReadDeadline(time.Now().Add(time.Second * 10))
+	var sizeBuf [4]byte
+	if _, er0 := io.ReadFull(c.conn, sizeBuf[:]); er0 != nil {
+		return nil
+	}
+	resp := make([]byte, binary.BigEndian.Uint32(sizeBuf[:]))
+	if _, er0 := io.ReadFull(c.conn, resp); er0 != nil {
+		c.t.Fatal(er0)
+	}
+
+	r := &reader{body: resp}
+	if id := r.int32(); id != c.correlationID {
+		c.t.Fatalf("correlation id expect %v actual %v", c.correlationID, id)
+	}
+	return r
+}
+
+func (c *testClient) produce(topic string, partition int32, acks int16, values ...string) (code int16, baseOffset int64) {
+	messages := make([]*queue.MessageWithMeta, len(values))
+	for i, v := range values {
+		messages[i] = &queue.MessageWithMeta{ID: int64(i), Message: []byte(v), Source: "k", Dt: time.Now()}
+	}
+
+	r := c.call(ApiKeyProduce, 7, func(w *writer) {
+		w.nullableString(nil)
+		w.int16(acks)
+		w.int32(1000)
+		w.arrayLen(1)
+		w.string(topic)
+		w.arrayLen(1)
+		w.int32(partition)
+		w.bytes(encodeRecordBatches(messages))
+	})
+	if r == nil {
+		c.t.Fatal("produce: connection is closed")
+	}
+
+	r.arrayLen()
+	r.string()
+	r.arrayLen()
+	r.int32()
+	code = r.int16()
+	baseOffset = r.int64()
+	return code, baseOffset
+}
+
+type testFetched struct {
+	code    int16
+	hw      int64
+	offsets []int64
+	values  []string
+	// next - offset after last record batch (0 when there are no batches)
+	next int64
+}
+
+func (c *testClient) fetch(topic string, partition int32, offset int64, maxWait int32) (f testFetched) {
+	r := c.call(ApiKeyFetch, 11, func(w *writer) {
+		w.int32(-1)
+		w.int32(maxWait)
+		w.int32(1)
+		w.int32(1 << 20)
+		w.int8(0)
+		w.int32(0)
+		w.int32(-1)
+		w.arrayLen(1)
+		w.string(topic)
+		w.arrayLen(1)
+		w.int32(partition)
+		w.int32(-1)
+		w.int64(offset)
+		w.int64(-1)
+		w.int32(1 << 20)
+		w.arrayLen(0)
+		w.string("")
+	})
+	if r == nil {
+		c.t.Fatal("fetch: connection is closed")
+	}
+
+	r.int32() // throttle_time_ms
+	if code := r.int16(); code != ErrNone {
+		c.t.Fatalf("fetch: error code %v", code)
+	}
+	r.int32() // session_id
+	r.arrayLen()
+	r.string()
+	r.arrayLen()
+	r.int32()
+	f.code = r.int16()
+	f.hw = r.int64()
+	r.int64()
+	r.int64()
+	r.int32() // aborted_transactions
+	r.int32()
+	records := r.bytes()
+	if r.broken {
+		c.t.Fatal("fetch: responce is broken")
+	}
+
+	for pos := 0; pos < len(records); {
+		baseOffset := int64(binary.BigEndian.Uint64(records[pos:]))
+		end := pos + 12 + int(binary.BigEndian.Uint32(records[pos+8:]))
+		f.next = baseOffset + int64(int32(binary.BigEndian.Uint32(records[pos+23:]))) + 1
+		produced, _, err := decodeRecordBatches(records[pos:end])
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		rr := &reader{body: records[pos:end], pos: recordBatchHeaderLen}
+		for _, p := range produced {
+			rr.varint()
+			rr.int8()
+			rr.varint()
+			f.offsets = append(f.offsets, baseOffset+rr.varint())
+			rr.varBytes()
+			rr.varBytes()
+			rr.varint()
+			f.values = append(f.values, string(p.Value))
+		}
+		pos = end
+	}
+	return f
+}
+
+func (c *testClient) listOffset(topic string, partition int32, timestamp int64) (code int16, offset int64) {
+	r := c.call(ApiKeyListOffsets, 5, func(w *writer) {
+		w.int32(-1)
+		w.int8(0)
+		w.arrayLen(1)
+		w.string(topic)
+		w.arrayLen(1)
+		w.int32(partition)
+		w.int32(-1)
+		w.int64(timestamp)
+	})
+	r.int32()
+	r.arrayLen()
+	r.string()
+	r.arrayLen()
+	r.int32()
+	code = r.int16()
+	r.int64()
+	offset = r.int64()
+	return code, offset
+}
+
+func TestGateway_ProduceFetch(t *testing.T) {
+	g, tc, addr := testGateway(t, testCheckAuth)
+	defer g.Close()
+
+	c := testDialAuth(t, addr)
+	defer c.conn.Close()
+
+	// ApiVersions
+	{
+		r := c.call(ApiKeyApiVersions, 2, func(w *writer) {})
+		if code := r.int16(); code != ErrNone {
+			t.Fatalf("ApiVersions error code %v", code)
+		}
+		if n := r.arrayLen(); n != len(SupportedApiVersions) {
+			t.Fatalf("ApiVersions count expect %v actual %v", len(SupportedApiVersions), n)
+		}
+
+		r = c.call(ApiKeyApiVersions, 3, func(w *writer) {})
+		if code := r.int16(); code != ErrUnsupportedVersion {
+			t.Fatalf("ApiVersions v3 error code expect %v actual %v", ErrUnsupportedVersion, code)
+		}
+	}
+
+	// Metadata of all topics
+	{
+		r := c.call(ApiKeyMetadata, 7, func(w *writer) {
+			w.int32(-1)
+			w.bool(false)
+		})
+		r.int32()
+		r.arrayLen()
+		r.int32()
+		host := r.string()
+		port := r.int32()
+		if host != g.Host || port != g.Port {
+			t.Fatalf("Metadata broker expect %v:%v actual %v:%v", g.Host, g.Port, host, port)
+		}
+		r.nullableString()
+		r.nullableString()
+		r.int32()
+		if n := r.arrayLen(); n != 1 {
+			t.Fatalf("Metadata topics count expect 1 actual %v", n)
+		}
+		code := r.int16()
+		name := r.string()
+		r.bool()
+		partitions := r.arrayLen()
+		if code != ErrNone || name != "q1" || partitions != 2 {
+			t.Fatalf("Metadata topic expect q1 with 2 partitions actual %v %v %v", name, code, partitions)
+		}
+	}
+
+	// Produce and fetch
+	code, baseOffset := c.produce("q1", 1, 1, "a", "b", "c")
+	if code != ErrNone || baseOffset <= 0 {
+		t.Fatalf("Produce fail code %v base offset %v", code, baseOffset)
+	}
+	if code, _ := c.produce("q2", 0, 1, "a"); code != ErrUnknownTopicOrPartition {
+		t.Fatalf("Produce into unknown topic error code expect %v actual %v", ErrUnknownTopicOrPartition, code)
+	}
+
+	f := c.fetch("q1", 1, 0, 0)
+	if len(f.values) != 3 || f.values[0] != "a" || f.values[2] != "c" || f.offsets[0] != baseOffset {
+		t.Fatalf("Fetch fail %+v", f)
+	}
+	if f.hw != f.offsets[2]+1 {
+		t.Fatalf("Fetch high watermark expect %v actual %v", f.offsets[2]+1, f.hw)
+	}
+
+	f = c.fetch("q1", 1, f.offsets[1], 0)
+	if len(f.values) != 2 || f.values[0] != "b" {
+		t.Fatalf("Fetch from offset fail %+v", f)
+	}
+
+	// partition is segment of message
+	f = c.fetch("q1", 0, 0, 0)
+	if len(f.values) != 0 {
+		t.Fatalf("Fetch of empty partition fail %+v", f)
+	}
+
+	// ListOffsets
+	if code, offset := c.listOffset("q1", 1, offsetEarliest); code != ErrNone || offset != baseOffset {
+		t.Fatalf("ListOffsets earliest expect %v actual %v (code %v)", baseOffset, offset, code)
+	}
+	if code, offset := c.listOffset("q1", 1, offsetLatest); code != ErrNone || offset < f.hw {
+		t.Fatalf("ListOffsets latest %v should not be less then %v (code %v)", offset, f.hw, code)
+	}
+
+	// long poll: fetch waits for produce
+	{
+		latest := c.listOffsetMust("q1", 0)
+
+		done := make(chan testFetched)
+		go func() {
+			fc := testDialAuth(t, addr)
+			defer fc.conn.Close()
+			done <- fc.fetch("q1", 0, latest, 5000)
+		}()
+
+		time.Sleep(time.Millisecond * 100)
+		start := time.Now()
+		if code, _ := c.produce("q1", 0, 1, "d"); code != ErrNone {
+			t.Fatalf("Produce fail code %v", code)
+		}
+
+		f := <-done
+		if len(f.values) != 1 || f.values[0] != "d" {
+			t.Fatalf("Fetch with wait fail %+v", f)
+		}
+		if time.Since(start) > time.Second*2 {
+			t.Fatalf("Fetch with wait is not woken up by produce")
+		}
+	}
+
+	// OffsetCommit and OffsetFetch
+	{
+		commitOffset := baseOffset + 1
+		r := c.call(ApiKeyOffsetCommit, 7, func(w *writer) {
+			w.string("g")
+			w.int32(-1)
+			w.string("")
+			w.nullableString(nil)
+			w.arrayLen(1)
+			w.string("q1")
+			w.arrayLen(1)
+			w.int32(1)
+			w.int64(commitOffset)
+			w.int32(-1)
+			w.nullableString(nil)
+		})
+		r.int32()
+		r.arrayLen()
+		r.string()
+		r.arrayLen()
+		r.int32()
+		if code := r.int16(); code != ErrNone {
+			t.Fatalf("OffsetCommit error code %v", code)
+		}
+
+		lastRead, err := tc.queues["q1"].SubscriberGetLastRead(context.Background(), nil, g.SubscriberName("g", 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lastRead != commitOffset-1 {
+			t.Fatalf("OffsetCommit last read of subscriber expect %v actual %v", commitOffset-1, lastRead)
+		}
+
+		r = c.call(ApiKeyOffsetFetch, 5, func(w *writer) {
+			w.string("g")
+			w.arrayLen(1)
+			w.string("q1")
+			w.arrayLen(2)
+			w.int32(1)
+			w.int32(0)
+		})
+		r.int32()
+		r.arrayLen()
+		r.string()
+		r.arrayLen()
+		r.int32()
+		offset := r.int64()
+		r.int32()
+		r.nullableString()
+		code := r.int16()
+		if code != ErrNone || offset != commitOffset {
+			t.Fatalf("OffsetFetch expect %v actual %v (code %v)", commitOffset, offset, code)
+		}
+		r.int32()
+		offset = r.int64()
+		if offset != -1 {
+			t.Fatalf("OffsetFetch of not committed partition expect -1 actual %v", offset)
+		}
+	}
+
+	// acks == 0 has no responce; next request is answered
+	{
+		c.correlationID++
+		w := &writer{}
+		w.int32(0)
+		w.int16(ApiKeyProduce)
+		w.int16(7)
+		w.int32(c.correlationID)
+		w.nullableString(nil)
+		w.nullableString(nil)
+		w.int16(0)
+		w.int32(1000)
+		w.arrayLen(1)
+		w.string("q1")
+		w.arrayLen(1)
+		w.int32(0)
+		w.bytes(encodeRecordBatches([]*queue.MessageWithMeta{{Message: []byte("e")}}))
+		binary.BigEndian.PutUint32(w.buf, uint32(len(w.buf)-4))
+		if _, er0 := c.conn.Write(w.buf); er0 != nil {
+			t.Fatal(er0)
+		}
+
+		f := c.fetch("q1", 0, 0, 0)
+		if len(f.values) != 2 || f.values[1] != "e" {
+			t.Fatalf("Produce with acks=0 fail %+v", f)
+		}
+	}
+}
+
+func (c *testClient) listOffsetMust(topic string, partition int32) int64 {
+	code, offset := c.listOffset(topic, partition, offsetLatest)
+	if code != ErrNone {
+		c.t.Fatalf("ListOffsets error code %v", code)
+	}
+	return offset
+}
+
+func TestGateway_FetchScanLimit(t *testing.T) {
+	g, _, addr := testGateway(t, testCheckAuth)
+	defer g.Close()
+	g.FetchCntLimit = 2
+	g.FetchScanLimit = 3
+
+	c := testDialAuth(t, addr)
+	defer c.conn.Close()
+
+	for i := 0; i < 10; i++ {
+		if code, _ := c.produce("q1", 0, 1, "a"); code != ErrNone {
+			t.Fatalf("Produce fail code %v", code)
+		}
+	}
+	if code, _ := c.produce("q1", 1, 1, "b"); code != ErrNone {
+		t.Fatalf("Produce fail code %v", code)
+	}
+
+	// earliest offset of partition is after checked messages of other partition
+	_, earliest := c.listOffset("q1", 1, offsetEarliest)
+
+	// fetch checks not more then FetchScanLimit messages and moves offset after them by empty record batch
+	offset := earliest
+	for i := 0; ; i++ {
+		if i > 4 {
+			t.Fatalf("Fetch should find message of partition in 4 fetches")
+		}
+		f := c.fetch("q1", 1, offset, 0)
+		if len(f.values) > 0 {
+			if len(f.values) != 1 || f.values[0] != "b" {
+				t.Fatalf("Fetch of partition fail %+v", f)
+			}
+			break
+		}
+		if f.next <= offset || f.hw != f.next {
+			t.Fatalf("Fetch without messages of partition should move offset %v: %+v", offset, f)
+		}
+		offset = f.next
+	}
+}
+
+func TestGateway_SaslPlain(t *testing.T) {
+	checkAuth := func(ctx context.Context, serviceRequest *cluster.ServiceRequest) (ok bool, failResponce cluster.ResponceBody) {
+		var pwd string
+		json.Unmarshal(serviceRequest.AuthentificationInfo, &pwd)
+		if serviceRequest.UserName != "user" || pwd != "pwd" {
+			return false, failResponce
+		}
+		serviceRequest.Request.User = serviceRequest.UserName
+		return true, failResponce
+	}
+
+	g, _, addr := testGateway(t, checkAuth)
+	defer g.Close()
+
+	metadata := func(w *writer) {
+		w.int32(0)
+		w.bool(false)
+	}
+	handshake := func(c *testClient) {
+		if code := c.saslHandshake(); code != ErrNone {
+			t.Fatalf("SaslHandshake error code %v", code)
+		}
+	}
+	authenticate := func(c *testClient, token string) int16 {
+		return c.saslAuthenticate(token)
+	}
+
+	// not authenticated connection is closed
+	{
+		c := testDial(t, addr)
+		if r := c.call(ApiKeyMetadata, 7, metadata); r != nil {
+			t.Fatalf("Metadata before authentication should close connection")
+		}
+		c.conn.Close()
+	}
+
+	// wrong password
+	{
+		c := testDial(t, addr)
+		handshake(c)
+		if code := authenticate(c, "\x00user\x00bad"); code != ErrSaslAuthenticationFailed {
+			t.Fatalf("SaslAuthenticate error code expect %v actual %v", ErrSaslAuthenticationFailed, code)
+		}
+		if r := c.call(ApiKeyMetadata, 7, metadata); r != nil {
+			t.Fatalf("connection should be closed after authentication fail")
+		}
+		c.conn.Close()
+	}
+
+	// success
+	{
+		c := testDial(t, addr)
+		defer c.conn.Close()
+		handshake(c)
+		if code := authenticate(c, "\x00user\x00pwd"); code != ErrNone {
+			t.Fatalf("SaslAuthenticate error code %v", code)
+		}
+		if code, _ := c.produce("q1", 0, 1, "a"); code != ErrNone {
+			t.Fatalf("Produce after authentication error code %v", code)
+		}
+	}
+}
+
+func TestGateway_NoCheckAuth(t *testing.T) {
+	g, _, addr := testGateway(t, nil)
+	defer g.Close()
+
+	c := testDial(t, addr)
+	defer c.conn.Close()
+
+	if code := c.saslHandshake(); code != ErrUnsupportedSaslMechanism {
+		t.Fatalf("SaslHandshake without CheckAuth error code expect %v actual %v", ErrUnsupportedSaslMechanism, code)
+	}
+	if r := c.call(ApiKeyMetadata, 7, func(w *writer) {
+		w.int32(0)
+		w.bool(false)
+	}); r != nil {
+		t.Fatalf("Metadata without CheckAuth should close connection")
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	if code := errorCode(cluster.GenerateErrorE(10121009, cluster.GenerateError(10100000))); code != ErrTopicAuthorizationFailed {
+		t.Errorf("errorCode of permission denied error expect %v actual %v", ErrTopicAuthorizationFailed, code)
+	}
+	if code := errorCode(mft.ErrorS("Permission denied")); code != ErrUnknownServerError {
+		t.Errorf("errorCode of other error expect %v actual %v", ErrUnknownServerError, code)
+	}
+}
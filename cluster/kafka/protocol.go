@@ -0,0 +1,236 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Kafka api keys
+const (
+	ApiKeyProduce          int16 = 0
+	ApiKeyFetch            int16 = 1
+	ApiKeyListOffsets      int16 = 2
+	ApiKeyMetadata         int16 = 3
+	ApiKeyOffsetCommit     int16 = 8
+	ApiKeyOffsetFetch      int16 = 9
+	ApiKeyFindCoordinator  int16 = 10
+	ApiKeySaslHandshake    int16 = 17
+	ApiKeyApiVersions      int16 = 18
+	ApiKeySaslAuthenticate int16 = 36
+)
+
+// Kafka error codes
+const (
+	ErrNone                     int16 = 0
+	ErrUnknownServerError       int16 = -1
+	ErrOffsetOutOfRange         int16 = 1
+	ErrCorruptMessage           int16 = 2
+	ErrUnknownTopicOrPartition  int16 = 3
+	ErrTopicAuthorizationFailed int16 = 29
+	ErrGroupAuthorizationFailed int16 = 30
+	ErrUnsupportedSaslMechanism int16 = 33
+	ErrIllegalSaslState         int16 = 34
+	ErrUnsupportedVersion       int16 = 35
+	ErrInvalidRequest           int16 = 42
+	ErrSaslAuthenticationFailed int16 = 58
+	ErrUnsupportedCompression   int16 = 76
+)
+
+// ApiVersion - supported versions of api (only not flexible versions are supported)
+type ApiVersion struct {
+	Key int16
+	Min int16
+	Max int16
+}
+
+// SupportedApiVersions - apis of gateway
+var SupportedApiVersions = []ApiVersion{
+	{Key: ApiKeyProduce, Min: 3, Max: 7},
+	{Key: ApiKeyFetch, Min: 4, Max: 11},
+	{Key: ApiKeyListOffsets, Min: 1, Max: 5},
+	{Key: ApiKeyMetadata, Min: 0, Max: 7},
+	{Key: ApiKeyOffsetCommit, Min: 2, Max: 7},
+	{Key: ApiKeyOffsetFetch, Min: 1, Max: 5},
+	{Key: ApiKeyFindCoordinator, Min: 0, Max: 2},
+	{Key: ApiKeySaslHandshake, Min: 1, Max: 1},
+	{Key: ApiKeyApiVersions, Min: 0, Max: 2},
+	{Key: ApiKeySaslAuthenticate, Min: 0, Max: 1},
+}
+
+// isSupported - api key and version are supported
+func isSupported(key int16, version int16) bool {
+	for _, v := range SupportedApiVersions {
+		if v.Key == key {
+			return version >= v.Min && version <= v.Max
+		}
+	}
+	return false
+}
+
+// writer - big endian encoder of kafka primitive types
+type writer struct {
+	buf []byte
+	b8  [8]byte
+}
+
+func (w *writer) int8(v int8) {
+	w.buf = append(w.buf, byte(v))
+}
+func (w *writer) bool(v bool) {
+	if v {
+		w.int8(1)
+	} else {
+		w.int8(0)
+	}
+}
+func (w *writer) int16(v int16) {
+	binary.BigEndian.PutUint16(w.b8[:2], uint16(v))
+	w.buf = append(w.buf, w.b8[:2]...)
+}
+func (w *writer) int32(v int32) {
+	binary.BigEndian.PutUint32(w.b8[:4], uint32(v))
+	w.buf = append(w.buf, w.b8[:4]...)
+}
+func (w *writer) int64(v int64) {
+	binary.BigEndian.PutUint64(w.b8[:], uint64(v))
+	w.buf = append(w.buf, w.b8[:]...)
+}
+func (w *writer) string(v string) {
+	w.int16(int16(len(v)))
+	w.buf = append(w.buf, v...)
+}
+func (w *writer) nullableString(v *string) {
+	if v == nil {
+		w.int16(-1)
+		return
+	}
+	w.string(*v)
+}
+func (w *writer) bytes(v []byte) {
+	if v == nil {
+		w.int32(-1)
+		return
+	}
+	w.int32(int32(len(v)))
+	w.buf = append(w.buf, v...)
+}
+func (w *writer) arrayLen(n int) {
+	w.int32(int32(n))
+}
+func (w *writer) varint(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(b[:], v)
+	w.buf = append(w.buf, b[:n]...)
+}
+func (w *writer) varBytes(v []byte) {
+	if v == nil {
+		w.varint(-1)
+		return
+	}
+	w.varint(int64(len(v)))
+	w.buf = append(w.buf, v...)
+}
+
+// reader - big endian decoder of kafka primitive types
+// broken reader returns zero values
+type reader struct {
+	body   []byte
+	pos    int
+	broken bool
+}
+
+func (r *reader) next(n int) []byte {
+	if r.broken || n < 0 || n > len(r.body)-r.pos {
+		r.broken = true
+		return nil
+	}
+	b := r.body[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+func (r *reader) int8() int8 {
+	b := r.next(1)
+	if b == nil {
+		return 0
+	}
+	return int8(b[0])
+}
+func (r *reader) bool() bool {
+	return r.int8() != 0
+}
+func (r *reader) int16() int16 {
+	b := r.next(2)
+	if b == nil {
+		return 0
+	}
+	return int16(binary.BigEndian.Uint16(b))
+}
+func (r *reader) int32() int32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(b))
+}
+func (r *reader) int64() int64 {
+	b := r.next(8)
+	if b == nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(b))
+}
+func (r *reader) string() string {
+	n := r.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(r.next(int(n)))
+}
+func (r *reader) nullableString() *string {
+	n := r.int16()
+	if n < 0 {
+		return nil
+	}
+	s := string(r.next(int(n)))
+	return &s
+}
+func (r *reader) bytes() []byte {
+	n := r.int32()
+	if n < 0 {
+		return nil
+	}
+	return r.next(int(n))
+}
+
+// arrayLen - length of array (-1 - null array); broken reader returns 0
+func (r *reader) arrayLen() int {
+	n := r.int32()
+	if r.broken {
+		return 0
+	}
+	// every element is at least 1 byte
+	if int(n) > len(r.body)-r.pos {
+		r.broken = true
+		return 0
+	}
+	return int(n)
+}
+func (r *reader) varint() int64 {
+	if r.broken {
+		return 0
+	}
+	v, n := binary.Varint(r.body[r.pos:])
+	if n <= 0 {
+		r.broken = true
+		return 0
+	}
+	r.pos += n
+	return v
+}
+func (r *reader) varBytes() []byte {
+	n := r.varint()
+	if n < 0 || n > math.MaxInt32 {
+		return nil
+	}
+	return r.next(int(n))
+}
@@ -0,0 +1,189 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"math"
+
+	"github.com/capella-pw/queue/queue"
+	"github.com/myfantasy/mft"
+)
+
+// Record batch (magic 2) layout
+//
+//	baseOffset           int64
+//	batchLength          int32 - length of batch after this field
+//	partitionLeaderEpoch int32
+//	magic                int8 (2)
+//	crc                  uint32 - crc32c of batch from attributes to end
+//	attributes           int16 (bits 0-2 - compression; only not compressed batches are supported)
+//	lastOffsetDelta      int32
+//	firstTimestamp       int64
+//	maxTimestamp         int64
+//	producerId           int64
+//	producerEpoch        int16
+//	baseSequence         int32
+//	records              [int32]record
+//
+// record: length varint, attributes int8, timestampDelta varint, offsetDelta varint,
+// key varbytes, value varbytes, headers [varint](key varbytes, value varbytes)
+//
+// message mapping: value - Message, key - Source, timestamp - Dt (unix ms), offset - ID
+const (
+	recordBatchMagic       = 2
+	recordBatchHeaderLen   = 8 + 4 + 4 + 1 + 4 + 2 + 4 + 8 + 8 + 8 + 2 + 4 + 4
+	recordBatchCrcStart    = 8 + 4 + 4 + 1 + 4
+	recordBatchCompression = 0x07
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// ProducedRecord - record of produce request
+type ProducedRecord struct {
+	Key       []byte
+	Value     []byte
+	Timestamp int64
+}
+
+// decodeRecordBatches - records of all batches of produce request
+func decodeRecordBatches(body []byte) (records []ProducedRecord, errCode int16, err *mft.Error) {
+	for pos := 0; pos < len(body); {
+		if len(body)-pos < recordBatchHeaderLen {
+			return nil, ErrCorruptMessage, GenerateError(10193100, pos)
+		}
+		batchLength := int(int32(binary.BigEndian.Uint32(body[pos+8:])))
+		end := pos + 12 + batchLength
+		if batchLength < recordBatchHeaderLen-12 || end > len(body) {
+			return nil, ErrCorruptMessage, GenerateError(10193100, pos)
+		}
+		batch := body[pos:end]
+		pos = end
+
+		if batch[16] != recordBatchMagic {
+			return nil, ErrUnsupportedVersion, GenerateError(10193101, batch[16])
+		}
+		if crc32.Checksum(batch[recordBatchCrcStart:], crc32c) != binary.BigEndian.Uint32(batch[17:]) {
+			return nil, ErrCorruptMessage, GenerateError(10193102)
+		}
+
+		r := &reader{body: batch, pos: recordBatchCrcStart}
+		attributes := r.int16()
+		if attributes&recordBatchCompression != 0 {
+			return nil, ErrUnsupportedCompression, GenerateError(10193103, attributes&recordBatchCompression)
+		}
+		r.int32() // lastOffsetDelta
+		firstTimestamp := r.int64()
+		r.int64() // maxTimestamp
+		r.int64() // producerId
+		r.int16() // producerEpoch
+		r.int32() // baseSequence
+		cnt := r.arrayLen()
+
+		for i := 0; i < cnt && !r.broken; i++ {
+			length := r.varint()
+			recordEnd := r.pos + int(length)
+			r.int8() // attributes
+			timestampDelta := r.varint()
+			r.varint() // offsetDelta
+			record := ProducedRecord{
+				Key:       r.varBytes(),
+				Value:     r.varBytes(),
+				Timestamp: firstTimestamp + timestampDelta,
+			}
+			// headers are skipped
+			if recordEnd > len(batch) || recordEnd < r.pos {
+				r.broken = true
+			}
+			if r.broken {
+				break
+			}
+			r.pos = recordEnd
+			records = append(records, record)
+		}
+		if r.broken {
+			return nil, ErrCorruptMessage, GenerateError(10193100, pos)
+		}
+	}
+
+	return records, ErrNone, nil
+}
+
+// encodeRecordBatches - record batches of messages (offset is ID of message)
+// messages are split into batches while offset delta fits into int32
+func encodeRecordBatches(messages []*queue.MessageWithMeta) []byte {
+	w := &writer{}
+	for start := 0; start < len(messages); {
+		end := start + 1
+		for end < len(messages) && messages[end].ID-messages[start].ID <= math.MaxInt32 {
+			end++
+		}
+		encodeRecordBatch(w, messages[start].ID, messages[end-1].ID, messages[start:end])
+		start = end
+	}
+	return w.buf
+}
+
+func timestampOf(msg *queue.MessageWithMeta) int64 {
+	if msg.Dt.IsZero() {
+		return -1
+	}
+	return msg.Dt.UnixNano() / 1e6
+}
+
+// encodeEmptyRecordBatch - record batch without records with offset lastOffset;
+// consumer moves fetch offset after lastOffset (as after batch with compacted records)
+func encodeEmptyRecordBatch(lastOffset int64) []byte {
+	w := &writer{}
+	encodeRecordBatch(w, lastOffset, lastOffset, nil)
+	return w.buf
+}
+
+func encodeRecordBatch(w *writer, baseOffset int64, lastOffset int64, messages []*queue.MessageWithMeta) {
+	var firstTimestamp int64 = -1
+	if len(messages) > 0 {
+		firstTimestamp = timestampOf(messages[0])
+	}
+	maxTimestamp := firstTimestamp
+	for _, msg := range messages {
+		if ts := timestampOf(msg); ts > maxTimestamp {
+			maxTimestamp = ts
+		}
+	}
+
+	start := len(w.buf)
+	w.int64(baseOffset)
+	w.int32(0) // batchLength
+	w.int32(0) // partitionLeaderEpoch
+	w.int8(recordBatchMagic)
+	w.int32(0) // crc
+	w.int16(0) // attributes
+	w.int32(int32(lastOffset - baseOffset))
+	w.int64(firstTimestamp)
+	w.int64(maxTimestamp)
+	w.int64(-1) // producerId
+	w.int16(-1) // producerEpoch
+	w.int32(-1) // baseSequence
+	w.arrayLen(len(messages))
+
+	for _, msg := range messages {
+		rw := &writer{}
+		rw.int8(0)
+		rw.varint(timestampOf(msg) - firstTimestamp)
+		rw.varint(msg.ID - baseOffset)
+		if msg.Source == "" {
+			rw.varBytes(nil)
+		} else {
+			rw.varBytes([]byte(msg.Source))
+		}
+		// erased message is tombstone (null value)
+		rw.varBytes(msg.Message)
+		rw.varint(0) // headers
+
+		w.varint(int64(len(rw.buf)))
+		w.buf = append(w.buf, rw.buf...)
+	}
+
+	batch := w.buf[start:]
+	binary.BigEndian.PutUint32(batch[8:], uint32(len(batch)-12))
+	binary.BigEndian.PutUint32(batch[17:], crc32.Checksum(batch[recordBatchCrcStart:], crc32c))
+}
@@ -0,0 +1,308 @@
+package cluster
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/queue"
+	"github.com/myfantasy/mft"
+)
+
+// OpSchema - description of cluster operation (RequestBody.Action)
+type OpSchema struct {
+	Op string
+	// ObjectType - type of object in RequestBody.ObjectName ("" - object name is not used)
+	ObjectType  string
+	Description string
+	// Request - value of type of RequestBody.Body (nil - body is empty)
+	Request interface{}
+	// Responce - value of type of ResponceBody.Body (nil - body is empty)
+	Responce interface{}
+}
+
+// anyValue - schema of any json value
+type anyValue struct{}
+
+// OpSchemas - operations of CallFuncInCluster
+// every operation from cn (Op*) should be described here
+var OpSchemas = []OpSchema{
+	{Op: cn.OpGetName, Description: "Name of cluster", Responce: ""},
+	{Op: cn.OpSetName, Description: "Set name of cluster", Request: ""},
+	{Op: cn.OpPing, Description: "Ping cluster"},
+	{Op: cn.OpGetNextId, Description: "Next unique id", Responce: int64(0)},
+	{Op: cn.OpGetNextIds, Description: "Next unique ids (body is count)", Request: int(0), Responce: []int64{}},
+
+	{Op: cn.OpAddQueue, Description: "Add queue", Request: QueueDescription{}},
+	{Op: cn.OpDropQueue, Description: "Drop queue (body is queue name)", Request: ""},
+	{Op: cn.OpGetQueueDescription, Description: "Description of queue (body is queue name)", Request: "", Responce: QueueDescription{}},
+	{Op: cn.OpGetQueuesList, Description: "Names of queues", Responce: []string{}},
+
+	{Op: cn.OpAddExternalCluster, Description: "Add external cluster", Request: ExternalClusterDescription{}},
+	{Op: cn.OpDropExternalCluster, Description: "Drop external cluster (body is name)", Request: ""},
+	{Op: cn.OpGetExternalClusterDescription, Description: "Description of external cluster (body is name)", Request: "", Responce: ExternalClusterDescription{}},
+	{Op: cn.OpGetExternalClustersList, Description: "Names of external clusters", Responce: []string{}},
+
+	{Op: cn.OpNestedCall, ObjectType: cn.ExternalClusterObjectType, Description: "Call request in external cluster; responce is responce of nested request",
+		Request: RequestBody{}, Responce: anyValue{}},
+	{Op: cn.OpBatch, Description: "Call ordered list of requests (sequentially or in parallel); responces are in order of requests",
+		Request: BatchRequest{}, Responce: BatchResponce{}},
+
+	{Op: cn.OpAddHandler, Description: "Add handler", Request: HandlerDescription{}},
+	{Op: cn.OpDropHandler, Description: "Drop handler (body is handler name)", Request: ""},
+	{Op: cn.OpGetHandlerDescription, Description: "Description of handler (body is handler name)", Request: "", Responce: HandlerDescription{}},
+	{Op: cn.OpGetHandlersList, Description: "Names of handlers", Responce: []string{}},
+
+	{Op: cn.OpCheckPermission, Description: "Check permission of user", Request: CheckPermissionRequest{}, Responce: false},
+
+	{Op: cn.OpRestoreArchive, Description: "Restore messages from archives of queue", Request: ArchiveRestoreRequest{}, Responce: ArchiveRestoreResponce{}},
+
+	{Op: cn.OpGetFullStruct, Description: "Full structure of cluster", Responce: anyValue{}},
+	{Op: cn.OpLoadFullStruct, Description: "Load full structure of cluster", Request: anyValue{}},
+
+	{Op: cn.OpQueueAdd, ObjectType: cn.QueueObjectType, Description: "Add message; responce is id", Request: QueueAddRequest{}, Responce: int64(0)},
+	{Op: cn.OpQueueAddList, ObjectType: cn.QueueObjectType, Description: "Add messages; responce is ids", Request: QueueAddListRequest{}, Responce: []int64{}},
+	{Op: cn.OpQueueGet, ObjectType: cn.QueueObjectType, Description: "Messages with id > id_start", Request: QueueGetRequest{}, Responce: []*queue.MessageWithMeta{}},
+	{Op: cn.OpQueueGetSegment, ObjectType: cn.QueueObjectType, Description: "Messages of segments with id > id_start", Request: QueueGetSegmentRequest{}, Responce: QueueGetSegmentResponce{}},
+	{Op: cn.OpQueueSaveAll, ObjectType: cn.QueueObjectType, Description: "Save queue"},
+	{Op: cn.OpQueueAddUnique, ObjectType: cn.QueueObjectType, Description: "Add message if message with external id and source does not exist; responce is id", Request: QueueAddRequest{}, Responce: int64(0)},
+	{Op: cn.OpQueueAddUniqueList, ObjectType: cn.QueueObjectType, Description: "Add unique messages; responce is ids", Request: QueueAddListRequest{}, Responce: []int64{}},
+	{Op: cn.OpQueueGetFromTime, ObjectType: cn.QueueObjectType, Description: "Messages from time", Request: QueueGetFromTimeRequest{}, Responce: []*queue.MessageWithMeta{}},
+	{Op: cn.OpQueueGetByIDs, ObjectType: cn.QueueObjectType, Description: "Messages by ids", Request: QueueGetByIDsRequest{}, Responce: []*queue.MessageWithMeta{}},
+	{Op: cn.OpQueueGetByExtID, ObjectType: cn.QueueObjectType, Description: "Message by external id and source", Request: QueueGetByExternalIDRequest{}, Responce: QueueGetByExternalIDResponce{}},
+	{Op: cn.OpQueueErase, ObjectType: cn.QueueObjectType, Description: "Erase messages (message body is removed)", Request: QueueEraseRequest{}, Responce: []*queue.MessageOnlyMeta{}},
+	{Op: cn.OpQueueMirrorTranslate, ObjectType: cn.QueueObjectType, Description: "Id of mirror by id of source message (sets last read of subscriber of mirror when it is set); responce is id", Request: QueueMirrorTranslateRequest{}, Responce: int64(0)},
+
+	{Op: cn.OpQueueSubscriberSetLastRead, ObjectType: cn.QueueObjectType, Description: "Set last read id of subscriber", Request: QueueSubscriberSetLastReadRequest{}},
+	{Op: cn.OpQueueSubscriberGetLastRead, ObjectType: cn.QueueObjectType, Description: "Last read id of subscriber (body is subscriber name)", Request: "", Responce: int64(0)},
+	{Op: cn.OpQueueSubscriberSeekTime, ObjectType: cn.QueueObjectType, Description: "Set last read id of subscriber by time; responce is id", Request: QueueSubscriberSeekTimeRequest{}, Responce: int64(0)},
+	{Op: cn.OpQueueSubscriberAddReplicaMember, ObjectType: cn.QueueObjectType, Description: "Add replica member (body is subscriber name)", Request: ""},
+	{Op: cn.OpQueueSubscriberRemoveReplicaMember, ObjectType: cn.QueueObjectType, Description: "Remove replica member (body is subscriber name)", Request: ""},
+	{Op: cn.OpQueueSubscriberGetReplicaCount, ObjectType: cn.QueueObjectType, Description: "Count of replica members that read id (body is id)", Request: int64(0), Responce: int(0)},
+
+	{Op: cn.OpHandlerStart, ObjectType: cn.HandlerObjectType, Description: "Start handler"},
+	{Op: cn.OpHandlerStop, ObjectType: cn.HandlerObjectType, Description: "Stop handler"},
+	{Op: cn.OpHandlerLastComplete, ObjectType: cn.HandlerObjectType, Description: "Time of last complete of handler", Responce: time.Time{}},
+	{Op: cn.OpHandlerLastError, ObjectType: cn.HandlerObjectType, Description: "Last error of handler (in error of responce)"},
+	{Op: cn.OpHandlerIsStarted, ObjectType: cn.HandlerObjectType, Description: "Handler is started", Responce: false},
+	{Op: cn.OpHandlerLastReport, ObjectType: cn.HandlerObjectType, Description: "Last report of handler", Responce: anyValue{}},
+}
+
+// GetOpSchema - schema of operation
+func GetOpSchema(op string) (schema OpSchema, ok bool) {
+	for _, s := range OpSchemas {
+		if s.Op == op {
+			return s, true
+		}
+	}
+	return schema, false
+}
+
+// OpenAPIVersion - version of OpenAPI document
+const OpenAPIVersion = "3.0.3"
+
+// OpenAPI - OpenAPI document of cluster endpoint (ServiceRequest -> ServiceResponce)
+// every operation is described in `x-ops` (action, object type, body and responce schemas)
+// and RequestBody.body is oneOf of operation body schemas
+type OpenAPI struct {
+	OpenAPI    string                 `json:"openapi"`
+	Info       map[string]interface{} `json:"info"`
+	Paths      map[string]interface{} `json:"paths"`
+	Components struct {
+		Schemas map[string]interface{} `json:"schemas"`
+	} `json:"components"`
+	Ops map[string]interface{} `json:"x-ops"`
+}
+
+// OpenAPIGenerate - generate OpenAPI document from OpSchemas
+func OpenAPIGenerate(title string, version string, clusterPath string) *OpenAPI {
+	doc := &OpenAPI{
+		OpenAPI: OpenAPIVersion,
+		Info: map[string]interface{}{
+			"title":   title,
+			"version": version,
+		},
+		Paths: map[string]interface{}{},
+		Ops:   map[string]interface{}{},
+	}
+	doc.Components.Schemas = map[string]interface{}{}
+
+	bodies := make([]interface{}, 0, len(OpSchemas))
+	for _, s := range OpSchemas {
+		op := map[string]interface{}{
+			"description": s.Description,
+		}
+		if s.ObjectType != "" {
+			op["object_type"] = s.ObjectType
+		}
+
+		name := "op." + s.Op
+		if s.Request != nil {
+			doc.Components.Schemas[name+".body"] = doc.Schema(reflect.TypeOf(s.Request))
+			op["body"] = schemaRef(name + ".body")
+			bodies = append(bodies, schemaRef(name+".body"))
+		}
+		if s.Responce != nil {
+			doc.Components.Schemas[name+".responce"] = doc.Schema(reflect.TypeOf(s.Responce))
+			op["responce"] = schemaRef(name + ".responce")
+		}
+
+		doc.Ops[s.Op] = op
+	}
+
+	serviceRequest := doc.Schema(reflect.TypeOf(ServiceRequest{}))
+	serviceResponce := doc.Schema(reflect.TypeOf(ServiceResponce{}))
+
+	actions := make([]string, 0, len(OpSchemas))
+	for _, s := range OpSchemas {
+		actions = append(actions, s.Op)
+	}
+	sort.Strings(actions)
+
+	requestBody := doc.Components.Schemas[schemaName(reflect.TypeOf(RequestBody{}))].(map[string]interface{})
+	requestProperties := requestBody["properties"].(map[string]interface{})
+	requestProperties["action"] = map[string]interface{}{"type": "string", "enum": actions}
+	requestProperties["body"] = map[string]interface{}{"oneOf": bodies}
+
+	doc.Paths[clusterPath] = map[string]interface{}{
+		"post": map[string]interface{}{
+			"summary":     "Call operation in cluster (see x-ops for body of each action)",
+			"operationId": "cluster",
+			"requestBody": map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": serviceRequest},
+				},
+			},
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "Responce of operation (error is in responce.error)",
+					"content": map[string]interface{}{
+						"application/json": map[string]interface{}{"schema": serviceResponce},
+					},
+				},
+			},
+		},
+	}
+
+	return doc
+}
+
+// Schema - json schema of type (named structs are added into components)
+func (doc *OpenAPI) Schema(t reflect.Type) map[string]interface{} {
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case reflect.TypeOf(time.Duration(0)):
+		return map[string]interface{}{"type": "integer", "format": "int64", "description": "duration in nanoseconds"}
+	case reflect.TypeOf(json.RawMessage{}), reflect.TypeOf(anyValue{}):
+		return map[string]interface{}{}
+	case reflect.TypeOf([]byte{}):
+		return map[string]interface{}{"type": "string", "format": "byte"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := doc.Schema(t.Elem())
+		if _, ok := s["$ref"]; ok {
+			return map[string]interface{}{"allOf": []interface{}{s}, "nullable": true}
+		}
+		s["nullable"] = true
+		return s
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": doc.Schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": doc.Schema(t.Elem())}
+	case reflect.Struct:
+		name := schemaName(t)
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			// placeholder for recursive types
+			doc.Components.Schemas[name] = map[string]interface{}{}
+			doc.Components.Schemas[name] = doc.structSchema(t)
+		}
+		return schemaRef(name)
+	}
+
+	return map[string]interface{}{}
+}
+
+func (doc *OpenAPI) structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+
+	var addFields func(t reflect.Type)
+	addFields = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" || f.PkgPath != "" && !f.Anonymous {
+				continue
+			}
+			name := strings.Split(tag, ",")[0]
+			if f.Anonymous && name == "" {
+				ft := f.Type
+				if ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				if ft.Kind() == reflect.Struct {
+					addFields(ft)
+					continue
+				}
+			}
+			if name == "" {
+				name = f.Name
+			}
+
+			properties[name] = doc.Schema(f.Type)
+			if !strings.Contains(tag, ",omitempty") && f.Type.Kind() != reflect.Ptr {
+				required = append(required, name)
+			}
+		}
+	}
+	addFields(t)
+
+	s := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		sort.Strings(required)
+		s["required"] = required
+	}
+
+	return s
+}
+
+func schemaName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	if idx := strings.LastIndex(pkg, "/"); idx >= 0 {
+		pkg = pkg[idx+1:]
+	}
+	return pkg + "." + t.Name()
+}
+
+func schemaRef(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+// JSON - OpenAPI document json
+func (doc *OpenAPI) JSON() (body []byte, err *mft.Error) {
+	body, er0 := json.MarshalIndent(doc, "", "  ")
+	if er0 != nil {
+		return nil, GenerateErrorE(10123000, er0)
+	}
+	return body, nil
+}
@@ -0,0 +1,117 @@
+package cluster
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// clusterOps - values of Op* constants of cn/cluster.go
+func clusterOps(t *testing.T) []string {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "../cn/cluster.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ops []string
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			vs := spec.(*ast.ValueSpec)
+			for i, name := range vs.Names {
+				if !strings.HasPrefix(name.Name, "Op") || i >= len(vs.Values) {
+					continue
+				}
+				lit, ok := vs.Values[i].(*ast.BasicLit)
+				if !ok || lit.Kind != token.STRING {
+					t.Fatalf("cn.%v should be string literal", name.Name)
+				}
+				op, err := strconv.Unquote(lit.Value)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ops = append(ops, op)
+			}
+		}
+	}
+
+	return ops
+}
+
+func TestOpSchemas_AllOps(t *testing.T) {
+	ops := clusterOps(t)
+	if len(ops) == 0 {
+		t.Fatal("cn/cluster.go ops are not found")
+	}
+
+	known := make(map[string]bool)
+	for _, op := range ops {
+		known[op] = true
+		if _, ok := GetOpSchema(op); !ok {
+			t.Errorf("op `%v` has no schema in OpSchemas", op)
+		}
+	}
+
+	described := make(map[string]bool)
+	for _, s := range OpSchemas {
+		if !known[s.Op] {
+			t.Errorf("OpSchemas op `%v` is not an op of cn/cluster.go", s.Op)
+		}
+		if described[s.Op] {
+			t.Errorf("OpSchemas op `%v` is described twice", s.Op)
+		}
+		described[s.Op] = true
+	}
+}
+
+func TestOpenAPIGenerate(t *testing.T) {
+	body, err := OpenAPIGenerate("test", "1", "/cluster").JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc map[string]interface{}
+	if er0 := json.Unmarshal(body, &doc); er0 != nil {
+		t.Fatal(er0)
+	}
+
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	ops := doc["x-ops"].(map[string]interface{})
+	if len(ops) != len(OpSchemas) {
+		t.Errorf("x-ops should contain %v ops not %v", len(OpSchemas), len(ops))
+	}
+
+	// every $ref should be resolved
+	var check func(v interface{})
+	check = func(v interface{}) {
+		switch x := v.(type) {
+		case map[string]interface{}:
+			if ref, ok := x["$ref"].(string); ok {
+				name := strings.TrimPrefix(ref, "#/components/schemas/")
+				if _, ok := schemas[name]; !ok {
+					t.Errorf("$ref `%v` is not resolved", ref)
+				}
+			}
+			for _, item := range x {
+				check(item)
+			}
+		case []interface{}:
+			for _, item := range x {
+				check(item)
+			}
+		}
+	}
+	check(doc)
+
+	if _, ok := schemas["cluster.QueueAddListRequest"]; !ok {
+		t.Errorf("schema cluster.QueueAddListRequest should be generated")
+	}
+}
@@ -0,0 +1,45 @@
+package resp
+
+import (
+	"fmt"
+
+	"github.com/myfantasy/mft"
+)
+
+// Errors codes and description
+var Errors map[int]string = map[int]string{
+	10194000: "Server.ListenAndServe: listen `%v` fail",
+	10194001: "Server: protocol error near `%v`",
+	10194002: "Server.Serve: accept fail",
+	10194003: "Server: write reply fail",
+
+	10194100: "wrong number of arguments for '%v' command",
+	10194101: "syntax error",
+	10194102: "value `%v` is not an integer or out of range",
+	10194103: "invalid stream ID `%v`",
+	10194104: "only `*` ID is supported by XADD",
+	10194105: "queue `%v` does not exists",
+	10194106: "wrong number of fields of XADD",
+	10194107: "unknown command '%v'",
+	10194108: "unknown XGROUP subcommand '%v'",
+	10194109: "unbalanced list of streams and IDs of '%v' command",
+
+	10194200: "Server: AUTH of user `%v` fail",
+	10194201: "Authentication required",
+}
+
+// GenerateError -
+func GenerateError(key int, a ...interface{}) *mft.Error {
+	if text, ok := Errors[key]; ok {
+		return mft.ErrorCS(key, fmt.Sprintf(text, a...))
+	}
+	panic(fmt.Sprintf("resp.GenerateError, error not found code:%v", key))
+}
+
+// GenerateErrorE -
+func GenerateErrorE(key int, err error, a ...interface{}) *mft.Error {
+	if text, ok := Errors[key]; ok {
+		return mft.ErrorCSE(key, fmt.Sprintf(text, a...), err)
+	}
+	panic(fmt.Sprintf("resp.GenerateErrorE, error not found code:%v error:%v", key, err))
+}
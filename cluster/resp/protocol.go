@@ -0,0 +1,127 @@
+package resp
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var (
+	// MaxArgs - max count of arguments of command
+	MaxArgs = 1024 * 1024
+	// MaxBulkSize - max size of argument of command
+	MaxBulkSize = 100 * 1024 * 1024
+)
+
+// respReader - reader of commands (array of bulk strings or inline command)
+type respReader struct {
+	br *bufio.Reader
+}
+
+func (r *respReader) line() (string, error) {
+	line, err := r.br.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// command - arguments of next command; empty command (inline empty line) is skipped
+func (r *respReader) command() (args []string, err error) {
+	for {
+		line, err := r.line()
+		if err != nil {
+			return nil, err
+		}
+		if line == "" {
+			continue
+		}
+
+		if line[0] != '*' {
+			args = strings.Fields(line)
+			if len(args) == 0 {
+				continue
+			}
+			return args, nil
+		}
+
+		n, er0 := strconv.Atoi(line[1:])
+		if er0 != nil || n > MaxArgs {
+			return nil, GenerateError(10194001, line)
+		}
+		if n <= 0 {
+			continue
+		}
+
+		args = make([]string, n)
+		for i := 0; i < n; i++ {
+			line, err := r.line()
+			if err != nil {
+				return nil, err
+			}
+			if line == "" || line[0] != '$' {
+				return nil, GenerateError(10194001, line)
+			}
+			size, er0 := strconv.Atoi(line[1:])
+			if er0 != nil || size < 0 || size > MaxBulkSize {
+				return nil, GenerateError(10194001, line)
+			}
+			b := make([]byte, size+2)
+			if _, err := io.ReadFull(r.br, b); err != nil {
+				return nil, err
+			}
+			args[i] = string(b[:size])
+		}
+		return args, nil
+	}
+}
+
+// respWriter - writer of replies
+type respWriter struct {
+	bw *bufio.Writer
+}
+
+func (w *respWriter) simple(s string) {
+	w.bw.WriteByte('+')
+	w.bw.WriteString(s)
+	w.bw.WriteString("\r\n")
+}
+
+// error - error reply; prefix is error kind (ERR, NOAUTH, NOPERM ...)
+func (w *respWriter) error(prefix string, msg string) {
+	msg = strings.NewReplacer("\r", " ", "\n", " ").Replace(msg)
+	w.bw.WriteByte('-')
+	w.bw.WriteString(prefix)
+	w.bw.WriteByte(' ')
+	w.bw.WriteString(msg)
+	w.bw.WriteString("\r\n")
+}
+
+func (w *respWriter) integer(v int64) {
+	w.bw.WriteByte(':')
+	w.bw.WriteString(strconv.FormatInt(v, 10))
+	w.bw.WriteString("\r\n")
+}
+
+func (w *respWriter) bulk(s string) {
+	w.bw.WriteByte('$')
+	w.bw.WriteString(strconv.Itoa(len(s)))
+	w.bw.WriteString("\r\n")
+	w.bw.WriteString(s)
+	w.bw.WriteString("\r\n")
+}
+
+func (w *respWriter) nullBulk() {
+	w.bw.WriteString("$-1\r\n")
+}
+
+func (w *respWriter) array(n int) {
+	w.bw.WriteByte('*')
+	w.bw.WriteString(strconv.Itoa(n))
+	w.bw.WriteString("\r\n")
+}
+
+func (w *respWriter) nullArray() {
+	w.bw.WriteString("*-1\r\n")
+}
@@ -0,0 +1,364 @@
+package resp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/capella-pw/queue/cluster"
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/queue"
+	"github.com/myfantasy/mft"
+)
+
+var (
+	// CallTimeoutDefault - timeout of cluster calls when Server.CallTimeout is not set
+	CallTimeoutDefault = time.Second * 30
+	// MaxCountDefault - max count of entries of reply when Server.MaxCount is not set (and COUNT is not set)
+	MaxCountDefault = 10000
+	// PollInterval - interval of checking of queues that do not implement queue.AppendNotifier
+	PollInterval = time.Millisecond * 100
+)
+
+// Server - listener that speaks RESP (redis protocol) with subset of redis streams commands
+//
+//	stream   - queue
+//	entry id - `<message id>-0`
+//	group    - subscriber of queue; XACK moves last read id of subscriber over acknowledged prefix
+//
+// commands: AUTH, PING, ECHO, SELECT, CLIENT, COMMAND, QUIT,
+// XADD, XRANGE, XREVRANGE, XLEN, XREAD, XREADGROUP, XACK, XGROUP (CREATE, SETID, DESTROY)
+type Server struct {
+	Cluster cluster.Cluster
+	// CheckAuth - clients should authenticate with AUTH; when is not set AUTH always fails
+	CheckAuth cluster.CheckAuthFunc
+
+	CallTimeout time.Duration
+	MaxCount    int
+
+	ThrowErrorFunc func(err *mft.Error) bool
+
+	mx     sync.Mutex
+	ln     net.Listener
+	conns  map[net.Conn]struct{}
+	closed bool
+	done   chan struct{}
+
+	mxGroups sync.Mutex
+	groups   map[groupKey]*groupState
+}
+
+// ServerCreate - resp server of cluster
+func ServerCreate(cl cluster.Cluster, checkAuth cluster.CheckAuthFunc) *Server {
+	return &Server{
+		Cluster:   cl,
+		CheckAuth: checkAuth,
+	}
+}
+
+func (s *Server) init() {
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]struct{})
+	}
+	if s.done == nil {
+		s.done = make(chan struct{})
+	}
+}
+
+// ListenAndServe - listen tcp addr and serve connections until Close
+func (s *Server) ListenAndServe(addr string) (err *mft.Error) {
+	ln, er0 := net.Listen("tcp", addr)
+	if er0 != nil {
+		return GenerateErrorE(10194000, er0, addr)
+	}
+	return s.Serve(ln)
+}
+
+// Serve - serve connections of listener until Close
+func (s *Server) Serve(ln net.Listener) (err *mft.Error) {
+	s.mx.Lock()
+	if s.closed {
+		s.mx.Unlock()
+		ln.Close()
+		return nil
+	}
+	s.init()
+	s.ln = ln
+	s.mx.Unlock()
+
+	for {
+		conn, er0 := ln.Accept()
+		if er0 != nil {
+			s.mx.Lock()
+			closed := s.closed
+			s.mx.Unlock()
+			if closed {
+				return nil
+			}
+			return GenerateErrorE(10194002, er0)
+		}
+
+		s.mx.Lock()
+		if s.closed {
+			s.mx.Unlock()
+			conn.Close()
+			return nil
+		}
+		s.conns[conn] = struct{}{}
+		s.mx.Unlock()
+
+		go s.serveConn(conn)
+	}
+}
+
+// Close - stop listener and close connections
+func (s *Server) Close() {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.init()
+	close(s.done)
+	if s.ln != nil {
+		s.ln.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func (s *Server) throwError(err *mft.Error) {
+	if s.ThrowErrorFunc != nil {
+		s.ThrowErrorFunc(err)
+	}
+}
+
+func (s *Server) callTimeout() time.Duration {
+	if s.CallTimeout > 0 {
+		return s.CallTimeout
+	}
+	return CallTimeoutDefault
+}
+
+func (s *Server) maxCount() int {
+	if s.MaxCount > 0 {
+		return s.MaxCount
+	}
+	return MaxCountDefault
+}
+
+// respConn - state of client connection
+type respConn struct {
+	s *Server
+	r *respReader
+	w *respWriter
+
+	user          cn.CapUser
+	authenticated bool
+	quit          bool
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.mx.Lock()
+		delete(s.conns, conn)
+		s.mx.Unlock()
+	}()
+
+	c := &respConn{
+		s: s,
+		r: &respReader{br: bufio.NewReader(conn)},
+		w: &respWriter{bw: bufio.NewWriter(conn)},
+	}
+
+	for !c.quit {
+		args, er0 := c.r.command()
+		if er0 != nil {
+			if err, ok := er0.(*mft.Error); ok {
+				c.w.error("ERR", err.Msg)
+				c.w.bw.Flush()
+			}
+			return
+		}
+
+		c.call(args)
+
+		if er0 := c.w.bw.Flush(); er0 != nil {
+			s.throwError(GenerateErrorE(10194003, er0))
+			return
+		}
+	}
+}
+
+// call - call command and write reply
+func (c *respConn) call(args []string) {
+	name := strings.ToUpper(args[0])
+
+	if !c.authenticated && name != "AUTH" && name != "QUIT" && name != "PING" {
+		c.w.error("NOAUTH", GenerateError(10194201).Msg)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.s.callTimeout())
+	defer cancel()
+
+	var err *mft.Error
+	switch name {
+	case "PING":
+		if len(args) > 1 {
+			c.w.bulk(args[1])
+		} else {
+			c.w.simple("PONG")
+		}
+	case "ECHO":
+		if len(args) != 2 {
+			err = GenerateError(10194100, args[0])
+			break
+		}
+		c.w.bulk(args[1])
+	case "QUIT":
+		c.quit = true
+		c.w.simple("OK")
+	case "SELECT", "CLIENT":
+		c.w.simple("OK")
+	case "COMMAND":
+		c.w.array(0)
+	case "AUTH":
+		err = c.auth(ctx, args)
+	case "XADD":
+		err = c.xadd(ctx, args)
+	case "XRANGE":
+		err = c.xrange(ctx, args, false)
+	case "XREVRANGE":
+		err = c.xrange(ctx, args, true)
+	case "XLEN":
+		err = c.xlen(ctx, args)
+	case "XREAD":
+		err = c.xread(args)
+	case "XREADGROUP":
+		err = c.xreadgroup(args)
+	case "XACK":
+		err = c.xack(ctx, args)
+	case "XGROUP":
+		err = c.xgroup(ctx, args)
+	default:
+		err = GenerateError(10194107, args[0])
+	}
+
+	if err != nil {
+		c.writeError(err)
+	}
+}
+
+// writeError - errors of command are written as is; cluster errors are written with codes
+func (c *respConn) writeError(err *mft.Error) {
+	if _, ok := Errors[err.Code]; ok {
+		c.w.error("ERR", err.Msg)
+		return
+	}
+
+	c.s.throwError(err)
+	if cluster.IsPermissionDenied(err) {
+		c.w.error("NOPERM", err.Error())
+		return
+	}
+	c.w.error("ERR", err.Error())
+}
+
+// auth - `AUTH password` (empty user name) or `AUTH username password`
+func (c *respConn) auth(ctx context.Context, args []string) *mft.Error {
+	var userName, pwd string
+	switch len(args) {
+	case 2:
+		pwd = args[1]
+	case 3:
+		userName, pwd = args[1], args[2]
+	default:
+		return GenerateError(10194100, args[0])
+	}
+
+	if c.s.CheckAuth == nil {
+		c.w.error("WRONGPASS", "invalid username-password pair or user is disabled.")
+		return nil
+	}
+
+	pwdJSON, er0 := json.Marshal(pwd)
+	if er0 != nil {
+		return GenerateErrorE(10194200, er0, userName)
+	}
+
+	sr := &cluster.ServiceRequest{
+		UserName:             userName,
+		AuthentificationInfo: pwdJSON,
+		Request:              &cluster.RequestBody{},
+	}
+	ok, failResponce := c.s.CheckAuth(ctx, sr)
+	if !ok {
+		if failResponce.Err != nil {
+			c.s.throwError(GenerateErrorE(10194200, failResponce.Err, userName))
+		}
+		c.w.error("WRONGPASS", "invalid username-password pair or user is disabled.")
+		return nil
+	}
+
+	c.user = sr.Request
+	c.authenticated = true
+	c.w.simple("OK")
+	return nil
+}
+
+// getQueue - queue of stream; exists == false when queue does not exist
+func (c *respConn) getQueue(ctx context.Context, name string) (q queue.Queue, exists bool, err *mft.Error) {
+	return c.s.Cluster.GetQueue(ctx, c.user, name)
+}
+
+// waitAny - wait any of channels, timeout (timeout <= 0 - no timeout) or close of server
+func (s *Server) waitAny(chs []<-chan struct{}, timeout time.Duration) {
+	if len(chs) == 0 && (timeout <= 0 || timeout > PollInterval) {
+		timeout = PollInterval
+	}
+
+	var timer <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timer = t.C
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	signal := make(chan struct{}, 1)
+	for _, ch := range chs {
+		go func(ch <-chan struct{}) {
+			select {
+			case <-ch:
+				select {
+				case signal <- struct{}{}:
+				default:
+				}
+			case <-stop:
+			}
+		}(ch)
+	}
+
+	select {
+	case <-signal:
+	case <-timer:
+	case <-s.done:
+	}
+}
+
+func (s *Server) isClosed() bool {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.closed
+}
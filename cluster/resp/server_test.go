@@ -0,0 +1,468 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/capella-pw/queue/cluster"
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/queue"
+	"github.com/capella-pw/queue/storage"
+	"github.com/myfantasy/mft"
+)
+
+// testCluster - cluster with queues only
+type testCluster struct {
+	cluster.Cluster
+
+	gen    *mft.G
+	queues map[string]queue.Queue
+}
+
+func (tc *testCluster) GetQueue(ctx context.Context, user cn.CapUser, name string) (q queue.Queue, exists bool, err *mft.Error) {
+	q, exists = tc.queues[name]
+	return q, exists, nil
+}
+func (tc *testCluster) GetNextId(ctx context.Context, user cn.CapUser) (id int64, err *mft.Error) {
+	return tc.gen.RvGetPart(), nil
+}
+
+// testClient - in-process resp client
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func testServer(t *testing.T, checkAuth cluster.CheckAuthFunc) (s *Server, tc *testCluster, addr string) {
+	tc = &testCluster{
+		gen:    &mft.G{},
+		queues: make(map[string]queue.Queue),
+	}
+	tc.queues["q1"] = queue.CreateSimpleQueue(5, 0, 0, storage.CreateMapSorage(), nil, nil, tc.gen)
+
+	ln, er0 := net.Listen("tcp", "127.0.0.1:0")
+	if er0 != nil {
+		t.Fatal(er0)
+	}
+
+	s = ServerCreate(tc, checkAuth)
+	s.ThrowErrorFunc = func(err *mft.Error) bool {
+		t.Log(err)
+		return true
+	}
+	go s.Serve(ln)
+
+	return s, tc, ln.Addr().String()
+}
+
+func testDial(t *testing.T, addr string) *testClient {
+	conn, er0 := net.Dial("tcp", addr)
+	if er0 != nil {
+		t.Fatal(er0)
+	}
+	return &testClient{t: t, conn: conn, br: bufio.NewReader(conn)}
+}
+
+// testCheckAuth - any user is authenticated
+func testCheckAuth(ctx context.Context, serviceRequest *cluster.ServiceRequest) (ok bool, failResponce cluster.ResponceBody) {
+	serviceRequest.Request.User = serviceRequest.UserName
+	return true, failResponce
+}
+
+// testDialAuth - connection authenticated as `test`
+func testDialAuth(t *testing.T, addr string) *testClient {
+	c := testDial(t, addr)
+	if r := c.do("AUTH", "test", ""); r != "OK" {
+		t.Fatalf("AUTH reply %#v", r)
+	}
+	return c
+}
+
+// do - send command and read reply: string, int64, []interface{}, nil or error
+func (c *testClient) do(args ...string) interface{} {
+	var sb strings.Builder
+	sb.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, a := range args {
+		sb.WriteString("$" + strconv.Itoa(len(a)) + "\r\n" + a + "\r\n")
+	}
+	if _, er0 := c.conn.Write([]byte(sb.String())); er0 != nil {
+		c.t.Fatal(er0)
+	}
+
+	c.conn.SetReadDeadline(time.Now().Add(time.Second * 10))
+	return c.reply()
+}
+
+func (c *testClient) reply() interface{} {
+	line, er0 := c.br.ReadString('\n')
+	if er0 != nil {
+		c.t.Fatal(er0)
+	}
+	line = strings.TrimRight(line, "\r\n")
+
+	switch line[0] {
+	case '+':
+		return line[1:]
+	case '-':
+		return errors.New(line[1:])
+	case ':':
+		v, _ := strconv.ParseInt(line[1:], 10, 64)
+		return v
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return nil
+		}
+		b := make([]byte, n+2)
+		if _, er0 := io.ReadFull(c.br, b); er0 != nil {
+			c.t.Fatal(er0)
+		}
+		return string(b[:n])
+	case '*':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return nil
+		}
+		arr := make([]interface{}, n)
+		for i := range arr {
+			arr[i] = c.reply()
+		}
+		return arr
+	}
+	c.t.Fatalf("unknown reply `%v`", line)
+	return nil
+}
+
+// testEntries - ids and fields of entries of reply
+func testEntries(t *testing.T, reply interface{}) (ids []string, fields [][]string) {
+	arr, ok := reply.([]interface{})
+	if !ok {
+		t.Fatalf("entries expected actual %#v", reply)
+	}
+	for _, e := range arr {
+		entry := e.([]interface{})
+		ids = append(ids, entry[0].(string))
+		var f []string
+		for _, v := range entry[1].([]interface{}) {
+			f = append(f, v.(string))
+		}
+		fields = append(fields, f)
+	}
+	return ids, fields
+}
+
+// testStreamEntries - entries of stream of XREAD reply
+func testStreamEntries(t *testing.T, reply interface{}, key string) (ids []string, fields [][]string) {
+	arr, ok := reply.([]interface{})
+	if !ok {
+		t.Fatalf("streams expected actual %#v", reply)
+	}
+	for _, s := range arr {
+		stream := s.([]interface{})
+		if stream[0].(string) == key {
+			return testEntries(t, stream[1])
+		}
+	}
+	return nil, nil
+}
+
+func TestServer_Streams(t *testing.T) {
+	s, tc, addr := testServer(t, testCheckAuth)
+	defer s.Close()
+
+	c := testDialAuth(t, addr)
+	defer c.conn.Close()
+
+	if r := c.do("PING"); r != "PONG" {
+		t.Fatalf("PING reply %#v", r)
+	}
+
+	// XADD
+	id1, ok := c.do("XADD", "q1", "*", "message", "hello").(string)
+	if !ok || !strings.HasSuffix(id1, "-0") {
+		t.Fatalf("XADD reply %#v", id1)
+	}
+	id2, _ := c.do("XADD", "q1", "MAXLEN", "~", "100", "*", "a", "1", "b", "2").(string)
+	id3, _ := c.do("XADD", "q1", "*", "message", "last").(string)
+	if _, ok := c.do("XADD", "q2", "*", "a", "1").(error); !ok {
+		t.Fatalf("XADD into not existing queue should fail")
+	}
+	if _, ok := c.do("XADD", "q1", "1-1", "a", "1").(error); !ok {
+		t.Fatalf("XADD with explicit id should fail")
+	}
+
+	// message with only `message` field is stored as is
+	messages, err := tc.queues["q1"].Get(context.Background(), nil, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 3 || string(messages[0].Message) != "hello" {
+		t.Fatalf("XADD messages %v", messages)
+	}
+
+	// XLEN
+	if r := c.do("XLEN", "q1"); r != int64(3) {
+		t.Fatalf("XLEN reply %#v", r)
+	}
+	if r := c.do("XLEN", "q2"); r != int64(0) {
+		t.Fatalf("XLEN of not existing queue reply %#v", r)
+	}
+
+	// XRANGE
+	ids, fields := testEntries(t, c.do("XRANGE", "q1", "-", "+"))
+	if len(ids) != 3 || ids[0] != id1 || ids[1] != id2 || ids[2] != id3 {
+		t.Fatalf("XRANGE ids %v", ids)
+	}
+	if strings.Join(fields[0], ",") != "message,hello" || strings.Join(fields[1], ",") != "a,1,b,2" {
+		t.Fatalf("XRANGE fields %v", fields)
+	}
+	ids, _ = testEntries(t, c.do("XRANGE", "q1", id2, "+", "COUNT", "1"))
+	if len(ids) != 1 || ids[0] != id2 {
+		t.Fatalf("XRANGE from id ids %v", ids)
+	}
+	ids, _ = testEntries(t, c.do("XRANGE", "q1", "("+id1, "("+id3))
+	if len(ids) != 1 || ids[0] != id2 {
+		t.Fatalf("XRANGE exclusive ids %v", ids)
+	}
+	ids, _ = testEntries(t, c.do("XREVRANGE", "q1", "+", "-", "COUNT", "2"))
+	if len(ids) != 2 || ids[0] != id3 || ids[1] != id2 {
+		t.Fatalf("XREVRANGE ids %v", ids)
+	}
+
+	// XREAD
+	ids, _ = testStreamEntries(t, c.do("XREAD", "COUNT", "2", "STREAMS", "q1", "0"), "q1")
+	if len(ids) != 2 || ids[0] != id1 {
+		t.Fatalf("XREAD ids %v", ids)
+	}
+	if r := c.do("XREAD", "STREAMS", "q1", id3); r != nil {
+		t.Fatalf("XREAD after last reply %#v", r)
+	}
+
+	// XREAD BLOCK is woken up by XADD
+	{
+		done := make(chan interface{})
+		go func() {
+			bc := testDialAuth(t, addr)
+			defer bc.conn.Close()
+			done <- bc.do("XREAD", "BLOCK", "5000", "STREAMS", "q1", "$")
+		}()
+
+		time.Sleep(time.Millisecond * 100)
+		start := time.Now()
+		id4, _ := c.do("XADD", "q1", "*", "message", "new").(string)
+
+		ids, fields := testStreamEntries(t, <-done, "q1")
+		if len(ids) != 1 || ids[0] != id4 || fields[0][1] != "new" {
+			t.Fatalf("XREAD BLOCK ids %v", ids)
+		}
+		if time.Since(start) > time.Second*2 {
+			t.Fatalf("XREAD BLOCK is not woken up by XADD")
+		}
+	}
+	if r := c.do("XREAD", "BLOCK", "50", "STREAMS", "q1", "$"); r != nil {
+		t.Fatalf("XREAD BLOCK timeout reply %#v", r)
+	}
+
+	// consumer group
+	{
+		if r := c.do("XGROUP", "CREATE", "q1", "g", "0"); r != "OK" {
+			t.Fatalf("XGROUP CREATE reply %#v", r)
+		}
+
+		ids, _ := testStreamEntries(t, c.do("XREADGROUP", "GROUP", "g", "c1", "COUNT", "2", "STREAMS", "q1", ">"), "q1")
+		if len(ids) != 2 || ids[0] != id1 || ids[1] != id2 {
+			t.Fatalf("XREADGROUP ids %v", ids)
+		}
+		// next consumer gets next messages
+		ids, _ = testStreamEntries(t, c.do("XREADGROUP", "GROUP", "g", "c2", "COUNT", "1", "STREAMS", "q1", ">"), "q1")
+		if len(ids) != 1 || ids[0] != id3 {
+			t.Fatalf("XREADGROUP of second consumer ids %v", ids)
+		}
+
+		// pending messages
+		ids, _ = testStreamEntries(t, c.do("XREADGROUP", "GROUP", "g", "c1", "STREAMS", "q1", "0"), "q1")
+		if len(ids) != 3 {
+			t.Fatalf("XREADGROUP pending ids %v", ids)
+		}
+
+		if r := c.do("XACK", "q1", "g", id1, id2); r != int64(2) {
+			t.Fatalf("XACK reply %#v", r)
+		}
+		msgID, _, _ := parseID(id2)
+		lastRead, err := tc.queues["q1"].SubscriberGetLastRead(context.Background(), nil, "g")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lastRead != msgID {
+			t.Fatalf("XACK last read of subscriber expect %v actual %v", msgID, lastRead)
+		}
+
+		ids, _ = testStreamEntries(t, c.do("XREADGROUP", "GROUP", "g", "c1", "STREAMS", "q1", "0"), "q1")
+		if len(ids) != 1 || ids[0] != id3 {
+			t.Fatalf("XREADGROUP pending after ack ids %v", ids)
+		}
+
+		if r := c.do("XGROUP", "DESTROY", "q1", "g"); r != int64(1) {
+			t.Fatalf("XGROUP DESTROY reply %#v", r)
+		}
+		lastRead, _ = tc.queues["q1"].SubscriberGetLastRead(context.Background(), nil, "g")
+		if lastRead != 0 {
+			t.Fatalf("XGROUP DESTROY should remove subscriber")
+		}
+	}
+
+	// fields that are stored as json array
+	var stored []string
+	messages, _ = tc.queues["q1"].Get(context.Background(), nil, 0, 10)
+	if er0 := json.Unmarshal(messages[1].Message, &stored); er0 != nil || len(stored) != 4 {
+		t.Fatalf("XADD fields should be stored as json array `%s`", messages[1].Message)
+	}
+
+	if _, ok := c.do("UNKNOWN").(error); !ok {
+		t.Fatalf("unknown command should fail")
+	}
+}
+
+func TestServer_StreamsGroupAck(t *testing.T) {
+	s, tc, addr := testServer(t, testCheckAuth)
+	defer s.Close()
+
+	c1 := testDialAuth(t, addr)
+	defer c1.conn.Close()
+	c2 := testDialAuth(t, addr)
+	defer c2.conn.Close()
+
+	var ids []string
+	for i := 0; i < 4; i++ {
+		id, _ := c1.do("XADD", "q1", "*", "message", strconv.Itoa(i)).(string)
+		ids = append(ids, id)
+	}
+	if r := c1.do("XGROUP", "CREATE", "q1", "g", "0"); r != "OK" {
+		t.Fatalf("XGROUP CREATE reply %#v", r)
+	}
+
+	lastRead := func() string {
+		id, err := tc.queues["q1"].SubscriberGetLastRead(context.Background(), nil, "g")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return formatID(id)
+	}
+
+	// c1 gets ids[0], ids[1]; c2 gets ids[2], ids[3]
+	got, _ := testStreamEntries(t, c1.do("XREADGROUP", "GROUP", "g", "c1", "COUNT", "2", "STREAMS", "q1", ">"), "q1")
+	if len(got) != 2 || got[0] != ids[0] {
+		t.Fatalf("XREADGROUP of c1 ids %v", got)
+	}
+	got, _ = testStreamEntries(t, c2.do("XREADGROUP", "GROUP", "g", "c2", "COUNT", "2", "STREAMS", "q1", ">"), "q1")
+	if len(got) != 2 || got[0] != ids[2] {
+		t.Fatalf("XREADGROUP of c2 ids %v", got)
+	}
+
+	// ack of c2 does not acknowledge messages of c1
+	if r := c2.do("XACK", "q1", "g", ids[3], ids[2], ids[3]); r != int64(2) {
+		t.Fatalf("XACK of c2 reply %#v", r)
+	}
+	if lr := lastRead(); lr != "0-0" {
+		t.Fatalf("XACK of c2 should not move last read of group: %v", lr)
+	}
+	got, _ = testStreamEntries(t, c1.do("XREADGROUP", "GROUP", "g", "c1", "STREAMS", "q1", "0"), "q1")
+	if len(got) != 2 || got[0] != ids[0] || got[1] != ids[1] {
+		t.Fatalf("XREADGROUP pending should contain not acknowledged messages of c1 %v", got)
+	}
+
+	// last read is moved over acknowledged prefix
+	if r := c1.do("XACK", "q1", "g", ids[1]); r != int64(1) {
+		t.Fatalf("XACK of c1 reply %#v", r)
+	}
+	if lr := lastRead(); lr != "0-0" {
+		t.Fatalf("XACK of c1 should not move last read of group over ids[0]: %v", lr)
+	}
+	if r := c1.do("XACK", "q1", "g", ids[0]); r != int64(1) {
+		t.Fatalf("XACK of c1 reply %#v", r)
+	}
+	if lr := lastRead(); lr != ids[3] {
+		t.Fatalf("XACK should move last read of group to %v not %v", ids[3], lr)
+	}
+	got, _ = testStreamEntries(t, c1.do("XREADGROUP", "GROUP", "g", "c1", "STREAMS", "q1", "0"), "q1")
+	if len(got) != 0 {
+		t.Fatalf("XREADGROUP pending after ack ids %v", got)
+	}
+}
+
+func TestServer_Auth(t *testing.T) {
+	checkAuth := func(ctx context.Context, serviceRequest *cluster.ServiceRequest) (ok bool, failResponce cluster.ResponceBody) {
+		var pwd string
+		json.Unmarshal(serviceRequest.AuthentificationInfo, &pwd)
+		if serviceRequest.UserName != "user" || pwd != "pwd" {
+			return false, failResponce
+		}
+		serviceRequest.Request.User = serviceRequest.UserName
+		return true, failResponce
+	}
+
+	s, _, addr := testServer(t, checkAuth)
+	defer s.Close()
+
+	c := testDial(t, addr)
+	defer c.conn.Close()
+
+	if r, ok := c.do("XLEN", "q1").(error); !ok || !strings.HasPrefix(r.Error(), "NOAUTH") {
+		t.Fatalf("XLEN before AUTH reply %#v", r)
+	}
+	if r, ok := c.do("AUTH", "user", "bad").(error); !ok || !strings.HasPrefix(r.Error(), "WRONGPASS") {
+		t.Fatalf("AUTH with wrong password reply %#v", r)
+	}
+	if r := c.do("AUTH", "user", "pwd"); r != "OK" {
+		t.Fatalf("AUTH reply %#v", r)
+	}
+	if r := c.do("XLEN", "q1"); r != int64(0) {
+		t.Fatalf("XLEN after AUTH reply %#v", r)
+	}
+}
+
+func TestServer_NoCheckAuth(t *testing.T) {
+	s, _, addr := testServer(t, nil)
+	defer s.Close()
+
+	c := testDial(t, addr)
+	defer c.conn.Close()
+
+	if r, ok := c.do("AUTH", "test", "").(error); !ok || !strings.HasPrefix(r.Error(), "WRONGPASS") {
+		t.Fatalf("AUTH without CheckAuth reply %#v", r)
+	}
+	if r, ok := c.do("XLEN", "q1").(error); !ok || !strings.HasPrefix(r.Error(), "NOAUTH") {
+		t.Fatalf("XLEN without CheckAuth reply %#v", r)
+	}
+}
+
+func TestRespConn_writeError(t *testing.T) {
+	tests := []struct {
+		err    *mft.Error
+		prefix string
+	}{
+		{cluster.GenerateErrorE(10121009, cluster.GenerateError(10111100, "q1")), "-NOPERM "},
+		{mft.ErrorS("Permission denied"), "-ERR "},
+		{GenerateError(10194107, "X"), "-ERR "},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		c := &respConn{s: &Server{}, w: &respWriter{bw: bufio.NewWriter(&buf)}}
+		c.writeError(tt.err)
+		c.w.bw.Flush()
+		if !strings.HasPrefix(buf.String(), tt.prefix) {
+			t.Errorf("respConn.writeError of %v should start with %q: %q", tt.err, tt.prefix, buf.String())
+		}
+	}
+}
@@ -0,0 +1,850 @@
+package resp
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/queue"
+	"github.com/myfantasy/mft"
+)
+
+// MessageField - field of entry that is message body;
+// entry with only this field is stored as is, other entries are stored as json array of fields and values
+const MessageField = "message"
+
+// readBatch - count of messages of one queue call of scan
+const readBatch = 1000
+
+// groupState - last delivered id and acknowledged ids of consumer group
+// (is not stored: after restart delivery starts from last read id)
+type groupState struct {
+	mx        sync.Mutex
+	loaded    bool
+	delivered int64
+	// acked - acknowledged ids > last read id; last read id is moved over acknowledged prefix of delivered ids
+	acked map[int64]struct{}
+}
+
+type groupKey struct {
+	queue string
+	group string
+}
+
+func (s *Server) group(queueName string, group string) *groupState {
+	s.mxGroups.Lock()
+	defer s.mxGroups.Unlock()
+
+	if s.groups == nil {
+		s.groups = make(map[groupKey]*groupState)
+	}
+	key := groupKey{queue: queueName, group: group}
+	gs, ok := s.groups[key]
+	if !ok {
+		gs = &groupState{}
+		s.groups[key] = gs
+	}
+	return gs
+}
+
+func (s *Server) groupDrop(queueName string, group string) {
+	s.mxGroups.Lock()
+	defer s.mxGroups.Unlock()
+
+	delete(s.groups, groupKey{queue: queueName, group: group})
+}
+
+// formatID - entry id of message id
+func formatID(id int64) string {
+	return strconv.FormatInt(id, 10) + "-0"
+}
+
+// parseID - message id and sequence of entry id `id` or `id-seq`
+func parseID(s string) (id int64, seq int64, err *mft.Error) {
+	idS, seqS := s, ""
+	if i := strings.IndexByte(s, '-'); i > 0 {
+		idS, seqS = s[:i], s[i+1:]
+	}
+	id, er0 := strconv.ParseInt(idS, 10, 64)
+	if er0 != nil || id < 0 {
+		return 0, 0, GenerateError(10194103, s)
+	}
+	if seqS != "" {
+		seq, er0 = strconv.ParseInt(seqS, 10, 64)
+		if er0 != nil || seq < 0 {
+			return 0, 0, GenerateError(10194103, s)
+		}
+	}
+	return id, seq, nil
+}
+
+// rangeStart - messages with id > idStart are in range of start (`-`, `id-seq` or exclusive `(id-seq`)
+func rangeStart(s string) (idStart int64, err *mft.Error) {
+	if s == "-" {
+		return 0, nil
+	}
+	exclusive := strings.HasPrefix(s, "(")
+	id, seq, err := parseID(strings.TrimPrefix(s, "("))
+	if err != nil {
+		return 0, err
+	}
+	if exclusive || seq > 0 || id == 0 {
+		return id, nil
+	}
+	return id - 1, nil
+}
+
+// rangeEnd - messages with id <= idEnd are in range of end (`+`, `id-seq` or exclusive `(id-seq`)
+func rangeEnd(s string) (idEnd int64, err *mft.Error) {
+	if s == "+" {
+		return math.MaxInt64, nil
+	}
+	exclusive := strings.HasPrefix(s, "(")
+	id, seq, err := parseID(strings.TrimPrefix(s, "("))
+	if err != nil {
+		return 0, err
+	}
+	if exclusive && seq == 0 {
+		return id - 1, nil
+	}
+	return id, nil
+}
+
+// messageFields - fields and values of entry of message
+func messageFields(message []byte) []string {
+	var fields []string
+	if len(message) > 0 && message[0] == '[' &&
+		json.Unmarshal(message, &fields) == nil && len(fields) > 0 && len(fields)%2 == 0 {
+		return fields
+	}
+	return []string{MessageField, string(message)}
+}
+
+// fieldsMessage - message of fields and values of entry
+func fieldsMessage(fields []string) []byte {
+	if len(fields) == 2 && fields[0] == MessageField {
+		return []byte(fields[1])
+	}
+	message, er0 := json.Marshal(fields)
+	if er0 != nil {
+		panic(er0)
+	}
+	return message
+}
+
+func (c *respConn) writeEntries(messages []*queue.MessageWithMeta) {
+	c.w.array(len(messages))
+	for _, msg := range messages {
+		c.w.array(2)
+		c.w.bulk(formatID(msg.ID))
+		fields := messageFields(msg.Message)
+		c.w.array(len(fields))
+		for _, f := range fields {
+			c.w.bulk(f)
+		}
+	}
+}
+
+// readRange - messages with idStart < id <= idEnd not more then cnt
+func (c *respConn) readRange(ctx context.Context, q queue.Queue, idStart int64, idEnd int64, cnt int,
+) (messages []*queue.MessageWithMeta, err *mft.Error) {
+	for len(messages) < cnt && idStart < idEnd {
+		limit := cnt - len(messages)
+		if limit > readBatch {
+			limit = readBatch
+		}
+		got, err := q.Get(ctx, c.user, idStart, limit)
+		if err != nil {
+			return nil, err
+		}
+		if len(got) == 0 {
+			break
+		}
+		for _, msg := range got {
+			if msg.ID > idEnd {
+				return messages, nil
+			}
+			messages = append(messages, msg)
+		}
+		idStart = got[len(got)-1].ID
+	}
+	return messages, nil
+}
+
+// parseCount - value of COUNT option
+func parseCount(s string) (cnt int, err *mft.Error) {
+	cnt, er0 := strconv.Atoi(s)
+	if er0 != nil || cnt < 0 {
+		return 0, GenerateError(10194102, s)
+	}
+	return cnt, nil
+}
+
+// xadd - XADD key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold [LIMIT count]] * field value [field value ...]
+// trim options are ignored: retention of queue is set by handlers
+func (c *respConn) xadd(ctx context.Context, args []string) *mft.Error {
+	if len(args) < 5 {
+		return GenerateError(10194100, args[0])
+	}
+
+	i := 2
+options:
+	for i < len(args) {
+		switch strings.ToUpper(args[i]) {
+		case "NOMKSTREAM":
+			i++
+		case "MAXLEN", "MINID":
+			i++
+			if i < len(args) && (args[i] == "=" || args[i] == "~") {
+				i++
+			}
+			i++
+			if i < len(args) && strings.ToUpper(args[i]) == "LIMIT" {
+				i += 2
+			}
+		default:
+			break options
+		}
+	}
+	if i >= len(args) {
+		return GenerateError(10194101)
+	}
+	if args[i] != "*" {
+		return GenerateError(10194104)
+	}
+	fields := args[i+1:]
+	if len(fields) == 0 || len(fields)%2 != 0 {
+		return GenerateError(10194106)
+	}
+
+	q, exists, err := c.getQueue(ctx, args[1])
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return GenerateError(10194105, args[1])
+	}
+
+	id, err := q.Add(ctx, c.user, fieldsMessage(fields), 0, 0, "", 0, cn.QueueSetDefaultMode)
+	if err != nil {
+		return err
+	}
+
+	c.w.bulk(formatID(id))
+	return nil
+}
+
+// xrange - XRANGE key start end [COUNT count] or XREVRANGE key end start [COUNT count]
+// XREVRANGE reads range forward (messages are returned from last)
+func (c *respConn) xrange(ctx context.Context, args []string, rev bool) *mft.Error {
+	if len(args) != 4 && len(args) != 6 {
+		return GenerateError(10194100, args[0])
+	}
+
+	startS, endS := args[2], args[3]
+	if rev {
+		startS, endS = endS, startS
+	}
+	idStart, err := rangeStart(startS)
+	if err != nil {
+		return err
+	}
+	idEnd, err := rangeEnd(endS)
+	if err != nil {
+		return err
+	}
+
+	cnt := c.s.maxCount()
+	if len(args) == 6 {
+		if strings.ToUpper(args[4]) != "COUNT" {
+			return GenerateError(10194101)
+		}
+		cnt, err = parseCount(args[5])
+		if err != nil {
+			return err
+		}
+	}
+
+	q, exists, err := c.getQueue(ctx, args[1])
+	if err != nil {
+		return err
+	}
+	if !exists || cnt == 0 {
+		c.w.array(0)
+		return nil
+	}
+
+	if !rev {
+		messages, err := c.readRange(ctx, q, idStart, idEnd, cnt)
+		if err != nil {
+			return err
+		}
+		c.writeEntries(messages)
+		return nil
+	}
+
+	var last []*queue.MessageWithMeta
+	for {
+		messages, err := c.readRange(ctx, q, idStart, idEnd, readBatch)
+		if err != nil {
+			return err
+		}
+		if len(messages) == 0 {
+			break
+		}
+		last = append(last, messages...)
+		if len(last) > cnt {
+			last = last[len(last)-cnt:]
+		}
+		idStart = messages[len(messages)-1].ID
+	}
+	for i, j := 0, len(last)-1; i < j; i, j = i+1, j-1 {
+		last[i], last[j] = last[j], last[i]
+	}
+	c.writeEntries(last)
+	return nil
+}
+
+// xlen - XLEN key; messages of queue are counted by scan
+func (c *respConn) xlen(ctx context.Context, args []string) *mft.Error {
+	if len(args) != 2 {
+		return GenerateError(10194100, args[0])
+	}
+
+	q, exists, err := c.getQueue(ctx, args[1])
+	if err != nil {
+		return err
+	}
+	if !exists {
+		c.w.integer(0)
+		return nil
+	}
+
+	var cnt int64
+	idStart := int64(0)
+	for {
+		messages, err := q.Get(ctx, c.user, idStart, readBatch)
+		if err != nil {
+			return err
+		}
+		if len(messages) == 0 {
+			break
+		}
+		cnt += int64(len(messages))
+		idStart = messages[len(messages)-1].ID
+	}
+
+	c.w.integer(cnt)
+	return nil
+}
+
+// readArgs - options of XREAD and XREADGROUP
+type readArgs struct {
+	group    string
+	count    int
+	block    time.Duration
+	hasBlock bool
+	noAck    bool
+	keys     []string
+	ids      []string
+}
+
+func parseReadArgs(args []string, group bool) (ra readArgs, err *mft.Error) {
+	ra.count = -1
+	i := 1
+	if group {
+		if len(args) < 4 || strings.ToUpper(args[1]) != "GROUP" {
+			return ra, GenerateError(10194101)
+		}
+		// consumer (args[3]) is not used: messages are delivered to any consumer of group
+		ra.group = args[2]
+		i = 4
+	}
+
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "COUNT":
+			if i+1 >= len(args) {
+				return ra, GenerateError(10194101)
+			}
+			i++
+			ra.count, err = parseCount(args[i])
+			if err != nil {
+				return ra, err
+			}
+		case "BLOCK":
+			if i+1 >= len(args) {
+				return ra, GenerateError(10194101)
+			}
+			i++
+			ms, er0 := strconv.ParseInt(args[i], 10, 64)
+			if er0 != nil || ms < 0 {
+				return ra, GenerateError(10194102, args[i])
+			}
+			ra.block = time.Duration(ms) * time.Millisecond
+			ra.hasBlock = true
+		case "NOACK":
+			if !group {
+				return ra, GenerateError(10194101)
+			}
+			ra.noAck = true
+		case "STREAMS":
+			rest := args[i+1:]
+			if len(rest) == 0 || len(rest)%2 != 0 {
+				return ra, GenerateError(10194109, args[0])
+			}
+			ra.keys = rest[:len(rest)/2]
+			ra.ids = rest[len(rest)/2:]
+			return ra, nil
+		default:
+			return ra, GenerateError(10194101)
+		}
+	}
+
+	return ra, GenerateError(10194100, args[0])
+}
+
+// readResult - entries of stream of XREAD and XREADGROUP
+type readResult struct {
+	key      string
+	messages []*queue.MessageWithMeta
+}
+
+func (c *respConn) writeReadResults(results []readResult) {
+	c.w.array(len(results))
+	for _, r := range results {
+		c.w.array(2)
+		c.w.bulk(r.key)
+		c.writeEntries(r.messages)
+	}
+}
+
+// blockRead - call read until any entries are read or block timeout is expired
+// (read returns notify channels that are got before read)
+func (c *respConn) blockRead(ra readArgs,
+	read func(ctx context.Context) (results []readResult, notify []<-chan struct{}, err *mft.Error),
+) *mft.Error {
+	deadline := time.Now().Add(ra.block)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), c.s.callTimeout())
+		results, notify, err := read(ctx)
+		cancel()
+		if err != nil {
+			return err
+		}
+		if len(results) > 0 {
+			c.writeReadResults(results)
+			return nil
+		}
+
+		if !ra.hasBlock || c.s.isClosed() {
+			c.w.nullArray()
+			return nil
+		}
+		wait := time.Duration(0)
+		if ra.block > 0 {
+			wait = time.Until(deadline)
+			if wait <= 0 {
+				c.w.nullArray()
+				return nil
+			}
+		}
+		c.s.waitAny(notify, wait)
+	}
+}
+
+func (c *respConn) readCount(ra readArgs) int {
+	if ra.count > 0 && ra.count < c.s.maxCount() {
+		return ra.count
+	}
+	return c.s.maxCount()
+}
+
+// xread - XREAD [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+func (c *respConn) xread(args []string) *mft.Error {
+	ra, err := parseReadArgs(args, false)
+	if err != nil {
+		return err
+	}
+
+	queues := make([]queue.Queue, len(ra.keys))
+	starts := make([]int64, len(ra.keys))
+	{
+		ctx, cancel := context.WithTimeout(context.Background(), c.s.callTimeout())
+		defer cancel()
+
+		for i, key := range ra.keys {
+			q, exists, err := c.getQueue(ctx, key)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				continue
+			}
+			queues[i] = q
+
+			if ra.ids[i] == "$" {
+				// next id is more then ids of all messages of cluster
+				starts[i], err = c.s.Cluster.GetNextId(ctx, c.user)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			starts[i], _, err = parseID(ra.ids[i])
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	cnt := c.readCount(ra)
+	return c.blockRead(ra, func(ctx context.Context) (results []readResult, notify []<-chan struct{}, err *mft.Error) {
+		for i, q := range queues {
+			if q == nil {
+				continue
+			}
+			if notifier, ok := q.(queue.AppendNotifier); ok {
+				notify = append(notify, notifier.AppendNotify())
+			}
+
+			messages, err := q.Get(ctx, c.user, starts[i], cnt)
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(messages) > 0 {
+				results = append(results, readResult{key: ra.keys[i], messages: messages})
+			}
+		}
+		return results, notify, nil
+	})
+}
+
+// xreadgroup - XREADGROUP GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+//
+//	id `>` - messages after last delivered id of group
+//	other  - delivered and not acknowledged messages after id (not blocked)
+func (c *respConn) xreadgroup(args []string) *mft.Error {
+	ra, err := parseReadArgs(args, true)
+	if err != nil {
+		return err
+	}
+
+	queues := make([]queue.Queue, len(ra.keys))
+	history := make([]int64, len(ra.keys))
+	{
+		ctx, cancel := context.WithTimeout(context.Background(), c.s.callTimeout())
+		defer cancel()
+
+		for i, key := range ra.keys {
+			q, exists, err := c.getQueue(ctx, key)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				return GenerateError(10194105, key)
+			}
+			queues[i] = q
+
+			if ra.ids[i] == ">" {
+				history[i] = -1
+				continue
+			}
+			ra.hasBlock = false
+			history[i], _, err = parseID(ra.ids[i])
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	cnt := c.readCount(ra)
+	return c.blockRead(ra, func(ctx context.Context) (results []readResult, notify []<-chan struct{}, err *mft.Error) {
+		for i, q := range queues {
+			if notifier, ok := q.(queue.AppendNotifier); ok {
+				notify = append(notify, notifier.AppendNotify())
+			}
+
+			var messages []*queue.MessageWithMeta
+			if history[i] < 0 {
+				messages, err = c.groupDeliver(ctx, q, ra.keys[i], ra.group, cnt, ra.noAck)
+			} else {
+				messages, err = c.groupPending(ctx, q, ra.keys[i], ra.group, history[i], cnt)
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			// history is returned for every stream (even empty)
+			if len(messages) > 0 || history[i] >= 0 {
+				results = append(results, readResult{key: ra.keys[i], messages: messages})
+			}
+		}
+		return results, notify, nil
+	})
+}
+
+// groupLoad - load last read id of group into state (gs.mx should be locked)
+func (c *respConn) groupLoad(ctx context.Context, q queue.Queue, gs *groupState, group string) (lastRead int64, err *mft.Error) {
+	lastRead, err = q.SubscriberGetLastRead(ctx, c.user, group)
+	if err != nil {
+		return 0, err
+	}
+	if !gs.loaded || gs.delivered < lastRead {
+		gs.delivered = lastRead
+		gs.loaded = true
+	}
+	return lastRead, nil
+}
+
+// groupDeliver - messages after last delivered id of group
+func (c *respConn) groupDeliver(ctx context.Context, q queue.Queue, queueName string, group string, cnt int, noAck bool,
+) (messages []*queue.MessageWithMeta, err *mft.Error) {
+	gs := c.s.group(queueName, group)
+	gs.mx.Lock()
+	defer gs.mx.Unlock()
+
+	lastRead, err := c.groupLoad(ctx, q, gs, group)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err = q.Get(ctx, c.user, gs.delivered, cnt)
+	if err != nil || len(messages) == 0 {
+		return nil, err
+	}
+	gs.delivered = messages[len(messages)-1].ID
+
+	if noAck {
+		for _, msg := range messages {
+			gs.ack(msg.ID)
+		}
+		if err = c.groupAdvance(ctx, q, gs, group, lastRead); err != nil {
+			return nil, err
+		}
+	}
+
+	return messages, nil
+}
+
+// groupPending - delivered and not acknowledged messages with id > idStart
+func (c *respConn) groupPending(ctx context.Context, q queue.Queue, queueName string, group string, idStart int64, cnt int,
+) (messages []*queue.MessageWithMeta, err *mft.Error) {
+	gs := c.s.group(queueName, group)
+	gs.mx.Lock()
+	defer gs.mx.Unlock()
+
+	lastRead, err := c.groupLoad(ctx, q, gs, group)
+	if err != nil {
+		return nil, err
+	}
+	if idStart < lastRead {
+		idStart = lastRead
+	}
+
+	// acknowledged messages are skipped
+	for len(messages) < cnt && idStart < gs.delivered {
+		got, err := c.readRange(ctx, q, idStart, gs.delivered, cnt-len(messages))
+		if err != nil {
+			return nil, err
+		}
+		if len(got) == 0 {
+			break
+		}
+		for _, msg := range got {
+			if _, ok := gs.acked[msg.ID]; !ok {
+				messages = append(messages, msg)
+			}
+		}
+		idStart = got[len(got)-1].ID
+	}
+
+	return messages, nil
+}
+
+// ack - mark id as acknowledged (gs.mx should be locked); returns false when id is already acknowledged
+func (gs *groupState) ack(id int64) bool {
+	if gs.acked == nil {
+		gs.acked = make(map[int64]struct{})
+	}
+	if _, ok := gs.acked[id]; ok {
+		return false
+	}
+	gs.acked[id] = struct{}{}
+	return true
+}
+
+// groupAdvance - move last read id of group over acknowledged prefix of delivered ids (gs.mx should be locked)
+func (c *respConn) groupAdvance(ctx context.Context, q queue.Queue, gs *groupState, group string, lastRead int64) *mft.Error {
+	for id := range gs.acked {
+		if id <= lastRead {
+			delete(gs.acked, id)
+		}
+	}
+
+	newLastRead := lastRead
+	pending := false
+	for !pending && len(gs.acked) > 0 && newLastRead < gs.delivered {
+		messages, err := c.readRange(ctx, q, newLastRead, gs.delivered, readBatch)
+		if err != nil {
+			return err
+		}
+		if len(messages) == 0 {
+			break
+		}
+		for _, msg := range messages {
+			if _, ok := gs.acked[msg.ID]; !ok {
+				pending = true
+				break
+			}
+			delete(gs.acked, msg.ID)
+			newLastRead = msg.ID
+		}
+	}
+
+	if newLastRead > lastRead {
+		return q.SubscriberSetLastRead(ctx, c.user, group, newLastRead, cn.SaveMarkSaveMode)
+	}
+	return nil
+}
+
+// xack - XACK key group id [id ...]; last read id of subscriber is moved over acknowledged prefix of delivered ids
+// (acknowledged ids after not acknowledged id are kept in memory: after restart they are delivered again)
+// returns count of acknowledged delivered ids
+func (c *respConn) xack(ctx context.Context, args []string) *mft.Error {
+	if len(args) < 4 {
+		return GenerateError(10194100, args[0])
+	}
+
+	ids := make([]int64, 0, len(args)-3)
+	for _, s := range args[3:] {
+		id, _, err := parseID(s)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+
+	q, exists, err := c.getQueue(ctx, args[1])
+	if err != nil {
+		return err
+	}
+	if !exists {
+		c.w.integer(0)
+		return nil
+	}
+
+	group := args[2]
+	gs := c.s.group(args[1], group)
+	gs.mx.Lock()
+	defer gs.mx.Unlock()
+
+	lastRead, err := c.groupLoad(ctx, q, gs, group)
+	if err != nil {
+		return err
+	}
+
+	pendingIDs := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if id > lastRead && id <= gs.delivered {
+			pendingIDs = append(pendingIDs, id)
+		}
+	}
+
+	var cnt int64
+	if len(pendingIDs) > 0 {
+		// only ids of messages are acknowledged
+		messages, err := q.GetByIDs(ctx, c.user, pendingIDs)
+		if err != nil {
+			return err
+		}
+		for _, msg := range messages {
+			if gs.ack(msg.ID) {
+				cnt++
+			}
+		}
+		if err = c.groupAdvance(ctx, q, gs, group, lastRead); err != nil {
+			return err
+		}
+	}
+
+	c.w.integer(cnt)
+	return nil
+}
+
+// xgroup - XGROUP CREATE key group id|$ [MKSTREAM] [ENTRIESREAD n], XGROUP SETID key group id|$ [ENTRIESREAD n],
+// XGROUP DESTROY key group, XGROUP CREATECONSUMER key group consumer, XGROUP DELCONSUMER key group consumer
+// (consumers are not stored)
+func (c *respConn) xgroup(ctx context.Context, args []string) *mft.Error {
+	if len(args) < 4 {
+		return GenerateError(10194100, args[0])
+	}
+
+	sub := strings.ToUpper(args[1])
+	switch sub {
+	case "CREATE", "SETID", "DESTROY", "CREATECONSUMER", "DELCONSUMER":
+	default:
+		return GenerateError(10194108, args[1])
+	}
+
+	queueName, group := args[2], args[3]
+	q, exists, err := c.getQueue(ctx, queueName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return GenerateError(10194105, queueName)
+	}
+
+	switch sub {
+	case "CREATECONSUMER":
+		c.w.integer(1)
+		return nil
+	case "DELCONSUMER":
+		c.w.integer(0)
+		return nil
+	case "DESTROY":
+		err = q.SubscriberSetLastRead(ctx, c.user, group, 0, cn.SaveMarkSaveMode)
+		if err != nil {
+			return err
+		}
+		c.s.groupDrop(queueName, group)
+		c.w.integer(1)
+		return nil
+	}
+
+	if len(args) < 5 {
+		return GenerateError(10194100, args[0])
+	}
+
+	var id int64
+	if args[4] == "$" {
+		// next id is more then ids of all messages of cluster
+		id, err = c.s.Cluster.GetNextId(ctx, c.user)
+	} else {
+		id, _, err = parseID(args[4])
+	}
+	if err != nil {
+		return err
+	}
+
+	gs := c.s.group(queueName, group)
+	gs.mx.Lock()
+	defer gs.mx.Unlock()
+
+	// id == 0 removes subscriber: group reads queue from start
+	err = q.SubscriberSetLastRead(ctx, c.user, group, id, cn.SaveMarkSaveMode)
+	if err != nil {
+		return err
+	}
+	gs.delivered = id
+	gs.loaded = true
+	gs.acked = nil
+
+	c.w.simple("OK")
+	return nil
+}
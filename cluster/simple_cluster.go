@@ -230,6 +230,7 @@ func (sc *SimpleCluster) LoadFullStructRaw(data json.RawMessage) (err *mft.Error
 			return GenerateErrorE(10103003, err, name, load.Type)
 		}
 
+		sc.setQueueEraseCheck(name, queue)
 		load.Queue = queue
 	}
 
@@ -0,0 +1,124 @@
+package cluster
+
+import (
+	"context"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/queue"
+	"github.com/myfantasy/mft"
+)
+
+// ArchiveRestoreRequest - params of restore archive into queue
+type ArchiveRestoreRequest struct {
+	// QueueName - queue with archives (should be local queue.SimpleQueue)
+	QueueName string `json:"queue"`
+	// TargetQueueName - queue to restore messages ("" - QueueName)
+	TargetQueueName string `json:"target_queue,omitempty"`
+	// FromID - restore messages with id >= FromID
+	FromID int64 `json:"from_id"`
+	// ToID - restore messages with id <= ToID (0 - unlimited)
+	ToID     int64       `json:"to_id"`
+	SaveMode cn.SaveMode `json:"sm"`
+}
+
+// ArchiveRestoreResponce - result of restore archive into queue
+type ArchiveRestoreResponce struct {
+	Archives []*queue.SimpleQueueArchive `json:"archives"`
+	Cnt      int                         `json:"cnt"`
+}
+
+// RestoreArchive - restore messages from archives of queue into target queue
+// messages are added with AddUniqueList so restore can be repeated
+// tombstones and messages erased after archive are erased in target queue (body is not restored)
+func (sc *SimpleCluster) RestoreArchive(ctx context.Context, user cn.CapUser, req ArchiveRestoreRequest) (resp ArchiveRestoreResponce, err *mft.Error) {
+	allowed, err := sc.CheckPermission(ctx, user, cn.ClusterSelfObjectType, cn.RestoreArchiveAction, req.QueueName)
+	if err != nil {
+		return resp, err
+	}
+	if !allowed {
+		return resp, GenerateErrorForClusterUser(user, 10121000)
+	}
+
+	q, exists, err := sc.GetQueue(ctx, user, req.QueueName)
+	if err != nil {
+		return resp, GenerateErrorForClusterUserE(user, 10121001, err, req.QueueName)
+	}
+	if !exists {
+		return resp, GenerateErrorForClusterUser(user, 10121002, req.QueueName)
+	}
+	sq, ok := q.(*queue.SimpleQueue)
+	if !ok {
+		return resp, GenerateErrorForClusterUser(user, 10121003, req.QueueName)
+	}
+
+	targetQueueName := req.TargetQueueName
+	if targetQueueName == "" {
+		targetQueueName = req.QueueName
+	}
+	tq, exists, err := sc.GetQueue(ctx, user, targetQueueName)
+	if err != nil {
+		return resp, GenerateErrorForClusterUserE(user, 10121001, err, targetQueueName)
+	}
+	if !exists {
+		return resp, GenerateErrorForClusterUser(user, 10121002, targetQueueName)
+	}
+
+	archives, err := sq.GetArchives(ctx, user, req.FromID, req.ToID)
+	if err != nil {
+		return resp, GenerateErrorForClusterUserE(user, 10121004, err, req.QueueName)
+	}
+
+	for _, archive := range archives {
+		st, err := sc.StorageGenerator.Create(ctx, archive.Mount, archive.RelativePath)
+		if err != nil {
+			return resp, GenerateErrorForClusterUserE(user, 10121005, err, archive.Mount, archive.RelativePath)
+		}
+
+		body, err := st.Get(ctx, archive.FileName)
+		if err != nil {
+			return resp, GenerateErrorForClusterUserE(user, 10121006, err, archive.FileName)
+		}
+
+		messages, err := ArchiveDecode(ctx, sc.Compressor, sc.EncryptData, archive.CompressAlg, archive.EncryptAlg, body)
+		if err != nil {
+			return resp, GenerateErrorForClusterUserE(user, 10121007, err, archive.FileName)
+		}
+
+		msgs := make([]queue.Message, 0, len(messages))
+		tombstones := make([]int, 0)
+		for _, msg := range messages {
+			if msg.ID < req.FromID || (req.ToID > 0 && msg.ID > req.ToID) {
+				continue
+			}
+			m := msg.ToMessage()
+			if msg.Tombstone || archive.IsErased(msg.ID) {
+				m.Message = nil
+				tombstones = append(tombstones, len(msgs))
+			}
+			msgs = append(msgs, m)
+		}
+
+		if len(msgs) > 0 {
+			ids, err := tq.AddUniqueList(ctx, user, msgs, req.SaveMode)
+			if err != nil {
+				return resp, GenerateErrorForClusterUserE(user, 10121008, err, archive.FileName, targetQueueName)
+			}
+
+			if len(tombstones) > 0 {
+				eraseIDs := make([]int64, 0, len(tombstones))
+				for _, i := range tombstones {
+					eraseIDs = append(eraseIDs, ids[i])
+				}
+				_, err = tq.Erase(ctx, user, eraseIDs, "restore erased messages of archive "+archive.FileName)
+				if err != nil {
+					return resp, GenerateErrorForClusterUserE(user, 10121009, err, archive.FileName, targetQueueName)
+				}
+			}
+		}
+
+		resp.Archives = append(resp.Archives, archive)
+		resp.Cnt += len(msgs)
+	}
+
+	return resp, nil
+}
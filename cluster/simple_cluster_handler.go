@@ -15,6 +15,11 @@ const (
 	BlockDeleteHandlerType   = "block_delete"
 	BlockUnloadHandlerType   = "block_unload"
 	BlockMarkHandlerType     = "block_mark"
+	RetentionHandlerType     = "retention"
+	ArchiveHandlerType       = "archive"
+	ReconcileHandlerType     = "reconcile"
+	CopyTransformHandlerType = "copy_transform"
+	FanOutHandlerType        = "fan_out"
 )
 
 type HNewGenerator func(
@@ -245,6 +250,11 @@ func HandlerGeneratorCreate() *HandlerGenerator {
 	res.AddGenerator(BlockDeleteHandlerType, BlockDeleteNewGenerator, BlockDeleteLoadGenerator)
 	res.AddGenerator(BlockUnloadHandlerType, BlockUnloadNewGenerator, BlockUnloadLoadGenerator)
 	res.AddGenerator(BlockMarkHandlerType, BlockMarkNewGenerator, BlockMarkLoadGenerator)
+	res.AddGenerator(RetentionHandlerType, RetentionNewGenerator, RetentionLoadGenerator)
+	res.AddGenerator(ArchiveHandlerType, ArchiveNewGenerator, ArchiveLoadGenerator)
+	res.AddGenerator(ReconcileHandlerType, ReconcileNewGenerator, ReconcileLoadGenerator)
+	res.AddGenerator(CopyTransformHandlerType, CopyTransformNewGenerator, CopyTransformLoadGenerator)
+	res.AddGenerator(FanOutHandlerType, FanOutNewGenerator, FanOutLoadGenerator)
 
 	return res
 }
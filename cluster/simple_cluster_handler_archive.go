@@ -0,0 +1,416 @@
+package cluster
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/capella-pw/queue/compress"
+	"github.com/capella-pw/queue/queue"
+	"github.com/myfantasy/mfs"
+	"github.com/myfantasy/mft"
+)
+
+// ArchivePrefixFileName - prefix file name with archived block
+const ArchivePrefixFileName = "arch_"
+
+// ArchivePostfixFileName - postfix file name with archived block
+const ArchivePostfixFileName = ".jsonl"
+
+// ArchiveMaxLineSize - max size of one line (message) of archive
+const ArchiveMaxLineSize = 64 * 1024 * 1024
+
+func ArchiveNewGenerator(
+	ctx context.Context,
+	cluster Cluster,
+	hDescription HandlerDescription,
+	idGenerator *mft.G,
+) (*HandlerLoadDescription, *mft.Error) {
+	hld := &HandlerLoadDescription{
+		Name:       hDescription.Name,
+		Type:       hDescription.Type,
+		Params:     hDescription.Params,
+		QueueNames: hDescription.QueueNames,
+		UserName:   hDescription.UserName,
+	}
+
+	if len(hld.QueueNames) != 1 {
+		return nil, GenerateError(10118620, len(hld.QueueNames))
+	}
+
+	var rshp ArchiveHandlerParams
+	er0 := json.Unmarshal(hld.Params, &rshp)
+	if er0 != nil {
+		return nil, GenerateErrorE(10118621, er0)
+	}
+
+	if rshp.Interval <= 0 {
+		return nil, GenerateError(10118622, rshp.Interval)
+	}
+	if rshp.Wait <= 0 {
+		return nil, GenerateError(10118623, rshp.Wait)
+	}
+	if rshp.LimitArchive <= 0 {
+		return nil, GenerateError(10118624, rshp.LimitArchive)
+	}
+	if rshp.ArchiveTime < 0 {
+		return nil, GenerateError(10118625, rshp.ArchiveTime)
+	}
+	if rshp.Mount == "" {
+		return nil, GenerateError(10118626)
+	}
+
+	return hld, nil
+}
+
+func ArchiveLoadGenerator(
+	ctx context.Context,
+	cluster Cluster,
+	hDescription *HandlerLoadDescription,
+	idGenerator *mft.G,
+) (Handler, *mft.Error) {
+	if len(hDescription.QueueNames) != 1 {
+		return nil, GenerateError(10118640, len(hDescription.QueueNames))
+	}
+
+	var rshp ArchiveHandlerParams
+	er0 := json.Unmarshal(hDescription.Params, &rshp)
+	if er0 != nil {
+		return nil, GenerateErrorE(10118641, er0)
+	}
+
+	rsh := &ArchiveHandler{
+		Cluster:      cluster,
+		QueueName:    hDescription.QueueNames[0],
+		UserName:     hDescription.UserName,
+		HDescription: hDescription,
+		Params:       rshp,
+	}
+
+	return rsh, nil
+}
+
+type ArchiveHandlerParams struct {
+	// Interval - interval between call
+	Interval time.Duration `json:"interval"`
+	// Wait - wait archive timeout
+	Wait time.Duration `json:"wait"`
+	// ArchiveTime - age of block to archive. For example 3*24*time.Hour
+	ArchiveTime time.Duration `json:"archive_time"`
+	// Marks - archive only blocks with mark from list (empty - all marks)
+	Marks []string `json:"marks,omitempty"`
+	// LimitArchive - limit of archived blocks for one iteration
+	LimitArchive int `json:"limit_archive"`
+	// Mount - storage mount for archive
+	Mount string `json:"mount"`
+	// RelativePath - path in mount (default is queue name)
+	RelativePath string `json:"relative_path,omitempty"`
+	// CompressAlg - compress algorithm (compress.Zip and etc.)
+	CompressAlg string `json:"compress_alg,omitempty"`
+	// Encrypt - encrypt archive with cluster EncryptData
+	Encrypt bool `json:"encrypt,omitempty"`
+	// DeleteAfterArchive - mark archived blocks as need delete
+	DeleteAfterArchive bool `json:"delete_after_archive,omitempty"`
+	// WaitDelete - wait delete blocks timeout
+	WaitDelete time.Duration `json:"wait_delete,omitempty"`
+}
+
+func (hp ArchiveHandlerParams) ToJson() json.RawMessage {
+	msg, er0 := json.Marshal(hp)
+	if er0 != nil {
+		panic(GenerateErrorE(10118660, er0))
+	}
+
+	return msg
+}
+
+// markAllowed - block with mark should be archived
+func (hp ArchiveHandlerParams) markAllowed(mark string) bool {
+	if len(hp.Marks) == 0 {
+		return true
+	}
+	for _, m := range hp.Marks {
+		if m == mark {
+			return true
+		}
+	}
+	return false
+}
+
+// ArchiveEncode - marshal messages into JSONL, compress and encrypt it
+func ArchiveEncode(ctx context.Context, compressor *compress.Generator, encryptData *EncryptData,
+	compressAlg string, encrypt bool, messages []*queue.MessageWithMeta,
+) (body []byte, encryptAlg string, err *mft.Error) {
+	var buf bytes.Buffer
+	for _, msg := range messages {
+		line, er0 := json.Marshal(msg)
+		if er0 != nil {
+			return nil, "", GenerateErrorE(10118700, er0, msg.ID)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	body = buf.Bytes()
+
+	if compressAlg != "" {
+		_, body, err = compressor.Compress(ctx, true, compressAlg, body, nil)
+		if err != nil {
+			return nil, "", GenerateErrorE(10118701, err, compressAlg)
+		}
+	}
+
+	if encrypt {
+		if encryptData == nil || encryptData.EncryptAlg == "" {
+			return nil, "", GenerateError(10118702)
+		}
+		encryptAlg, body, err = compressor.Compress(ctx, true, encryptData.EncryptAlg, body, encryptData.EncryptKey)
+		if err != nil {
+			return nil, "", GenerateErrorE(10118703, err, encryptData.EncryptAlg)
+		}
+	}
+
+	return body, encryptAlg, nil
+}
+
+// ArchiveDecode - decrypt, restore and unmarshal messages from JSONL
+func ArchiveDecode(ctx context.Context, compressor *compress.Generator, encryptData *EncryptData,
+	compressAlg string, encryptAlg string, body []byte,
+) (messages []*queue.MessageWithMeta, err *mft.Error) {
+	if encryptAlg != "" {
+		if encryptData == nil || encryptData.DecryptAlg != encryptAlg {
+			return nil, GenerateError(10118720, encryptAlg)
+		}
+		_, body, err = compressor.Restore(ctx, encryptAlg, body, encryptData.DecryptKey)
+		if err != nil {
+			return nil, GenerateErrorE(10118721, err, encryptAlg)
+		}
+	}
+
+	if compressAlg != "" {
+		_, body, err = compressor.Restore(ctx, compressAlg, body, nil)
+		if err != nil {
+			return nil, GenerateErrorE(10118722, err, compressAlg)
+		}
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), ArchiveMaxLineSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var msg queue.MessageWithMeta
+		er0 := json.Unmarshal(line, &msg)
+		if er0 != nil {
+			return nil, GenerateErrorE(10118723, er0)
+		}
+		messages = append(messages, &msg)
+	}
+	if er0 := scanner.Err(); er0 != nil {
+		return nil, GenerateErrorE(10118724, er0)
+	}
+
+	return messages, nil
+}
+
+type ArchiveHandler struct {
+	Cluster      Cluster
+	QueueName    string
+	UserName     string
+	HDescription *HandlerLoadDescription
+	Params       ArchiveHandlerParams
+	mx           mfs.PMutex
+	chStop       chan bool
+	lastComplete time.Time
+	lastError    *mft.Error
+}
+
+func (rsh *ArchiveHandler) GetName() string {
+	return rsh.UserName
+}
+
+func (rsh *ArchiveHandler) relativePath() string {
+	if rsh.Params.RelativePath != "" {
+		return rsh.Params.RelativePath
+	}
+	return rsh.QueueName + "/"
+}
+
+// archive - archive blocks of queue
+func (rsh *ArchiveHandler) archive(ctx context.Context) (err *mft.Error) {
+	ctxInternal, cancel := context.WithTimeout(context.Background(), rsh.Params.Wait)
+	defer cancel()
+
+	sc, ok := rsh.Cluster.(*SimpleCluster)
+	if !ok {
+		return GenerateErrorForClusterUser(rsh, 10118600, rsh.QueueName)
+	}
+
+	q, exists, err := rsh.Cluster.GetQueue(ctx, rsh, rsh.QueueName)
+	if err != nil {
+		return GenerateErrorForClusterUserE(rsh, 10118601, err, rsh.QueueName)
+	}
+	if !exists {
+		return GenerateErrorForClusterUser(rsh, 10118602, rsh.QueueName)
+	}
+	sq, ok := q.(*queue.SimpleQueue)
+	if !ok {
+		return GenerateErrorForClusterUser(rsh, 10118603, rsh.QueueName)
+	}
+
+	relativePath := rsh.relativePath()
+	st, err := sc.StorageGenerator.Create(ctxInternal, rsh.Params.Mount, relativePath)
+	if err != nil {
+		return GenerateErrorForClusterUserE(rsh, 10118604, err, rsh.QueueName, rsh.Params.Mount)
+	}
+
+	dtCheck := time.Now().Add(-rsh.Params.ArchiveTime).Add(-sq.TimeLimit)
+
+	_, err = sq.SetArchive(ctxInternal, rsh,
+		func(ctx context.Context,
+			i int, len int,
+			q *queue.SimpleQueue, block *queue.SimpleQueueBlock,
+		) (needArchive bool, err *mft.Error) {
+			return block.Dt.Before(dtCheck) && rsh.Params.markAllowed(block.Mark), nil
+		},
+		func(ctx context.Context, q *queue.SimpleQueue, block *queue.SimpleQueueBlock,
+			messages []*queue.MessageWithMeta,
+		) (archive *queue.SimpleQueueArchive, err *mft.Error) {
+			body, encryptAlg, err := ArchiveEncode(ctx, sc.Compressor, sc.EncryptData,
+				rsh.Params.CompressAlg, rsh.Params.Encrypt, messages)
+			if err != nil {
+				return nil, err
+			}
+
+			archive = &queue.SimpleQueueArchive{
+				BlockID:      block.ID,
+				Dt:           block.Dt,
+				ArchiveDt:    time.Now(),
+				Cnt:          len(messages),
+				Mount:        rsh.Params.Mount,
+				RelativePath: relativePath,
+				FileName:     ArchivePrefixFileName + strconv.Itoa(int(block.ID)) + ArchivePostfixFileName,
+				CompressAlg:  rsh.Params.CompressAlg,
+				EncryptAlg:   encryptAlg,
+			}
+			if len(messages) > 0 {
+				archive.FirstID = messages[0].ID
+				archive.LastID = messages[len(messages)-1].ID
+			}
+
+			err = st.Save(ctx, archive.FileName, body)
+			if err != nil {
+				return nil, err
+			}
+
+			return archive, nil
+		},
+		rsh.Params.LimitArchive,
+	)
+
+	// archive location (q.Archives, block.Archived) should be saved before blocks are deleted
+	errSave := sq.SaveAll(ctxInternal, rsh)
+	if err != nil {
+		return GenerateErrorForClusterUserE(rsh, 10118605, err, rsh.QueueName)
+	}
+	if errSave != nil {
+		return GenerateErrorForClusterUserE(rsh, 10118610, errSave, rsh.QueueName)
+	}
+
+	if !rsh.Params.DeleteAfterArchive {
+		return nil
+	}
+
+	err = sq.SetDelete(ctxInternal, rsh,
+		func(ctx context.Context,
+			i int, len int,
+			q *queue.SimpleQueue, block *queue.SimpleQueueBlock,
+		) (needDelete bool, err *mft.Error) {
+			return block.Archived, nil
+		},
+	)
+	if err != nil {
+		return GenerateErrorForClusterUserE(rsh, 10118606, err, rsh.QueueName)
+	}
+
+	waitDelete := rsh.Params.WaitDelete
+	if waitDelete <= 0 {
+		waitDelete = rsh.Params.Wait
+	}
+	ctxInternalDelete, cancelDelete := context.WithTimeout(context.Background(), waitDelete)
+	defer cancelDelete()
+
+	err = sq.DeleteBlocks(ctxInternalDelete, rsh, rsh.Params.LimitArchive)
+	if err != nil {
+		return GenerateErrorForClusterUserE(rsh, 10118607, err, rsh.QueueName)
+	}
+
+	return nil
+}
+
+func (rsh *ArchiveHandler) Start(ctx context.Context) (err *mft.Error) {
+	rsh.mx.Lock()
+	defer rsh.mx.Unlock()
+	if rsh.chStop == nil {
+		chStop := make(chan bool, 1)
+		rsh.chStop = chStop
+		go func() {
+			for {
+				err := rsh.archive(ctx)
+
+				if err == nil {
+					rsh.lastComplete = time.Now()
+				} else {
+					rsh.lastError = err
+					rsh.Cluster.ThrowError(err)
+				}
+
+				time.Sleep(rsh.Params.Interval)
+				select {
+				case <-chStop:
+					return
+				default:
+				}
+			}
+		}()
+	}
+	rsh.HDescription.Start = true
+	err = rsh.Cluster.OnChange()
+
+	if err != nil {
+		return GenerateErrorE(10118608, err, rsh.HDescription.Name)
+	}
+
+	return nil
+}
+func (rsh *ArchiveHandler) Stop(ctx context.Context) (err *mft.Error) {
+	rsh.mx.Lock()
+	defer rsh.mx.Unlock()
+	if rsh.chStop != nil {
+		rsh.chStop <- true
+		rsh.chStop = nil
+	}
+
+	rsh.HDescription.Start = false
+	err = rsh.Cluster.OnChange()
+
+	if err != nil {
+		return GenerateErrorE(10118609, err, rsh.HDescription.Name)
+	}
+
+	return nil
+}
+
+func (rsh *ArchiveHandler) LastComplete(ctx context.Context) (time.Time, *mft.Error) {
+	return rsh.lastComplete, nil
+}
+func (rsh *ArchiveHandler) LastError(ctx context.Context) (err *mft.Error) {
+	return rsh.lastError
+}
+func (rsh *ArchiveHandler) IsStarted(ctx context.Context) (isStarted bool, err *mft.Error) {
+	return rsh.HDescription.Start, nil
+}
@@ -0,0 +1,88 @@
+package cluster
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/compress"
+	"github.com/capella-pw/queue/queue"
+	"github.com/capella-pw/queue/storage"
+	"github.com/myfantasy/mft"
+)
+
+// failSaveStorage - storage with failing Save when fail > 0
+type failSaveStorage struct {
+	storage.Storage
+	fail int32
+}
+
+func (fs *failSaveStorage) Save(ctx context.Context, name string, body []byte) *mft.Error {
+	if atomic.LoadInt32(&fs.fail) > 0 {
+		return mft.ErrorS("save fail")
+	}
+	return fs.Storage.Save(ctx, name, body)
+}
+
+func TestArchiveHandler_archiveSaveBeforeDelete(t *testing.T) {
+	ctx := context.Background()
+
+	meta := &failSaveStorage{Storage: storage.CreateMapSorage()}
+	q := queue.CreateSimpleQueue(2, 0, 0, meta, nil, nil, nil)
+	for i := 0; i < 5; i++ {
+		_, err := q.Add(ctx, nil, []byte("msg"), 0, 0, "", 0, cn.SaveImmediatelySaveMode)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	blocksCnt := len(q.Blocks)
+
+	sc := &SimpleCluster{
+		Queues: map[string]*QueueLoadDescription{"q1": {Name: "q1", Queue: q}},
+		StorageGenerator: storage.CreateGenerator(storage.GeneratorInfo{
+			Mounts: map[string]storage.Mount{"arch": {ProviderType: storage.StorageMAPType}},
+		}, nil),
+		Compressor: compress.GeneratorCreate(7),
+	}
+	rsh := &ArchiveHandler{
+		Cluster:   sc,
+		QueueName: "q1",
+		UserName:  "archive",
+		Params: ArchiveHandlerParams{
+			Wait:               5 * time.Second,
+			LimitArchive:       10,
+			Mount:              "arch",
+			DeleteAfterArchive: true,
+		},
+	}
+
+	// queue save fails: archived blocks are not deleted
+	atomic.StoreInt32(&meta.fail, 1)
+	err := rsh.archive(ctx)
+	if err == nil || err.Code != 10118610 {
+		t.Fatalf("ArchiveHandler.archive should fail with 10118610 not %v", err)
+	}
+	if len(q.Blocks) != blocksCnt {
+		t.Fatalf("ArchiveHandler.archive should not delete blocks when queue is not saved")
+	}
+
+	// queue is saved: archived blocks are deleted and archives are loaded after restart
+	atomic.StoreInt32(&meta.fail, 0)
+	err = rsh.archive(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(q.Blocks) != 1 {
+		t.Fatalf("ArchiveHandler.archive should delete archived blocks: %v blocks", len(q.Blocks))
+	}
+
+	lq, err := queue.LoadSimpleQueue(ctx, meta, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lq.Archives) != blocksCnt-1 {
+		t.Errorf("loaded queue should have %v archives not %v", blocksCnt-1, len(lq.Archives))
+	}
+}
@@ -42,6 +42,12 @@ func CopyUniqueNewGenerator(
 	if rshp.Wait <= 0 {
 		return nil, GenerateError(10117903, rshp.Wait)
 	}
+	if !rshp.Mirror && (rshp.MirrorSource != "" || len(rshp.MirrorSubscribers) > 0) {
+		return nil, GenerateError(10117904)
+	}
+	if !rshp.EffectivelyOnce && rshp.Checkpoint != "" {
+		return nil, GenerateError(10117905)
+	}
 
 	return hld, nil
 }
@@ -77,6 +83,20 @@ func CopyUniqueLoadGenerator(
 		CntLimit:       rshp.CntLimit,
 		DoSaveDst:      rshp.DoSaveDst,
 		Segments:       rshp.Segments,
+
+		Mirror:            rshp.Mirror,
+		MirrorSource:      rshp.MirrorSource,
+		MirrorSubscribers: rshp.MirrorSubscribers,
+
+		EffectivelyOnce: rshp.EffectivelyOnce,
+		Checkpoint:  rshp.Checkpoint,
+	}
+
+	if rsh.Mirror && rsh.MirrorSource == "" {
+		rsh.MirrorSource = queue.MirrorSourceDefault(rsh.SrcQueueName)
+	}
+	if rsh.EffectivelyOnce && rsh.Checkpoint == "" {
+		rsh.Checkpoint = queue.CopyCheckpointDefault(rsh.SrcQueueName, rsh.SubscriberName)
 	}
 
 	return rsh, nil
@@ -94,6 +114,21 @@ type CopyUniqueHandlerParams struct {
 	CntLimit       int               `json:"cnt_limit"`
 	DoSaveDst      bool              `json:"do_save_dst"`
 	Segments       *segment.Segments `json:"segments"`
+
+	// Mirror - messages are copied with Source = MirrorSource and ExternalID = id of source message
+	// so id of source can be translated into id of mirror (see queue.MirrorTranslateID)
+	Mirror bool `json:"mirror,omitempty"`
+	// MirrorSource - source of mirror messages (default `mirror:<src queue name>`)
+	MirrorSource string `json:"mirror_source,omitempty"`
+	// MirrorSubscribers - last read ids of these subscribers of source are translated and set on mirror
+	MirrorSubscribers []string `json:"mirror_subscribers,omitempty"`
+
+	// EffectivelyOnce - last copied id is stored in dst (as last read of subscriber Checkpoint) after dst is saved
+	// and copy resumes from it (do_save_dst is always on); checkpoint is not saved with messages:
+	// batch saved without checkpoint is copied again and deduplicated by AddUniqueList
+	EffectivelyOnce bool `json:"effectively_once,omitempty"`
+	// Checkpoint - name of subscriber of dst that stores checkpoint (default `checkpoint:<src queue name>:<subscribe_name>`)
+	Checkpoint string `json:"checkpoint,omitempty"`
 }
 
 func (hp CopyUniqueHandlerParams) ToJson() json.RawMessage {
@@ -122,7 +157,15 @@ type CopyUniqueHandler struct {
 	DoSaveDst      bool
 	Segments       *segment.Segments
 
+	Mirror            bool
+	MirrorSource      string
+	MirrorSubscribers []string
+
+	EffectivelyOnce bool
+	Checkpoint  string
+
 	mx           mfs.PMutex
+	mirrored     map[string]int64
 	chStop       chan bool
 	lastComplete time.Time
 	lastError    *mft.Error
@@ -159,23 +202,60 @@ func (rsh *CopyUniqueHandler) Start(ctx context.Context) (err *mft.Error) {
 		}
 
 		rsh.chStop = chStop
-		copy := queue.SubscribeCopyUnique(
-			srcQueue,
-			dstQueue,
-			rsh,
-			rsh,
-			rsh.SaveModeSrc,
-			rsh.SaveModeDst,
-			rsh.SubscriberName,
-			rsh.CntLimit,
-			rsh.DoSaveDst,
-			rsh.Segments)
+		var copy func(ctx context.Context) (isEmpty bool, err *mft.Error)
+		if rsh.EffectivelyOnce {
+			mirrorSource := ""
+			if rsh.Mirror {
+				mirrorSource = rsh.MirrorSource
+			}
+			copy = queue.SubscribeCopyCheckpoint(
+				srcQueue,
+				dstQueue,
+				rsh,
+				rsh,
+				rsh.SaveModeSrc,
+				rsh.SaveModeDst,
+				rsh.SubscriberName,
+				rsh.CntLimit,
+				rsh.Segments,
+				rsh.Checkpoint,
+				mirrorSource)
+		} else if rsh.Mirror {
+			copy = queue.SubscribeMirror(
+				srcQueue,
+				dstQueue,
+				rsh,
+				rsh,
+				rsh.SaveModeSrc,
+				rsh.SaveModeDst,
+				rsh.SubscriberName,
+				rsh.CntLimit,
+				rsh.DoSaveDst,
+				rsh.Segments,
+				rsh.MirrorSource)
+		} else {
+			copy = queue.SubscribeCopyUnique(
+				srcQueue,
+				dstQueue,
+				rsh,
+				rsh,
+				rsh.SaveModeSrc,
+				rsh.SaveModeDst,
+				rsh.SubscriberName,
+				rsh.CntLimit,
+				rsh.DoSaveDst,
+				rsh.Segments)
+		}
 		go func() {
 			for {
 				ctxInternal, cancel := context.WithTimeout(context.Background(), rsh.Wait)
 
 				isEmpty, err := copy(ctxInternal)
 
+				if err == nil && len(rsh.MirrorSubscribers) > 0 {
+					err = rsh.mirrorSubscribers(ctxInternal, srcQueue, dstQueue)
+				}
+
 				if err == nil {
 					rsh.lastComplete = time.Now()
 				} else {
@@ -238,3 +318,38 @@ func (rsh *CopyUniqueHandler) LastError(ctx context.Context) (err *mft.Error) {
 func (rsh *CopyUniqueHandler) IsStarted(ctx context.Context) (isStarted bool, err *mft.Error) {
 	return rsh.HDescription.Start, nil
 }
+
+// mirrorSubscribers - translate last read ids of MirrorSubscribers of src into ids of mirror dst
+// (ids are limited by last read id of subscriber of handler: position in not copied messages is not translated)
+func (rsh *CopyUniqueHandler) mirrorSubscribers(ctx context.Context, srcQueue queue.Queue, dstQueue queue.Queue) (err *mft.Error) {
+	copied, err := srcQueue.SubscriberGetLastRead(ctx, rsh, rsh.SubscriberName)
+	if err != nil {
+		return GenerateErrorE(10118008, err, rsh.SubscriberName)
+	}
+
+	if rsh.mirrored == nil {
+		rsh.mirrored = make(map[string]int64)
+	}
+
+	for _, subscriber := range rsh.MirrorSubscribers {
+		lastID, err := srcQueue.SubscriberGetLastRead(ctx, rsh, subscriber)
+		if err != nil {
+			return GenerateErrorE(10118008, err, subscriber)
+		}
+		if lastID > copied {
+			lastID = copied
+		}
+		if prev, ok := rsh.mirrored[subscriber]; ok && prev == lastID {
+			continue
+		}
+
+		_, err = queue.MirrorSubscriberSetLastRead(ctx, dstQueue, rsh, rsh.MirrorSource,
+			subscriber, lastID, rsh.SaveModeDst)
+		if err != nil {
+			return GenerateErrorE(10118009, err, subscriber)
+		}
+		rsh.mirrored[subscriber] = lastID
+	}
+
+	return nil
+}
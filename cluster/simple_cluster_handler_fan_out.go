@@ -0,0 +1,347 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/queue"
+	"github.com/myfantasy/mfs"
+	"github.com/myfantasy/mft"
+	"github.com/myfantasy/segment"
+)
+
+func FanOutNewGenerator(
+	ctx context.Context,
+	cluster Cluster,
+	hDescription HandlerDescription,
+	idGenerator *mft.G,
+) (*HandlerLoadDescription, *mft.Error) {
+	hld := &HandlerLoadDescription{
+		Name:       hDescription.Name,
+		Type:       hDescription.Type,
+		Params:     hDescription.Params,
+		QueueNames: hDescription.QueueNames,
+		UserName:   hDescription.UserName,
+	}
+
+	if len(hld.QueueNames) < 2 {
+		return nil, GenerateError(10119000, len(hld.QueueNames))
+	}
+
+	var rshp FanOutHandlerParams
+	er0 := json.Unmarshal(hld.Params, &rshp)
+	if er0 != nil {
+		return nil, GenerateErrorE(10119001, er0)
+	}
+
+	if rshp.Interval <= 0 {
+		return nil, GenerateError(10119002, rshp.Interval)
+	}
+	if rshp.Wait <= 0 {
+		return nil, GenerateError(10119003, rshp.Wait)
+	}
+
+	dstNames := make(map[string]struct{})
+	for _, queueName := range hld.QueueNames[1:] {
+		if _, ok := dstNames[queueName]; ok {
+			return nil, GenerateError(10119004, queueName)
+		}
+		dstNames[queueName] = struct{}{}
+	}
+	for queueName, route := range rshp.Routes {
+		if _, ok := dstNames[queueName]; !ok {
+			return nil, GenerateError(10119005, queueName)
+		}
+		err := (&queue.Transform{Filter: route}).Validate()
+		if err != nil {
+			return nil, GenerateErrorE(10119006, err, queueName)
+		}
+	}
+
+	return hld, nil
+}
+
+func FanOutLoadGenerator(
+	ctx context.Context,
+	cluster Cluster,
+	hDescription *HandlerLoadDescription,
+	idGenerator *mft.G,
+) (Handler, *mft.Error) {
+	if len(hDescription.QueueNames) < 2 {
+		return nil, GenerateError(10119020, len(hDescription.QueueNames))
+	}
+
+	var rshp FanOutHandlerParams
+	er0 := json.Unmarshal(hDescription.Params, &rshp)
+	if er0 != nil {
+		return nil, GenerateErrorE(10119021, er0)
+	}
+
+	rsh := &FanOutHandler{
+		Cluster:       cluster,
+		SrcQueueName:  hDescription.QueueNames[0],
+		DstQueueNames: hDescription.QueueNames[1:],
+		Interval:      rshp.Interval,
+		Wait:          rshp.Wait,
+		UserName:      hDescription.UserName,
+		HDescription:  hDescription,
+
+		SaveModeSrc:    rshp.SaveModeSrc,
+		SaveModeDst:    rshp.SaveModeDst,
+		SubscriberName: rshp.SubscriberName,
+		CntLimit:       rshp.CntLimit,
+		DoSaveDst:      rshp.DoSaveDst,
+		Segments:       rshp.Segments,
+		CacheLimit:     rshp.CacheLimit,
+		Routes:         rshp.Routes,
+	}
+
+	return rsh, nil
+}
+
+type FanOutHandlerParams struct {
+	// Interval - interval between call
+	Interval time.Duration `json:"interval"`
+	// Wait - wait save timeout
+	Wait time.Duration `json:"wait"`
+
+	SaveModeSrc cn.SaveMode `json:"src_save_mode"`
+	SaveModeDst cn.SaveMode `json:"dst_save_mode"`
+	// SubscriberName - progress of destination is stored in subscriber `<subscribe_name>:<dst queue name>` of source
+	SubscriberName string            `json:"subscribe_name"`
+	CntLimit       int               `json:"cnt_limit"`
+	DoSaveDst      bool              `json:"do_save_dst"`
+	Segments       *segment.Segments `json:"segments"`
+	// CacheLimit - count of batches of source that are kept for destinations (0 - queue.FanOutCacheLimitDefault)
+	CacheLimit int `json:"cache_limit,omitempty"`
+	// Routes - only messages that match route of destination are copied into it (key - dst queue name)
+	Routes map[string]queue.TransformFilter `json:"routes,omitempty"`
+}
+
+func (hp FanOutHandlerParams) ToJson() json.RawMessage {
+	msg, er0 := json.Marshal(hp)
+	if er0 != nil {
+		panic(GenerateErrorE(10119040, er0))
+	}
+
+	return msg
+}
+
+// FanOutDestinationState - state of destination of fan out
+type FanOutDestinationState struct {
+	QueueName string `json:"queue"`
+	// LastID - last id of source that is copied into destination
+	LastID       int64      `json:"last_id"`
+	LastComplete time.Time  `json:"last_complete"`
+	LastError    *mft.Error `json:"last_error,omitempty"`
+}
+
+type FanOutHandler struct {
+	Cluster        Cluster
+	SrcQueueName   string
+	DstQueueNames  []string
+	Interval       time.Duration
+	ActiveInterval time.Duration
+	Wait           time.Duration
+	UserName       string
+	HDescription   *HandlerLoadDescription
+
+	SaveModeSrc    cn.SaveMode
+	SaveModeDst    cn.SaveMode
+	SubscriberName string
+	CntLimit       int
+	DoSaveDst      bool
+	Segments       *segment.Segments
+	CacheLimit     int
+	Routes         map[string]queue.TransformFilter
+
+	mx           mfs.PMutex
+	mxState      mfs.PMutex
+	chStop       chan bool
+	fanOut       *queue.FanOut
+	states       map[string]*FanOutDestinationState
+	lastComplete time.Time
+	lastError    *mft.Error
+}
+
+func (rsh *FanOutHandler) GetName() string {
+	return rsh.UserName
+}
+
+func (rsh *FanOutHandler) setState(queueName string, err *mft.Error) {
+	rsh.mxState.Lock()
+	defer rsh.mxState.Unlock()
+
+	state := rsh.states[queueName]
+	if err != nil {
+		state.LastError = err
+		rsh.lastError = err
+		return
+	}
+	state.LastComplete = time.Now()
+	rsh.lastComplete = state.LastComplete
+}
+
+// destination - copy loop of destination; destination queue is got on each run until it is available
+func (rsh *FanOutHandler) destination(fanOut *queue.FanOut, queueName string, chStop chan bool) {
+	var copy func(ctx context.Context) (isEmpty bool, err *mft.Error)
+	for {
+		ctxInternal, cancel := context.WithTimeout(context.Background(), rsh.Wait)
+
+		isEmpty := true
+		var err *mft.Error
+		if copy == nil {
+			var dstQueue queue.Queue
+			var exists bool
+			dstQueue, exists, err = rsh.Cluster.GetQueue(ctxInternal, rsh, queueName)
+			if err != nil {
+				err = GenerateErrorForClusterUserE(rsh, 10119060, err, queueName)
+			} else if !exists {
+				err = GenerateErrorForClusterUser(rsh, 10119061, queueName)
+			} else {
+				copy = fanOut.Subscribe(queue.FanOutDestination{
+					Name:     queueName,
+					Queue:    dstQueue,
+					User:     rsh,
+					SaveMode: rsh.SaveModeDst,
+					DoSave:   rsh.DoSaveDst,
+					Route:    rsh.Routes[queueName],
+				})
+			}
+		}
+
+		if copy != nil {
+			isEmpty, err = copy(ctxInternal)
+			if err != nil {
+				err = GenerateErrorForClusterUserE(rsh, 10119062, err,
+					rsh.SrcQueueName,
+					queueName,
+					rsh.HDescription.Name)
+			}
+		}
+
+		rsh.setState(queueName, err)
+		if err != nil {
+			rsh.Cluster.ThrowError(err)
+		}
+
+		cancel()
+		if isEmpty || err != nil {
+			time.Sleep(rsh.Interval)
+		} else {
+			time.Sleep(rsh.ActiveInterval)
+		}
+		select {
+		case <-chStop:
+			return
+		default:
+		}
+	}
+}
+
+func (rsh *FanOutHandler) Start(ctx context.Context) (err *mft.Error) {
+	rsh.mx.Lock()
+	defer rsh.mx.Unlock()
+	if rsh.chStop == nil {
+		chStop := make(chan bool)
+
+		srcQueue, exists, err := rsh.Cluster.GetQueue(ctx, rsh, rsh.SrcQueueName)
+		if err != nil {
+			err = GenerateErrorForClusterUserE(rsh, 10119063, err, rsh.SrcQueueName)
+			return err
+		}
+		if !exists {
+			err = GenerateErrorForClusterUser(rsh, 10119064, rsh.SrcQueueName)
+			return err
+		}
+
+		rsh.chStop = chStop
+		fanOut := queue.FanOutCreate(srcQueue, rsh, rsh.SaveModeSrc, rsh.SubscriberName, rsh.CntLimit, rsh.Segments)
+		fanOut.CacheLimit = rsh.CacheLimit
+
+		rsh.mxState.Lock()
+		rsh.fanOut = fanOut
+		rsh.states = make(map[string]*FanOutDestinationState, len(rsh.DstQueueNames))
+		for _, queueName := range rsh.DstQueueNames {
+			rsh.states[queueName] = &FanOutDestinationState{QueueName: queueName}
+		}
+		rsh.mxState.Unlock()
+
+		for _, queueName := range rsh.DstQueueNames {
+			go rsh.destination(fanOut, queueName, chStop)
+		}
+	}
+	rsh.HDescription.Start = true
+	err = rsh.Cluster.OnChange()
+
+	if err != nil {
+		return GenerateErrorE(10119065, err, rsh.HDescription.Name)
+	}
+
+	return nil
+}
+func (rsh *FanOutHandler) Stop(ctx context.Context) (err *mft.Error) {
+	rsh.mx.Lock()
+	defer rsh.mx.Unlock()
+	if rsh.chStop != nil {
+		close(rsh.chStop)
+		rsh.chStop = nil
+	}
+
+	rsh.HDescription.Start = false
+	err = rsh.Cluster.OnChange()
+
+	if err != nil {
+		return GenerateErrorE(10119066, err, rsh.HDescription.Name)
+	}
+
+	return nil
+}
+
+func (rsh *FanOutHandler) LastComplete(ctx context.Context) (time.Time, *mft.Error) {
+	rsh.mxState.Lock()
+	defer rsh.mxState.Unlock()
+
+	return rsh.lastComplete, nil
+}
+func (rsh *FanOutHandler) LastError(ctx context.Context) (err *mft.Error) {
+	rsh.mxState.Lock()
+	defer rsh.mxState.Unlock()
+
+	return rsh.lastError
+}
+func (rsh *FanOutHandler) IsStarted(ctx context.Context) (isStarted bool, err *mft.Error) {
+	return rsh.HDescription.Start, nil
+}
+
+// LastReport - gets list of FanOutDestinationState (progress and last error of each destination)
+func (rsh *FanOutHandler) LastReport(ctx context.Context) (report json.RawMessage, err *mft.Error) {
+	rsh.mxState.Lock()
+	defer rsh.mxState.Unlock()
+
+	var progress map[string]int64
+	if rsh.fanOut != nil {
+		progress = rsh.fanOut.Progress()
+	}
+
+	states := make([]FanOutDestinationState, 0, len(rsh.DstQueueNames))
+	for _, queueName := range rsh.DstQueueNames {
+		state, ok := rsh.states[queueName]
+		if !ok {
+			states = append(states, FanOutDestinationState{QueueName: queueName})
+			continue
+		}
+		s := *state
+		s.LastID = progress[queueName]
+		states = append(states, s)
+	}
+
+	report, er0 := json.Marshal(states)
+	if er0 != nil {
+		return nil, GenerateErrorE(10119041, er0)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,302 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/queue"
+	"github.com/myfantasy/mfs"
+	"github.com/myfantasy/mft"
+)
+
+// ReconcileReportLimitDefault - default count of stored reports
+const ReconcileReportLimitDefault = 10
+
+func ReconcileNewGenerator(
+	ctx context.Context,
+	cluster Cluster,
+	hDescription HandlerDescription,
+	idGenerator *mft.G,
+) (*HandlerLoadDescription, *mft.Error) {
+	hld := &HandlerLoadDescription{
+		Name:       hDescription.Name,
+		Type:       hDescription.Type,
+		Params:     hDescription.Params,
+		QueueNames: hDescription.QueueNames,
+		UserName:   hDescription.UserName,
+	}
+
+	if len(hld.QueueNames) != 2 && len(hld.QueueNames) != 3 {
+		return nil, GenerateError(10118800, len(hld.QueueNames))
+	}
+
+	var rshp ReconcileHandlerParams
+	er0 := json.Unmarshal(hld.Params, &rshp)
+	if er0 != nil {
+		return nil, GenerateErrorE(10118801, er0)
+	}
+
+	if rshp.Interval <= 0 {
+		return nil, GenerateError(10118802, rshp.Interval)
+	}
+	if rshp.Wait <= 0 {
+		return nil, GenerateError(10118803, rshp.Wait)
+	}
+	if rshp.Window < 0 || rshp.Delay < 0 {
+		return nil, GenerateError(10118804, rshp.Window, rshp.Delay)
+	}
+
+	return hld, nil
+}
+
+func ReconcileLoadGenerator(
+	ctx context.Context,
+	cluster Cluster,
+	hDescription *HandlerLoadDescription,
+	idGenerator *mft.G,
+) (Handler, *mft.Error) {
+	if len(hDescription.QueueNames) != 2 && len(hDescription.QueueNames) != 3 {
+		return nil, GenerateError(10118820, len(hDescription.QueueNames))
+	}
+
+	var rshp ReconcileHandlerParams
+	er0 := json.Unmarshal(hDescription.Params, &rshp)
+	if er0 != nil {
+		return nil, GenerateErrorE(10118821, er0)
+	}
+
+	reportLimit := rshp.ReportLimit
+	if reportLimit <= 0 {
+		reportLimit = ReconcileReportLimitDefault
+	}
+
+	rsh := &ReconcileHandler{
+		Cluster:      cluster,
+		SrcQueueName: hDescription.QueueNames[0],
+		DstQueueName: hDescription.QueueNames[1],
+		Interval:     rshp.Interval,
+		Wait:         rshp.Wait,
+		UserName:     hDescription.UserName,
+		HDescription: hDescription,
+		Params:       rshp,
+		ReportLimit:  reportLimit,
+	}
+	if len(hDescription.QueueNames) == 3 {
+		rsh.ReportQueueName = hDescription.QueueNames[2]
+	}
+
+	return rsh, nil
+}
+
+type ReconcileHandlerParams struct {
+	// Interval - interval between call
+	Interval time.Duration `json:"interval"`
+	// Wait - wait reconcile timeout
+	Wait time.Duration `json:"wait"`
+
+	// Range - range of messages of source
+	Range queue.ReconcileRange `json:"range"`
+	// Window - when > 0 time range of source is [now - Delay - Window, now - Delay) on each run (replaces Range.FromDt and Range.ToDt)
+	Window time.Duration `json:"window,omitempty"`
+	// Delay - messages newer than Delay are not compared (they can be not copied yet)
+	Delay time.Duration `json:"delay,omitempty"`
+
+	queue.ReconcileSettings
+
+	// Recopy - copy missing messages into destination
+	Recopy      bool        `json:"recopy,omitempty"`
+	SaveModeDst cn.SaveMode `json:"dst_save_mode"`
+	// SaveModeReport - save mode of report queue (report is written as json message)
+	SaveModeReport cn.SaveMode `json:"report_save_mode"`
+	// ReportLimit - count of stored reports (0 - ReconcileReportLimitDefault)
+	ReportLimit int `json:"report_limit,omitempty"`
+}
+
+func (hp ReconcileHandlerParams) ToJson() json.RawMessage {
+	msg, er0 := json.Marshal(hp)
+	if er0 != nil {
+		panic(GenerateErrorE(10118840, er0))
+	}
+
+	return msg
+}
+
+type ReconcileHandler struct {
+	Cluster         Cluster
+	SrcQueueName    string
+	DstQueueName    string
+	ReportQueueName string
+	Interval        time.Duration
+	Wait            time.Duration
+	UserName        string
+	HDescription    *HandlerLoadDescription
+	Params          ReconcileHandlerParams
+	ReportLimit     int
+	mx              mfs.PMutex
+	mxReport        mfs.PMutex
+	chStop          chan bool
+	lastComplete    time.Time
+	lastError       *mft.Error
+	report          []*queue.ReconcileReport
+}
+
+func (rsh *ReconcileHandler) GetName() string {
+	return rsh.UserName
+}
+
+func (rsh *ReconcileHandler) addReport(report *queue.ReconcileReport) {
+	rsh.mxReport.Lock()
+	defer rsh.mxReport.Unlock()
+
+	rsh.report = append(rsh.report, report)
+	if len(rsh.report) > rsh.ReportLimit {
+		rsh.report = rsh.report[len(rsh.report)-rsh.ReportLimit:]
+	}
+}
+
+// getQueue - gets queue for handler
+func (rsh *ReconcileHandler) getQueue(ctx context.Context, queueName string) (q queue.Queue, err *mft.Error) {
+	q, exists, err := rsh.Cluster.GetQueue(ctx, rsh, queueName)
+	if err != nil {
+		return nil, GenerateErrorForClusterUserE(rsh, 10118860, err, queueName)
+	}
+	if !exists {
+		return nil, GenerateErrorForClusterUser(rsh, 10118861, queueName)
+	}
+	return q, nil
+}
+
+// reconcile - compare source and destination, recopy missing messages and write report
+func (rsh *ReconcileHandler) reconcile(ctx context.Context) (err *mft.Error) {
+	srcQueue, err := rsh.getQueue(ctx, rsh.SrcQueueName)
+	if err != nil {
+		return err
+	}
+	dstQueue, err := rsh.getQueue(ctx, rsh.DstQueueName)
+	if err != nil {
+		return err
+	}
+
+	rng := rsh.Params.Range
+	if rsh.Params.Window > 0 {
+		rng.ToDt = time.Now().Add(-rsh.Params.Delay)
+		rng.FromDt = rng.ToDt.Add(-rsh.Params.Window)
+	}
+
+	report, err := queue.Reconcile(ctx, srcQueue, dstQueue, rsh, rsh, rng, rsh.Params.ReconcileSettings)
+	if err != nil {
+		return GenerateErrorForClusterUserE(rsh, 10118862, err, rsh.SrcQueueName, rsh.DstQueueName)
+	}
+
+	if rsh.Params.Recopy {
+		err = queue.ReconcileCopyMissing(ctx, srcQueue, dstQueue, rsh, rsh, report,
+			rsh.Params.MirrorSource, rsh.Params.SaveModeDst)
+		if err != nil {
+			rsh.addReport(report)
+			return GenerateErrorForClusterUserE(rsh, 10118863, err, rsh.SrcQueueName, rsh.DstQueueName)
+		}
+	}
+
+	rsh.addReport(report)
+
+	if rsh.ReportQueueName == "" {
+		return nil
+	}
+
+	reportQueue, err := rsh.getQueue(ctx, rsh.ReportQueueName)
+	if err != nil {
+		return err
+	}
+	body, er0 := json.Marshal(report)
+	if er0 != nil {
+		return GenerateErrorE(10118864, er0)
+	}
+	_, err = reportQueue.Add(ctx, rsh, body, 0, 0, rsh.HDescription.Name, 0, rsh.Params.SaveModeReport)
+	if err != nil {
+		return GenerateErrorForClusterUserE(rsh, 10118865, err, rsh.ReportQueueName)
+	}
+
+	return nil
+}
+
+func (rsh *ReconcileHandler) Start(ctx context.Context) (err *mft.Error) {
+	rsh.mx.Lock()
+	defer rsh.mx.Unlock()
+	if rsh.chStop == nil {
+		chStop := make(chan bool, 1)
+		rsh.chStop = chStop
+		go func() {
+			for {
+				ctxInternal, cancel := context.WithTimeout(context.Background(), rsh.Wait)
+
+				err := rsh.reconcile(ctxInternal)
+				if err == nil {
+					rsh.lastComplete = time.Now()
+				} else {
+					err = GenerateErrorForClusterUserE(rsh, 10118866, err, rsh.HDescription.Name)
+					rsh.lastError = err
+					rsh.Cluster.ThrowError(err)
+				}
+
+				cancel()
+
+				time.Sleep(rsh.Interval)
+				select {
+				case <-chStop:
+					return
+				default:
+				}
+			}
+		}()
+	}
+	rsh.HDescription.Start = true
+	err = rsh.Cluster.OnChange()
+
+	if err != nil {
+		return GenerateErrorE(10118867, err, rsh.HDescription.Name)
+	}
+
+	return nil
+}
+func (rsh *ReconcileHandler) Stop(ctx context.Context) (err *mft.Error) {
+	rsh.mx.Lock()
+	defer rsh.mx.Unlock()
+	if rsh.chStop != nil {
+		rsh.chStop <- true
+		rsh.chStop = nil
+	}
+
+	rsh.HDescription.Start = false
+	err = rsh.Cluster.OnChange()
+
+	if err != nil {
+		return GenerateErrorE(10118868, err, rsh.HDescription.Name)
+	}
+
+	return nil
+}
+
+func (rsh *ReconcileHandler) LastComplete(ctx context.Context) (time.Time, *mft.Error) {
+	return rsh.lastComplete, nil
+}
+func (rsh *ReconcileHandler) LastError(ctx context.Context) (err *mft.Error) {
+	return rsh.lastError
+}
+func (rsh *ReconcileHandler) IsStarted(ctx context.Context) (isStarted bool, err *mft.Error) {
+	return rsh.HDescription.Start, nil
+}
+
+// LastReport - gets list of queue.ReconcileReport (last runs)
+func (rsh *ReconcileHandler) LastReport(ctx context.Context) (report json.RawMessage, err *mft.Error) {
+	rsh.mxReport.Lock()
+	defer rsh.mxReport.Unlock()
+
+	report, er0 := json.Marshal(rsh.report)
+	if er0 != nil {
+		return nil, GenerateErrorE(10118841, er0)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,300 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/capella-pw/queue/queue"
+	"github.com/myfantasy/mfs"
+	"github.com/myfantasy/mft"
+)
+
+// RetentionReportLimitDefault - default count of stored report items
+const RetentionReportLimitDefault = 100
+
+func RetentionNewGenerator(
+	ctx context.Context,
+	cluster Cluster,
+	hDescription HandlerDescription,
+	idGenerator *mft.G,
+) (*HandlerLoadDescription, *mft.Error) {
+	hld := &HandlerLoadDescription{
+		Name:       hDescription.Name,
+		Type:       hDescription.Type,
+		Params:     hDescription.Params,
+		QueueNames: hDescription.QueueNames,
+		UserName:   hDescription.UserName,
+	}
+
+	if len(hld.QueueNames) == 0 {
+		return nil, GenerateError(10118520, len(hld.QueueNames))
+	}
+
+	var rshp RetentionHandlerParams
+	er0 := json.Unmarshal(hld.Params, &rshp)
+	if er0 != nil {
+		return nil, GenerateErrorE(10118521, er0)
+	}
+
+	if rshp.Interval <= 0 {
+		return nil, GenerateError(10118522, rshp.Interval)
+	}
+	if rshp.WaitMark <= 0 {
+		return nil, GenerateError(10118523, rshp.WaitMark)
+	}
+	if rshp.WaitDelete <= 0 {
+		return nil, GenerateError(10118524, rshp.WaitDelete)
+	}
+	if rshp.LimitDelete < 0 {
+		return nil, GenerateError(10118525, rshp.LimitDelete)
+	}
+
+	queueNames := make(map[string]struct{})
+	for _, queueName := range hld.QueueNames {
+		queueNames[queueName] = struct{}{}
+		if rshp.GetPolicy(queueName).IsEmpty() {
+			return nil, GenerateError(10118526, queueName)
+		}
+	}
+	for queueName := range rshp.Policies {
+		if _, ok := queueNames[queueName]; !ok {
+			return nil, GenerateError(10118527, queueName)
+		}
+	}
+
+	return hld, nil
+}
+
+func RetentionLoadGenerator(
+	ctx context.Context,
+	cluster Cluster,
+	hDescription *HandlerLoadDescription,
+	idGenerator *mft.G,
+) (Handler, *mft.Error) {
+	if len(hDescription.QueueNames) == 0 {
+		return nil, GenerateError(10118540, len(hDescription.QueueNames))
+	}
+
+	var rshp RetentionHandlerParams
+	er0 := json.Unmarshal(hDescription.Params, &rshp)
+	if er0 != nil {
+		return nil, GenerateErrorE(10118541, er0)
+	}
+
+	reportLimit := rshp.ReportLimit
+	if reportLimit <= 0 {
+		reportLimit = RetentionReportLimitDefault
+	}
+
+	rsh := &RetentionHandler{
+		Cluster:      cluster,
+		QueueNames:   hDescription.QueueNames,
+		Interval:     rshp.Interval,
+		UserName:     hDescription.UserName,
+		HDescription: hDescription,
+		WaitMark:     rshp.WaitMark,
+		WaitDelete:   rshp.WaitDelete,
+		LimitDelete:  rshp.LimitDelete,
+		Params:       rshp,
+		ReportLimit:  reportLimit,
+	}
+
+	return rsh, nil
+}
+
+type RetentionHandlerParams struct {
+	// Interval - interval between call
+	Interval time.Duration `json:"interval"`
+	// WaitMark - wait to mark as deleted block timeout
+	WaitMark time.Duration `json:"wait_mark"`
+	// WaitDelete - wait to delete block timeout
+	WaitDelete time.Duration `json:"wait_delete"`
+	// Limit to delete block for one iteration for one queue (0 - unlimited)
+	LimitDelete int `json:"limit_delete"`
+	// Policy - default retention policy for all queues
+	Policy queue.RetentionPolicy `json:"policy"`
+	// Policies - retention policy for queue (replaces Policy)
+	Policies map[string]queue.RetentionPolicy `json:"policies,omitempty"`
+	// ReportLimit - count of stored report items (0 - RetentionReportLimitDefault)
+	ReportLimit int `json:"report_limit,omitempty"`
+}
+
+// GetPolicy - gets retention policy for queue
+func (hp RetentionHandlerParams) GetPolicy(queueName string) queue.RetentionPolicy {
+	if policy, ok := hp.Policies[queueName]; ok {
+		return policy
+	}
+	return hp.Policy
+}
+
+func (hp RetentionHandlerParams) ToJson() json.RawMessage {
+	msg, er0 := json.Marshal(hp)
+	if er0 != nil {
+		panic(GenerateErrorE(10118560, er0))
+	}
+
+	return msg
+}
+
+// RetentionReportItem - blocks deleted from queue on one run
+type RetentionReportItem struct {
+	Dt        time.Time                   `json:"dt"`
+	QueueName string                      `json:"queue"`
+	Blocks    []queue.RetentionDeleteInfo `json:"blocks"`
+}
+
+type RetentionHandler struct {
+	Cluster      Cluster
+	QueueNames   []string
+	Interval     time.Duration
+	WaitMark     time.Duration
+	WaitDelete   time.Duration
+	UserName     string
+	HDescription *HandlerLoadDescription
+	LimitDelete  int
+	Params       RetentionHandlerParams
+	ReportLimit  int
+	mx           mfs.PMutex
+	mxReport     mfs.PMutex
+	chStop       chan bool
+	lastComplete time.Time
+	lastError    *mft.Error
+	report       []RetentionReportItem
+}
+
+func (rsh *RetentionHandler) GetName() string {
+	return rsh.UserName
+}
+
+func (rsh *RetentionHandler) addReport(item RetentionReportItem) {
+	rsh.mxReport.Lock()
+	defer rsh.mxReport.Unlock()
+
+	rsh.report = append(rsh.report, item)
+	if len(rsh.report) > rsh.ReportLimit {
+		rsh.report = rsh.report[len(rsh.report)-rsh.ReportLimit:]
+	}
+}
+
+// apply - apply retention policy to queue
+func (rsh *RetentionHandler) apply(ctx context.Context, queueName string) (err *mft.Error) {
+	ctxInternalMark, cancelMark := context.WithTimeout(context.Background(), rsh.WaitMark)
+	defer cancelMark()
+
+	q, exists, err := rsh.Cluster.GetQueue(ctx, rsh, queueName)
+	if err != nil {
+		return GenerateErrorForClusterUserE(rsh, 10118500, err, queueName)
+	}
+	if !exists {
+		return GenerateErrorForClusterUser(rsh, 10118501, queueName)
+	}
+	sq, ok := q.(*queue.SimpleQueue)
+	if !ok {
+		return GenerateErrorForClusterUser(rsh, 10118502, queueName)
+	}
+
+	deleted, err := sq.SetDeleteByRetention(ctxInternalMark, rsh, rsh.Params.GetPolicy(queueName), rsh.LimitDelete)
+	if len(deleted) > 0 {
+		rsh.addReport(RetentionReportItem{
+			Dt:        time.Now(),
+			QueueName: queueName,
+			Blocks:    deleted,
+		})
+	}
+	if err != nil {
+		return GenerateErrorForClusterUserE(rsh, 10118503, err, queueName)
+	}
+
+	ctxInternalDelete, cancelDelete := context.WithTimeout(context.Background(), rsh.WaitDelete)
+	defer cancelDelete()
+
+	err = sq.DeleteBlocks(ctxInternalDelete, rsh, rsh.LimitDelete)
+	if err != nil {
+		return GenerateErrorForClusterUserE(rsh, 10118504, err, queueName)
+	}
+
+	return nil
+}
+
+func (rsh *RetentionHandler) Start(ctx context.Context) (err *mft.Error) {
+	rsh.mx.Lock()
+	defer rsh.mx.Unlock()
+	if rsh.chStop == nil {
+		chStop := make(chan bool, 1)
+		rsh.chStop = chStop
+		go func() {
+			for {
+				var lastErr *mft.Error
+				for _, queueName := range rsh.QueueNames {
+					err := rsh.apply(ctx, queueName)
+					if err != nil {
+						lastErr = err
+						rsh.Cluster.ThrowError(err)
+					}
+				}
+
+				if lastErr == nil {
+					rsh.lastComplete = time.Now()
+				} else {
+					rsh.lastError = lastErr
+				}
+
+				time.Sleep(rsh.Interval)
+				select {
+				case <-chStop:
+					return
+				default:
+				}
+			}
+		}()
+	}
+	rsh.HDescription.Start = true
+	err = rsh.Cluster.OnChange()
+
+	if err != nil {
+		return GenerateErrorE(10118505, err, rsh.HDescription.Name)
+	}
+
+	return nil
+}
+func (rsh *RetentionHandler) Stop(ctx context.Context) (err *mft.Error) {
+	rsh.mx.Lock()
+	defer rsh.mx.Unlock()
+	if rsh.chStop != nil {
+		rsh.chStop <- true
+		rsh.chStop = nil
+	}
+
+	rsh.HDescription.Start = false
+	err = rsh.Cluster.OnChange()
+
+	if err != nil {
+		return GenerateErrorE(10118506, err, rsh.HDescription.Name)
+	}
+
+	return nil
+}
+
+func (rsh *RetentionHandler) LastComplete(ctx context.Context) (time.Time, *mft.Error) {
+	return rsh.lastComplete, nil
+}
+func (rsh *RetentionHandler) LastError(ctx context.Context) (err *mft.Error) {
+	return rsh.lastError
+}
+func (rsh *RetentionHandler) IsStarted(ctx context.Context) (isStarted bool, err *mft.Error) {
+	return rsh.HDescription.Start, nil
+}
+
+// LastReport - gets list of RetentionReportItem (what blocks was deleted and why)
+func (rsh *RetentionHandler) LastReport(ctx context.Context) (report json.RawMessage, err *mft.Error) {
+	rsh.mxReport.Lock()
+	defer rsh.mxReport.Unlock()
+
+	report, er0 := json.Marshal(rsh.report)
+	if er0 != nil {
+		return nil, GenerateErrorE(10118561, er0)
+	}
+
+	return report, nil
+}
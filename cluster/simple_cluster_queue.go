@@ -131,6 +131,7 @@ func (sc *SimpleCluster) AddQueue(ctx context.Context, user cn.CapUser, queueDes
 		return err
 	}
 
+	sc.setQueueEraseCheck(qld.Name, q)
 	qld.Queue = q
 
 	sc.mx.Lock()
@@ -251,6 +252,24 @@ func (sc *SimpleCluster) GetQueue(ctx context.Context, user cn.CapUser, name str
 	return qld.Queue, true, nil
 }
 
+// setQueueEraseCheck - sets check of EraseAction permission into queue.Erase
+func (sc *SimpleCluster) setQueueEraseCheck(name string, q queue.Queue) {
+	sq, ok := q.(*queue.SimpleQueue)
+	if !ok {
+		return
+	}
+	sq.EraseCheck = func(ctx context.Context, user cn.CapUser) *mft.Error {
+		allowed, err := sc.CheckPermission(ctx, user, cn.ClusterSelfObjectType, cn.EraseAction, name)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return GenerateErrorForClusterUser(user, 10111100, name)
+		}
+		return nil
+	}
+}
+
 func QueueGeneratorCreate() *QueueGenerator {
 	res := &QueueGenerator{
 		qNewGenerator: make(map[string]func(ctx context.Context, storageGenerator *storage.Generator,
@@ -274,6 +293,14 @@ type SimpleQueueParams struct {
 	Segments                        *segment.Segments `json:"segments"`
 	DefaultSaveMode                 cn.SaveMode       `json:"default_save_mod"`
 	UseDefaultSaveModeForce         bool              `json:"use_default_save_mod_force"`
+	// BlockFormat - format of block files ("" - json, "bin" - binary with crc)
+	// blocks in other format are rewritten on load
+	BlockFormat string `json:"block_format,omitempty"`
+	// AppendSave - saves of current write block append only new messages into segment file
+	AppendSave bool `json:"append_save,omitempty"`
+	// ManifestCheckpoint - count of metadata change events between checkpoints
+	// 0 - queue.ManifestCheckpointDefault; < 0 - metadata is always rewritten
+	ManifestCheckpoint int `json:"manifest_checkpoint,omitempty"`
 }
 
 func (sqp SimpleQueueParams) ToJson() json.RawMessage {
@@ -298,6 +325,9 @@ func SimppleQueueNewGenerator(ctx context.Context, storageGenerator *storage.Gen
 	if er0 != nil {
 		return nil, GenerateErrorE(10105001, er0)
 	}
+	if !queue.IsBlockFormatAllowed(sqp.BlockFormat) {
+		return nil, GenerateError(10105006, sqp.BlockFormat)
+	}
 
 	qd = &QueueLoadDescription{
 		Name:         queueDescription.Name,
@@ -337,6 +367,9 @@ func SimppleQueueNewGenerator(ctx context.Context, storageGenerator *storage.Gen
 	sq.Segments = sqp.Segments
 	sq.DefaultSaveMode = sqp.DefaultSaveMode
 	sq.UseDefaultSaveModeForce = sqp.UseDefaultSaveModeForce
+	sq.BlockFormat = sqp.BlockFormat
+	sq.AppendSave = sqp.AppendSave
+	sq.ManifestCheckpoint = sqp.ManifestCheckpoint
 
 	err = sq.SaveAll(ctx, queueDescription)
 	if err != nil {
@@ -384,6 +417,9 @@ func SimppleQueueLoadGenerator(ctx context.Context, storageGenerator *storage.Ge
 	if er0 != nil {
 		return nil, GenerateErrorE(10106001, er0)
 	}
+	if !queue.IsBlockFormatAllowed(sqp.BlockFormat) {
+		return nil, GenerateError(10106006, sqp.BlockFormat)
+	}
 
 	metaStorage, err := storageGenerator.Create(ctx, sqp.MetaStorageMountName, queueDescription.RelativePath)
 	if err != nil {
@@ -417,6 +453,9 @@ func SimppleQueueLoadGenerator(ctx context.Context, storageGenerator *storage.Ge
 	if err != nil {
 		return nil, GenerateErrorE(10106005, err, queueDescription.Name)
 	}
+	sq.BlockFormat = sqp.BlockFormat
+	sq.AppendSave = sqp.AppendSave
+	sq.ManifestCheckpoint = sqp.ManifestCheckpoint
 
 	return sq, nil
 }
@@ -0,0 +1,124 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/queue"
+	"github.com/capella-pw/queue/storage"
+	"github.com/myfantasy/mft"
+)
+
+func TestSimpleCluster_EraseCheck(t *testing.T) {
+	ctx := context.Background()
+
+	q := queue.CreateSimpleQueue(5, 0, 0, storage.CreateMapSorage(), nil, nil, nil)
+	ids := make([]int64, 0)
+	for i := 0; i < 3; i++ {
+		id, err := q.Add(ctx, nil, []byte("secret text"), 0, 0, "", 0, cn.SaveMarkSaveMode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	sc := &SimpleCluster{
+		Queues: map[string]*QueueLoadDescription{"q1": {Name: "q1", Queue: q}},
+		CheckPermissionFunc: func(ctx context.Context, user cn.CapUser, objectType string, action string, objectName string) (allowed bool, err *mft.Error) {
+			if action == cn.EraseAction {
+				return user != nil && user.GetName() == "auditor" && objectName == "q1", nil
+			}
+			return true, nil
+		},
+	}
+	sc.setQueueEraseCheck("q1", q)
+
+	// erase by queue of GetQueue
+	gq, _, err := sc.GetQueue(ctx, cn.CapUserName("reader"), "q1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = gq.Erase(ctx, cn.CapUserName("reader"), []int64{ids[0]}, "test")
+	if err == nil || !IsPermissionDenied(err) {
+		t.Errorf("Queue.Erase without EraseAction permission should fail with permission denied not %v", err)
+	}
+
+	// erase by CallFuncInCluster
+	request := MarshalRequestMust(cn.CapUserName("reader"), cn.OpQueueErase, QueueEraseRequest{IDs: []int64{ids[1]}})
+	request.ObjectName = "q1"
+	responce := CallFuncInCluster(ctx, sc, request, nil)
+	if responce.Err == nil || !IsPermissionDenied(responce.Err) {
+		t.Errorf("CallFuncInCluster erase without EraseAction permission should fail with permission denied not %v", responce.Err)
+	}
+
+	messages, err := q.GetByIDs(ctx, nil, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range messages {
+		if string(m.Message) != "secret text" {
+			t.Fatalf("message %v should not be erased without EraseAction permission", m.ID)
+		}
+	}
+
+	erased, err := gq.Erase(ctx, cn.CapUserName("auditor"), []int64{ids[2]}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(erased) != 1 || erased[0].ID != ids[2] {
+		t.Errorf("Queue.Erase with EraseAction permission should erase message")
+	}
+}
+
+func TestExternalAbstractQueue_MirrorTranslate(t *testing.T) {
+	ctx := context.Background()
+
+	src := queue.CreateSimpleQueue(5, 0, 0, storage.CreateMapSorage(), nil, nil, nil)
+	mirror := queue.CreateSimpleQueue(5, 0, 0, storage.CreateMapSorage(), nil, nil, nil)
+	srcIDs := make([]int64, 0)
+	for i := 0; i < 3; i++ {
+		id, err := src.Add(ctx, nil, []byte("text"), 0, 0, "", 0, cn.SaveMarkSaveMode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srcIDs = append(srcIDs, id)
+	}
+	_, err := queue.SubscribeMirror(src, mirror, nil, nil, cn.SaveMarkSaveMode, cn.SaveMarkSaveMode,
+		"mirror", 10, false, nil, "m")(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages, err := mirror.Get(ctx, nil, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sc := &SimpleCluster{Queues: map[string]*QueueLoadDescription{"mirror": {Name: "mirror", Queue: mirror}}}
+	eaq := &ExternalAbstractQueue{
+		QueueName: "mirror",
+		CallFunc: func(ctx context.Context, request *RequestBody) (responce *ResponceBody) {
+			return CallFuncInCluster(ctx, sc, request, nil)
+		},
+	}
+
+	id, err := eaq.MirrorTranslate(ctx, nil, "m", srcIDs[1], "", cn.SaveMarkSaveMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != messages[1].ID {
+		t.Errorf("MirrorTranslate should be %v not %v", messages[1].ID, id)
+	}
+
+	id, err = eaq.MirrorTranslate(ctx, nil, "m", srcIDs[2]+1, "consumer", cn.SaveMarkSaveMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lastID, err := mirror.SubscriberGetLastRead(ctx, nil, "consumer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != messages[2].ID || lastID != id {
+		t.Errorf("MirrorTranslate with subscriber should set last read %v not %v (%v)", messages[2].ID, lastID, id)
+	}
+}
@@ -31,6 +31,9 @@ const (
 	DropHandlerAction     = "DROP_HANDLER"
 	GetHandlerDescrAction = "GET_HANDLER_DESCR"
 	GetHandlerAction      = "GET_HANDLER"
+
+	RestoreArchiveAction = "RESTORE_ARCHIVE"
+	EraseAction          = "ERASE"
 )
 
 // Operation names
@@ -54,6 +57,8 @@ const (
 
 	OpNestedCall = "nested_call"
 
+	OpBatch = "batch"
+
 	OpAddHandler            = "add_h"
 	OpDropHandler           = "drop_h"
 	OpGetHandlerDescription = "gd_h"
@@ -61,6 +66,8 @@ const (
 
 	OpCheckPermission = "check_perms"
 
+	OpRestoreArchive = "restore_archive"
+
 	OpGetFullStruct  = "full_struct_get"
 	OpLoadFullStruct = "full_struct_set"
 
@@ -71,9 +78,16 @@ const (
 	OpQueueSaveAll       = "q_save_all"
 	OpQueueAddUnique     = "q_add_unique"
 	OpQueueAddUniqueList = "q_add_unique_list"
+	OpQueueGetFromTime   = "q_get_from_time"
+	OpQueueGetByIDs      = "q_get_by_ids"
+	OpQueueGetByExtID    = "q_get_by_ext_id"
+	OpQueueErase         = "q_erase"
+
+	OpQueueMirrorTranslate = "q_mirror_translate"
 
 	OpQueueSubscriberSetLastRead         = "q_subs_set_last"
 	OpQueueSubscriberGetLastRead         = "q_subs_get_last"
+	OpQueueSubscriberSeekTime            = "q_subs_seek_time"
 	OpQueueSubscriberAddReplicaMember    = "q_subs_add_r_m"
 	OpQueueSubscriberRemoveReplicaMember = "q_subs_rm_r_m"
 	OpQueueSubscriberGetReplicaCount     = "q_subs_get_r_m_cnt"
@@ -83,4 +97,5 @@ const (
 	OpHandlerLastComplete = "h_last_complete"
 	OpHandlerLastError    = "h_last_error"
 	OpHandlerIsStarted    = "h_is_started"
+	OpHandlerLastReport   = "h_last_report"
 )
@@ -4,9 +4,9 @@ go 1.16
 
 require (
 	github.com/andybalholm/brotli v1.0.3 // indirect
-	github.com/jmoiron/sqlx v1.3.4 // indirect
+	github.com/jmoiron/sqlx v1.3.4
 	github.com/klauspost/compress v1.13.0 // indirect
-	github.com/lib/pq v1.10.2 // indirect
+	github.com/lib/pq v1.10.2
 	github.com/myfantasy/mfs v0.1.4
 	github.com/myfantasy/mft v0.0.12
 	github.com/myfantasy/segment v0.0.5
@@ -19,6 +19,8 @@ var Errors map[int]string = map[int]string{
 	10010008: "SimpleQueueBlock.add: externat time in future ext time: %v now:%v",
 	10010009: "SimpleQueue.Add: segment %v is out of valid segments",
 	10010010: "SimpleQueue.Add: save mode %v is not allowed",
+	10010011: "SimpleQueue.Add: context is done before add (message is not added)",
+	10010012: "SimpleQueue.Add: context is done while add (message can be added)",
 
 	10011000: "SimpleQueue.getBlockForNext: block RLock fail wait",
 	10011001: "SimpleQueueBlock.getItemsAfter: block RLock fail wait",
@@ -35,6 +37,8 @@ var Errors map[int]string = map[int]string{
 	10013002: "SimpleQueueBlock.Save: block.data marshal fail",
 	10013003: "SimpleQueueBlock.Save: file %v save fail",
 	10013004: "SimpleQueueBlock.Save: block Lock fail wait",
+	10013005: "SimpleQueueBlock.Save: segment file %v delete fail",
+	10013006: "SimpleQueueBlock.Save: queue Lock fail wait",
 
 	10014000: "SimpleQueue.SaveAll: block Lock BlockSaveWait mutex fail wait",
 
@@ -60,7 +64,7 @@ var Errors map[int]string = map[int]string{
 
 	10020000: "SimpleQueueBlock.load: block Lock FileSave mutex fail wait",
 	10020001: "SimpleQueueBlock.load: block Promote to Lock fail wait",
-	10020002: "SimpleQueueBlock.load: json Unmarchal Fail",
+	10020002: "SimpleQueueBlock.load: unmarshal fail file: %v mark: %v",
 	10020003: "SimpleQueueBlock.load: load from storage Fail file name: %v, mark:%v",
 
 	10021000: "SimpleQueue.SetUnload: queue RLock fail wait",
@@ -91,6 +95,8 @@ var Errors map[int]string = map[int]string{
 
 	10030000: "LoadSimpleQueue() (*SimpleQueue): unmarshal queue info error",
 	10030001: "LoadSimpleQueue() (*SimpleQueue): unmarshal subscribers info error",
+	10030002: "LoadSimpleQueue() (*SimpleQueue): load manifest error",
+	10030003: "LoadSimpleQueue() (*SimpleQueue): metadata marshal error",
 
 	10031000: "SimpleQueue.SaveSubscribers: queue subscribers Lock FileSave mutex fail wait",
 	10031001: "SimpleQueue.SaveSubscribers: queue subscribers RLock fail wait",
@@ -111,6 +117,110 @@ var Errors map[int]string = map[int]string{
 	10033201: "SimpleQueue.SubscriberRemoveReplicaMember: save fail",
 
 	10033300: "SimpleQueue.SubscriberGetReplicaCount: queue subscribers RLock fail wait",
+
+	10034000: "SimpleQueue.getIDBeforeTime: queue RLock fail wait",
+	10034001: "SimpleQueue.getIDBeforeTime: block RLock fail wait",
+
+	10034100: "SimpleQueue.SubscriberSeekTime: set last read fail subscriber: %v",
+
+	10035000: "SimpleQueueBlock.getItemByID: block RLock fail wait",
+	10035001: "SimpleQueue.GetByIDs: queue RLock fail wait",
+
+	10035100: "SimpleQueue.GetByExternalID: search fail source: %v external id: %v",
+	10035101: "SimpleQueue.GetByExternalID: get message fail id: %v",
+
+	10036000: "SimpleQueueBlock.lockForErase: block RLock fail wait",
+	10036001: "SimpleQueueBlock.lockForErase: block file save Lock fail wait",
+	10036002: "SimpleQueueBlock.lockForErase: block Lock fail wait",
+	10036003: "SimpleQueueBlock.lockForErase: block %v is unloaded during erase",
+	10036004: "SimpleQueueBlock.erase: block marshal fail",
+	10036005: "SimpleQueueBlock.erase: file %v exists check fail in storage mark `%v`",
+	10036006: "SimpleQueueBlock.erase: file %v save fail in storage mark `%v`",
+
+	10036100: "SimpleQueue.writeEraseAudit: queue erase Lock fail wait",
+	10036101: "SimpleQueue.writeEraseAudit: file %v read fail",
+	10036102: "SimpleQueue.writeEraseAudit: file %v unmarshal fail",
+	10036103: "SimpleQueue.writeEraseAudit: audit marshal fail",
+	10036104: "SimpleQueue.writeEraseAudit: file %v save fail",
+
+	10036200: "SimpleQueue.Erase: queue RLock fail wait",
+	10036201: "SimpleQueue.Erase: search block fail id: %v",
+	10036202: "SimpleQueue.Erase: erase fail block: %v",
+	10036203: "SimpleQueue.Erase: write audit fail",
+	10036204: "SimpleQueue.eraseArchived: queue Lock fail wait",
+	10036205: "SimpleQueue.Erase: erase archived messages fail",
+	10036206: "SimpleQueue.Erase: erase is not allowed",
+
+	10037000: "SimpleQueueBlock.retentionInfo: block RLock fail wait",
+	10037001: "SimpleQueue.subscriberReplicaReadAll: queue subscribers RLock fail wait",
+
+	10037100: "SimpleQueue.SetDeleteByRetention: queue RLock fail wait",
+	10037101: "SimpleQueue.SetDeleteByRetention: get info fail block: %v",
+	10037102: "SimpleQueue.SetDeleteByRetention: check replica subscribers fail block: %v",
+	10037103: "SimpleQueue.SetDeleteByRetention: set need delete fail block: %v",
+
+	10038000: "SimpleQueueBlock.getItems: block RLock fail wait",
+	10038001: "SimpleQueueBlock.setArchived: queue Lock fail wait",
+	10038002: "SimpleQueueBlock.setArchived: block Lock fail wait",
+
+	10038100: "SimpleQueue.SetArchive: queue RLock fail wait",
+	10038101: "SimpleQueue.SetArchive: get messages fail block: %v",
+	10038102: "SimpleQueue.SetArchive: archive fail block: %v",
+	10038103: "SimpleQueue.SetArchive: set archived fail block: %v",
+
+	10038200: "SimpleQueue.GetArchives: queue RLock fail wait",
+
+	10039000: "unmarshalBlockDataBinary: body is too short len: %v",
+	10039001: "unmarshalBlockDataBinary: crc check fail",
+	10039002: "unmarshalBlockDataBinary: unsupported version: %v",
+	10039003: "unmarshalBlockDataBinary: wrong length count: %v data len: %v body len: %v",
+	10039004: "unmarshalBlockDataBinary: message record out of range index: %v offset: %v",
+
+	10040000: "SimpleQueue.isCurrentBlock: queue RLock fail wait",
+	10040001: "SimpleQueueBlock.loadAppending: load from storage fail file name: %v, mark: %v",
+	10040002: "SimpleQueueBlock.loadAppending: unmarshal fail file name: %v, mark: %v",
+	10040003: "SimpleQueueBlock.loadAppending: truncate broken chunk fail file name: %v, mark: %v",
+
+	10041000: "SimpleQueue.saveMeta: queue RLock fail wait",
+	10041001: "SimpleQueue.saveMeta: metadata marshal fail",
+	10041002: "SimpleQueue.saveMeta: marshal fail",
+	10041003: "SimpleQueue.saveMeta: file %v save fail",
+	10041004: "SimpleQueue.saveMeta: file %v delete fail",
+
+	10041100: "SimpleQueue.loadManifest: load from storage fail file name: %v",
+	10041101: "SimpleQueue.loadManifest: unmarshal fail line: %v",
+	10041102: "SimpleQueue.loadManifest: apply fail line: %v op: %v",
+	10041103: "SimpleQueue.applyManifestEvent: unknown op: %v",
+
+	10042000: "GroupCommitter.Commit: context done before commit",
+
+	10043000: "MessagesWithMeta.UnmarshalBinary: wrong header len: %v",
+	10043001: "MessagesWithMeta.UnmarshalBinary: version %v is not supported",
+	10043002: "MessagesWithMeta.UnmarshalBinary: count %v does not match len: %v",
+	10043003: "MessagesWithMeta.UnmarshalBinary: message %v (position %v) is broken",
+
+	10044000: "MirrorTranslateID: get by external id fail source: %v id: %v",
+	10044001: "MirrorTranslateID: get messages fail source: %v id: %v",
+	10044002: "MirrorSubscriberSetLastRead: subscriber `%v` set last read %v fail",
+	10044003: "MirrorTranslateID: get known message fail source: %v id: %v",
+	10044004: "MirrorSubscriberSetLastRead: subscriber `%v` get last read fail",
+
+	10045000: "Reconcile: find source start by time %v fail",
+	10045001: "Reconcile: read source from %v fail",
+	10045002: "Reconcile: find destination start by time %v fail",
+	10045003: "Reconcile: read destination from %v fail",
+	10045004: "ReconcileCopyMissing: read source messages fail",
+	10045005: "ReconcileCopyMissing: add %v messages into destination fail",
+
+	10046000: "Transform.Validate: unknown op `%v` of field `%v`",
+	10046001: "Transform.Validate: path of field should be set",
+	10046002: "Transform.Validate: value of field `%v` is not json",
+	10046003: "Transform.Apply: body of message %v is not json object",
+	10046004: "Transform.Apply: marshal body of message %v fail",
+
+	10047000: "FanOut.read: wait read of source from %v fail",
+	10047001: "FanOut.read: read source from %v fail",
+	10047002: "FanOut: copy into destination `%v` fail",
 }
 
 // GenerateError -
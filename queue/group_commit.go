@@ -0,0 +1,107 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/myfantasy/mft"
+)
+
+// DefaultGroupCommitter - group committer for queues without own GroupCommitter
+var DefaultGroupCommitter = &GroupCommitter{}
+
+// GroupCommitTimeoutDefault - default timeout of one commit
+var GroupCommitTimeoutDefault = time.Minute
+
+// GroupCommitUser - user of SaveAll of group commit (commit is shared by waiters of different users)
+var GroupCommitUser cn.CapUser = cn.CapUserName("group_commit")
+
+// GroupCommitter - batches SaveAll of concurrent waiters (SaveImmediatelySaveMode)
+// waiters that come while commit is running wait for next commit
+// next commit saves all waiting queues in parallel (one SaveAll for each queue)
+// one GroupCommitter may be shared between queues
+type GroupCommitter struct {
+	// Timeout - timeout of one commit (0 - GroupCommitTimeoutDefault)
+	Timeout time.Duration
+
+	mx      sync.Mutex
+	running bool
+	waiters map[*SimpleQueue][]*groupCommitWaiter
+}
+
+type groupCommitWaiter struct {
+	ch chan *mft.Error
+}
+
+// Commit - wait for SaveAll of queue that starts after call
+// SaveAll is called by GroupCommitUser with Timeout (ctx limits only wait of caller)
+func (gc *GroupCommitter) Commit(ctx context.Context, q *SimpleQueue) (err *mft.Error) {
+	w := &groupCommitWaiter{
+		ch: make(chan *mft.Error, 1),
+	}
+
+	gc.mx.Lock()
+	if gc.waiters == nil {
+		gc.waiters = make(map[*SimpleQueue][]*groupCommitWaiter)
+	}
+	gc.waiters[q] = append(gc.waiters[q], w)
+	if !gc.running {
+		gc.running = true
+		go gc.loop()
+	}
+	gc.mx.Unlock()
+
+	select {
+	case err = <-w.ch:
+		return err
+	case <-ctx.Done():
+		return GenerateError(10042000)
+	}
+}
+
+func (gc *GroupCommitter) loop() {
+	for {
+		gc.mx.Lock()
+		if len(gc.waiters) == 0 {
+			gc.running = false
+			gc.mx.Unlock()
+			return
+		}
+		batch := gc.waiters
+		gc.waiters = make(map[*SimpleQueue][]*groupCommitWaiter)
+		gc.mx.Unlock()
+
+		timeout := gc.Timeout
+		if timeout <= 0 {
+			timeout = GroupCommitTimeoutDefault
+		}
+
+		var wg sync.WaitGroup
+		for q, waiters := range batch {
+			wg.Add(1)
+			go func(q *SimpleQueue, waiters []*groupCommitWaiter) {
+				defer wg.Done()
+
+				ctx, cancel := context.WithTimeout(context.Background(), timeout)
+				err := q.SaveAll(ctx, GroupCommitUser)
+				cancel()
+				for _, w := range waiters {
+					w.ch <- err
+				}
+			}(q, waiters)
+		}
+		wg.Wait()
+	}
+}
+
+// commit - SaveAll with group commit
+func (q *SimpleQueue) commit(ctx context.Context) (err *mft.Error) {
+	gc := q.GroupCommitter
+	if gc == nil {
+		gc = DefaultGroupCommitter
+	}
+
+	return gc.Commit(ctx, q)
+}
@@ -0,0 +1,114 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/storage"
+	"github.com/myfantasy/mft"
+)
+
+type slowSaveStorage struct {
+	*storage.MapSorage
+	cnt int64
+}
+
+func (s *slowSaveStorage) Save(ctx context.Context, name string, body []byte) *mft.Error {
+	atomic.AddInt64(&s.cnt, 1)
+	time.Sleep(10 * time.Millisecond)
+	return s.MapSorage.Save(ctx, name, body)
+}
+
+func TestGroupCommitter_Commit(t *testing.T) {
+	gc := &GroupCommitter{}
+	ctx := context.Background()
+
+	queues := make([]*SimpleQueue, 0)
+	stors := make([]*slowSaveStorage, 0)
+	for i := 0; i < 2; i++ {
+		stor := &slowSaveStorage{MapSorage: storage.CreateMapSorage()}
+		q := CreateSimpleQueue(1000, 0, 0, stor, nil, nil, nil)
+		q.ManifestCheckpoint = -1
+		q.GroupCommitter = gc
+
+		queues = append(queues, q)
+		stors = append(stors, stor)
+	}
+
+	cnt := 20
+
+	var wg sync.WaitGroup
+	for _, q := range queues {
+		for i := 0; i < cnt; i++ {
+			wg.Add(1)
+			go func(q *SimpleQueue) {
+				defer wg.Done()
+				_, err := q.Add(ctx, nil, []byte("text"), 0, 0, "", 0, cn.SaveImmediatelySaveMode)
+				if err != nil {
+					t.Error(err)
+				}
+			}(q)
+		}
+	}
+	wg.Wait()
+
+	for i, q := range queues {
+		block := q.Blocks[0]
+		if len(block.Data) != cnt || block.SaveRv != block.ChangesRv {
+			t.Errorf("queue %v: GroupCommitter.Commit should save all messages", i)
+		}
+
+		body, err := stors[i].MapSorage.Get(ctx, block.blockFileName())
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _, er0 := unmarshalBlockData(body)
+		if er0 != nil {
+			t.Fatal(er0)
+		}
+		if len(data) != cnt {
+			t.Errorf("queue %v: block file should contain %v messages not %v", i, cnt, len(data))
+		}
+
+		// each commit saves meta and block
+		if saves := atomic.LoadInt64(&stors[i].cnt); saves >= int64(cnt) {
+			t.Errorf("queue %v: GroupCommitter.Commit should batch saves: %v saves for %v messages", i, saves, cnt)
+		}
+	}
+}
+
+type hangSaveStorage struct {
+	*storage.MapSorage
+}
+
+func (s *hangSaveStorage) Save(ctx context.Context, name string, body []byte) *mft.Error {
+	<-ctx.Done()
+	return mft.ErrorE(ctx.Err())
+}
+
+func TestGroupCommitter_Commit_timeout(t *testing.T) {
+	gc := &GroupCommitter{Timeout: 50 * time.Millisecond}
+	ctx := context.Background()
+
+	q := CreateSimpleQueue(1000, 0, 0, &hangSaveStorage{MapSorage: storage.CreateMapSorage()}, nil, nil, nil)
+	q.GroupCommitter = gc
+
+	done := make(chan *mft.Error, 1)
+	go func() {
+		_, err := q.Add(ctx, nil, []byte("text"), 0, 0, "", 0, cn.SaveImmediatelySaveMode)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("GroupCommitter.Commit should return error when save is not completed in timeout")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("GroupCommitter.Commit should stop save by timeout")
+	}
+}
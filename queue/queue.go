@@ -21,6 +21,8 @@ type MessageWithMeta struct {
 	Source     string    `json:"src,omitempty"`
 	IsSaved    bool      `json:"is_saved"`
 	Segment    int64     `json:"sg,omitempty"`
+	// Tombstone - message was erased (message body is removed)
+	Tombstone bool `json:"tomb,omitempty"`
 }
 
 // MessageOnlyMeta one message only meta
@@ -33,6 +35,8 @@ type MessageOnlyMeta struct {
 	Source     string    `json:"src,omitempty"`
 	IsSaved    bool      `json:"is_saved"`
 	Segment    int64     `json:"sg,omitempty"`
+	// Tombstone - message was erased (message body is removed)
+	Tombstone bool `json:"tomb,omitempty"`
 }
 
 // Message one message
@@ -75,6 +79,23 @@ type Queue interface {
 		segments *segment.Segments,
 	) (messages []*MessageWithMeta, lastId int64, err *mft.Error)
 
+	// GetFromTime - gets messages from queue not more then cntLimit count with Dt >= dt
+	// returns messages == nil when no elements
+	GetFromTime(ctx context.Context, user cn.CapUser, dt time.Time, cntLimit int) (messages []*MessageWithMeta, err *mft.Error)
+
+	// GetByIDs - gets messages from queue by ids
+	// not found messages are skipped
+	// returns messages == nil when no elements
+	GetByIDs(ctx context.Context, user cn.CapUser, ids []int64) (messages []*MessageWithMeta, err *mft.Error)
+
+	// GetByExternalID - gets message from queue with source and external id
+	// returns exists == false when message not found
+	GetByExternalID(ctx context.Context, user cn.CapUser, source string, extID int64) (message *MessageWithMeta, exists bool, err *mft.Error)
+
+	// Erase - erase messages with ids (message body is removed, message is marked as tombstone)
+	// ID and order of messages is not changed; audit record is written
+	Erase(ctx context.Context, user cn.CapUser, ids []int64, reason string) (erased []*MessageOnlyMeta, err *mft.Error)
+
 	// SaveAll save all waiting for save block and metadata and else
 	SaveAll(ctx context.Context, user cn.CapUser) (err *mft.Error)
 
@@ -93,6 +114,12 @@ type Queue interface {
 		subscriber string, id int64,
 		saveMode cn.SaveMode) (err *mft.Error)
 
+	// SubscriberSeekTime - set last read info to position before first message with Dt >= dt
+	// returns new last read id
+	SubscriberSeekTime(ctx context.Context, user cn.CapUser,
+		subscriber string, dt time.Time,
+		saveMode cn.SaveMode) (id int64, err *mft.Error)
+
 	// SubscriberGetLastRead - get last read info
 	SubscriberGetLastRead(ctx context.Context, user cn.CapUser, subscriber string) (id int64, err *mft.Error)
 
@@ -106,6 +133,15 @@ type Queue interface {
 	SubscriberGetReplicaCount(ctx context.Context, user cn.CapUser, id int64) (cnt int, err *mft.Error)
 }
 
+// AppendNotifier - queue notifies about appended messages
+type AppendNotifier interface {
+	// AppendNotify - returns channel that is closed after next append of messages into queue
+	AppendNotify() <-chan struct{}
+}
+
+// EraseCheckFunc - checks that user is allowed to erase messages of queue; returns error when it is not allowed
+type EraseCheckFunc func(ctx context.Context, user cn.CapUser) (err *mft.Error)
+
 // CopyWM copy message to QueueMessageWithMeta
 func (msg *SimpleQueueMessage) CopyWM() *MessageWithMeta {
 	out := &MessageWithMeta{
@@ -116,6 +152,7 @@ func (msg *SimpleQueueMessage) CopyWM() *MessageWithMeta {
 		Message:    msg.Message,
 		Source:     msg.Source,
 		Segment:    msg.Segment,
+		Tombstone:  msg.Tombstone,
 	}
 
 	return out
@@ -130,6 +167,7 @@ func (msg *MessageWithMeta) CopyOM() *MessageOnlyMeta {
 		ExternalDt: msg.ExternalDt,
 		Source:     msg.Source,
 		Segment:    msg.Segment,
+		Tombstone:  msg.Tombstone,
 	}
 
 	return out
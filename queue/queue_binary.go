@@ -0,0 +1,160 @@
+package queue
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+)
+
+// MessagesWithMeta - list of messages with binary encoding (json encoding is the same as []*MessageWithMeta)
+type MessagesWithMeta []*MessageWithMeta
+
+// Binary format of MessagesWithMeta (all numbers are little endian)
+//
+//	header:
+//	  magic      [4]byte "CQMM"
+//	  version    uint16
+//	  count      uint32 - count of messages
+//	records:
+//	  id         int64
+//	  externalID int64
+//	  externalDt int64
+//	  dt         int64 (unix nano)
+//	  segment    int64
+//	  flags      uint8 (1 - tombstone, 2 - nil message, 4 - is saved, 8 - zero dt)
+//	  sourceLen  uint32
+//	  source     [sourceLen]byte
+//	  messageLen uint32
+//	  message    [messageLen]byte
+const (
+	messagesBinaryMagic      = "CQMM"
+	messagesBinaryVersion    = 1
+	messagesBinaryHeaderLen  = 4 + 2 + 4
+	messagesBinaryRecordLen  = 8*5 + 1 + 4 + 4
+	messagesBinaryTombstone  = 1
+	messagesBinaryNilMessage = 2
+	messagesBinaryIsSaved    = 4
+	messagesBinaryZeroDt     = 8
+)
+
+// MarshalBinary - implements encoding.BinaryMarshaler
+func (messages MessagesWithMeta) MarshalBinary() (body []byte, err error) {
+	size := messagesBinaryHeaderLen
+	for _, msg := range messages {
+		size += messagesBinaryRecordLen + len(msg.Source) + len(msg.Message)
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, size))
+	le := binary.LittleEndian
+	var b8 [8]byte
+
+	buf.WriteString(messagesBinaryMagic)
+	le.PutUint16(b8[:2], messagesBinaryVersion)
+	buf.Write(b8[:2])
+	le.PutUint32(b8[:4], uint32(len(messages)))
+	buf.Write(b8[:4])
+
+	for _, msg := range messages {
+		var flags byte
+		var dt int64
+		if msg.Dt.IsZero() {
+			flags |= messagesBinaryZeroDt
+		} else {
+			dt = msg.Dt.UnixNano()
+		}
+
+		for _, v := range []int64{msg.ID, msg.ExternalID, msg.ExternalDt, dt, msg.Segment} {
+			le.PutUint64(b8[:], uint64(v))
+			buf.Write(b8[:])
+		}
+
+		if msg.Tombstone {
+			flags |= messagesBinaryTombstone
+		}
+		if msg.Message == nil {
+			flags |= messagesBinaryNilMessage
+		}
+		if msg.IsSaved {
+			flags |= messagesBinaryIsSaved
+		}
+		buf.WriteByte(flags)
+
+		le.PutUint32(b8[:4], uint32(len(msg.Source)))
+		buf.Write(b8[:4])
+		buf.WriteString(msg.Source)
+
+		le.PutUint32(b8[:4], uint32(len(msg.Message)))
+		buf.Write(b8[:4])
+		buf.Write(msg.Message)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary - implements encoding.BinaryUnmarshaler
+func (messages *MessagesWithMeta) UnmarshalBinary(body []byte) (err error) {
+	le := binary.LittleEndian
+
+	if len(body) < messagesBinaryHeaderLen || string(body[:len(messagesBinaryMagic)]) != messagesBinaryMagic {
+		return GenerateError(10043000, len(body))
+	}
+
+	version := le.Uint16(body[4:6])
+	if version != messagesBinaryVersion {
+		return GenerateError(10043001, version)
+	}
+
+	count := int(le.Uint32(body[6:10]))
+	if count > (len(body)-messagesBinaryHeaderLen)/messagesBinaryRecordLen {
+		return GenerateError(10043002, count, len(body))
+	}
+
+	result := make(MessagesWithMeta, 0, count)
+	pos := messagesBinaryHeaderLen
+	for i := 0; i < count; i++ {
+		if pos+messagesBinaryRecordLen > len(body) {
+			return GenerateError(10043003, i, pos)
+		}
+		rec := body[pos:]
+
+		msg := &MessageWithMeta{
+			ID:         int64(le.Uint64(rec[0:8])),
+			ExternalID: int64(le.Uint64(rec[8:16])),
+			ExternalDt: int64(le.Uint64(rec[16:24])),
+			Segment:    int64(le.Uint64(rec[32:40])),
+		}
+		flags := rec[40]
+		if flags&messagesBinaryZeroDt == 0 {
+			msg.Dt = time.Unix(0, int64(le.Uint64(rec[24:32])))
+		}
+		msg.Tombstone = flags&messagesBinaryTombstone != 0
+		msg.IsSaved = flags&messagesBinaryIsSaved != 0
+
+		p := 41
+		sourceLen := int(le.Uint32(rec[p:]))
+		p += 4
+		if sourceLen > len(rec)-p-4 {
+			return GenerateError(10043003, i, pos)
+		}
+		msg.Source = string(rec[p : p+sourceLen])
+		p += sourceLen
+
+		messageLen := int(le.Uint32(rec[p:]))
+		p += 4
+		if messageLen > len(rec)-p {
+			return GenerateError(10043003, i, pos)
+		}
+		if flags&messagesBinaryNilMessage == 0 {
+			msg.Message = make([]byte, messageLen)
+			copy(msg.Message, rec[p:p+messageLen])
+		}
+		p += messageLen
+
+		result = append(result, msg)
+		pos += p
+	}
+
+	*messages = result
+
+	return nil
+}
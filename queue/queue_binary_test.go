@@ -0,0 +1,62 @@
+package queue
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestMessagesWithMeta_MarshalUnmarshalBinary(t *testing.T) {
+	dt := time.Now()
+	messages := MessagesWithMeta{
+		{ID: 10, ExternalID: 5, ExternalDt: 7, Dt: dt, Source: "src", Segment: 3, Message: []byte("hello"), IsSaved: true},
+		{ID: 11, Dt: dt, Message: []byte{}},
+		{ID: 12, Tombstone: true},
+	}
+
+	body, err := messages.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var res MessagesWithMeta
+	err = res.UnmarshalBinary(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != len(messages) {
+		t.Fatalf("MessagesWithMeta.UnmarshalBinary should return %v messages not %v", len(messages), len(res))
+	}
+	for i, msg := range messages {
+		r := res[i]
+		if r.ID != msg.ID || r.ExternalID != msg.ExternalID || r.ExternalDt != msg.ExternalDt ||
+			!r.Dt.Equal(msg.Dt) || r.Source != msg.Source || r.Segment != msg.Segment ||
+			r.Tombstone != msg.Tombstone || r.IsSaved != msg.IsSaved || !bytes.Equal(r.Message, msg.Message) ||
+			(r.Message == nil) != (msg.Message == nil) {
+			t.Errorf("MessagesWithMeta.UnmarshalBinary message %v is different %+v != %+v", i, r, msg)
+		}
+	}
+
+	for _, l := range []int{0, 5, messagesBinaryHeaderLen, len(body) - 1} {
+		err = res.UnmarshalBinary(body[:l])
+		if err == nil {
+			t.Errorf("MessagesWithMeta.UnmarshalBinary should fail on truncated body len %v", l)
+		}
+	}
+
+	// json encoding is the same as []*MessageWithMeta
+	{
+		b1, er0 := json.Marshal(messages)
+		if er0 != nil {
+			t.Fatal(er0)
+		}
+		b2, er0 := json.Marshal([]*MessageWithMeta(messages))
+		if er0 != nil {
+			t.Fatal(er0)
+		}
+		if !bytes.Equal(b1, b2) {
+			t.Errorf("MessagesWithMeta json should be the same as []*MessageWithMeta")
+		}
+	}
+}
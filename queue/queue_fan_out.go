@@ -0,0 +1,173 @@
+package queue
+
+import (
+	"context"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/myfantasy/mfs"
+	"github.com/myfantasy/mft"
+	"github.com/myfantasy/segment"
+)
+
+// FanOutCacheLimitDefault - default count of batches of source that are kept for destinations
+var FanOutCacheLimitDefault = 16
+
+// FanOutSubscriber - name of subscriber of source that stores progress of destination
+func FanOutSubscriber(subscriberName string, dstName string) string {
+	return subscriberName + ":" + dstName
+}
+
+// FanOutDestination - destination of fan out
+type FanOutDestination struct {
+	// Name - name of destination (progress of destination is stored in subscriber FanOutSubscriber)
+	Name     string
+	Queue    Queue
+	User     cn.CapUser
+	SaveMode cn.SaveMode
+	// DoSave - SaveAll of destination after add
+	DoSave bool
+	// Route - only messages that match route are copied into destination (sources, segments and fields)
+	Route TransformFilter
+}
+
+type fanOutBatch struct {
+	done     chan struct{}
+	messages []*MessageWithMeta
+	lastID   int64
+	err      *mft.Error
+}
+
+// FanOut - copy (addUniqueList) of source into several destinations; each destination has own progress
+// batch of source is read once for destinations that are at the same position (cache of last batches),
+// so slow or broken destination does not block others
+type FanOut struct {
+	Src         Queue
+	UserSrc     cn.CapUser
+	SaveModeSrc cn.SaveMode
+	// SubscriberName - prefix of subscribers of source (see FanOutSubscriber)
+	SubscriberName string
+	CntLimit       int
+	Segments       *segment.Segments
+	// CacheLimit - count of batches of source that are kept (0 - FanOutCacheLimitDefault)
+	CacheLimit int
+
+	mx         mfs.PMutex
+	cache      map[int64]*fanOutBatch
+	cacheOrder []int64
+	progress   map[string]int64
+	reads      int64
+}
+
+// FanOutCreate - create fan out of source
+func FanOutCreate(src Queue, userSrc cn.CapUser, saveModeSrc cn.SaveMode,
+	subscriberName string, cntLimit int, segments *segment.Segments) *FanOut {
+	return &FanOut{
+		Src:            src,
+		UserSrc:        userSrc,
+		SaveModeSrc:    saveModeSrc,
+		SubscriberName: subscriberName,
+		CntLimit:       cntLimit,
+		Segments:       segments,
+		cache:          make(map[int64]*fanOutBatch),
+		progress:       make(map[string]int64),
+	}
+}
+
+// read - batch of source after id (from cache when it is already read)
+func (fo *FanOut) read(ctx context.Context, id int64) (messages []*MessageWithMeta, lastID int64, err *mft.Error) {
+	fo.mx.Lock()
+	b, ok := fo.cache[id]
+	if !ok {
+		b = &fanOutBatch{done: make(chan struct{})}
+		fo.cache[id] = b
+		fo.cacheOrder = append(fo.cacheOrder, id)
+		cacheLimit := fo.CacheLimit
+		if cacheLimit <= 0 {
+			cacheLimit = FanOutCacheLimitDefault
+		}
+		for len(fo.cacheOrder) > cacheLimit {
+			delete(fo.cache, fo.cacheOrder[0])
+			fo.cacheOrder = fo.cacheOrder[1:]
+		}
+		fo.reads++
+	}
+	fo.mx.Unlock()
+
+	if !ok {
+		b.messages, b.lastID, b.err = fo.Src.GetSegment(ctx, fo.UserSrc, id, fo.CntLimit, fo.Segments)
+		if b.err != nil || (len(b.messages) == 0 && b.lastID <= id) {
+			// error and end of queue are not cached
+			fo.mx.Lock()
+			if fo.cache[id] == b {
+				delete(fo.cache, id)
+			}
+			fo.mx.Unlock()
+		}
+		close(b.done)
+	} else {
+		select {
+		case <-b.done:
+		case <-ctx.Done():
+			return nil, 0, GenerateErrorE(10047000, ctx.Err(), id)
+		}
+	}
+
+	if b.err != nil {
+		return nil, 0, GenerateErrorE(10047001, b.err, id)
+	}
+
+	return b.messages, b.lastID, nil
+}
+
+// setProgress - last id of source that is copied into destination
+func (fo *FanOut) setProgress(dstName string, id int64) {
+	fo.mx.Lock()
+	defer fo.mx.Unlock()
+
+	fo.progress[dstName] = id
+}
+
+// Progress - last ids of source that are copied into destinations (by name of destination)
+func (fo *FanOut) Progress() map[string]int64 {
+	fo.mx.Lock()
+	defer fo.mx.Unlock()
+
+	res := make(map[string]int64, len(fo.progress))
+	for k, v := range fo.progress {
+		res[k] = v
+	}
+	return res
+}
+
+// Reads - count of reads of source
+func (fo *FanOut) Reads() int64 {
+	fo.mx.Lock()
+	defer fo.mx.Unlock()
+
+	return fo.reads
+}
+
+// Subscribe - copy into destination (the same subscriber and unique semantics as SubscribeCopyUnique)
+// func should be called by one goroutine for destination; funcs of different destinations can be called in parallel
+func (fo *FanOut) Subscribe(dst FanOutDestination) func(ctx context.Context) (isEmpty bool, err *mft.Error) {
+	route := &Transform{Filter: dst.Route}
+	var readID int64
+	copy := subscribeCopy(fo.Src, dst.Queue, fo.UserSrc, dst.User, fo.SaveModeSrc, dst.SaveMode,
+		FanOutSubscriber(fo.SubscriberName, dst.Name), dst.DoSave,
+		func(ctx context.Context, id int64) (messages []*MessageWithMeta, lastID int64, err *mft.Error) {
+			messages, lastID, err = fo.read(ctx, id)
+			readID = lastID
+			return messages, lastID, err
+		}, "", route.Apply)
+
+	return func(ctx context.Context) (isEmpty bool, err *mft.Error) {
+		isEmpty, err = copy(ctx)
+		if err != nil {
+			return isEmpty, GenerateErrorE(10047002, err, dst.Name)
+		}
+		if !isEmpty {
+			fo.setProgress(dst.Name, readID)
+		}
+		return isEmpty, nil
+	}
+}
@@ -0,0 +1,98 @@
+package queue
+
+import (
+	"context"
+	"testing"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/storage"
+	"github.com/myfantasy/mft"
+	"github.com/myfantasy/segment"
+)
+
+type fanOutBrokenQueue struct {
+	*SimpleQueue
+}
+
+func (q fanOutBrokenQueue) AddUniqueList(ctx context.Context, user cn.CapUser, messages []Message,
+	saveMode cn.SaveMode) (ids []int64, err *mft.Error) {
+	return nil, GenerateError(10047002, "broken")
+}
+
+func TestFanOut(t *testing.T) {
+	src := CreateSimpleQueue(5, 0, 0, storage.CreateMapSorage(), nil, nil, nil)
+	ctx := context.Background()
+
+	var lastSrcID int64
+	for i := 1; i <= 10; i++ {
+		source := "s1"
+		if i > 5 {
+			source = "s2"
+		}
+		id, err := src.Add(ctx, nil, []byte("test text"), int64(i), 0, source, int64(i%2), cn.NotSaveSaveMode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lastSrcID = id
+	}
+
+	dstAll := CreateSimpleQueue(5, 0, 0, storage.CreateMapSorage(), nil, nil, nil)
+	dstOdd := CreateSimpleQueue(5, 0, 0, storage.CreateMapSorage(), nil, nil, nil)
+	dstS2 := CreateSimpleQueue(5, 0, 0, storage.CreateMapSorage(), nil, nil, nil)
+	dstBroken := fanOutBrokenQueue{CreateSimpleQueue(5, 0, 0, storage.CreateMapSorage(), nil, nil, nil)}
+
+	fo := FanOutCreate(src, nil, cn.SaveMarkSaveMode, "fan_out", 3, nil)
+	copies := []func(ctx context.Context) (isEmpty bool, err *mft.Error){
+		fo.Subscribe(FanOutDestination{Name: "all", Queue: dstAll, SaveMode: cn.NotSaveSaveMode}),
+		fo.Subscribe(FanOutDestination{Name: "odd", Queue: dstOdd, SaveMode: cn.NotSaveSaveMode,
+			Route: TransformFilter{Segments: segment.MakeSegments().Add(1)}}),
+		fo.Subscribe(FanOutDestination{Name: "s2", Queue: dstS2, SaveMode: cn.NotSaveSaveMode,
+			Route: TransformFilter{Sources: []string{"s2"}}}),
+	}
+	broken := fo.Subscribe(FanOutDestination{Name: "broken", Queue: dstBroken, SaveMode: cn.NotSaveSaveMode})
+
+	for _, copy := range copies {
+		for i := 0; i < 5; i++ {
+			_, err := copy(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		_, err := broken(ctx)
+		if err == nil {
+			t.Fatal("copy into broken destination should fail")
+		}
+	}
+
+	// 4 batches are read once, end of queue is read by each destination
+	if fo.Reads() != 7 {
+		t.Errorf("source should be read 7 times not %v", fo.Reads())
+	}
+
+	for q, cnt := range map[*SimpleQueue]int{dstAll: 10, dstOdd: 5, dstS2: 5} {
+		msgs, err := q.Get(ctx, nil, 0, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(msgs) != cnt {
+			t.Errorf("destination should contain %v messages not %v", cnt, len(msgs))
+		}
+	}
+
+	progress := fo.Progress()
+	for _, name := range []string{"all", "odd", "s2"} {
+		if progress[name] != lastSrcID {
+			t.Errorf("progress of %v should be %v not %v", name, lastSrcID, progress[name])
+		}
+		lastID, err := src.SubscriberGetLastRead(ctx, nil, FanOutSubscriber("fan_out", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lastID != lastSrcID {
+			t.Errorf("subscriber of %v should be %v not %v", name, lastSrcID, lastID)
+		}
+	}
+	if progress["broken"] != 0 {
+		t.Errorf("progress of broken destination should be 0 not %v", progress["broken"])
+	}
+}
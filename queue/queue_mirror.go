@@ -0,0 +1,126 @@
+package queue
+
+import (
+	"context"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/myfantasy/mft"
+	"github.com/myfantasy/segment"
+)
+
+// MirrorTranslateCntLimit - count of messages of one Get of MirrorTranslateID scan
+var MirrorTranslateCntLimit = 1000
+
+// MirrorSourceDefault - source of messages of mirror of queue when source is not set
+func MirrorSourceDefault(srcQueueName string) string {
+	return "mirror:" + srcQueueName
+}
+
+// MirrorMessage - message of mirror: source is mirrorSource, external id is id of source message
+// (so id of source message can be translated into id of mirror message by GetByExternalID);
+// Source and ExternalID of source message are not kept in mirror (they can be got from source by ExternalID of mirror message)
+func MirrorMessage(msg *MessageWithMeta, mirrorSource string) Message {
+	return Message{
+		ExternalID: msg.ID,
+		ExternalDt: msg.Dt.Unix(),
+		Source:     mirrorSource,
+		Message:    msg.Message,
+		Segment:    msg.Segment,
+	}
+}
+
+// SubscribeMirror subscribe on to queue and copy (addUniqueList) to destination as mirror (see MirrorMessage)
+func SubscribeMirror(src Queue, dst Queue,
+	userSrc cn.CapUser, userDst cn.CapUser,
+	saveModeSrc cn.SaveMode, saveModeDst cn.SaveMode,
+	subscriberName string, cntLimit int, doSaveDst bool,
+	segments *segment.Segments,
+	mirrorSource string,
+) func(ctx context.Context) (isEmpty bool, err *mft.Error) {
+	return subscribeCopy(src, dst, userSrc, userDst, saveModeSrc, saveModeDst,
+		subscriberName, doSaveDst, segmentReader(src, userSrc, cntLimit, segments), "",
+		func(msg *MessageWithMeta) (Message, bool, *mft.Error) {
+			return MirrorMessage(msg, mirrorSource), false, nil
+		})
+}
+
+// MirrorTranslateID - id of last message of mirror dst that is copy of source message with id <= srcID
+// returns 0 when mirror has no such messages
+func MirrorTranslateID(ctx context.Context, dst Queue, user cn.CapUser,
+	mirrorSource string, srcID int64) (dstID int64, err *mft.Error) {
+	return MirrorTranslateIDFrom(ctx, dst, user, mirrorSource, srcID, 0)
+}
+
+// MirrorTranslateIDFrom - MirrorTranslateID with known mapping: knownDstID is id of message of mirror
+// that is copy of source message with id <= srcID; scan of mirror (when source message was not copied) starts after it
+// (knownDstID that is not such message is ignored, 0 - scan from start of mirror)
+func MirrorTranslateIDFrom(ctx context.Context, dst Queue, user cn.CapUser,
+	mirrorSource string, srcID int64, knownDstID int64) (dstID int64, err *mft.Error) {
+	if srcID <= 0 {
+		return 0, nil
+	}
+
+	msg, exists, err := dst.GetByExternalID(ctx, user, mirrorSource, srcID)
+	if err != nil {
+		return 0, GenerateErrorE(10044000, err, mirrorSource, srcID)
+	}
+	if exists {
+		return msg.ID, nil
+	}
+
+	if knownDstID > 0 {
+		known, err := dst.GetByIDs(ctx, user, []int64{knownDstID})
+		if err != nil {
+			return 0, GenerateErrorE(10044003, err, mirrorSource, knownDstID)
+		}
+		if len(known) == 1 && known[0].Source == mirrorSource && known[0].ExternalID <= srcID {
+			dstID = knownDstID
+		}
+	}
+
+	// source message was not copied (filtered by segments); mirror keeps order of source
+	id := dstID
+	for {
+		messages, err := dst.Get(ctx, user, id, MirrorTranslateCntLimit)
+		if err != nil {
+			return 0, GenerateErrorE(10044001, err, mirrorSource, srcID)
+		}
+		if len(messages) == 0 {
+			return dstID, nil
+		}
+
+		for _, m := range messages {
+			if m.Source != mirrorSource {
+				continue
+			}
+			if m.ExternalID > srcID {
+				return dstID, nil
+			}
+			dstID = m.ID
+		}
+
+		id = messages[len(messages)-1].ID
+	}
+}
+
+// MirrorSubscriberSetLastRead - set last read of subscriber of mirror dst by last read id of subscriber of source
+// (current last read of subscriber of mirror is used as known mapping of MirrorTranslateIDFrom)
+func MirrorSubscriberSetLastRead(ctx context.Context, dst Queue, user cn.CapUser,
+	mirrorSource string, subscriber string, srcLastID int64, saveMode cn.SaveMode) (dstID int64, err *mft.Error) {
+	lastID, err := dst.SubscriberGetLastRead(ctx, user, subscriber)
+	if err != nil {
+		return 0, GenerateErrorE(10044004, err, subscriber)
+	}
+
+	dstID, err = MirrorTranslateIDFrom(ctx, dst, user, mirrorSource, srcLastID, lastID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = dst.SubscriberSetLastRead(ctx, user, subscriber, dstID, saveMode)
+	if err != nil {
+		return 0, GenerateErrorE(10044002, err, subscriber, dstID)
+	}
+
+	return dstID, nil
+}
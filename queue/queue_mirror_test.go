@@ -0,0 +1,202 @@
+package queue
+
+import (
+	"context"
+	"testing"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/storage"
+	"github.com/myfantasy/mft"
+)
+
+func TestSubscribeMirror_TranslateID(t *testing.T) {
+	src := CreateSimpleQueue(5, 0, 0, storage.CreateMapSorage(), nil, nil, nil)
+	dst := CreateSimpleQueue(5, 0, 0, storage.CreateMapSorage(), nil, nil, nil)
+
+	ctx := context.Background()
+
+	// messages of other source in mirror
+	_, err := dst.AddUnique(ctx, nil, []byte("other"), 1, 0, "other", 0, cn.NotSaveSaveMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srcIDs := make([]int64, 0)
+	for i := 0; i < 12; i++ {
+		// external id is not set: copy_unique can not copy such messages, mirror can
+		id, err := src.Add(ctx, nil, []byte("test text"), 0, 0, "", 0, cn.NotSaveSaveMode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srcIDs = append(srcIDs, id)
+	}
+
+	mirror := SubscribeMirror(src, dst, nil, nil, cn.SaveMarkSaveMode, cn.SaveMarkSaveMode,
+		"mirror", 5, false, nil, MirrorSourceDefault("src"))
+
+	for i := 0; i < 4; i++ {
+		_, err := mirror(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// repeat of copy does not duplicate messages
+	err = src.SubscriberSetLastRead(ctx, nil, "mirror", srcIDs[3], cn.SaveMarkSaveMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mirror = SubscribeMirror(src, dst, nil, nil, cn.SaveMarkSaveMode, cn.SaveMarkSaveMode,
+		"mirror", 5, false, nil, MirrorSourceDefault("src"))
+	for i := 0; i < 3; i++ {
+		_, err := mirror(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msgs, err := dst.Get(ctx, nil, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 13 {
+		t.Fatalf("mirror should contain 13 messages not %v", len(msgs))
+	}
+	dstIDs := make([]int64, 0)
+	for _, m := range msgs[1:] {
+		dstIDs = append(dstIDs, m.ID)
+	}
+
+	for i, srcID := range srcIDs {
+		dstID, err := MirrorTranslateID(ctx, dst, nil, MirrorSourceDefault("src"), srcID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dstID != dstIDs[i] {
+			t.Errorf("MirrorTranslateID %v should be %v not %v", srcID, dstIDs[i], dstID)
+		}
+	}
+
+	// id between messages of source
+	dstID, err := MirrorTranslateID(ctx, dst, nil, MirrorSourceDefault("src"), srcIDs[5]+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if srcIDs[5]+1 < srcIDs[6] && dstID != dstIDs[5] {
+		t.Errorf("MirrorTranslateID between messages should be %v not %v", dstIDs[5], dstID)
+	}
+
+	// id before first message
+	dstID, err = MirrorTranslateID(ctx, dst, nil, MirrorSourceDefault("src"), srcIDs[0]-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dstID != 0 {
+		t.Errorf("MirrorTranslateID before first message should be 0 not %v", dstID)
+	}
+
+	dstID, err = MirrorSubscriberSetLastRead(ctx, dst, nil, MirrorSourceDefault("src"), "consumer", srcIDs[7], cn.SaveMarkSaveMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lastID, err := dst.SubscriberGetLastRead(ctx, nil, "consumer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastID != dstIDs[7] || dstID != dstIDs[7] {
+		t.Errorf("MirrorSubscriberSetLastRead should set %v not %v", dstIDs[7], lastID)
+	}
+}
+
+// testGetStartQueue - queue that collects idStart of Get
+type testGetStartQueue struct {
+	Queue
+	starts []int64
+}
+
+func (q *testGetStartQueue) Get(ctx context.Context, user cn.CapUser, idStart int64, cntLimit int) (messages []*MessageWithMeta, err *mft.Error) {
+	q.starts = append(q.starts, idStart)
+	return q.Queue.Get(ctx, user, idStart, cntLimit)
+}
+
+func TestMirrorTranslateIDFrom(t *testing.T) {
+	src := CreateSimpleQueue(5, 0, 0, storage.CreateMapSorage(), nil, nil, nil)
+	mirror := CreateSimpleQueue(5, 0, 0, storage.CreateMapSorage(), nil, nil, nil)
+	dst := &testGetStartQueue{Queue: mirror}
+
+	ctx := context.Background()
+
+	otherID, err := mirror.AddUnique(ctx, nil, []byte("other"), 1, 0, "other", 0, cn.NotSaveSaveMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srcIDs := make([]int64, 0)
+	for i := 0; i < 12; i++ {
+		id, err := src.Add(ctx, nil, []byte("test text"), 0, 0, "", 0, cn.NotSaveSaveMode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srcIDs = append(srcIDs, id)
+	}
+	copyMirror := SubscribeMirror(src, mirror, nil, nil, cn.SaveMarkSaveMode, cn.SaveMarkSaveMode,
+		"mirror", 100, false, nil, MirrorSourceDefault("src"))
+	if _, err := copyMirror(ctx); err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := mirror.Get(ctx, nil, otherID, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 12 {
+		t.Fatalf("mirror should contain 12 messages of source not %v", len(msgs))
+	}
+
+	// id after last message of source is not in mirror: scan starts after known mapping
+	srcID := srcIDs[11] + 1
+	for _, tt := range []struct {
+		name  string
+		known int64
+		start int64
+	}{
+		{"known", msgs[8].ID, msgs[8].ID},
+		{"other source", otherID, 0},
+		{"not exists", msgs[11].ID + 1, 0},
+		{"empty", 0, 0},
+	} {
+		dst.starts = nil
+		dstID, err := MirrorTranslateIDFrom(ctx, dst, nil, MirrorSourceDefault("src"), srcID, tt.known)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dstID != msgs[11].ID {
+			t.Errorf("%v: MirrorTranslateIDFrom should be %v not %v", tt.name, msgs[11].ID, dstID)
+		}
+		if len(dst.starts) == 0 || dst.starts[0] != tt.start {
+			t.Errorf("%v: MirrorTranslateIDFrom scan should start from %v not %v", tt.name, tt.start, dst.starts)
+		}
+	}
+
+	// known mapping after srcID is ignored
+	dst.starts = nil
+	dstID, err := MirrorTranslateIDFrom(ctx, dst, nil, MirrorSourceDefault("src"), srcIDs[0]-1, msgs[3].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dstID != 0 || len(dst.starts) == 0 || dst.starts[0] != 0 {
+		t.Errorf("MirrorTranslateIDFrom should ignore known mapping after id: %v %v", dstID, dst.starts)
+	}
+
+	// last read of subscriber is known mapping
+	_, err = MirrorSubscriberSetLastRead(ctx, dst, nil, MirrorSourceDefault("src"), "consumer", srcIDs[5], cn.SaveMarkSaveMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst.starts = nil
+	dstID, err = MirrorSubscriberSetLastRead(ctx, dst, nil, MirrorSourceDefault("src"), "consumer", srcID, cn.SaveMarkSaveMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dstID != msgs[11].ID || len(dst.starts) == 0 || dst.starts[0] != msgs[5].ID {
+		t.Errorf("MirrorSubscriberSetLastRead should scan from last read %v: %v %v", msgs[5].ID, dstID, dst.starts)
+	}
+}
@@ -0,0 +1,353 @@
+package queue
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"time"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/myfantasy/mft"
+	"github.com/myfantasy/segment"
+)
+
+// ReconcileCntLimitDefault - default count of messages of one Get of Reconcile
+var ReconcileCntLimitDefault = 1000
+
+// ReconcileRange - range of messages of source: ids (FromID, ToID] and time [FromDt, ToDt); zero value - no limit
+type ReconcileRange struct {
+	FromID int64     `json:"from_id,omitempty"`
+	ToID   int64     `json:"to_id,omitempty"`
+	FromDt time.Time `json:"from_dt,omitempty"`
+	ToDt   time.Time `json:"to_dt,omitempty"`
+}
+
+// ReconcileSettings - settings of Reconcile
+type ReconcileSettings struct {
+	// CntLimit - count of messages of one Get (0 - ReconcileCntLimitDefault)
+	CntLimit int `json:"cnt_limit,omitempty"`
+	// Segments - only messages of source in segments are compared (the same as segments of copy)
+	Segments *segment.Segments `json:"segments,omitempty"`
+	// MirrorSource - destination is mirror of source (see MirrorMessage)
+	MirrorSource string `json:"mirror_source,omitempty"`
+	// Lag - destination is read until messages newer than last message of source + Lag (0 - until end of destination)
+	Lag time.Duration `json:"lag,omitempty"`
+	// ItemsLimit - max count of items of each list of report (0 - unlimited); counts are not limited
+	ItemsLimit int `json:"items_limit,omitempty"`
+}
+
+// ReconcileItem - message of source or destination with difference
+type ReconcileItem struct {
+	Source     string `json:"src,omitempty"`
+	ExternalID int64  `json:"eid"`
+	SrcID      int64  `json:"src_id,omitempty"`
+	DstID      int64  `json:"dst_id,omitempty"`
+	SrcHash    string `json:"src_hash,omitempty"`
+	DstHash    string `json:"dst_hash,omitempty"`
+}
+
+// ReconcileReport - result of Reconcile
+type ReconcileReport struct {
+	Dt    time.Time      `json:"dt"`
+	Range ReconcileRange `json:"range"`
+	// SrcFirstID, SrcLastID - ids of first and last compared messages of source
+	SrcFirstID int64 `json:"src_first_id,omitempty"`
+	SrcLastID  int64 `json:"src_last_id,omitempty"`
+	SrcCount   int   `json:"src_count"`
+	Matched    int   `json:"matched"`
+
+	MissingCount    int `json:"missing_count"`
+	ExtraCount      int `json:"extra_count"`
+	MismatchedCount int `json:"mismatched_count"`
+	DuplicateCount  int `json:"duplicate_count"`
+	// RecopiedCount - count of missing messages copied by ReconcileCopyMissing
+	RecopiedCount int `json:"recopied_count,omitempty"`
+
+	// Missing - messages of source that are not in destination
+	Missing []ReconcileItem `json:"missing,omitempty"`
+	// Extra - messages of destination (between copies of first and last messages of source) that are not in source
+	Extra []ReconcileItem `json:"extra,omitempty"`
+	// Mismatched - messages with different body
+	Mismatched []ReconcileItem `json:"mismatched,omitempty"`
+	// Duplicate - messages that are in destination more than once
+	Duplicate []ReconcileItem `json:"duplicate,omitempty"`
+}
+
+// IsEmpty - copy is complete: there are no differences
+func (r *ReconcileReport) IsEmpty() bool {
+	return r.MissingCount == 0 && r.ExtraCount == 0 && r.MismatchedCount == 0 && r.DuplicateCount == 0
+}
+
+type reconcileKey struct {
+	source     string
+	externalID int64
+}
+
+type reconcileSrc struct {
+	id        int64
+	hash      string
+	tombstone bool
+	dstID     int64
+}
+
+// ReconcileHash - hash of body of message
+func ReconcileHash(body []byte) string {
+	h := sha256.Sum256(body)
+	return hex.EncodeToString(h[:])
+}
+
+func reconcileAppend(items []ReconcileItem, item ReconcileItem, limit int) []ReconcileItem {
+	if limit > 0 && len(items) >= limit {
+		return items
+	}
+	return append(items, item)
+}
+
+// Reconcile - compare messages of source in range with their copies in destination by (Source, ExternalID) and body hash
+// messages of source without external id are not compared (they can not be copied) when MirrorSource is not set;
+// erased messages are compared only by presence
+func Reconcile(ctx context.Context, src Queue, dst Queue,
+	userSrc cn.CapUser, userDst cn.CapUser,
+	rng ReconcileRange, settings ReconcileSettings,
+) (report *ReconcileReport, err *mft.Error) {
+	cntLimit := settings.CntLimit
+	if cntLimit <= 0 {
+		cntLimit = ReconcileCntLimitDefault
+	}
+
+	report = &ReconcileReport{
+		Dt:    time.Now(),
+		Range: rng,
+	}
+
+	id := rng.FromID
+	if !rng.FromDt.IsZero() {
+		first, err := src.GetFromTime(ctx, userSrc, rng.FromDt, 1)
+		if err != nil {
+			return nil, GenerateErrorE(10045000, err, rng.FromDt)
+		}
+		if len(first) == 0 {
+			return report, nil
+		}
+		if first[0].ID-1 > id {
+			id = first[0].ID - 1
+		}
+	}
+
+	srcMessages := make(map[reconcileKey]*reconcileSrc)
+	sources := make(map[string]struct{})
+	var firstDt, lastDt time.Time
+
+	for done := false; !done; {
+		messages, lastID, err := src.GetSegment(ctx, userSrc, id, cntLimit, settings.Segments)
+		if err != nil {
+			return nil, GenerateErrorE(10045001, err, id)
+		}
+		if len(messages) == 0 && lastID <= id {
+			break
+		}
+
+		for _, msg := range messages {
+			if (rng.ToID > 0 && msg.ID > rng.ToID) || (!rng.ToDt.IsZero() && !msg.Dt.Before(rng.ToDt)) {
+				done = true
+				break
+			}
+
+			key := reconcileKey{source: msg.Source, externalID: msg.ExternalID}
+			if settings.MirrorSource != "" {
+				key = reconcileKey{source: settings.MirrorSource, externalID: msg.ID}
+			} else if msg.ExternalID == 0 {
+				continue
+			}
+
+			if report.SrcFirstID == 0 {
+				report.SrcFirstID = msg.ID
+				firstDt = msg.Dt
+			}
+			report.SrcLastID = msg.ID
+			lastDt = msg.Dt
+
+			if _, ok := srcMessages[key]; ok {
+				// several messages of source with the same key are copied once
+				continue
+			}
+			srcMessages[key] = &reconcileSrc{
+				id:        msg.ID,
+				hash:      ReconcileHash(msg.Message),
+				tombstone: msg.Tombstone,
+			}
+			sources[key.source] = struct{}{}
+			report.SrcCount++
+		}
+
+		if lastID > id {
+			id = lastID
+		}
+	}
+
+	if len(srcMessages) == 0 {
+		return report, nil
+	}
+
+	// copy is made after message is added to source
+	dstFirst, err := dst.GetFromTime(ctx, userDst, firstDt, 1)
+	if err != nil {
+		return nil, GenerateErrorE(10045002, err, firstDt)
+	}
+	if len(dstFirst) == 0 {
+		reconcileMissing(report, srcMessages, settings.ItemsLimit)
+		return report, nil
+	}
+
+	var firstMatch, lastMatch int64
+	extra := make([]ReconcileItem, 0)
+
+	id = dstFirst[0].ID - 1
+	for done := false; !done && report.Matched < len(srcMessages); {
+		messages, err := dst.Get(ctx, userDst, id, cntLimit)
+		if err != nil {
+			return nil, GenerateErrorE(10045003, err, id)
+		}
+		if len(messages) == 0 {
+			break
+		}
+
+		for _, msg := range messages {
+			if settings.Lag > 0 && msg.Dt.After(lastDt.Add(settings.Lag)) {
+				done = true
+				break
+			}
+			if _, ok := sources[msg.Source]; !ok {
+				continue
+			}
+
+			key := reconcileKey{source: msg.Source, externalID: msg.ExternalID}
+			s, ok := srcMessages[key]
+			if !ok {
+				extra = append(extra, ReconcileItem{
+					Source:     msg.Source,
+					ExternalID: msg.ExternalID,
+					DstID:      msg.ID,
+					DstHash:    ReconcileHash(msg.Message),
+				})
+				continue
+			}
+
+			if s.dstID != 0 {
+				report.DuplicateCount++
+				report.Duplicate = reconcileAppend(report.Duplicate, ReconcileItem{
+					Source:     key.source,
+					ExternalID: key.externalID,
+					SrcID:      s.id,
+					DstID:      msg.ID,
+				}, settings.ItemsLimit)
+				continue
+			}
+
+			s.dstID = msg.ID
+			report.Matched++
+			if firstMatch == 0 {
+				firstMatch = msg.ID
+			}
+			lastMatch = msg.ID
+
+			if s.tombstone || msg.Tombstone {
+				continue
+			}
+			if dstHash := ReconcileHash(msg.Message); dstHash != s.hash {
+				report.MismatchedCount++
+				report.Mismatched = reconcileAppend(report.Mismatched, ReconcileItem{
+					Source:     key.source,
+					ExternalID: key.externalID,
+					SrcID:      s.id,
+					DstID:      msg.ID,
+					SrcHash:    s.hash,
+					DstHash:    dstHash,
+				}, settings.ItemsLimit)
+			}
+		}
+
+		id = messages[len(messages)-1].ID
+	}
+
+	// copies of messages out of range can be before first and after last copy
+	for _, item := range extra {
+		if item.DstID > firstMatch && item.DstID < lastMatch {
+			report.ExtraCount++
+			report.Extra = reconcileAppend(report.Extra, item, settings.ItemsLimit)
+		}
+	}
+
+	reconcileMissing(report, srcMessages, settings.ItemsLimit)
+
+	return report, nil
+}
+
+func reconcileMissing(report *ReconcileReport, srcMessages map[reconcileKey]*reconcileSrc, limit int) {
+	missing := make([]ReconcileItem, 0)
+	for key, s := range srcMessages {
+		if s.dstID != 0 {
+			continue
+		}
+		missing = append(missing, ReconcileItem{
+			Source:     key.source,
+			ExternalID: key.externalID,
+			SrcID:      s.id,
+			SrcHash:    s.hash,
+		})
+	}
+	sort.Slice(missing, func(i, j int) bool {
+		return missing[i].SrcID < missing[j].SrcID
+	})
+
+	report.MissingCount = len(missing)
+	if limit > 0 && len(missing) > limit {
+		missing = missing[:limit]
+	}
+	if len(missing) > 0 {
+		report.Missing = missing
+	}
+}
+
+// ReconcileCopyMissing - copy (addUniqueList) messages of report.Missing from source to destination
+// (only listed messages are copied: see ReconcileSettings.ItemsLimit)
+func ReconcileCopyMissing(ctx context.Context, src Queue, dst Queue,
+	userSrc cn.CapUser, userDst cn.CapUser,
+	report *ReconcileReport, mirrorSource string, saveMode cn.SaveMode,
+) (err *mft.Error) {
+	if len(report.Missing) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(report.Missing))
+	for _, item := range report.Missing {
+		ids = append(ids, item.SrcID)
+	}
+
+	messages, err := src.GetByIDs(ctx, userSrc, ids)
+	if err != nil {
+		return GenerateErrorE(10045004, err)
+	}
+
+	messageSend := make([]Message, 0, len(messages))
+	for _, msg := range messages {
+		if msg.Tombstone {
+			continue
+		}
+		if mirrorSource != "" {
+			messageSend = append(messageSend, MirrorMessage(msg, mirrorSource))
+		} else {
+			messageSend = append(messageSend, msg.ToMessage())
+		}
+	}
+
+	_, err = dst.AddUniqueList(ctx, userDst, messageSend, saveMode)
+	if err != nil {
+		return GenerateErrorE(10045005, err, len(messageSend))
+	}
+
+	report.RecopiedCount = len(messageSend)
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package queue
+
+import (
+	"context"
+	"testing"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/storage"
+)
+
+func TestReconcile(t *testing.T) {
+	src := CreateSimpleQueue(5, 0, 0, storage.CreateMapSorage(), nil, nil, nil)
+	dst := CreateSimpleQueue(5, 0, 0, storage.CreateMapSorage(), nil, nil, nil)
+
+	ctx := context.Background()
+
+	srcIDs := make([]int64, 0)
+	for i := 1; i <= 10; i++ {
+		id, err := src.Add(ctx, nil, []byte("test text"), int64(i), 0, "s", 0, cn.NotSaveSaveMode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srcIDs = append(srcIDs, id)
+	}
+
+	// messages of other source are not compared
+	_, err := dst.Add(ctx, nil, []byte("other"), 1, 0, "other", 0, cn.NotSaveSaveMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 10; i++ {
+		body := []byte("test text")
+		switch i {
+		case 2:
+			body = []byte("changed text")
+		case 3:
+			// missing
+			continue
+		case 4:
+			_, err = dst.Add(ctx, nil, []byte("extra"), 100, 0, "s", 0, cn.NotSaveSaveMode)
+			if err != nil {
+				t.Fatal(err)
+			}
+		case 6:
+			// duplicate of 5
+			_, err = dst.Add(ctx, nil, body, 5, 0, "s", 0, cn.NotSaveSaveMode)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		_, err = dst.Add(ctx, nil, body, int64(i), 0, "s", 0, cn.NotSaveSaveMode)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := Reconcile(ctx, src, dst, nil, nil, ReconcileRange{}, ReconcileSettings{CntLimit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.SrcCount != 10 || report.Matched != 9 {
+		t.Errorf("Reconcile should compare 10 messages and match 9 not %v and %v", report.SrcCount, report.Matched)
+	}
+	if report.MissingCount != 1 || report.Missing[0].ExternalID != 3 || report.Missing[0].SrcID != srcIDs[2] {
+		t.Errorf("Reconcile should find missing message 3 not %+v", report.Missing)
+	}
+	if report.MismatchedCount != 1 || report.Mismatched[0].ExternalID != 2 {
+		t.Errorf("Reconcile should find mismatched message 2 not %+v", report.Mismatched)
+	}
+	if report.ExtraCount != 1 || report.Extra[0].ExternalID != 100 {
+		t.Errorf("Reconcile should find extra message 100 not %+v", report.Extra)
+	}
+	if report.DuplicateCount != 1 || report.Duplicate[0].ExternalID != 5 {
+		t.Errorf("Reconcile should find duplicate message 5 not %+v", report.Duplicate)
+	}
+
+	err = ReconcileCopyMissing(ctx, src, dst, nil, nil, report, "", cn.NotSaveSaveMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.RecopiedCount != 1 {
+		t.Errorf("ReconcileCopyMissing should copy 1 message not %v", report.RecopiedCount)
+	}
+
+	// range of source by ids
+	report, err = Reconcile(ctx, src, dst, nil, nil, ReconcileRange{FromID: srcIDs[2], ToID: srcIDs[8]}, ReconcileSettings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.SrcCount != 6 || report.MissingCount != 0 || report.MismatchedCount != 0 {
+		t.Errorf("Reconcile of range should compare 6 messages without differences not %+v", report)
+	}
+}
+
+func TestReconcile_mirror(t *testing.T) {
+	src := CreateSimpleQueue(5, 0, 0, storage.CreateMapSorage(), nil, nil, nil)
+	dst := CreateSimpleQueue(5, 0, 0, storage.CreateMapSorage(), nil, nil, nil)
+
+	ctx := context.Background()
+
+	for i := 0; i < 12; i++ {
+		_, err := src.Add(ctx, nil, []byte("test text"), 0, 0, "", 0, cn.NotSaveSaveMode)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mirror := SubscribeMirror(src, dst, nil, nil, cn.SaveMarkSaveMode, cn.SaveMarkSaveMode,
+		"mirror", 5, false, nil, MirrorSourceDefault("src"))
+	for i := 0; i < 4; i++ {
+		_, err := mirror(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := Reconcile(ctx, src, dst, nil, nil, ReconcileRange{},
+		ReconcileSettings{MirrorSource: MirrorSourceDefault("src")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.SrcCount != 12 || report.Matched != 12 || !report.IsEmpty() {
+		t.Errorf("Reconcile of mirror should match 12 messages not %+v", report)
+	}
+}
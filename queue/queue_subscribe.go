@@ -14,9 +14,73 @@ func SubscribeCopyUnique(src Queue, dst Queue,
 	saveModeSrc cn.SaveMode, saveModeDst cn.SaveMode,
 	subscriberName string, cntLimit int, doSaveDst bool,
 	segments *segment.Segments,
+) func(ctx context.Context) (isEmpty bool, err *mft.Error) {
+	return subscribeCopy(src, dst, userSrc, userDst, saveModeSrc, saveModeDst,
+		subscriberName, doSaveDst, segmentReader(src, userSrc, cntLimit, segments), "",
+		func(msg *MessageWithMeta) (Message, bool, *mft.Error) {
+			return msg.ToMessage(), false, nil
+		})
+}
+
+// CopyCheckpointDefault - name of subscriber of destination that stores checkpoint of copy when it is not set
+func CopyCheckpointDefault(srcQueueName string, subscriberName string) string {
+	return "checkpoint:" + srcQueueName + ":" + subscriberName
+}
+
+// SubscribeCopyCheckpoint subscribe on to queue and copy (addUniqueList) to destination effectively once:
+// last copied id of source is stored in destination as last read id of subscriber `checkpoint`
+// after messages are saved (SaveAll) and copy resumes from it (subscriber of source is used only when checkpoint is not set);
+// checkpoint is not written in the same save as messages, so batch saved before crash without checkpoint
+// is copied again and it is deduplicated by AddUniqueList (by the newest blocks of destination)
+// mirrorSource != "" - messages are copied as mirror (see MirrorMessage)
+func SubscribeCopyCheckpoint(src Queue, dst Queue,
+	userSrc cn.CapUser, userDst cn.CapUser,
+	saveModeSrc cn.SaveMode, saveModeDst cn.SaveMode,
+	subscriberName string, cntLimit int,
+	segments *segment.Segments,
+	checkpoint string, mirrorSource string,
+) func(ctx context.Context) (isEmpty bool, err *mft.Error) {
+	toMessage := func(msg *MessageWithMeta) (Message, bool, *mft.Error) {
+		return msg.ToMessage(), false, nil
+	}
+	if mirrorSource != "" {
+		toMessage = func(msg *MessageWithMeta) (Message, bool, *mft.Error) {
+			return MirrorMessage(msg, mirrorSource), false, nil
+		}
+	}
+
+	return subscribeCopy(src, dst, userSrc, userDst, saveModeSrc, saveModeDst,
+		subscriberName, true, segmentReader(src, userSrc, cntLimit, segments), checkpoint, toMessage)
+}
+
+// subscribeReader - reads messages of source after id (see Queue.GetSegment)
+type subscribeReader func(ctx context.Context, id int64) (messages []*MessageWithMeta, lastID int64, err *mft.Error)
+
+// segmentReader - reader of messages of src in segments
+func segmentReader(src Queue, user cn.CapUser, cntLimit int, segments *segment.Segments) subscribeReader {
+	return func(ctx context.Context, id int64) (messages []*MessageWithMeta, lastID int64, err *mft.Error) {
+		return src.GetSegment(ctx, user, id, cntLimit, segments)
+	}
+}
+
+// subscribeCopy subscribe on to queue and copy (addUniqueList) messages read by read and converted by toMessage to destination
+// (messages with skip == true are not copied)
+func subscribeCopy(src Queue, dst Queue,
+	userSrc cn.CapUser, userDst cn.CapUser,
+	saveModeSrc cn.SaveMode, saveModeDst cn.SaveMode,
+	subscriberName string, doSaveDst bool,
+	read subscribeReader,
+	checkpoint string,
+	toMessage func(msg *MessageWithMeta) (out Message, skip bool, err *mft.Error),
 ) func(ctx context.Context) (isEmpty bool, err *mft.Error) {
 	var id int64
 	return func(ctx context.Context) (isEmpty bool, err *mft.Error) {
+		if id == 0 && checkpoint != "" {
+			id, err = dst.SubscriberGetLastRead(ctx, userDst, checkpoint)
+			if err != nil {
+				return false, err
+			}
+		}
 		if id == 0 {
 			id, err = src.SubscriberGetLastRead(ctx, userSrc, subscriberName)
 			if err != nil {
@@ -24,7 +88,7 @@ func SubscribeCopyUnique(src Queue, dst Queue,
 			}
 		}
 
-		mesages, lastID, err := src.GetSegment(ctx, userSrc, id, cntLimit, segments)
+		mesages, lastID, err := read(ctx, id)
 		if err != nil {
 			return false, err
 		}
@@ -37,16 +101,24 @@ func SubscribeCopyUnique(src Queue, dst Queue,
 			messageSend := make([]Message, 0, len(mesages))
 
 			for i := 0; i < len(mesages); i++ {
-				messageSend = append(messageSend, mesages[i].ToMessage())
+				msg, skip, err := toMessage(mesages[i])
+				if err != nil {
+					return false, err
+				}
+				if !skip {
+					messageSend = append(messageSend, msg)
+				}
 			}
 
-			_, err = dst.AddUniqueList(ctx, userDst, messageSend, saveModeDst)
+			if len(messageSend) != 0 {
+				_, err = dst.AddUniqueList(ctx, userDst, messageSend, saveModeDst)
 
-			if err != nil {
-				return false, err
+				if err != nil {
+					return false, err
+				}
 			}
 
-			if doSaveDst {
+			if doSaveDst && len(messageSend) != 0 {
 				err = dst.SaveAll(ctx, userDst)
 				if err != nil {
 					return false, err
@@ -54,6 +126,13 @@ func SubscribeCopyUnique(src Queue, dst Queue,
 			}
 		}
 
+		if lastID > id && checkpoint != "" {
+			err = dst.SubscriberSetLastRead(ctx, userDst, checkpoint, lastID, cn.SaveImmediatelySaveMode)
+			if err != nil {
+				return false, err
+			}
+		}
+
 		if lastID > id {
 			err = src.SubscriberSetLastRead(ctx, userSrc, subscriberName, lastID, saveModeSrc)
 			if err != nil {
@@ -6,6 +6,7 @@ import (
 
 	"github.com/capella-pw/queue/cn"
 	"github.com/capella-pw/queue/storage"
+	"github.com/myfantasy/mft"
 )
 
 func TestSubscribeCopy_base(t *testing.T) {
@@ -158,3 +159,150 @@ func TestSubscribeCopy_base(t *testing.T) {
 		}
 	}
 }
+
+func TestSubscribeCopyCheckpoint_resume(t *testing.T) {
+	src := CreateSimpleQueue(5, 0, 0, storage.CreateMapSorage(), nil, nil, nil)
+	dst := CreateSimpleQueue(5, 0, 0, storage.CreateMapSorage(), nil, nil, nil)
+
+	ctx := context.Background()
+
+	var lastSrcID int64
+	for i := 0; i < 10; i++ {
+		id, err := src.Add(ctx, nil, []byte("test text"), int64(i)+1, 0, "", 0, cn.NotSaveSaveMode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lastSrcID = id
+	}
+
+	checkpoint := CopyCheckpointDefault("src", "q2_subscr")
+	copy := SubscribeCopyCheckpoint(src, dst, nil, nil, cn.SaveMarkSaveMode, cn.SaveMarkSaveMode,
+		"q2_subscr", 3, nil, checkpoint, "")
+
+	for i := 0; i < 4; i++ {
+		_, err := copy(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cp, err := dst.SubscriberGetLastRead(ctx, nil, checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp != lastSrcID {
+		t.Errorf("checkpoint should be %v not %v", lastSrcID, cp)
+	}
+
+	// subscriber of source is lost (not saved): copy resumes from checkpoint of destination
+	err = src.SubscriberSetLastRead(ctx, nil, "q2_subscr", 0, cn.SaveMarkSaveMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copy = SubscribeCopyCheckpoint(src, dst, nil, nil, cn.SaveMarkSaveMode, cn.SaveMarkSaveMode,
+		"q2_subscr", 3, nil, checkpoint, "")
+
+	isEmpty, err := copy(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isEmpty {
+		t.Errorf("SubscribeCopyCheckpoint after restart should return empty = true, not %v", isEmpty)
+	}
+
+	msgs, err := dst.Get(ctx, nil, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 10 {
+		t.Errorf("destination should contain 10 messages not %v", len(msgs))
+	}
+}
+
+// testCheckpointCrashQueue - destination that fails (crash) on save of checkpoint
+type testCheckpointCrashQueue struct {
+	Queue
+	checkpoint string
+}
+
+func (q *testCheckpointCrashQueue) SubscriberSetLastRead(ctx context.Context, user cn.CapUser,
+	subscriber string, id int64, saveMode cn.SaveMode) (err *mft.Error) {
+	if subscriber == q.checkpoint {
+		return mft.ErrorS("crash")
+	}
+	return q.Queue.SubscriberSetLastRead(ctx, user, subscriber, id, saveMode)
+}
+
+func TestSubscribeCopyCheckpoint_crash(t *testing.T) {
+	src := CreateSimpleQueue(5, 0, 0, storage.CreateMapSorage(), nil, nil, nil)
+	stor := storage.CreateMapSorage()
+	dst := CreateSimpleQueue(5, 0, 0, stor, stor, nil, nil)
+
+	ctx := context.Background()
+
+	var lastSrcID int64
+	for i := 0; i < 10; i++ {
+		id, err := src.Add(ctx, nil, []byte("test text"), int64(i)+1, 0, "", 0, cn.NotSaveSaveMode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lastSrcID = id
+	}
+
+	// crash after messages of destination are saved and before checkpoint is saved
+	checkpoint := CopyCheckpointDefault("src", "q2_subscr")
+	copy := SubscribeCopyCheckpoint(src, &testCheckpointCrashQueue{Queue: dst, checkpoint: checkpoint}, nil, nil,
+		cn.SaveMarkSaveMode, cn.SaveMarkSaveMode, "q2_subscr", 3, nil, checkpoint, "")
+	if _, err := copy(ctx); err == nil {
+		t.Fatalf("SubscribeCopyCheckpoint should fail on save of checkpoint")
+	}
+
+	// restart: destination is loaded from storage, batch without checkpoint is copied again
+	dst2, err := LoadSimpleQueue(ctx, stor, stor, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := dst2.Get(ctx, nil, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 3 {
+		t.Fatalf("destination should contain saved batch of 3 messages not %v", len(msgs))
+	}
+	cp, err := dst2.SubscriberGetLastRead(ctx, nil, checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp != 0 {
+		t.Fatalf("checkpoint should not be saved: %v", cp)
+	}
+
+	copy = SubscribeCopyCheckpoint(src, dst2, nil, nil, cn.SaveMarkSaveMode, cn.SaveMarkSaveMode,
+		"q2_subscr", 3, nil, checkpoint, "")
+	for i := 0; i < 5; i++ {
+		if _, err := copy(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msgs, err = dst2.Get(ctx, nil, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 10 {
+		t.Fatalf("destination should contain 10 messages without duplicates not %v", len(msgs))
+	}
+	for i, m := range msgs {
+		if m.ExternalID != int64(i)+1 {
+			t.Fatalf("destination message %v should have external id %v not %v", i, i+1, m.ExternalID)
+		}
+	}
+	cp, err = dst2.SubscriberGetLastRead(ctx, nil, checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp != lastSrcID {
+		t.Errorf("checkpoint should be %v not %v", lastSrcID, cp)
+	}
+}
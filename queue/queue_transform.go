@@ -0,0 +1,396 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/myfantasy/mft"
+	"github.com/myfantasy/segment"
+)
+
+// Operations of TransformFieldPredicate
+const (
+	TransformOpEq        = "eq"
+	TransformOpNe        = "ne"
+	TransformOpIn        = "in"
+	TransformOpNotIn     = "not_in"
+	TransformOpExists    = "exists"
+	TransformOpNotExists = "not_exists"
+	TransformOpGt        = "gt"
+	TransformOpGte       = "gte"
+	TransformOpLt        = "lt"
+	TransformOpLte       = "lte"
+)
+
+// TransformFieldPredicate - predicate on field of json body of message
+// Path - dot separated path of field (`a.b.c`); gt, gte, lt, lte compare numbers or strings
+type TransformFieldPredicate struct {
+	Path   string            `json:"path"`
+	Op     string            `json:"op"`
+	Value  json.RawMessage   `json:"value,omitempty"`
+	Values []json.RawMessage `json:"values,omitempty"`
+}
+
+// TransformFilter - filter of messages; message is copied when all conditions are true
+type TransformFilter struct {
+	// Sources - source of message should be in list (empty - any)
+	Sources []string `json:"sources,omitempty"`
+	// ExcludeSources - source of message should not be in list
+	ExcludeSources []string `json:"exclude_sources,omitempty"`
+	// Segments - segment of message should be in segments (nil - any)
+	Segments *segment.Segments `json:"segments,omitempty"`
+	// Fields - predicates on fields of json body (body that is not json object does not match)
+	Fields []TransformFieldPredicate `json:"fields,omitempty"`
+}
+
+// TransformFieldMap - field `From` of body is written as field `To`
+type TransformFieldMap struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Transform - declarative filter and rewrite of messages
+// body is changed in order: Project, Rename, Remove, Set
+// (messages have no headers: headers are fields of json body, for example `headers.origin`)
+type Transform struct {
+	Filter TransformFilter `json:"filter"`
+
+	// Source - new source of message ("" - source is kept)
+	// messages of different sources with the same external id are copied once when source is rewritten
+	Source string `json:"source,omitempty"`
+	// Segment - new segment of message (nil - segment is kept)
+	Segment *int64 `json:"segment,omitempty"`
+
+	// Project - only these fields are kept in body (empty - all fields are kept)
+	Project []TransformFieldMap `json:"project,omitempty"`
+	// Rename - rename fields of body
+	Rename []TransformFieldMap `json:"rename,omitempty"`
+	// Remove - remove fields of body
+	Remove []string `json:"remove,omitempty"`
+	// Set - set value of fields of body
+	Set map[string]json.RawMessage `json:"set,omitempty"`
+
+	// SkipInvalid - messages with body that is not json object are skipped (otherwise copy fails on them)
+	SkipInvalid bool `json:"skip_invalid,omitempty"`
+}
+
+// Validate - check of transform
+func (t *Transform) Validate() (err *mft.Error) {
+	for _, p := range t.Filter.Fields {
+		if p.Path == "" {
+			return GenerateError(10046001)
+		}
+		switch p.Op {
+		case TransformOpExists, TransformOpNotExists:
+		case TransformOpIn, TransformOpNotIn:
+			for _, v := range p.Values {
+				if !json.Valid(v) {
+					return GenerateError(10046002, p.Path)
+				}
+			}
+		case TransformOpEq, TransformOpNe, TransformOpGt, TransformOpGte, TransformOpLt, TransformOpLte:
+			if !json.Valid(p.Value) {
+				return GenerateError(10046002, p.Path)
+			}
+		default:
+			return GenerateError(10046000, p.Op, p.Path)
+		}
+	}
+	for _, m := range append(append([]TransformFieldMap{}, t.Project...), t.Rename...) {
+		if m.From == "" || m.To == "" {
+			return GenerateError(10046001)
+		}
+	}
+	for _, path := range t.Remove {
+		if path == "" {
+			return GenerateError(10046001)
+		}
+	}
+	for path, v := range t.Set {
+		if path == "" {
+			return GenerateError(10046001)
+		}
+		if !json.Valid(v) {
+			return GenerateError(10046002, path)
+		}
+	}
+
+	return nil
+}
+
+// changesBody - transform parses and changes body
+func (t *Transform) changesBody() bool {
+	return len(t.Project) > 0 || len(t.Rename) > 0 || len(t.Remove) > 0 || len(t.Set) > 0
+}
+
+// Apply - filter and rewrite message; skip == true - message should not be copied
+// external id and external dt are kept
+func (t *Transform) Apply(msg *MessageWithMeta) (out Message, skip bool, err *mft.Error) {
+	out = msg.ToMessage()
+
+	if !t.matchMeta(msg) {
+		return out, true, nil
+	}
+
+	var body map[string]interface{}
+	if len(t.Filter.Fields) > 0 || t.changesBody() {
+		body, err = transformParse(msg)
+		if err != nil {
+			if t.SkipInvalid || !t.changesBody() {
+				return out, true, nil
+			}
+			return out, false, err
+		}
+	}
+
+	for _, p := range t.Filter.Fields {
+		if !p.match(body) {
+			return out, true, nil
+		}
+	}
+
+	if t.Source != "" {
+		out.Source = t.Source
+	}
+	if t.Segment != nil {
+		out.Segment = *t.Segment
+	}
+
+	if !t.changesBody() {
+		return out, false, nil
+	}
+
+	if len(t.Project) > 0 {
+		projected := make(map[string]interface{})
+		for _, m := range t.Project {
+			if v, ok := transformGet(body, m.From); ok {
+				transformSet(projected, m.To, v)
+			}
+		}
+		body = projected
+	}
+	for _, m := range t.Rename {
+		if v, ok := transformGet(body, m.From); ok {
+			transformRemove(body, m.From)
+			transformSet(body, m.To, v)
+		}
+	}
+	for _, path := range t.Remove {
+		transformRemove(body, path)
+	}
+	setPaths := make([]string, 0, len(t.Set))
+	for path := range t.Set {
+		setPaths = append(setPaths, path)
+	}
+	sort.Strings(setPaths)
+	for _, path := range setPaths {
+		transformSet(body, path, transformValue(t.Set[path]))
+	}
+
+	b, er0 := json.Marshal(body)
+	if er0 != nil {
+		return out, false, GenerateErrorE(10046004, er0, msg.ID)
+	}
+	out.Message = b
+
+	return out, false, nil
+}
+
+func (t *Transform) matchMeta(msg *MessageWithMeta) bool {
+	if len(t.Filter.Sources) > 0 && !transformContains(t.Filter.Sources, msg.Source) {
+		return false
+	}
+	if transformContains(t.Filter.ExcludeSources, msg.Source) {
+		return false
+	}
+	if t.Filter.Segments != nil && !t.Filter.Segments.In(msg.Segment) {
+		return false
+	}
+	return true
+}
+
+func transformContains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func transformParse(msg *MessageWithMeta) (body map[string]interface{}, err *mft.Error) {
+	d := json.NewDecoder(bytes.NewReader(msg.Message))
+	d.UseNumber()
+	er0 := d.Decode(&body)
+	if er0 != nil {
+		return nil, GenerateErrorE(10046003, er0, msg.ID)
+	}
+	if body == nil {
+		return nil, GenerateError(10046003, msg.ID)
+	}
+	return body, nil
+}
+
+func transformGet(body map[string]interface{}, path string) (v interface{}, ok bool) {
+	parts := strings.Split(path, ".")
+	var cur interface{} = body
+	for _, part := range parts {
+		obj, isObj := cur.(map[string]interface{})
+		if !isObj {
+			return nil, false
+		}
+		cur, ok = obj[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// transformSet - set value of field; not object intermediate fields are replaced by objects
+func transformSet(body map[string]interface{}, path string, v interface{}) {
+	parts := strings.Split(path, ".")
+	obj := body
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := obj[part].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			obj[part] = next
+		}
+		obj = next
+	}
+	obj[parts[len(parts)-1]] = v
+}
+
+func transformRemove(body map[string]interface{}, path string) {
+	parts := strings.Split(path, ".")
+	obj := body
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := obj[part].(map[string]interface{})
+		if !ok {
+			return
+		}
+		obj = next
+	}
+	delete(obj, parts[len(parts)-1])
+}
+
+func transformValue(raw json.RawMessage) interface{} {
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	if d.Decode(&v) != nil {
+		return nil
+	}
+	return v
+}
+
+// transformEqual - values are equal (numbers are compared by value)
+func transformEqual(a interface{}, b interface{}) bool {
+	if an, ok := a.(json.Number); ok {
+		bn, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		af, er1 := an.Float64()
+		bf, er2 := bn.Float64()
+		if er1 == nil && er2 == nil {
+			return af == bf
+		}
+		return an == bn
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// transformCompare - compare numbers or strings; ok == false when values can not be compared
+func transformCompare(a interface{}, b interface{}) (cmp int, ok bool) {
+	switch av := a.(type) {
+	case json.Number:
+		bv, isNum := b.(json.Number)
+		if !isNum {
+			return 0, false
+		}
+		af, er1 := av.Float64()
+		bf, er2 := bv.Float64()
+		if er1 != nil || er2 != nil {
+			return 0, false
+		}
+		switch {
+		case af < bf:
+			return -1, true
+		case af > bf:
+			return 1, true
+		}
+		return 0, true
+	case string:
+		bv, isStr := b.(string)
+		if !isStr {
+			return 0, false
+		}
+		return strings.Compare(av, bv), true
+	}
+	return 0, false
+}
+
+func (p TransformFieldPredicate) match(body map[string]interface{}) bool {
+	v, exists := transformGet(body, p.Path)
+
+	switch p.Op {
+	case TransformOpExists:
+		return exists
+	case TransformOpNotExists:
+		return !exists
+	case TransformOpEq:
+		return exists && transformEqual(v, transformValue(p.Value))
+	case TransformOpNe:
+		return !exists || !transformEqual(v, transformValue(p.Value))
+	case TransformOpIn, TransformOpNotIn:
+		in := false
+		if exists {
+			for _, raw := range p.Values {
+				if transformEqual(v, transformValue(raw)) {
+					in = true
+					break
+				}
+			}
+		}
+		return in == (p.Op == TransformOpIn)
+	}
+
+	if !exists {
+		return false
+	}
+	cmp, ok := transformCompare(v, transformValue(p.Value))
+	if !ok {
+		return false
+	}
+	switch p.Op {
+	case TransformOpGt:
+		return cmp > 0
+	case TransformOpGte:
+		return cmp >= 0
+	case TransformOpLt:
+		return cmp < 0
+	case TransformOpLte:
+		return cmp <= 0
+	}
+	return false
+}
+
+// SubscribeCopyTransform subscribe on to queue and copy (addUniqueList) messages filtered and rewritten by transform to destination
+// (the same subscriber and unique semantics as SubscribeCopyUnique: external id of message is kept)
+func SubscribeCopyTransform(src Queue, dst Queue,
+	userSrc cn.CapUser, userDst cn.CapUser,
+	saveModeSrc cn.SaveMode, saveModeDst cn.SaveMode,
+	subscriberName string, cntLimit int, doSaveDst bool,
+	segments *segment.Segments,
+	transform *Transform,
+) func(ctx context.Context) (isEmpty bool, err *mft.Error) {
+	return subscribeCopy(src, dst, userSrc, userDst, saveModeSrc, saveModeDst,
+		subscriberName, doSaveDst, segmentReader(src, userSrc, cntLimit, segments), "", transform.Apply)
+}
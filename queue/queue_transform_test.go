@@ -0,0 +1,149 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/storage"
+)
+
+func TestTransform_Apply(t *testing.T) {
+	var transform Transform
+	er0 := json.Unmarshal([]byte(`{
+		"filter": {
+			"sources": ["s1", "s2"],
+			"fields": [
+				{"path": "type", "op": "in", "values": ["order", "refund"]},
+				{"path": "amount", "op": "gte", "value": 10}
+			]
+		},
+		"source": "orders",
+		"segment": 7,
+		"project": [
+			{"from": "id", "to": "order_id"},
+			{"from": "amount", "to": "sum.value"},
+			{"from": "meta.origin", "to": "origin"}
+		],
+		"rename": [{"from": "origin", "to": "headers.origin"}],
+		"set": {"headers.copied": true}
+	}`), &transform)
+	if er0 != nil {
+		t.Fatal(er0)
+	}
+	if err := transform.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := &MessageWithMeta{
+		ID:         1,
+		ExternalID: 10,
+		Source:     "s1",
+		Message:    []byte(`{"id": 12345678901234567, "type": "order", "amount": 15.5, "meta": {"origin": "web"}, "extra": 1}`),
+	}
+	out, skip, err := transform.Apply(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skip {
+		t.Fatal("Transform.Apply should not skip message")
+	}
+	if out.Source != "orders" || out.Segment != 7 || out.ExternalID != 10 {
+		t.Errorf("Transform.Apply wrong meta %+v", out)
+	}
+	expected := `{"headers":{"copied":true,"origin":"web"},"order_id":12345678901234567,"sum":{"value":15.5}}`
+	if string(out.Message) != expected {
+		t.Errorf("Transform.Apply body should be %v not %v", expected, string(out.Message))
+	}
+
+	skipped := []*MessageWithMeta{
+		{ID: 2, ExternalID: 11, Source: "s3", Message: []byte(`{"type": "order", "amount": 15}`)},
+		{ID: 3, ExternalID: 12, Source: "s1", Message: []byte(`{"type": "other", "amount": 15}`)},
+		{ID: 4, ExternalID: 13, Source: "s2", Message: []byte(`{"type": "refund", "amount": 5}`)},
+		{ID: 5, ExternalID: 14, Source: "s2", Message: []byte(`not json`)},
+	}
+	transform.SkipInvalid = true
+	for _, msg := range skipped {
+		_, skip, err := transform.Apply(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !skip {
+			t.Errorf("Transform.Apply should skip message %v", msg.ID)
+		}
+	}
+
+	transform.SkipInvalid = false
+	_, _, err = transform.Apply(skipped[3])
+	if err == nil {
+		t.Error("Transform.Apply should fail on not json body")
+	}
+
+	bad := Transform{Filter: TransformFilter{Fields: []TransformFieldPredicate{{Path: "a", Op: "like"}}}}
+	if err := bad.Validate(); err == nil {
+		t.Error("Transform.Validate should fail on unknown op")
+	}
+}
+
+func TestSubscribeCopyTransform(t *testing.T) {
+	src := CreateSimpleQueue(5, 0, 0, storage.CreateMapSorage(), nil, nil, nil)
+	dst := CreateSimpleQueue(5, 0, 0, storage.CreateMapSorage(), nil, nil, nil)
+
+	ctx := context.Background()
+
+	for i := 1; i <= 10; i++ {
+		body := []byte(`{"n": 1}`)
+		if i%2 == 0 {
+			body = []byte(`{"n": 2}`)
+		}
+		_, err := src.Add(ctx, nil, body, int64(i), 0, "s", 0, cn.NotSaveSaveMode)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	transform := &Transform{
+		Filter: TransformFilter{
+			Fields: []TransformFieldPredicate{{Path: "n", Op: TransformOpEq, Value: json.RawMessage(`2`)}},
+		},
+		Source: "even",
+	}
+
+	for run := 0; run < 2; run++ {
+		// second run repeats copy: messages are not duplicated
+		err := src.SubscriberSetLastRead(ctx, nil, "transform", 0, cn.SaveMarkSaveMode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		copy := SubscribeCopyTransform(src, dst, nil, nil, cn.SaveMarkSaveMode, cn.SaveMarkSaveMode,
+			"transform", 3, false, nil, transform)
+		for i := 0; i < 5; i++ {
+			_, err := copy(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	msgs, err := dst.Get(ctx, nil, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 5 {
+		t.Fatalf("destination should contain 5 messages not %v", len(msgs))
+	}
+	for _, msg := range msgs {
+		if msg.Source != "even" || msg.ExternalID%2 != 0 {
+			t.Errorf("wrong copied message %+v", msg)
+		}
+	}
+
+	lastID, err := src.SubscriberGetLastRead(ctx, nil, "transform")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastID == 0 {
+		t.Error("subscriber should be moved over skipped messages")
+	}
+}
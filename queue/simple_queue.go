@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"sort"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/capella-pw/queue/cn"
@@ -31,6 +32,7 @@ type SimpleQueue struct {
 	mx              mfs.PMutex
 	mxFileSave      mfs.PMutex
 	mxBlockSaveWait mfs.PMutex
+	mxErase         mfs.PMutex
 
 	Blocks []*SimpleQueueBlock `json:"blocks"`
 
@@ -64,8 +66,39 @@ type SimpleQueue struct {
 
 	Source string `json:"-"`
 
+	// EraseCheck - checks that user is allowed to erase messages (Erase); nil - erase is allowed
+	EraseCheck EraseCheckFunc `json:"-"`
+
 	Segments *segment.Segments `json:"segments,omitempty"`
 
+	// BlockFormat - format of block files (BlockFormatJSON, BlockFormatBinary)
+	BlockFormat string `json:"block_format,omitempty"`
+	// AppendSave - saves of current write block append new messages into segment file
+	// block file is rewritten when block closes
+	AppendSave bool `json:"append_save,omitempty"`
+
+	// ManifestCheckpoint - count of metadata change events in ManifestFileName between checkpoints
+	// 0 - ManifestCheckpointDefault; < 0 - metadata is always rewritten into MetaDataFileName
+	ManifestCheckpoint int `json:"manifest_checkpoint,omitempty"`
+	// ManifestSeq - sequence of last manifest event included into MetaDataFileName
+	ManifestSeq int64 `json:"manifest_seq,omitempty"`
+	// manifest - changes of metadata after last save (nil - checkpoint is written on next save)
+	manifest *manifestChanges
+
+	combiner addCombiner
+
+	mxID      sync.Mutex
+	lastGenID int64
+
+	mxAppend sync.Mutex
+	chAppend chan struct{}
+
+	// GroupCommitter - batches saves of SaveImmediatelySaveMode (nil - DefaultGroupCommitter)
+	GroupCommitter *GroupCommitter `json:"-"`
+
+	// Archives - list of archived blocks
+	Archives []*SimpleQueueArchive `json:"archives,omitempty"`
+
 	DefaultSaveMode         cn.SaveMode `json:"default_save_mod,omitempty"`
 	UseDefaultSaveModeForce bool        `json:"use_default_save_mod_force,omitempty"`
 }
@@ -81,9 +114,18 @@ type SimpleQueueBlock struct {
 	RemoveMarks []string  `json:"rm_marks,omitempty"`
 	NextMark    string    `json:"next_mark"`
 	NeedDelete  bool      `json:"need_delete"`
+	Archived    bool      `json:"archived,omitempty"`
 	Len         int       `json:"len"`
+	Cnt         int       `json:"cnt,omitempty"`
+	LastID      int64     `json:"last_id,omitempty"`
+	// Appending - messages of block may be stored in segment file
+	Appending bool `json:"appending,omitempty"`
 
 	Data []*SimpleQueueMessage `json:"-"`
+	// appendCnt - count of messages of Data stored in files
+	appendCnt int
+	// needMigrate - block file has format other than queue format (block is rewritten on next save)
+	needMigrate bool
 
 	ChangesRv int64 `json:"-"`
 	SaveRv    int64 `json:"-"`
@@ -108,6 +150,8 @@ type SimpleQueueMessage struct {
 	Message    []byte    `json:"msg,omitempty"`
 	Source     string    `json:"src,omitempty"`
 	Segment    int64     `json:"sg,omitempty"`
+	// Tombstone - message was erased (message body is removed)
+	Tombstone bool `json:"tomb,omitempty"`
 }
 
 // SimpleQueueSubscribers line subscribers info
@@ -224,6 +268,12 @@ func LoadSimpleQueue(ctx context.Context, metaStorage storage.Storage, subscribe
 		return nil, GenerateErrorE(10030000, er0)
 	}
 
+	cnt, err := q.loadManifest(ctx)
+	if err != nil {
+		return nil, GenerateErrorE(10030002, err)
+	}
+	q.manifest = newManifestChanges(cnt)
+
 	q.SaveRv = idGenerator.RvGetPart()
 	q.ChangesRv = q.SaveRv
 
@@ -236,6 +286,13 @@ func LoadSimpleQueue(ctx context.Context, metaStorage storage.Storage, subscribe
 	q.Subscribers.SaveRv = q.SaveRv
 	q.Subscribers.ChangesRv = q.SaveRv
 
+	if len(q.Blocks) > 0 {
+		q.lastGenID = q.Blocks[len(q.Blocks)-1].ID
+		if q.Blocks[len(q.Blocks)-1].LastID > q.lastGenID {
+			q.lastGenID = q.Blocks[len(q.Blocks)-1].LastID
+		}
+	}
+
 	if q.SubscriberStorage != nil {
 		ok, err := q.SubscriberStorage.Exists(ctx, SubscribersFileName)
 		if err != nil {
@@ -291,12 +348,14 @@ func (q *SimpleQueue) checkAndAddCurrentBlockForWrite(ctx context.Context, saveM
 
 	if len(q.Blocks) == 0 {
 		block := &SimpleQueueBlock{
-			ID:   q.IDGenerator.RvGetPart(),
-			Dt:   time.Now(),
-			Data: make([]*SimpleQueueMessage, 0, 1),
+			ID:        q.nextID(),
+			Dt:        time.Now(),
+			Data:      make([]*SimpleQueueMessage, 0, 1),
+			Appending: q.AppendSave,
 		}
 		q.Blocks = append(q.Blocks, block)
 		q.ChangesRv = block.ID
+		q.setBlockChanged(block)
 	}
 
 	ok, err := q.Blocks[len(q.Blocks)-1].canAppend(ctx, q.CntLimit, q.TimeLimit, q.LenLimit)
@@ -306,13 +365,24 @@ func (q *SimpleQueue) checkAndAddCurrentBlockForWrite(ctx context.Context, saveM
 	}
 
 	if !ok {
+		if closed := q.Blocks[len(q.Blocks)-1]; closed.Appending {
+			// closed block should be rewritten without segment file
+			q.mxBlockSaveWait.Lock()
+			if _, ok := q.SaveBlocks[closed.ID]; !ok {
+				q.SaveBlocks[closed.ID] = closed
+			}
+			q.mxBlockSaveWait.Unlock()
+		}
+
 		block := &SimpleQueueBlock{
-			ID:   q.IDGenerator.RvGetPart(),
-			Dt:   time.Now(),
-			Data: make([]*SimpleQueueMessage, 0, 1),
+			ID:        q.nextID(),
+			Dt:        time.Now(),
+			Data:      make([]*SimpleQueueMessage, 0, 1),
+			Appending: q.AppendSave,
 		}
 		q.Blocks = append(q.Blocks, block)
 		q.ChangesRv = block.ID
+		q.setBlockChanged(block)
 	}
 
 	if saveMode == cn.SaveWaitSaveMode {
@@ -330,180 +400,75 @@ func (q *SimpleQueue) checkAndAddCurrentBlockForWrite(ctx context.Context, saveM
 func (q *SimpleQueue) Add(ctx context.Context, user cn.CapUser, message []byte,
 	externalID int64, externalDt int64, source string, segment int64,
 	saveMode cn.SaveMode) (id int64, err *mft.Error) {
-	if externalDt > time.Now().Unix() {
-		return id, GenerateError(10010008, externalDt, time.Now())
-	}
-
-	if !q.mx.RTryLock(ctx) {
-		return id, GenerateError(10010000)
-	}
-
-	if q.UseDefaultSaveModeForce {
-		saveMode = q.DefaultSaveMode
-	} else if saveMode == cn.QueueSetDefaultMode {
-		saveMode = q.DefaultSaveMode
-	}
-
-	if saveMode != cn.NotSaveSaveMode &&
-		saveMode != cn.SaveImmediatelySaveMode &&
-		saveMode != cn.SaveMarkSaveMode &&
-		saveMode != cn.SaveWaitSaveMode {
-		return id, GenerateError(10010010, saveMode)
-	}
-
-	if !q.Segments.In(segment) {
-		return id, GenerateError(10010009, segment)
-	}
-
-	block, chWaitSaveMeta, err := q.currentBlockForWrite(ctx, saveMode)
+	saveMode, err = q.saveModeForAdd(saveMode)
 	if err != nil {
 		return id, err
 	}
 
-	id, chWaitBlockSave, err := block.add(ctx, message, externalID, externalDt, source, segment, q.IDGenerator, saveMode)
-
-	if source == "" {
-		source = q.Source
-	}
-
-	if saveMode != cn.NotSaveSaveMode {
-		// mark block as need to save even if there are errors
-
-		q.mxBlockSaveWait.Lock()
-
-		// if !q.mxBlockSaveWait.TryLock(ctx) {
-		// 	q.mx.RUnlock()
-		// 	return id, GenerateError(10010004)
-		// }
-
-		if _, ok := q.SaveBlocks[block.ID]; !ok {
-			q.SaveBlocks[block.ID] = block
-		}
-
-		q.mxBlockSaveWait.Unlock()
-	}
-
+	req, err := q.newAddRequest(message, externalID, externalDt, source, segment, saveMode)
 	if err != nil {
-		q.mx.RUnlock()
 		return id, err
 	}
 
-	if externalID != 0 {
-		q.SetMaxExtID(source, externalID)
+	err = q.combiner.add(ctx, q, req)
+	if err != nil {
+		return 0, err
 	}
-
-	q.mx.RUnlock()
-
-	if saveMode == cn.SaveImmediatelySaveMode {
-		err = q.SaveAll(ctx, user)
-		if err != nil {
-			return id, err
-		}
-		return id, nil
+	if req.err != nil {
+		return req.id, req.err
 	}
 
-	if saveMode == cn.SaveWaitSaveMode {
-		if chWaitSaveMeta != nil {
-			select {
-			case <-chWaitSaveMeta:
-			case <-ctx.Done():
-				return id, GenerateError(10010005)
-			}
-		}
-
-		select {
-		case <-chWaitBlockSave:
-		case <-ctx.Done():
-			return id, GenerateError(10010006)
-		}
-	}
-
-	return id, nil
+	return req.id, q.waitAdd(ctx, user, req, saveMode)
 }
 
+// AddList add messages to queue with one lock of queue
+// saveMode is applied to last message (other messages wait with it)
 func (q *SimpleQueue) AddList(ctx context.Context, user cn.CapUser, messages []Message,
 	saveMode cn.SaveMode) (ids []int64, err *mft.Error) {
-	baseSaveMode := cn.SaveMarkSaveMode
-	if saveMode == cn.NotSaveSaveMode {
-		baseSaveMode = cn.NotSaveSaveMode
-	}
 	if len(messages) == 0 {
 		return make([]int64, 0), nil
 	}
-	ids = make([]int64, 0, len(messages))
-	for i := 0; i < len(messages)-1; i++ {
-		id, err := q.Add(ctx, user, messages[i].Message,
-			messages[i].ExternalID,
-			messages[i].ExternalDt,
-			messages[i].Source,
-			messages[i].Segment,
-			baseSaveMode,
-		)
-		if err != nil {
-			return ids, err
-		}
-
-		ids = append(ids, id)
-	}
 
-	i := len(messages) - 1
-	id, err := q.Add(ctx, user, messages[i].Message,
-		messages[i].ExternalID,
-		messages[i].ExternalDt,
-		messages[i].Source,
-		messages[i].Segment,
-		saveMode,
-	)
+	saveMode, err = q.saveModeForAdd(saveMode)
 	if err != nil {
-		return ids, err
+		return make([]int64, 0), err
 	}
 
-	ids = append(ids, id)
-	return ids, nil
-}
-
-// add message to queue block
-// externalDt - unix()
-func (block *SimpleQueueBlock) add(ctx context.Context, message []byte,
-	externalID int64, externalDt int64, source string, segment int64,
-	idGen *mft.G, saveMode cn.SaveMode) (id int64, chWait chan bool, err *mft.Error) {
-	if !block.mx.TryLock(ctx) {
-		return id, nil, GenerateError(10010001)
+	// messages before wrong message are added
+	var errCheck *mft.Error
+	reqs := make([]*addRequest, 0, len(messages))
+	for _, msg := range messages {
+		req, err := q.newAddRequest(msg.Message, msg.ExternalID, msg.ExternalDt, msg.Source, msg.Segment, saveMode)
+		if err != nil {
+			errCheck = err
+			break
+		}
+		reqs = append(reqs, req)
 	}
-
-	if block.IsUnload {
-		block.mx.Unlock()
-		return id, nil, GenerateError(10010007)
+	if len(reqs) == 0 {
+		return make([]int64, 0), errCheck
 	}
-
-	id = idGen.RvGetPart()
-
-	if externalID == 0 {
-		externalID = id
+	// only last message waits
+	for i := 0; i < len(reqs)-1; i++ {
+		reqs[i].wait = false
 	}
 
-	msg := &SimpleQueueMessage{
-		ID:         id,
-		ExternalID: externalID,
-		ExternalDt: externalDt,
-		Message:    message,
-		Source:     source,
-		Segment:    segment,
-		Dt:         time.Now(),
-	}
+	q.addRequests(ctx, reqs)
 
-	block.Data = append(block.Data, msg)
-	block.Len += len(message)
-	block.ChangesRv = msg.ID
-	block.LastGet = time.Now()
+	ids = make([]int64, 0, len(reqs))
+	for _, req := range reqs {
+		if req.err != nil {
+			return ids, req.err
+		}
+		ids = append(ids, req.id)
+	}
 
-	if saveMode == cn.SaveWaitSaveMode {
-		chWait = make(chan bool, 1)
-		block.SaveWait = append(block.SaveWait, chWait)
+	err = q.waitAdd(ctx, user, reqs[len(reqs)-1], saveMode)
+	if err != nil {
+		return ids, err
 	}
 
-	block.mx.Unlock()
-	return id, chWait, nil
+	return ids, errCheck
 }
 
 // canAppend can append message to queue block
@@ -514,24 +479,32 @@ func (block *SimpleQueueBlock) canAppend(ctx context.Context, cntLimit int, time
 
 	ok = true
 
+	ok = block.canAppendLocked(cntLimit, timeLimit, lenLimit)
+
+	block.mx.RUnlock()
+	return ok, nil
+}
+
+// canAppendLocked can append message to queue block
+// need block.mx RLocked
+func (block *SimpleQueueBlock) canAppendLocked(cntLimit int, timeLimit time.Duration, lenLimit int) (ok bool) {
 	if block.IsUnload {
-		ok = false
+		return false
 	}
 
-	if ok && timeLimit > 0 && time.Since(block.Dt) >= timeLimit {
-		ok = false
+	if timeLimit > 0 && time.Since(block.Dt) >= timeLimit {
+		return false
 	}
 
-	if ok && cntLimit > 0 && len(block.Data) >= cntLimit {
-		ok = false
+	if cntLimit > 0 && len(block.Data) >= cntLimit {
+		return false
 	}
 
-	if ok && lenLimit > 0 && block.Len >= lenLimit {
-		ok = false
+	if lenLimit > 0 && block.Len >= lenLimit {
+		return false
 	}
 
-	block.mx.RUnlock()
-	return ok, nil
+	return true
 }
 
 // getBlockForNext gets block where eixts next after idStart available message
@@ -689,6 +662,7 @@ func (q *SimpleQueue) GetSegment(ctx context.Context, user cn.CapUser, idStart i
 }
 
 // Save save meta info of queue
+// changes are appended into ManifestFileName, MetaDataFileName is rewritten on checkpoint
 // When MetaStorage == nil returns nil
 // When SaveRv == ChangesRv do nothing and returns nil
 func (q *SimpleQueue) Save(ctx context.Context, user cn.CapUser) (err *mft.Error) {
@@ -710,16 +684,11 @@ func (q *SimpleQueue) Save(ctx context.Context, user cn.CapUser) (err *mft.Error
 	}
 
 	changesRv := q.ChangesRv
-	data, errMarshal := json.MarshalIndent(q, "", "\t")
 	chLen := len(q.SaveWait)
 
 	q.mx.RUnlock()
 
-	if errMarshal != nil {
-		return GenerateErrorE(10012002, errMarshal)
-	}
-
-	err = q.MetaStorage.Save(ctx, MetaDataFileName, data)
+	err = q.saveMeta(ctx)
 	if err != nil {
 		return GenerateErrorE(10012003, err, MetaDataFileName)
 	}
@@ -779,26 +748,54 @@ func (block *SimpleQueueBlock) blockFileName() string {
 // Save save block of queue
 // When q.MetaStorage == nil returns nil
 // When block.SaveRv == block.ChangesRv do nothing and returns nil
+// (except closed appending block that should be rewritten without segment file
+// and block that should be rewritten in queue format)
+// Appending current block appends new messages into segment file when storage supports it
 func (block *SimpleQueueBlock) Save(ctx context.Context, q *SimpleQueue) (err *mft.Error) {
 	if q.MetaStorage == nil {
 		return nil
 	}
+	isCurrent, err := q.isCurrentBlock(ctx, block)
+	if err != nil {
+		return err
+	}
 	if !block.mxFileSave.TryLock(ctx) {
 		return GenerateError(10013000)
 	}
 	defer block.mxFileSave.Unlock()
 
+	st, err := q.getStorageLock(ctx, block.Mark)
+
+	if err != nil {
+		return err
+	}
+	appender, canAppend := storage.GetAppender(st)
+
 	if !block.mx.RTryLock(ctx) {
 		return GenerateError(10013001)
 	}
 
-	if block.SaveRv == block.ChangesRv {
+	compact := block.Appending && !isCurrent && !block.IsUnload
+	migrate := block.needMigrate && !block.IsUnload
+	if block.SaveRv == block.ChangesRv && !compact && !migrate {
 		block.mx.RUnlock()
 		return nil
 	}
 
+	appendMode := block.Appending && isCurrent && canAppend
+	appending := block.Appending
+
 	changesRv := block.ChangesRv
-	data, errMarshal := json.MarshalIndent(block.Data, "", "\t")
+	cnt := len(block.Data)
+	var data []byte
+	var errMarshal error
+	if appendMode {
+		if block.appendCnt < cnt {
+			data = marshalBlockSegment(block.Data[block.appendCnt:])
+		}
+	} else {
+		data, errMarshal = marshalBlockData(q.BlockFormat, block.Data)
+	}
 	chLen := len(block.SaveWait)
 
 	block.mx.RUnlock()
@@ -807,23 +804,51 @@ func (block *SimpleQueueBlock) Save(ctx context.Context, q *SimpleQueue) (err *m
 		return GenerateErrorE(10013002, errMarshal)
 	}
 
-	fileName := block.blockFileName()
-
-	st, err := q.getStorageLock(ctx, block.Mark)
+	if appendMode {
+		if len(data) > 0 {
+			fileName := block.segmentFileName()
+			err = appender.Append(ctx, fileName, data)
+			if err != nil {
+				return GenerateErrorE(10013003, err, fileName)
+			}
+		}
+	} else {
+		fileName := block.blockFileName()
+		err = st.Save(ctx, fileName, data)
+		if err != nil {
+			return GenerateErrorE(10013003, err, fileName)
+		}
 
-	if err != nil {
-		return err
+		if appending {
+			fileName = block.segmentFileName()
+			err = storage.DeleteIfExists(ctx, st, fileName)
+			if err != nil {
+				return GenerateErrorE(10013005, err, fileName)
+			}
+		}
 	}
 
-	err = st.Save(ctx, fileName, data)
-	if err != nil {
-		return GenerateErrorE(10013003, err, fileName)
+	if compact {
+		if !q.mx.TryLock(ctx) {
+			return GenerateError(10013006)
+		}
 	}
-
 	if !block.mx.TryLock(ctx) {
+		if compact {
+			q.mx.Unlock()
+		}
 		return GenerateError(10013004)
 	}
 	block.SaveRv = changesRv
+	block.appendCnt = cnt
+	if migrate && !appendMode {
+		block.needMigrate = false
+	}
+	if compact {
+		block.Appending = false
+		q.ChangesRv = q.nextID()
+		q.setBlockChanged(block)
+	}
 	if len(block.SaveWait) > 0 && chLen > 0 {
 		saveWait := make([]chan bool, 0)
 		for i := chLen; i < len(block.SaveWait); i++ {
@@ -840,6 +865,9 @@ func (block *SimpleQueueBlock) Save(ctx context.Context, q *SimpleQueue) (err *m
 	}
 
 	block.mx.Unlock()
+	if compact {
+		q.mx.Unlock()
+	}
 
 	return nil
 }
@@ -850,8 +878,9 @@ func (q *SimpleQueue) SaveAll(ctx context.Context, user cn.CapUser) (err *mft.Er
 	if !q.mxBlockSaveWait.TryLock(ctx) {
 		return GenerateError(10014000)
 	}
-	waitSaveBlocks := q.SaveBlocks
-	if len(waitSaveBlocks) > 0 {
+	var waitSaveBlocks map[int64]*SimpleQueueBlock
+	if len(q.SaveBlocks) > 0 {
+		waitSaveBlocks = q.SaveBlocks
 		q.SaveBlocks = make(map[int64]*SimpleQueueBlock)
 	}
 	q.mxBlockSaveWait.Unlock()
@@ -928,20 +957,30 @@ func (block *SimpleQueueBlock) load(ctx context.Context, q *SimpleQueue) (err *m
 		return err
 	}
 
-	body, err := st.Get(ctx, fileName)
+	var data []*SimpleQueueMessage
+	var format string
 
-	if err != nil {
-		block.mx.Unlock()
-		return GenerateErrorE(10020003, err, fileName, block.Mark)
-	}
+	if block.Appending {
+		data, format, err = block.loadAppending(ctx, st)
+		if err != nil {
+			block.mx.Unlock()
+			return err
+		}
+	} else {
+		body, err := st.Get(ctx, fileName)
 
-	data := make([]*SimpleQueueMessage, 0)
+		if err != nil {
+			block.mx.Unlock()
+			return GenerateErrorE(10020003, err, fileName, block.Mark)
+		}
 
-	errJSONUnmarshal := json.Unmarshal(body, &data)
+		var errUnmarshal error
+		data, format, errUnmarshal = unmarshalBlockData(body)
 
-	if errJSONUnmarshal != nil {
-		block.mx.Unlock()
-		return GenerateErrorE(10020002, errJSONUnmarshal)
+		if errUnmarshal != nil {
+			block.mx.Unlock()
+			return GenerateErrorE(10020002, errUnmarshal, fileName, block.Mark)
+		}
 	}
 
 	block.Data = data
@@ -949,11 +988,27 @@ func (block *SimpleQueueBlock) load(ctx context.Context, q *SimpleQueue) (err *m
 	if len(block.Data) > 0 {
 		block.SaveRv = block.Data[len(block.Data)-1].ID
 		block.ChangesRv = block.Data[len(block.Data)-1].ID
+		block.Cnt = len(block.Data)
+		block.LastID = block.Data[len(block.Data)-1].ID
 	} else {
 		block.SaveRv = block.ID
 		block.ChangesRv = block.ID
 	}
 
+	block.appendCnt = len(block.Data)
+	// lazy migration: block is rewritten in queue format on next save
+	block.needMigrate = !block.Appending && format != q.BlockFormat
+
+	if block.Appending || block.needMigrate {
+		// appending block is rewritten without segment file on next save when block is closed
+
+		q.mxBlockSaveWait.Lock()
+		if _, ok := q.SaveBlocks[block.ID]; !ok {
+			q.SaveBlocks[block.ID] = block
+		}
+		q.mxBlockSaveWait.Unlock()
+	}
+
 	block.mx.Reduce()
 
 	return nil
@@ -1002,7 +1057,8 @@ func (block *SimpleQueueBlock) setNewStorage(ctx context.Context, q *SimpleQueue
 		block.NextMark = nextMark
 	}
 
-	q.ChangesRv = q.IDGenerator.RvGetPart()
+	q.ChangesRv = q.nextID()
+	q.setBlockChanged(block)
 
 	return nil
 }
@@ -1025,7 +1081,8 @@ func (block *SimpleQueueBlock) setNeedDelete(ctx context.Context, q *SimpleQueue
 	if !block.NeedDelete {
 		block.NeedDelete = true
 
-		q.ChangesRv = q.IDGenerator.RvGetPart()
+		q.ChangesRv = q.nextID()
+		q.setBlockChanged(block)
 	}
 
 	return nil
@@ -1053,7 +1110,8 @@ func (block *SimpleQueueBlock) moveToNewStorage(ctx context.Context, q *SimpleQu
 	fileName := block.blockFileName()
 
 	changesRv := block.ChangesRv
-	data, errMarshal := json.MarshalIndent(block.Data, "", "\t")
+	cnt := len(block.Data)
+	data, errMarshal := marshalBlockData(q.BlockFormat, block.Data)
 	chLen := len(block.SaveWait)
 
 	if errMarshal != nil {
@@ -1084,6 +1142,7 @@ func (block *SimpleQueueBlock) moveToNewStorage(ctx context.Context, q *SimpleQu
 		return GenerateError(10018005)
 	}
 	block.SaveRv = changesRv
+	block.appendCnt = cnt
 	block.RemoveMarks = append(block.RemoveMarks, block.Mark)
 	block.Mark = block.NextMark
 
@@ -1101,7 +1160,8 @@ func (block *SimpleQueueBlock) moveToNewStorage(ctx context.Context, q *SimpleQu
 			}
 		}()
 	}
-	q.ChangesRv = q.IDGenerator.RvGetPart()
+	q.ChangesRv = q.nextID()
+	q.setBlockChanged(block)
 
 	block.mx.Unlock()
 	q.mx.Unlock()
@@ -1121,8 +1181,6 @@ func (block *SimpleQueueBlock) clearOldStorage(ctx context.Context, q *SimpleQue
 		return true, nil
 	}
 
-	fileName := block.blockFileName()
-
 	for _, stName := range block.RemoveMarks {
 		if block.Mark == stName {
 			continue
@@ -1132,7 +1190,7 @@ func (block *SimpleQueueBlock) clearOldStorage(ctx context.Context, q *SimpleQue
 			return false, err
 		}
 
-		err = storage.DeleteIfExists(ctx, st, fileName)
+		err = block.deleteFiles(ctx, st)
 		if err != nil {
 			return false, err
 		}
@@ -1144,7 +1202,8 @@ func (block *SimpleQueueBlock) clearOldStorage(ctx context.Context, q *SimpleQue
 
 	block.RemoveMarks = make([]string, 0)
 
-	q.ChangesRv = q.IDGenerator.RvGetPart()
+	q.ChangesRv = q.nextID()
+	q.setBlockChanged(block)
 
 	q.mx.Unlock()
 
@@ -1168,8 +1227,6 @@ func (block *SimpleQueueBlock) delete(ctx context.Context, q *SimpleQueue) (err
 		return nil
 	}
 
-	fileName := block.blockFileName()
-
 	if !block.mx.TryPromote(ctx) {
 		return GenerateError(10015002)
 	}
@@ -1182,7 +1239,7 @@ func (block *SimpleQueueBlock) delete(ctx context.Context, q *SimpleQueue) (err
 			return err
 		}
 
-		err = storage.DeleteIfExists(ctx, st, fileName)
+		err = block.deleteFiles(ctx, st)
 		if err != nil {
 			block.mx.Unlock()
 			return err
@@ -1196,7 +1253,7 @@ func (block *SimpleQueueBlock) delete(ctx context.Context, q *SimpleQueue) (err
 			return err
 		}
 
-		err = storage.DeleteIfExists(ctx, st, fileName)
+		err = block.deleteFiles(ctx, st)
 		if err != nil {
 			block.mx.Unlock()
 			return err
@@ -1211,7 +1268,7 @@ func (block *SimpleQueueBlock) delete(ctx context.Context, q *SimpleQueue) (err
 			return err
 		}
 
-		err = storage.DeleteIfExists(ctx, st, fileName)
+		err = block.deleteFiles(ctx, st)
 		if err != nil {
 			block.mx.Unlock()
 			return err
@@ -1234,7 +1291,8 @@ func (block *SimpleQueueBlock) delete(ctx context.Context, q *SimpleQueue) (err
 			}
 		}
 		q.Blocks = newBlocks
-		q.ChangesRv = q.IDGenerator.RvGetPart()
+		q.ChangesRv = q.nextID()
+		q.setBlockDeleted(block.ID)
 	}
 	q.mx.Unlock()
 
@@ -1708,6 +1766,15 @@ func (q *SimpleQueue) SaveSubscribers(ctx context.Context, user cn.CapUser) (err
 func (q *SimpleQueue) SubscriberSetLastRead(ctx context.Context, user cn.CapUser,
 	subscriber string, id int64,
 	saveMode cn.SaveMode) (err *mft.Error) {
+	return q.subscriberSetLastRead(ctx, user, subscriber, id, saveMode, false)
+}
+
+// subscriberSetLastRead - set last read info
+// if id == 0 remove subscribe (if allowRewind then subscriber is moved before first message of queue)
+// if allowRewind then last read id may be moved back
+func (q *SimpleQueue) subscriberSetLastRead(ctx context.Context, user cn.CapUser,
+	subscriber string, id int64,
+	saveMode cn.SaveMode, allowRewind bool) (err *mft.Error) {
 
 	if !q.Subscribers.mx.TryLock(ctx) {
 		return GenerateError(10032000)
@@ -1729,7 +1796,7 @@ func (q *SimpleQueue) SubscriberSetLastRead(ctx context.Context, user cn.CapUser
 	isChanged := false
 	var chWait chan bool
 	v, ok := q.Subscribers.SubscribersInfo[subscriber]
-	if !ok && id != 0 {
+	if !ok && (id != 0 || allowRewind) {
 		v = &SimpleQueueSubscriberInfo{
 			StartDt: time.Now(),
 			LastID:  id,
@@ -1738,7 +1805,7 @@ func (q *SimpleQueue) SubscriberSetLastRead(ctx context.Context, user cn.CapUser
 		q.Subscribers.SubscribersInfo[subscriber] = v
 
 		isChanged = true
-	} else if v.LastID < id && id != 0 {
+	} else if ok && (v.LastID < id || allowRewind && v.LastID != id) && (id != 0 || allowRewind) {
 		v.LastID = id
 		v.LastDt = time.Now()
 
@@ -1758,7 +1825,7 @@ func (q *SimpleQueue) SubscriberSetLastRead(ctx context.Context, user cn.CapUser
 	}
 
 	if saveMode == cn.SaveMarkSaveMode {
-		q.Subscribers.ChangesRv = q.IDGenerator.RvGetPart()
+		q.Subscribers.ChangesRv = q.nextID()
 	}
 
 	q.Subscribers.mx.Unlock()
@@ -0,0 +1,154 @@
+package queue
+
+import (
+	"context"
+	"encoding/binary"
+
+	"github.com/capella-pw/queue/storage"
+	"github.com/myfantasy/mft"
+)
+
+// BlockSegmentPostfixFileName - postfix file name with appended messages of current block
+const BlockSegmentPostfixFileName = ".seg"
+
+// Segment file of block is a sequence of chunks
+// one chunk is written on each save of current write block
+//
+//	chunk:
+//	  len   uint32 - length of body
+//	  body  [len]byte - binary block (see BlockFormatBinary) with new messages
+//
+// Incomplete last chunk (broken write) is ignored on load and segment file is truncated to the last complete chunk
+const blockSegmentChunkHeaderLen = 4
+
+func (block *SimpleQueueBlock) segmentFileName() string {
+	return block.blockFileName() + BlockSegmentPostfixFileName
+}
+
+// marshalBlockSegment - marshal messages into segment chunk
+func marshalBlockSegment(data []*SimpleQueueMessage) []byte {
+	body := marshalBlockDataBinary(data)
+
+	chunk := make([]byte, blockSegmentChunkHeaderLen, blockSegmentChunkHeaderLen+len(body))
+	binary.LittleEndian.PutUint32(chunk, uint32(len(body)))
+
+	return append(chunk, body...)
+}
+
+// unmarshalBlockSegment - unmarshal messages from all chunks of segment
+// validLen - length of complete chunks (validLen < len(body) when last chunk is broken)
+func unmarshalBlockSegment(body []byte) (data []*SimpleQueueMessage, validLen int, err error) {
+	data = make([]*SimpleQueueMessage, 0)
+
+	for pos := 0; pos < len(body); {
+		if pos+blockSegmentChunkHeaderLen > len(body) {
+			// broken last chunk
+			break
+		}
+		chunkLen := int(binary.LittleEndian.Uint32(body[pos:]))
+		pos += blockSegmentChunkHeaderLen
+		if pos+chunkLen > len(body) {
+			// broken last chunk
+			break
+		}
+
+		msgs, err := unmarshalBlockDataBinary(body[pos : pos+chunkLen])
+		pos += chunkLen
+		if err != nil {
+			if pos == len(body) {
+				// broken last chunk
+				break
+			}
+			return nil, validLen, err
+		}
+
+		data = append(data, msgs...)
+		validLen = pos
+	}
+
+	return data, validLen, nil
+}
+
+// isCurrentBlock - block is current block for write
+func (q *SimpleQueue) isCurrentBlock(ctx context.Context, block *SimpleQueueBlock) (ok bool, err *mft.Error) {
+	if !q.mx.RTryLock(ctx) {
+		return false, GenerateError(10040000)
+	}
+	defer q.mx.RUnlock()
+
+	return len(q.Blocks) > 0 && q.Blocks[len(q.Blocks)-1] == block, nil
+}
+
+// loadAppending - reads block file and segment file of appending block
+// segment file with broken last chunk is truncated
+// messages from segment with id > last id of block file are added to result
+func (block *SimpleQueueBlock) loadAppending(ctx context.Context, st storage.Storage) (data []*SimpleQueueMessage, format string, err *mft.Error) {
+	fileName := block.blockFileName()
+	segmentFileName := block.segmentFileName()
+
+	data = make([]*SimpleQueueMessage, 0)
+	format = BlockFormatJSON
+
+	ok, err := st.Exists(ctx, fileName)
+	if err != nil {
+		return nil, format, GenerateErrorE(10040001, err, fileName, block.Mark)
+	}
+	if ok {
+		body, err := st.Get(ctx, fileName)
+		if err != nil {
+			return nil, format, GenerateErrorE(10040001, err, fileName, block.Mark)
+		}
+		var errUnmarshal error
+		data, format, errUnmarshal = unmarshalBlockData(body)
+		if errUnmarshal != nil {
+			return nil, format, GenerateErrorE(10040002, errUnmarshal, fileName, block.Mark)
+		}
+	}
+
+	ok, err = st.Exists(ctx, segmentFileName)
+	if err != nil {
+		return nil, format, GenerateErrorE(10040001, err, segmentFileName, block.Mark)
+	}
+	if !ok {
+		return data, format, nil
+	}
+
+	body, err := st.Get(ctx, segmentFileName)
+	if err != nil {
+		return nil, format, GenerateErrorE(10040001, err, segmentFileName, block.Mark)
+	}
+	segmentData, validLen, errUnmarshal := unmarshalBlockSegment(body)
+	if errUnmarshal != nil {
+		return nil, format, GenerateErrorE(10040002, errUnmarshal, segmentFileName, block.Mark)
+	}
+	if validLen < len(body) {
+		// broken last chunk is removed so next chunks are appended after complete chunks
+		err = st.Save(ctx, segmentFileName, body[:validLen])
+		if err != nil {
+			return nil, format, GenerateErrorE(10040003, err, segmentFileName, block.Mark)
+		}
+	}
+
+	var lastID int64
+	if len(data) > 0 {
+		lastID = data[len(data)-1].ID
+	}
+	for _, msg := range segmentData {
+		if msg.ID > lastID {
+			data = append(data, msg)
+			lastID = msg.ID
+		}
+	}
+
+	return data, format, nil
+}
+
+// deleteFiles - delete block file and segment file from storage
+func (block *SimpleQueueBlock) deleteFiles(ctx context.Context, st storage.Storage) (err *mft.Error) {
+	err = storage.DeleteIfExists(ctx, st, block.blockFileName())
+	if err != nil {
+		return err
+	}
+
+	return storage.DeleteIfExists(ctx, st, block.segmentFileName())
+}
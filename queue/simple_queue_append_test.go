@@ -0,0 +1,178 @@
+package queue
+
+import (
+	"context"
+	"testing"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/storage"
+)
+
+func TestSimpleQueue_AppendSave(t *testing.T) {
+	stor := storage.CreateMapSorage()
+	q := CreateSimpleQueue(5, 0, 0, stor, nil, nil, nil)
+	q.AppendSave = true
+
+	ctx := context.Background()
+
+	ids := make([]int64, 0)
+	add := func(cnt int) {
+		for i := 0; i < cnt; i++ {
+			id, err := q.Add(ctx, nil, []byte("text"), 0, 0, "", 0, cn.SaveImmediatelySaveMode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+	}
+
+	add(3)
+
+	block := q.Blocks[0]
+	if !block.Appending {
+		t.Fatalf("SimpleQueue.Add should create appending block")
+	}
+
+	// current block is saved into segment file only
+	{
+		ok, err := stor.Exists(ctx, block.blockFileName())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			t.Errorf("SimpleQueueBlock.Save should not write block file for current block")
+		}
+
+		body, err := stor.Get(ctx, block.segmentFileName())
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _, er0 := unmarshalBlockSegment(body)
+		if er0 != nil {
+			t.Fatal(er0)
+		}
+		if len(data) != 3 {
+			t.Errorf("SimpleQueueBlock.Save should append 3 messages into segment not %v", len(data))
+		}
+	}
+
+	// broken last chunk is ignored and removed from segment file
+	{
+		body, err := stor.Get(ctx, block.segmentFileName())
+		if err != nil {
+			t.Fatal(err)
+		}
+		validLen := len(body)
+
+		err = stor.Append(ctx, block.segmentFileName(), []byte{200, 0, 0, 0, 1, 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = block.Unload(ctx, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		msgs, err := q.Get(ctx, nil, 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(msgs) != 3 || msgs[2].ID != ids[2] {
+			t.Fatalf("SimpleQueue.Get should load appending block from segment %v", len(msgs))
+		}
+
+		body, err = stor.Get(ctx, block.segmentFileName())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(body) != validLen {
+			t.Errorf("SimpleQueueBlock.load should truncate broken chunk %v != %v", len(body), validLen)
+		}
+
+		// messages appended after broken chunk are loaded
+		add(1)
+
+		_, err = block.Unload(ctx, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		msgs, err = q.Get(ctx, nil, 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(msgs) != 4 || msgs[3].ID != ids[3] {
+			t.Fatalf("SimpleQueue.Get should load messages appended after broken chunk %v", len(msgs))
+		}
+	}
+
+	// closed block is rewritten without segment
+	{
+		add(3)
+
+		if len(q.Blocks) != 2 {
+			t.Fatalf("SimpleQueue.Add should create second block")
+		}
+
+		err := q.SaveAll(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if block.Appending {
+			t.Errorf("SimpleQueueBlock.Save should compact closed block")
+		}
+		ok, err := stor.Exists(ctx, block.segmentFileName())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			t.Errorf("SimpleQueueBlock.Save should delete segment file of closed block")
+		}
+
+		_, err = block.Unload(ctx, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = q.Blocks[1].Unload(ctx, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		msgs, err := q.Get(ctx, nil, 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(msgs) != 7 {
+			t.Fatalf("SimpleQueue.Get should return 7 messages not %v", len(msgs))
+		}
+		for i, msg := range msgs {
+			if msg.ID != ids[i] {
+				t.Errorf("SimpleQueue.Get message %v should have id %v not %v", i, ids[i], msg.ID)
+			}
+		}
+	}
+
+	// erase in appending block
+	{
+		_, err := q.Erase(ctx, nil, []int64{ids[6]}, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		add(1)
+
+		_, err = q.Blocks[1].Unload(ctx, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		msgs, err := q.Get(ctx, nil, ids[4], 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(msgs) != 3 || !msgs[1].Tombstone || msgs[2].ID != ids[7] {
+			t.Fatalf("SimpleQueue.Get should load erased appending block")
+		}
+	}
+}
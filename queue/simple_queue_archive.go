@@ -0,0 +1,194 @@
+package queue
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/myfantasy/mft"
+)
+
+// SimpleQueueArchive - info about archived block
+type SimpleQueueArchive struct {
+	BlockID   int64     `json:"block_id"`
+	Dt        time.Time `json:"dt"`
+	ArchiveDt time.Time `json:"archive_dt"`
+	FirstID   int64     `json:"first_id"`
+	LastID    int64     `json:"last_id"`
+	Cnt       int       `json:"cnt"`
+
+	// Mount - storage mount name
+	Mount string `json:"mount"`
+	// RelativePath - path in mount
+	RelativePath string `json:"relative_path"`
+	FileName     string `json:"file_name"`
+
+	CompressAlg string `json:"compress_alg,omitempty"`
+	EncryptAlg  string `json:"encrypt_alg,omitempty"`
+
+	// Erased - sorted ids of messages erased after archive (restore writes them as tombstones)
+	Erased []int64 `json:"erased,omitempty"`
+}
+
+// IsErased - message with id was erased after archive
+func (a *SimpleQueueArchive) IsErased(id int64) bool {
+	idx := sort.Search(len(a.Erased), func(i int) bool {
+		return a.Erased[i] >= id
+	})
+	return idx < len(a.Erased) && a.Erased[idx] == id
+}
+
+// setErased - appends id into Erased; returns false when id is already erased
+func (a *SimpleQueueArchive) setErased(id int64) bool {
+	idx := sort.Search(len(a.Erased), func(i int) bool {
+		return a.Erased[i] >= id
+	})
+	if idx < len(a.Erased) && a.Erased[idx] == id {
+		return false
+	}
+	a.Erased = append(a.Erased, 0)
+	copy(a.Erased[idx+1:], a.Erased[idx:])
+	a.Erased[idx] = id
+	return true
+}
+
+// InRange - archive contains messages with id in [fromID, toID]
+// toID = 0 - unlimited
+func (a *SimpleQueueArchive) InRange(fromID int64, toID int64) bool {
+	if a.LastID < fromID {
+		return false
+	}
+	if toID > 0 && a.FirstID > toID {
+		return false
+	}
+	return true
+}
+
+// ArchiveFunc - writes messages of block into archive
+type ArchiveFunc func(ctx context.Context, q *SimpleQueue, block *SimpleQueueBlock, messages []*MessageWithMeta) (archive *SimpleQueueArchive, err *mft.Error)
+
+// getItems - gets copy of all items from block
+func (block *SimpleQueueBlock) getItems(ctx context.Context, q *SimpleQueue) (messages []*MessageWithMeta, err *mft.Error) {
+	if !block.mx.RTryLock(ctx) {
+		return nil, GenerateError(10038000)
+	}
+
+	if block.IsUnload {
+		err = block.load(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		block.LastGet = time.Now()
+	}
+
+	messages = make([]*MessageWithMeta, 0, len(block.Data))
+	for _, msg := range block.Data {
+		messages = append(messages, msg.CopyWM())
+	}
+
+	block.mx.RUnlock()
+
+	return messages, nil
+}
+
+// setArchived - set block as archived and append archive into queue metadata
+func (block *SimpleQueueBlock) setArchived(ctx context.Context, q *SimpleQueue, archive *SimpleQueueArchive) (err *mft.Error) {
+	if !q.mx.TryLock(ctx) {
+		return GenerateError(10038001)
+	}
+	defer q.mx.Unlock()
+
+	if !block.mx.TryLock(ctx) {
+		return GenerateError(10038002)
+	}
+	defer block.mx.Unlock()
+
+	block.Archived = true
+	q.Archives = append(q.Archives, archive)
+
+	q.ChangesRv = q.nextID()
+	q.setBlockChanged(block)
+	q.setMetaChanged()
+
+	return nil
+}
+
+// SetArchive - find and archive blocks
+// it needs to save q (q.save(ctx)) after done
+// last (current for write), archived and deleted blocks are skipped
+// blocksCount = 0 - unlimited
+func (q *SimpleQueue) SetArchive(ctx context.Context, user cn.CapUser,
+	needArchive func(ctx context.Context, i int, len int, q *SimpleQueue, block *SimpleQueueBlock) (needArchive bool, err *mft.Error),
+	archiveFunc ArchiveFunc,
+	blocksCount int,
+) (archives []*SimpleQueueArchive, err *mft.Error) {
+	blocks := make([]*SimpleQueueBlock, 0)
+
+	if !q.mx.RTryLock(ctx) {
+		return nil, GenerateError(10038100)
+	}
+
+	for i := 0; i < len(q.Blocks)-1; i++ {
+		blocks = append(blocks, q.Blocks[i])
+	}
+
+	q.mx.RUnlock()
+
+	for i, block := range blocks {
+		if blocksCount > 0 && len(archives) >= blocksCount {
+			break
+		}
+
+		if block.Archived || block.NeedDelete {
+			continue
+		}
+
+		ok, err := needArchive(ctx, i, len(blocks), q, block)
+		if err != nil {
+			return archives, err
+		}
+		if !ok {
+			continue
+		}
+
+		messages, err := block.getItems(ctx, q)
+		if err != nil {
+			return archives, GenerateErrorE(10038101, err, block.ID)
+		}
+
+		archive, err := archiveFunc(ctx, q, block, messages)
+		if err != nil {
+			return archives, GenerateErrorE(10038102, err, block.ID)
+		}
+
+		err = block.setArchived(ctx, q, archive)
+		if err != nil {
+			return archives, GenerateErrorE(10038103, err, block.ID)
+		}
+
+		archives = append(archives, archive)
+	}
+
+	return archives, nil
+}
+
+// GetArchives - gets copy of archives with messages with id in [fromID, toID]
+// toID = 0 - unlimited
+func (q *SimpleQueue) GetArchives(ctx context.Context, user cn.CapUser, fromID int64, toID int64) (archives []*SimpleQueueArchive, err *mft.Error) {
+	if !q.mx.RTryLock(ctx) {
+		return nil, GenerateError(10038200)
+	}
+	defer q.mx.RUnlock()
+
+	for _, archive := range q.Archives {
+		if archive.InRange(fromID, toID) {
+			a := *archive
+			a.Erased = append([]int64(nil), archive.Erased...)
+			archives = append(archives, &a)
+		}
+	}
+
+	return archives, nil
+}
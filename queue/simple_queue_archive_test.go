@@ -0,0 +1,128 @@
+package queue
+
+import (
+	"context"
+	"testing"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/storage"
+	"github.com/myfantasy/mft"
+)
+
+func TestSimpleQueue_SetArchive(t *testing.T) {
+	stor := storage.CreateMapSorage()
+	q := CreateSimpleQueue(5, 0, 0, stor, nil, nil, nil)
+
+	ctx := context.Background()
+
+	ids := make([]int64, 0)
+
+	// Add msgs (3 blocks by 5 messages)
+	{
+		for i := 0; i < 15; i++ {
+			id, err := q.Add(ctx, nil, []byte("test text"), 0, 0, "", 0, cn.SaveMarkSaveMode)
+			if err != nil {
+				t.Error(err)
+			}
+			ids = append(ids, id)
+		}
+	}
+
+	// Not archived blocks are not deleted with WaitArchive
+	{
+		deleted, err := q.SetDeleteByRetention(ctx, nil, RetentionPolicy{MaxCount: 1, WaitArchive: true}, 0)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(deleted) != 0 {
+			t.Errorf("SimpleQueue.SetDeleteByRetention should wait archive but deleted %v blocks", len(deleted))
+		}
+	}
+
+	// Archive
+	{
+		archived := make(map[int64][]*MessageWithMeta)
+		archives, err := q.SetArchive(ctx, nil,
+			func(ctx context.Context, i, len int, q *SimpleQueue, block *SimpleQueueBlock) (needArchive bool, err *mft.Error) {
+				return i == 0, nil
+			},
+			func(ctx context.Context, q *SimpleQueue, block *SimpleQueueBlock, messages []*MessageWithMeta) (archive *SimpleQueueArchive, err *mft.Error) {
+				archived[block.ID] = messages
+				return &SimpleQueueArchive{
+					BlockID:  block.ID,
+					FirstID:  messages[0].ID,
+					LastID:   messages[len(messages)-1].ID,
+					Cnt:      len(messages),
+					FileName: "test",
+				}, nil
+			},
+			0,
+		)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(archives) != 1 || len(archived) != 1 {
+			t.Fatalf("SimpleQueue.SetArchive should archive 1 block not %v", len(archives))
+		}
+		if archives[0].FirstID != ids[0] || archives[0].LastID != ids[4] || archives[0].Cnt != 5 {
+			t.Errorf("SimpleQueue.SetArchive wrong archive %+v", archives[0])
+		}
+		if !q.Blocks[0].Archived || q.Blocks[1].Archived {
+			t.Errorf("SimpleQueue.SetArchive should set only first block as archived")
+		}
+	}
+
+	// Get archives
+	{
+		archives, err := q.GetArchives(ctx, nil, ids[3], ids[8])
+		if err != nil {
+			t.Error(err)
+		}
+		if len(archives) != 1 {
+			t.Errorf("SimpleQueue.GetArchives should return 1 archive not %v", len(archives))
+		}
+
+		archives, err = q.GetArchives(ctx, nil, ids[5], 0)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(archives) != 0 {
+			t.Errorf("SimpleQueue.GetArchives should return 0 archives not %v", len(archives))
+		}
+	}
+
+	// Archived blocks are deleted with WaitArchive
+	{
+		deleted, err := q.SetDeleteByRetention(ctx, nil, RetentionPolicy{MaxCount: 1, WaitArchive: true}, 0)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(deleted) != 1 {
+			t.Errorf("SimpleQueue.SetDeleteByRetention should delete 1 archived block not %v", len(deleted))
+		}
+	}
+
+	// Erase archived message
+	{
+		_, err := q.Erase(ctx, cn.CapUserName("auditor"), []int64{ids[2], ids[7]}, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		archives, err := q.GetArchives(ctx, nil, ids[0], ids[4])
+		if err != nil {
+			t.Error(err)
+		}
+		if len(archives) != 1 || len(archives[0].Erased) != 1 || !archives[0].IsErased(ids[2]) || archives[0].IsErased(ids[3]) {
+			t.Errorf("SimpleQueue.Erase should mark archived message as erased %+v", archives)
+		}
+
+		records, err := q.EraseAudit(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 1 || len(records[0].ArchivedIDs) != 1 || records[0].ArchivedIDs[0] != ids[2] {
+			t.Errorf("SimpleQueue.Erase should write archived ids into audit record")
+		}
+	}
+}
@@ -0,0 +1,408 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/myfantasy/mft"
+)
+
+// addRequest - message waiting for add into queue
+type addRequest struct {
+	message    []byte
+	externalID int64
+	externalDt int64
+	source     string
+	segment    int64
+	// save - block should be saved (saveMode != cn.NotSaveSaveMode)
+	save bool
+	// wait - wait for save of meta and block (cn.SaveWaitSaveMode)
+	wait bool
+
+	// ctx - context of caller; request is dropped when ctx is done before add
+	ctx context.Context
+	// state - addRequestWait, addRequestTaken, addRequestDropped
+	state int32
+
+	id          int64
+	err         *mft.Error
+	chWaitMeta  chan struct{}
+	chWaitBlock chan struct{}
+	done        chan struct{}
+}
+
+const (
+	// addRequestWait - request waits for add
+	addRequestWait int32 = iota
+	// addRequestTaken - request is taken for add (done is closed after add)
+	addRequestTaken
+	// addRequestDropped - request is dropped (context of caller is done before add); done is not closed
+	addRequestDropped
+)
+
+// AddCombineTimeout - timeout of add of collected requests (requests of different callers are added with own context)
+var AddCombineTimeout = time.Minute
+
+// addCombiner - combining appender
+// concurrent Add calls are collected and added into queue by one goroutine
+// with one lock of queue and one lock of block for all collected messages
+type addCombiner struct {
+	mx      sync.Mutex
+	running bool
+	pending []*addRequest
+}
+
+// add - add request and wait until request is processed or ctx is done
+// err == nil - request is processed (result is in req.id and req.err)
+// collected requests are added with own context with AddCombineTimeout (ctx of one caller does not cancel requests of others)
+func (c *addCombiner) add(ctx context.Context, q *SimpleQueue, req *addRequest) (err *mft.Error) {
+	req.ctx = ctx
+
+	c.mx.Lock()
+	c.pending = append(c.pending, req)
+	if !c.running {
+		c.running = true
+		go func() {
+			for c.next(q) {
+			}
+		}()
+	}
+	c.mx.Unlock()
+
+	select {
+	case <-req.done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	if atomic.CompareAndSwapInt32(&req.state, addRequestWait, addRequestDropped) ||
+		atomic.LoadInt32(&req.state) == addRequestDropped {
+		return GenerateError(10010011)
+	}
+	return GenerateError(10010012)
+}
+
+// next - process collected requests
+// requests with done context are dropped
+// returns true when there are requests collected while processing
+func (c *addCombiner) next(q *SimpleQueue) (more bool) {
+	c.mx.Lock()
+	pending := c.pending
+	c.pending = nil
+	if len(pending) == 0 {
+		c.running = false
+		c.mx.Unlock()
+		return false
+	}
+	c.mx.Unlock()
+
+	batch := make([]*addRequest, 0, len(pending))
+	for _, req := range pending {
+		if req.ctx.Err() != nil {
+			atomic.CompareAndSwapInt32(&req.state, addRequestWait, addRequestDropped)
+			continue
+		}
+		if atomic.CompareAndSwapInt32(&req.state, addRequestWait, addRequestTaken) {
+			batch = append(batch, req)
+		}
+	}
+
+	if len(batch) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), AddCombineTimeout)
+		q.addRequests(ctx, batch)
+		cancel()
+	}
+
+	c.mx.Lock()
+	more = len(c.pending) > 0
+	if !more {
+		c.running = false
+	}
+	c.mx.Unlock()
+
+	return more
+}
+
+// saveModeForAdd - checks saveMode and replaces it with queue default when needed
+func (q *SimpleQueue) saveModeForAdd(saveMode cn.SaveMode) (cn.SaveMode, *mft.Error) {
+	if q.UseDefaultSaveModeForce {
+		saveMode = q.DefaultSaveMode
+	} else if saveMode == cn.QueueSetDefaultMode {
+		saveMode = q.DefaultSaveMode
+	}
+
+	if saveMode != cn.NotSaveSaveMode &&
+		saveMode != cn.SaveImmediatelySaveMode &&
+		saveMode != cn.SaveMarkSaveMode &&
+		saveMode != cn.SaveWaitSaveMode {
+		return saveMode, GenerateError(10010010, saveMode)
+	}
+
+	return saveMode, nil
+}
+
+// newAddRequest - checks message and creates addRequest
+func (q *SimpleQueue) newAddRequest(message []byte,
+	externalID int64, externalDt int64, source string, segment int64,
+	saveMode cn.SaveMode) (req *addRequest, err *mft.Error) {
+	if externalDt > time.Now().Unix() {
+		return nil, GenerateError(10010008, externalDt, time.Now())
+	}
+
+	if !q.Segments.In(segment) {
+		return nil, GenerateError(10010009, segment)
+	}
+
+	return &addRequest{
+		message:    message,
+		externalID: externalID,
+		externalDt: externalDt,
+		source:     source,
+		segment:    segment,
+		save:       saveMode != cn.NotSaveSaveMode,
+		wait:       saveMode == cn.SaveWaitSaveMode,
+		done:       make(chan struct{}),
+	}, nil
+}
+
+// waitAdd - waits for save of added message by saveMode
+func (q *SimpleQueue) waitAdd(ctx context.Context, user cn.CapUser, req *addRequest, saveMode cn.SaveMode) (err *mft.Error) {
+	if saveMode == cn.SaveImmediatelySaveMode {
+		return q.commit(ctx)
+	}
+
+	if saveMode == cn.SaveWaitSaveMode {
+		if req.chWaitMeta != nil {
+			select {
+			case <-req.chWaitMeta:
+			case <-ctx.Done():
+				return GenerateError(10010005)
+			}
+		}
+
+		select {
+		case <-req.chWaitBlock:
+		case <-ctx.Done():
+			return GenerateError(10010006)
+		}
+	}
+
+	return nil
+}
+
+// waitBroadcast - returns channel that is closed after ch receive
+// one save wait channel is shared by all waiting messages of batch
+func waitBroadcast(ch chan bool) chan struct{} {
+	if ch == nil {
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		<-ch
+		close(done)
+	}()
+
+	return done
+}
+
+// addRequests - add messages into queue with one lock of queue and one lock of each block
+// result (id and err) is set into each request; done of each request is closed
+func (q *SimpleQueue) addRequests(ctx context.Context, batch []*addRequest) {
+	defer func() {
+		for _, req := range batch {
+			close(req.done)
+		}
+		q.notifyAppend()
+	}()
+
+	fail := func(reqs []*addRequest, err *mft.Error) {
+		for _, req := range reqs {
+			req.err = err
+		}
+	}
+
+	if !q.mx.RTryLock(ctx) {
+		fail(batch, GenerateError(10010000))
+		return
+	}
+
+	for pos := 0; pos < len(batch); {
+		rest := batch[pos:]
+
+		saveMode := cn.SaveMarkSaveMode
+		for _, req := range rest {
+			if req.wait {
+				saveMode = cn.SaveWaitSaveMode
+				break
+			}
+		}
+
+		block, chWaitSaveMeta, err := q.currentBlockForWrite(ctx, saveMode)
+		if err != nil {
+			fail(rest, err)
+			return
+		}
+
+		n, chWaitBlockSave, err := block.addRequests(ctx, rest, q.nextIDs, q.CntLimit, q.TimeLimit, q.LenLimit)
+
+		save := false
+		for _, req := range rest[:n] {
+			save = save || req.save
+		}
+		if save {
+			// mark block as need to save even if there are errors
+			q.mxBlockSaveWait.Lock()
+			if _, ok := q.SaveBlocks[block.ID]; !ok {
+				q.SaveBlocks[block.ID] = block
+			}
+			q.mxBlockSaveWait.Unlock()
+		}
+
+		if err != nil {
+			q.mx.RUnlock()
+			fail(rest, err)
+			return
+		}
+
+		metaDone := waitBroadcast(chWaitSaveMeta)
+		blockDone := waitBroadcast(chWaitBlockSave)
+		for _, req := range rest[:n] {
+			if req.wait {
+				req.chWaitMeta = metaDone
+				req.chWaitBlock = blockDone
+			}
+
+			if req.externalID != 0 {
+				source := req.source
+				if source == "" {
+					source = q.Source
+				}
+				q.SetMaxExtID(source, req.externalID)
+			}
+		}
+
+		pos += n
+	}
+
+	q.mx.RUnlock()
+}
+
+// addRequests - add messages into block while block is not full (at least one message)
+// ids for all added messages are got by one nextIDs call
+// returns count of added messages
+func (block *SimpleQueueBlock) addRequests(ctx context.Context, reqs []*addRequest,
+	nextIDs func(cnt int) []int64, cntLimit int, timeLimit time.Duration, lenLimit int,
+) (n int, chWait chan bool, err *mft.Error) {
+	if !block.mx.TryLock(ctx) {
+		return 0, nil, GenerateError(10010001)
+	}
+
+	if block.IsUnload {
+		block.mx.Unlock()
+		return 0, nil, GenerateError(10010007)
+	}
+
+	// count of messages that fit into block
+	timeOk := timeLimit <= 0 || time.Since(block.Dt) < timeLimit
+	cnt, ln := len(block.Data), block.Len
+	for _, req := range reqs {
+		if n > 0 && !(timeOk && (cntLimit <= 0 || cnt < cntLimit) && (lenLimit <= 0 || ln < lenLimit)) {
+			break
+		}
+		cnt++
+		ln += len(req.message)
+		n++
+	}
+
+	ids := nextIDs(n)
+	now := time.Now()
+
+	wait := false
+	for i, req := range reqs[:n] {
+		id := ids[i]
+
+		externalID := req.externalID
+		if externalID == 0 {
+			externalID = id
+		}
+
+		msg := &SimpleQueueMessage{
+			ID:         id,
+			ExternalID: externalID,
+			ExternalDt: req.externalDt,
+			Message:    req.message,
+			Source:     req.source,
+			Segment:    req.segment,
+			Dt:         now,
+		}
+
+		block.Data = append(block.Data, msg)
+		block.Len += len(req.message)
+		block.Cnt++
+		block.LastID = msg.ID
+		block.ChangesRv = msg.ID
+
+		req.id = id
+		wait = wait || req.wait
+	}
+	block.LastGet = now
+
+	if wait {
+		chWait = make(chan bool, 1)
+		block.SaveWait = append(block.SaveWait, chWait)
+	}
+
+	block.mx.Unlock()
+	return n, chWait, nil
+}
+
+// nextIDs - gets cnt increasing ids from IDGenerator under one lock of mxID
+// each id is got from IDGenerator by RvGetPart (range of ids can not be reserved: partition of id is kept)
+// id that is not greater than last id of queue is skipped
+func (q *SimpleQueue) nextIDs(cnt int) (ids []int64) {
+	ids = make([]int64, cnt)
+
+	q.mxID.Lock()
+	for i := range ids {
+		id := q.IDGenerator.RvGetPart()
+		for id <= q.lastGenID {
+			id = q.IDGenerator.RvGetPart()
+		}
+		ids[i] = id
+		q.lastGenID = id
+	}
+	q.mxID.Unlock()
+
+	return ids
+}
+
+// nextID - gets one id
+func (q *SimpleQueue) nextID() int64 {
+	return q.nextIDs(1)[0]
+}
+
+// AppendNotify - implements AppendNotifier
+func (q *SimpleQueue) AppendNotify() <-chan struct{} {
+	q.mxAppend.Lock()
+	defer q.mxAppend.Unlock()
+
+	if q.chAppend == nil {
+		q.chAppend = make(chan struct{})
+	}
+
+	return q.chAppend
+}
+
+// notifyAppend - wakes up waiters of AppendNotify
+func (q *SimpleQueue) notifyAppend() {
+	q.mxAppend.Lock()
+	if q.chAppend != nil {
+		close(q.chAppend)
+		q.chAppend = nil
+	}
+	q.mxAppend.Unlock()
+}
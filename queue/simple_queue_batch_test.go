@@ -0,0 +1,220 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/storage"
+	"github.com/myfantasy/mft"
+)
+
+func TestSimpleQueue_Add_Parallel(t *testing.T) {
+	stor := storage.CreateMapSorage()
+	q := CreateSimpleQueue(7, 0, 0, stor, nil, nil, nil)
+
+	ctx := context.Background()
+
+	producers := 16
+	cnt := 50
+
+	var mx sync.Mutex
+	ids := make(map[int64]struct{})
+
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < cnt; i++ {
+				saveMode := cn.SaveMarkSaveMode
+				if i%10 == 0 {
+					saveMode = cn.SaveWaitSaveMode
+				}
+				id, err := q.Add(ctx, nil, []byte("text"), 0, 0, "", 0, saveMode)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mx.Lock()
+				ids[id] = struct{}{}
+				mx.Unlock()
+			}
+		}(p)
+	}
+
+	// save for SaveWaitSaveMode
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			q.SaveAll(ctx, nil)
+		}
+	}()
+
+	wg.Wait()
+	close(stop)
+
+	if len(ids) != producers*cnt {
+		t.Fatalf("SimpleQueue.Add should return %v unique ids not %v", producers*cnt, len(ids))
+	}
+
+	msgs, err := q.Get(ctx, nil, 0, producers*cnt+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != producers*cnt {
+		t.Fatalf("SimpleQueue.Get should return %v messages not %v", producers*cnt, len(msgs))
+	}
+	for i, msg := range msgs {
+		if _, ok := ids[msg.ID]; !ok {
+			t.Fatalf("message %v: id %v is not returned by SimpleQueue.Add", i, msg.ID)
+		}
+		if i > 0 && msg.ID <= msgs[i-1].ID {
+			t.Fatalf("message %v: ids should increase", i)
+		}
+	}
+
+	for _, block := range q.Blocks[:len(q.Blocks)-1] {
+		if len(block.Data) > 7 {
+			t.Errorf("block %v should contain not more than 7 messages not %v", block.ID, len(block.Data))
+		}
+	}
+}
+
+func TestSimpleQueue_AddList_Blocks(t *testing.T) {
+	stor := storage.CreateMapSorage()
+	q := CreateSimpleQueue(3, 0, 0, stor, nil, nil, nil)
+
+	ctx := context.Background()
+
+	list := make([]Message, 10)
+	for i := range list {
+		list[i] = Message{Message: []byte("text")}
+	}
+
+	ids, err := q.AddList(ctx, nil, list, cn.SaveImmediatelySaveMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != len(list) {
+		t.Fatalf("SimpleQueue.AddList should return %v ids not %v", len(list), len(ids))
+	}
+	for i := 1; i < len(ids); i++ {
+		if ids[i] <= ids[i-1] {
+			t.Fatalf("SimpleQueue.AddList ids should increase")
+		}
+	}
+
+	if len(q.Blocks) != 4 {
+		t.Errorf("SimpleQueue.AddList should create 4 blocks not %v", len(q.Blocks))
+	}
+}
+
+func TestSimpleQueue_AppendNotify(t *testing.T) {
+	stor := storage.CreateMapSorage()
+	q := CreateSimpleQueue(3, 0, 0, stor, nil, nil, nil)
+
+	ctx := context.Background()
+
+	notify := q.AppendNotify()
+	select {
+	case <-notify:
+		t.Fatalf("SimpleQueue.AppendNotify should not be closed before add")
+	default:
+	}
+
+	_, err := q.Add(ctx, nil, []byte("text"), 0, 0, "", 0, cn.SaveMarkSaveMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-notify:
+	case <-time.After(time.Second):
+		t.Fatalf("SimpleQueue.AppendNotify should be closed after add")
+	}
+
+	if q.AppendNotify() == notify {
+		t.Errorf("SimpleQueue.AppendNotify should return new channel after add")
+	}
+}
+
+func TestSimpleQueue_AddList_IDPartition(t *testing.T) {
+	stor := storage.CreateMapSorage()
+	q := CreateSimpleQueue(3, 0, 0, stor, nil, nil, &mft.G{AddValue: 120})
+
+	ctx := context.Background()
+
+	list := make([]Message, 50)
+	for i := range list {
+		list[i] = Message{Message: []byte("text")}
+	}
+
+	ids, err := q.AddList(ctx, nil, list, cn.SaveMarkSaveMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, id := range ids {
+		if id%10000 < 120 || id%10000 > 130 {
+			t.Fatalf("SimpleQueue.AddList id %v should be in partition of IDGenerator", id)
+		}
+		if i > 0 && id <= ids[i-1] {
+			t.Fatalf("SimpleQueue.AddList ids should increase")
+		}
+	}
+	for _, block := range q.Blocks {
+		if block.ID%10000 < 120 || block.ID%10000 > 130 {
+			t.Errorf("block id %v should be in partition of IDGenerator", block.ID)
+		}
+	}
+}
+
+func TestSimpleQueue_addCombiner_ctx(t *testing.T) {
+	stor := storage.CreateMapSorage()
+	q := CreateSimpleQueue(3, 0, 0, stor, nil, nil, nil)
+
+	// request with done context is dropped
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := q.Add(ctx, nil, []byte("text"), 0, 0, "", 0, cn.SaveMarkSaveMode)
+	if err == nil || err.Code != 10010011 {
+		t.Fatalf("SimpleQueue.Add with done context should fail with 10010011 not %v", err)
+	}
+
+	// context of caller does not cancel add of collected requests
+	// caller does not wait add after context is done
+	q.mx.Lock()
+	ctxTimeout, cancelTimeout := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelTimeout()
+
+	start := time.Now()
+	_, err = q.Add(ctxTimeout, nil, []byte("text"), 0, 0, "", 0, cn.SaveMarkSaveMode)
+	if time.Since(start) > time.Second {
+		t.Errorf("SimpleQueue.Add should not wait after context is done: %v", time.Since(start))
+	}
+	if err == nil || err.Code != 10010012 {
+		t.Errorf("SimpleQueue.Add with context done while add should fail with 10010012 not %v", err)
+	}
+	q.mx.Unlock()
+
+	id, err := q.Add(context.Background(), nil, []byte("text2"), 0, 0, "", 0, cn.SaveMarkSaveMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, err := q.Get(context.Background(), nil, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || string(msgs[0].Message) != "text" || msgs[1].ID != id {
+		t.Errorf("SimpleQueue should contain taken message and next message not %v messages", len(msgs))
+	}
+}
@@ -2,6 +2,7 @@ package queue
 
 import (
 	"context"
+	"strconv"
 	"testing"
 
 	"github.com/capella-pw/queue/cn"
@@ -111,3 +112,48 @@ func BenchmarkSimpleQueue_SaveMarkSaveMode_and_Save_5_lage(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkSimpleQueue_Add_Parallel(b *testing.B) {
+	for _, producers := range []int{1, 4, 16, 64} {
+		b.Run(strconv.Itoa(producers), func(b *testing.B) {
+			ctx := context.Background()
+			stor := storage.CreateMapSorage()
+			q := CreateSimpleQueue(10000, 0, 0, stor, nil, nil, nil)
+
+			b.SetParallelism(producers)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					_, err := q.Add(ctx, nil, []byte("test  text"), 0, 0, "", 0, cn.SaveMarkSaveMode)
+					if err != nil {
+						b.Error(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkSimpleQueue_AddList_Parallel(b *testing.B) {
+	for _, producers := range []int{1, 4, 16, 64} {
+		b.Run(strconv.Itoa(producers), func(b *testing.B) {
+			ctx := context.Background()
+			stor := storage.CreateMapSorage()
+			q := CreateSimpleQueue(10000, 0, 0, stor, nil, nil, nil)
+
+			msgs := make([]Message, 10)
+			for i := range msgs {
+				msgs[i] = Message{Message: []byte("test  text")}
+			}
+
+			b.SetParallelism(producers)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					_, err := q.AddList(ctx, nil, msgs, cn.SaveMarkSaveMode)
+					if err != nil {
+						b.Error(err)
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package queue
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"time"
+)
+
+// Block file formats
+// file name of block is the same for all formats, format is detected by file header
+const (
+	// BlockFormatJSON - json array of messages (default)
+	BlockFormatJSON = ""
+	// BlockFormatBinary - versioned length-prefixed binary format with CRC and offset table
+	BlockFormatBinary = "bin"
+)
+
+// Binary block format (all numbers are little endian)
+//
+//	header:
+//	  magic      [4]byte "CQBL"
+//	  version    uint16
+//	  flags      uint16 (reserved)
+//	  count      uint32 - count of messages
+//	  dataLen    uint64 - length of data section
+//	offsets:     [count]uint64 - offset of message record from start of data section
+//	data:        message records
+//	  id         int64
+//	  externalID int64
+//	  externalDt int64
+//	  dt         int64 (unix nano)
+//	  segment    int64
+//	  flags      uint8 (1 - tombstone)
+//	  sourceLen  uint32
+//	  source     [sourceLen]byte
+//	  messageLen uint32
+//	  message    [messageLen]byte
+//	crc          uint32 - crc32 (IEEE) of all previous bytes
+const (
+	blockBinaryMagic      = "CQBL"
+	blockBinaryVersion    = 1
+	blockBinaryHeaderLen  = 4 + 2 + 2 + 4 + 8
+	blockBinaryRecordLen  = 8*5 + 1 + 4 + 4
+	blockBinaryCrcLen     = 4
+	blockBinaryTombstone  = 1
+	blockBinaryNilMessage = 2
+)
+
+// IsBlockFormatAllowed - format is known
+func IsBlockFormatAllowed(format string) bool {
+	return format == BlockFormatJSON || format == BlockFormatBinary
+}
+
+// marshalBlockData - marshal messages of block in format
+func marshalBlockData(format string, data []*SimpleQueueMessage) (body []byte, err error) {
+	if format == BlockFormatBinary {
+		return marshalBlockDataBinary(data), nil
+	}
+
+	return json.MarshalIndent(data, "", "\t")
+}
+
+// unmarshalBlockData - unmarshal messages of block (format is detected by header)
+func unmarshalBlockData(body []byte) (data []*SimpleQueueMessage, format string, err error) {
+	if len(body) >= len(blockBinaryMagic) && string(body[:len(blockBinaryMagic)]) == blockBinaryMagic {
+		data, err = unmarshalBlockDataBinary(body)
+		return data, BlockFormatBinary, err
+	}
+
+	data = make([]*SimpleQueueMessage, 0)
+	err = json.Unmarshal(body, &data)
+
+	return data, BlockFormatJSON, err
+}
+
+func marshalBlockDataBinary(data []*SimpleQueueMessage) []byte {
+	dataLen := 0
+	for _, msg := range data {
+		dataLen += blockBinaryRecordLen + len(msg.Source) + len(msg.Message)
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, blockBinaryHeaderLen+8*len(data)+dataLen+blockBinaryCrcLen))
+	le := binary.LittleEndian
+	var b8 [8]byte
+
+	buf.WriteString(blockBinaryMagic)
+	le.PutUint16(b8[:2], blockBinaryVersion)
+	buf.Write(b8[:2])
+	le.PutUint16(b8[:2], 0)
+	buf.Write(b8[:2])
+	le.PutUint32(b8[:4], uint32(len(data)))
+	buf.Write(b8[:4])
+	le.PutUint64(b8[:], uint64(dataLen))
+	buf.Write(b8[:])
+
+	offset := 0
+	for _, msg := range data {
+		le.PutUint64(b8[:], uint64(offset))
+		buf.Write(b8[:])
+		offset += blockBinaryRecordLen + len(msg.Source) + len(msg.Message)
+	}
+
+	for _, msg := range data {
+		for _, v := range []int64{msg.ID, msg.ExternalID, msg.ExternalDt, msg.Dt.UnixNano(), msg.Segment} {
+			le.PutUint64(b8[:], uint64(v))
+			buf.Write(b8[:])
+		}
+
+		var flags byte
+		if msg.Tombstone {
+			flags |= blockBinaryTombstone
+		}
+		if msg.Message == nil {
+			flags |= blockBinaryNilMessage
+		}
+		buf.WriteByte(flags)
+
+		le.PutUint32(b8[:4], uint32(len(msg.Source)))
+		buf.Write(b8[:4])
+		buf.WriteString(msg.Source)
+
+		le.PutUint32(b8[:4], uint32(len(msg.Message)))
+		buf.Write(b8[:4])
+		buf.Write(msg.Message)
+	}
+
+	le.PutUint32(b8[:4], crc32.ChecksumIEEE(buf.Bytes()))
+	buf.Write(b8[:4])
+
+	return buf.Bytes()
+}
+
+func unmarshalBlockDataBinary(body []byte) (data []*SimpleQueueMessage, err error) {
+	le := binary.LittleEndian
+
+	if len(body) < blockBinaryHeaderLen+blockBinaryCrcLen {
+		return nil, GenerateError(10039000, len(body))
+	}
+
+	crc := le.Uint32(body[len(body)-blockBinaryCrcLen:])
+	content := body[:len(body)-blockBinaryCrcLen]
+	if crc32.ChecksumIEEE(content) != crc {
+		return nil, GenerateError(10039001)
+	}
+
+	version := le.Uint16(content[4:6])
+	if version != blockBinaryVersion {
+		return nil, GenerateError(10039002, version)
+	}
+
+	count := int(le.Uint32(content[8:12]))
+	dataLen := le.Uint64(content[12:20])
+
+	offsetsStart := blockBinaryHeaderLen
+	dataStart := offsetsStart + 8*count
+	if dataStart < offsetsStart || uint64(len(content)) != uint64(dataStart)+dataLen {
+		return nil, GenerateError(10039003, count, dataLen, len(content))
+	}
+	section := content[dataStart:]
+
+	data = make([]*SimpleQueueMessage, 0, count)
+	for i := 0; i < count; i++ {
+		offset := le.Uint64(content[offsetsStart+8*i:])
+		if offset+blockBinaryRecordLen > dataLen {
+			return nil, GenerateError(10039004, i, offset)
+		}
+		rec := section[offset:]
+
+		msg := &SimpleQueueMessage{
+			ID:         int64(le.Uint64(rec[0:8])),
+			ExternalID: int64(le.Uint64(rec[8:16])),
+			ExternalDt: int64(le.Uint64(rec[16:24])),
+			Dt:         time.Unix(0, int64(le.Uint64(rec[24:32]))),
+			Segment:    int64(le.Uint64(rec[32:40])),
+		}
+		flags := rec[40]
+		msg.Tombstone = flags&blockBinaryTombstone != 0
+
+		pos := uint64(41)
+		sourceLen := uint64(le.Uint32(rec[pos:]))
+		pos += 4
+		if offset+pos+sourceLen+4 > dataLen {
+			return nil, GenerateError(10039004, i, offset)
+		}
+		msg.Source = string(rec[pos : pos+sourceLen])
+		pos += sourceLen
+
+		messageLen := uint64(le.Uint32(rec[pos:]))
+		pos += 4
+		if offset+pos+messageLen > dataLen {
+			return nil, GenerateError(10039004, i, offset)
+		}
+		if flags&blockBinaryNilMessage == 0 {
+			msg.Message = make([]byte, messageLen)
+			copy(msg.Message, rec[pos:pos+messageLen])
+		}
+
+		data = append(data, msg)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,153 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/storage"
+	"github.com/myfantasy/mft"
+)
+
+func TestBlockFormatBinary_MarshalUnmarshal(t *testing.T) {
+	dt := time.Now()
+	data := []*SimpleQueueMessage{
+		{ID: 10, ExternalID: 5, ExternalDt: 7, Dt: dt, Source: "src", Segment: 3, Message: []byte("hello")},
+		{ID: 11, Dt: dt, Message: []byte{}},
+		{ID: 12, Dt: dt, Tombstone: true},
+	}
+
+	body, err := marshalBlockData(BlockFormatBinary, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, format, err := unmarshalBlockData(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != BlockFormatBinary {
+		t.Errorf("unmarshalBlockData should detect binary format not `%v`", format)
+	}
+	if len(res) != len(data) {
+		t.Fatalf("unmarshalBlockData should return %v messages not %v", len(data), len(res))
+	}
+	for i, msg := range data {
+		r := res[i]
+		if r.ID != msg.ID || r.ExternalID != msg.ExternalID || r.ExternalDt != msg.ExternalDt ||
+			!r.Dt.Equal(msg.Dt) || r.Source != msg.Source || r.Segment != msg.Segment ||
+			r.Tombstone != msg.Tombstone || !bytes.Equal(r.Message, msg.Message) ||
+			(r.Message == nil) != (msg.Message == nil) {
+			t.Errorf("unmarshalBlockData message %v is different %+v != %+v", i, r, msg)
+		}
+	}
+
+	// corruption
+	{
+		broken := make([]byte, len(body))
+		copy(broken, body)
+		broken[blockBinaryHeaderLen+10] ^= 0xff
+
+		_, _, err = unmarshalBlockData(broken)
+		if e, ok := err.(*mft.Error); !ok || e.Code != 10039001 {
+			t.Errorf("unmarshalBlockData should fail on crc check: %v", err)
+		}
+
+		_, _, err = unmarshalBlockData(body[:len(body)-1])
+		if err == nil {
+			t.Errorf("unmarshalBlockData should fail on truncated body")
+		}
+	}
+
+	// json
+	{
+		body, err := marshalBlockData(BlockFormatJSON, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, format, err := unmarshalBlockData(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if format != BlockFormatJSON || len(res) != len(data) {
+			t.Errorf("unmarshalBlockData should load json format")
+		}
+	}
+}
+
+func TestSimpleQueue_BlockFormatMigration(t *testing.T) {
+	stor := storage.CreateMapSorage()
+	q := CreateSimpleQueue(5, 0, 0, stor, nil, nil, nil)
+
+	ctx := context.Background()
+
+	ids := make([]int64, 0)
+	for i := 0; i < 7; i++ {
+		id, err := q.Add(ctx, nil, []byte("text"), 0, 0, "", 0, cn.SaveImmediatelySaveMode)
+		if err != nil {
+			t.Error(err)
+		}
+		ids = append(ids, id)
+	}
+
+	fileName := q.Blocks[0].blockFileName()
+
+	body, err := stor.Get(ctx, fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.HasPrefix(body, []byte(blockBinaryMagic)) {
+		t.Fatalf("SimpleQueue should save blocks in json by default")
+	}
+
+	// switch format and reload
+	q.BlockFormat = BlockFormatBinary
+
+	_, err = q.Blocks[0].Unload(ctx, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, err := q.Get(ctx, nil, 0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 3 || msgs[0].ID != ids[0] {
+		t.Fatalf("SimpleQueue.Get should load json block")
+	}
+	for _, msg := range msgs {
+		if !msg.IsSaved {
+			t.Errorf("SimpleQueue.Get should keep saved messages of not migrated block as saved")
+		}
+	}
+
+	err = q.SaveAll(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err = stor.Get(ctx, fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(body, []byte(blockBinaryMagic)) {
+		t.Fatalf("SimpleQueue should rewrite loaded block in binary format")
+	}
+
+	// load binary block
+	_, err = q.Blocks[0].Unload(ctx, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, err = q.Get(ctx, nil, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 7 || msgs[4].ID != ids[4] || string(msgs[4].Message) != "text" {
+		t.Fatalf("SimpleQueue.Get should load binary block")
+	}
+}
@@ -0,0 +1,102 @@
+package queue
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/myfantasy/mft"
+)
+
+// getItemByID gets item from block where id == msgID
+// returns msg == nil when not found
+func (block *SimpleQueueBlock) getItemByID(ctx context.Context,
+	q *SimpleQueue, msgID int64, queueSaveRv int64,
+) (msg *MessageWithMeta, err *mft.Error) {
+	if !block.mx.RTryLock(ctx) {
+		return nil, GenerateError(10035000)
+	}
+
+	if block.IsUnload {
+		err = block.load(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		block.LastGet = time.Now()
+	}
+
+	idx := sort.Search(len(block.Data), func(i int) bool {
+		return block.Data[i].ID >= msgID
+	})
+
+	if idx < len(block.Data) && block.Data[idx].ID == msgID {
+		msg = block.Data[idx].CopyWM()
+		msg.IsSaved = block.ID <= queueSaveRv && msg.ID <= block.SaveRv
+	}
+
+	block.mx.RUnlock()
+
+	return msg, nil
+}
+
+// GetByIDs - gets messages from queue by ids
+// not found messages are skipped; order of result is the same as ids
+// returns messages == nil when no elements
+func (q *SimpleQueue) GetByIDs(ctx context.Context, user cn.CapUser, ids []int64) (messages []*MessageWithMeta, err *mft.Error) {
+	for _, msgID := range ids {
+		if msgID <= 0 {
+			continue
+		}
+
+		if !q.mx.RTryLock(ctx) {
+			return messages, GenerateError(10035001)
+		}
+
+		blocks, err := q.getBlockForNext(ctx, msgID-1)
+		queueSaveRv := q.SaveRv
+		q.mx.RUnlock()
+
+		if err != nil {
+			return messages, err
+		}
+
+		if len(blocks) == 0 {
+			continue
+		}
+
+		msg, err := blocks[0].getItemByID(ctx, q, msgID, queueSaveRv)
+		if err != nil {
+			return messages, err
+		}
+
+		if msg != nil {
+			messages = append(messages, msg)
+		}
+	}
+
+	return messages, nil
+}
+
+// GetByExternalID - gets last message from queue with source and external id
+// returns exists == false when message not found
+func (q *SimpleQueue) GetByExternalID(ctx context.Context, user cn.CapUser, source string, extID int64) (message *MessageWithMeta, exists bool, err *mft.Error) {
+	id, ok, err := q.searchExtID(ctx, source, extID, 0)
+	if err != nil {
+		return nil, false, GenerateErrorE(10035100, err, source, extID)
+	}
+	if !ok {
+		return nil, false, nil
+	}
+
+	messages, err := q.GetByIDs(ctx, user, []int64{id})
+	if err != nil {
+		return nil, false, GenerateErrorE(10035101, err, id)
+	}
+	if len(messages) == 0 {
+		return nil, false, nil
+	}
+
+	return messages[0], true, nil
+}
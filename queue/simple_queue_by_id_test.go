@@ -0,0 +1,68 @@
+package queue
+
+import (
+	"context"
+	"testing"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/storage"
+)
+
+func TestSimpleQueue_GetByIDs_and_GetByExternalID(t *testing.T) {
+	stor := storage.CreateMapSorage()
+	q := CreateSimpleQueue(5, 0, 0, stor, nil, nil, nil)
+
+	ctx := context.Background()
+
+	ids := make([]int64, 0)
+
+	// Add msgs
+	{
+		for i := 0; i < 20; i++ {
+			id, err := q.AddUnique(ctx, nil, []byte("test text"), int64(i)+100, 0, "src", 0, cn.SaveMarkSaveMode)
+			if err != nil {
+				t.Error(err)
+			}
+			ids = append(ids, id)
+		}
+	}
+
+	// Get by ids
+	{
+		msgs, err := q.GetByIDs(ctx, nil, []int64{ids[17], ids[2], ids[len(ids)-1] + 1, ids[5]})
+		if err != nil {
+			t.Error(err)
+		}
+		if len(msgs) != 3 {
+			t.Fatalf("SimpleQueue.GetByIDs should return 3 messages not %v", len(msgs))
+		}
+		if msgs[0].ID != ids[17] || msgs[1].ID != ids[2] || msgs[2].ID != ids[5] {
+			t.Errorf("SimpleQueue.GetByIDs wrong order or ids")
+		}
+		if msgs[0].ExternalID != 117 {
+			t.Errorf("SimpleQueue.GetByIDs external id should be 117 not %v", msgs[0].ExternalID)
+		}
+	}
+
+	// Get by external id
+	{
+		msg, ok, err := q.GetByExternalID(ctx, nil, "src", 103)
+		if err != nil {
+			t.Error(err)
+		}
+		if !ok {
+			t.Fatalf("SimpleQueue.GetByExternalID should find message")
+		}
+		if msg.ID != ids[3] {
+			t.Errorf("SimpleQueue.GetByExternalID id should be %v not %v", ids[3], msg.ID)
+		}
+
+		_, ok, err = q.GetByExternalID(ctx, nil, "src_other", 103)
+		if err != nil {
+			t.Error(err)
+		}
+		if ok {
+			t.Errorf("SimpleQueue.GetByExternalID should not find message with other source")
+		}
+	}
+}
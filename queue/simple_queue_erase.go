@@ -0,0 +1,341 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/storage"
+	"github.com/myfantasy/mft"
+)
+
+// EraseAuditFileName - file name with erase audit records (json line for each erase call, file is only appended)
+const EraseAuditFileName = "erase_audit.log"
+
+// eraseLoadTryCount - count of tries load block before erase
+const eraseLoadTryCount = 3
+
+// EraseAuditRecord - info about one erase call
+type EraseAuditRecord struct {
+	Dt       time.Time          `json:"dt"`
+	UserName string             `json:"user"`
+	Reason   string             `json:"reason,omitempty"`
+	Messages []*MessageOnlyMeta `json:"msgs"`
+	// ArchivedIDs - ids of messages in archives that are marked as erased
+	ArchivedIDs []int64 `json:"archived_ids,omitempty"`
+}
+
+// lockForErase - loads block and locks block.mxFileSave and block.mx
+// case err==nil block.mxFileSave and block.mx are locked
+func (block *SimpleQueueBlock) lockForErase(ctx context.Context, q *SimpleQueue) (err *mft.Error) {
+	for i := 0; i < eraseLoadTryCount; i++ {
+		if !block.mx.RTryLock(ctx) {
+			return GenerateError(10036000)
+		}
+		if block.IsUnload {
+			err = block.load(ctx, q)
+			if err != nil {
+				return err
+			}
+		}
+		block.mx.RUnlock()
+
+		if !block.mxFileSave.TryLock(ctx) {
+			return GenerateError(10036001)
+		}
+		if !block.mx.TryLock(ctx) {
+			block.mxFileSave.Unlock()
+			return GenerateError(10036002)
+		}
+
+		if !block.IsUnload {
+			return nil
+		}
+
+		// block was unloaded between load and lock
+		block.mx.Unlock()
+		block.mxFileSave.Unlock()
+	}
+
+	return GenerateError(10036003, block.ID)
+}
+
+// erase - set tombstone for messages with ids and rewrite block files in all storages that hold it
+func (block *SimpleQueueBlock) erase(ctx context.Context, q *SimpleQueue, ids []int64) (erased []*MessageOnlyMeta, err *mft.Error) {
+	err = block.lockForErase(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer block.mxFileSave.Unlock()
+
+	for _, msgID := range ids {
+		idx := sort.Search(len(block.Data), func(i int) bool {
+			return block.Data[i].ID >= msgID
+		})
+
+		if idx >= len(block.Data) || block.Data[idx].ID != msgID || block.Data[idx].Tombstone {
+			continue
+		}
+
+		msg := block.Data[idx]
+		block.Len -= len(msg.Message)
+		msg.Message = nil
+		msg.Tombstone = true
+
+		erased = append(erased, msg.CopyWM().CopyOM())
+	}
+
+	if len(erased) == 0 || q.MetaStorage == nil {
+		block.mx.Unlock()
+		return erased, nil
+	}
+
+	data, errMarshal := marshalBlockData(q.BlockFormat, block.Data)
+	marks := append([]string{block.Mark, block.NextMark}, block.RemoveMarks...)
+	// block file will contain all messages so segment file is removed
+	// messages appended later with id <= last id of block file are skipped on load
+	appending := block.Appending
+	block.mx.Unlock()
+
+	if errMarshal != nil {
+		return erased, GenerateErrorE(10036004, errMarshal)
+	}
+
+	fileName := block.blockFileName()
+
+	saved := make(map[string]struct{})
+	for i, mark := range marks {
+		if _, ok := saved[mark]; ok {
+			continue
+		}
+		saved[mark] = struct{}{}
+
+		st, err := q.getStorageLock(ctx, mark)
+		if err != nil {
+			return erased, err
+		}
+
+		// storage of current mark always contains actual data
+		if i > 0 {
+			ok, err := st.Exists(ctx, fileName)
+			if err != nil {
+				return erased, GenerateErrorE(10036005, err, fileName, mark)
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		err = st.Save(ctx, fileName, data)
+		if err != nil {
+			return erased, GenerateErrorE(10036006, err, fileName, mark)
+		}
+
+		if appending {
+			segmentFileName := block.segmentFileName()
+			err = storage.DeleteIfExists(ctx, st, segmentFileName)
+			if err != nil {
+				return erased, GenerateErrorE(10036006, err, segmentFileName, mark)
+			}
+		}
+	}
+
+	return erased, nil
+}
+
+// writeEraseAudit - appends audit record (json line) into EraseAuditFileName
+// When MetaStorage == nil do nothing
+// When MetaStorage does not support append file is read and saved with new line
+func (q *SimpleQueue) writeEraseAudit(ctx context.Context, record EraseAuditRecord) (err *mft.Error) {
+	if q.MetaStorage == nil {
+		return nil
+	}
+
+	line, er0 := json.Marshal(record)
+	if er0 != nil {
+		return GenerateErrorE(10036103, er0)
+	}
+	line = append(line, '\n')
+
+	if !q.mxErase.TryLock(ctx) {
+		return GenerateError(10036100)
+	}
+	defer q.mxErase.Unlock()
+
+	appender, canAppend := storage.GetAppender(q.MetaStorage)
+	if canAppend {
+		err = appender.Append(ctx, EraseAuditFileName, line)
+		if err != nil {
+			return GenerateErrorE(10036104, err, EraseAuditFileName)
+		}
+		return nil
+	}
+
+	var body []byte
+	ok, err := q.MetaStorage.Exists(ctx, EraseAuditFileName)
+	if err != nil {
+		return GenerateErrorE(10036101, err, EraseAuditFileName)
+	}
+	if ok {
+		body, err = q.MetaStorage.Get(ctx, EraseAuditFileName)
+		if err != nil {
+			return GenerateErrorE(10036101, err, EraseAuditFileName)
+		}
+	}
+
+	err = q.MetaStorage.Save(ctx, EraseAuditFileName, append(body, line...))
+	if err != nil {
+		return GenerateErrorE(10036104, err, EraseAuditFileName)
+	}
+
+	return nil
+}
+
+// EraseAudit - reads audit records from EraseAuditFileName
+// not complete last line (write was interrupted) is skipped
+func (q *SimpleQueue) EraseAudit(ctx context.Context) (records []EraseAuditRecord, err *mft.Error) {
+	if q.MetaStorage == nil {
+		return nil, nil
+	}
+
+	ok, err := q.MetaStorage.Exists(ctx, EraseAuditFileName)
+	if err != nil {
+		return nil, GenerateErrorE(10036101, err, EraseAuditFileName)
+	}
+	if !ok {
+		return nil, nil
+	}
+	body, err := q.MetaStorage.Get(ctx, EraseAuditFileName)
+	if err != nil {
+		return nil, GenerateErrorE(10036101, err, EraseAuditFileName)
+	}
+
+	lines := bytes.Split(body, []byte{'\n'})
+	for i, line := range lines {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var record EraseAuditRecord
+		er0 := json.Unmarshal(line, &record)
+		if er0 != nil {
+			if i == len(lines)-1 {
+				break
+			}
+			return records, GenerateErrorE(10036102, er0, EraseAuditFileName)
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// eraseArchived - marks ids as erased in archives that contain them
+// archive files are not changed, erased messages are written as tombstones on restore
+func (q *SimpleQueue) eraseArchived(ctx context.Context, ids []int64) (archivedIDs []int64, err *mft.Error) {
+	if !q.mx.TryLock(ctx) {
+		return nil, GenerateError(10036204)
+	}
+	defer q.mx.Unlock()
+
+	for _, msgID := range ids {
+		if msgID <= 0 {
+			continue
+		}
+		for _, archive := range q.Archives {
+			if archive.InRange(msgID, msgID) && archive.setErased(msgID) {
+				archivedIDs = append(archivedIDs, msgID)
+			}
+		}
+	}
+
+	if len(archivedIDs) > 0 {
+		q.ChangesRv = q.nextID()
+		q.setMetaChanged()
+	}
+
+	return archivedIDs, nil
+}
+
+// Erase - erase messages with ids (message body is removed, message is marked as tombstone)
+// ID and order of messages is not changed
+// block files are rewritten in all storages that hold it
+// ids of archived messages are stored in archive metadata (SimpleQueueArchive.Erased) and queue metadata is saved
+// audit record is written into EraseAuditFileName
+// user is checked by EraseCheck before erase
+func (q *SimpleQueue) Erase(ctx context.Context, user cn.CapUser, ids []int64, reason string) (erased []*MessageOnlyMeta, err *mft.Error) {
+	if q.EraseCheck != nil {
+		err = q.EraseCheck(ctx, user)
+		if err != nil {
+			return nil, GenerateErrorE(10036206, err)
+		}
+	}
+
+	blockIDs := make(map[*SimpleQueueBlock][]int64)
+	blocks := make([]*SimpleQueueBlock, 0)
+
+	for _, msgID := range ids {
+		if msgID <= 0 {
+			continue
+		}
+
+		if !q.mx.RTryLock(ctx) {
+			return nil, GenerateError(10036200)
+		}
+
+		bl, err := q.getBlockForNext(ctx, msgID-1)
+		q.mx.RUnlock()
+
+		if err != nil {
+			return nil, GenerateErrorE(10036201, err, msgID)
+		}
+
+		if len(bl) == 0 {
+			continue
+		}
+
+		if _, ok := blockIDs[bl[0]]; !ok {
+			blocks = append(blocks, bl[0])
+		}
+		blockIDs[bl[0]] = append(blockIDs[bl[0]], msgID)
+	}
+
+	record := EraseAuditRecord{
+		Dt:     time.Now(),
+		Reason: reason,
+	}
+	if user != nil {
+		record.UserName = user.GetName()
+	}
+
+	for _, block := range blocks {
+		msgs, errErase := block.erase(ctx, q, blockIDs[block])
+		erased = append(erased, msgs...)
+		if errErase != nil {
+			err = GenerateErrorE(10036202, errErase, block.ID)
+			break
+		}
+	}
+
+	if err == nil {
+		record.ArchivedIDs, err = q.eraseArchived(ctx, ids)
+		if err == nil && len(record.ArchivedIDs) > 0 {
+			err = q.Save(ctx, user)
+		}
+		if err != nil {
+			err = GenerateErrorE(10036205, err)
+		}
+	}
+
+	if len(erased) > 0 || len(record.ArchivedIDs) > 0 {
+		record.Messages = erased
+		errAudit := q.writeEraseAudit(ctx, record)
+		if errAudit != nil && err == nil {
+			err = GenerateErrorE(10036203, errAudit)
+		}
+	}
+
+	return erased, err
+}
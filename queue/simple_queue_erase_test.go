@@ -0,0 +1,163 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/storage"
+	"github.com/myfantasy/mft"
+)
+
+func TestSimpleQueue_Erase(t *testing.T) {
+	stor := storage.CreateMapSorage()
+	storA := storage.CreateMapSorage()
+	q := CreateSimpleQueue(5, 0, 0, stor, nil, map[string]storage.Storage{"a": storA}, nil)
+
+	ctx := context.Background()
+
+	ids := make([]int64, 0)
+
+	// Add msgs
+	{
+		for i := 0; i < 12; i++ {
+			id, err := q.Add(ctx, nil, []byte("secret text"), 0, 0, "", 0, cn.SaveImmediatelySaveMode)
+			if err != nil {
+				t.Error(err)
+			}
+			ids = append(ids, id)
+		}
+	}
+
+	// move first block into storage "a" without clear old storage
+	{
+		block := q.Blocks[0]
+		block.NextMark = "a"
+		err := block.moveToNewStorage(ctx, q)
+		if err != nil {
+			t.Error(err)
+		}
+		if block.Mark != "a" || len(block.RemoveMarks) != 1 {
+			t.Fatalf("SimpleQueueBlock.moveToNewStorage should move block into \"a\"")
+		}
+	}
+
+	// Erase
+	{
+		erased, err := q.Erase(ctx, cn.CapUserName("auditor"), []int64{ids[1], ids[7], ids[len(ids)-1] + 1}, "test")
+		if err != nil {
+			t.Error(err)
+		}
+		if len(erased) != 2 {
+			t.Fatalf("SimpleQueue.Erase should erase 2 messages not %v", len(erased))
+		}
+
+		erased, err = q.Erase(ctx, nil, []int64{ids[1]}, "repeat")
+		if err != nil {
+			t.Error(err)
+		}
+		if len(erased) != 0 {
+			t.Errorf("SimpleQueue.Erase should not erase tombstone messages again")
+		}
+	}
+
+	// Check files
+	{
+		for _, st := range []storage.Storage{stor, storA} {
+			body, err := st.Get(ctx, q.Blocks[0].blockFileName())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var data []*SimpleQueueMessage
+			er0 := json.Unmarshal(body, &data)
+			if er0 != nil {
+				t.Fatal(er0)
+			}
+			if len(data) != 5 {
+				t.Fatalf("SimpleQueue.Erase should keep messages in block file %v", len(data))
+			}
+			if !data[1].Tombstone || data[1].Message != nil || data[1].ID != ids[1] {
+				t.Errorf("SimpleQueue.Erase should rewrite block file with tombstone")
+			}
+			if data[0].Tombstone || !bytes.Equal(data[0].Message, []byte("secret text")) {
+				t.Errorf("SimpleQueue.Erase should not change other messages")
+			}
+		}
+
+		records, err := q.EraseAudit(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 1 || records[0].UserName != "auditor" || len(records[0].Messages) != 2 {
+			t.Errorf("SimpleQueue.Erase should write audit record")
+		}
+
+		_, err = q.Erase(ctx, cn.CapUserName("auditor2"), []int64{ids[2]}, "second")
+		if err != nil {
+			t.Error(err)
+		}
+		records, err = q.EraseAudit(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 2 || records[0].UserName != "auditor" || records[1].UserName != "auditor2" {
+			t.Errorf("SimpleQueue.Erase should append audit record")
+		}
+	}
+
+	// Get after unload
+	{
+		_, err := q.Blocks[1].Unload(ctx, q)
+		if err != nil {
+			t.Error(err)
+		}
+
+		msgs, err := q.Get(ctx, nil, ids[6], 1)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(msgs) != 1 || msgs[0].ID != ids[7] || !msgs[0].Tombstone || len(msgs[0].Message) != 0 {
+			t.Errorf("SimpleQueue.Get should return tombstone message")
+		}
+	}
+}
+
+func TestSimpleQueue_EraseCheck(t *testing.T) {
+	q := CreateSimpleQueue(5, 0, 0, storage.CreateMapSorage(), nil, nil, nil)
+
+	ctx := context.Background()
+
+	id, err := q.Add(ctx, nil, []byte("secret text"), 0, 0, "", 0, cn.SaveImmediatelySaveMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q.EraseCheck = func(ctx context.Context, user cn.CapUser) *mft.Error {
+		if user == nil || user.GetName() != "auditor" {
+			return mft.ErrorS("erase is denied")
+		}
+		return nil
+	}
+
+	_, err = q.Erase(ctx, cn.CapUserName("reader"), []int64{id}, "test")
+	if err == nil || err.Code != 10036206 {
+		t.Fatalf("SimpleQueue.Erase should fail with 10036206 not %v", err)
+	}
+	messages, err := q.GetByIDs(ctx, nil, []int64{id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || string(messages[0].Message) != "secret text" {
+		t.Fatalf("SimpleQueue.Erase should not erase message when EraseCheck fails")
+	}
+
+	erased, err := q.Erase(ctx, cn.CapUserName("auditor"), []int64{id}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(erased) != 1 {
+		t.Fatalf("SimpleQueue.Erase should erase message when EraseCheck passes")
+	}
+}
@@ -0,0 +1,326 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/capella-pw/queue/storage"
+	"github.com/myfantasy/mft"
+)
+
+// ManifestFileName - file name with log of metadata changes after last checkpoint (MetaDataFileName)
+const ManifestFileName = "q.log"
+
+// ManifestCheckpointDefault - default count of manifest events between checkpoints
+const ManifestCheckpointDefault = 1000
+
+// Manifest event operations
+const (
+	// ManifestOpBlock - block added or block metadata changed
+	ManifestOpBlock = "block"
+	// ManifestOpDelete - block deleted
+	ManifestOpDelete = "del"
+	// ManifestOpQueue - queue metadata (except blocks) changed
+	ManifestOpQueue = "queue"
+)
+
+// ManifestEvent - one line of manifest log
+type ManifestEvent struct {
+	Seq     int64           `json:"seq"`
+	Op      string          `json:"op"`
+	BlockID int64           `json:"id,omitempty"`
+	Body    json.RawMessage `json:"body,omitempty"`
+}
+
+// simpleQueueMeta - queue metadata without blocks and manifest sequence
+type simpleQueueMeta struct {
+	*SimpleQueue
+	Blocks      []*SimpleQueueBlock `json:"blocks,omitempty"`
+	ManifestSeq int64               `json:"manifest_seq,omitempty"`
+}
+
+// manifestChanges - changes of metadata after last save
+type manifestChanges struct {
+	// blocks - added or changed blocks by block id
+	blocks map[int64]*SimpleQueueBlock
+	// deleted - ids of deleted blocks
+	deleted map[int64]struct{}
+	// queue - queue metadata (except blocks) changed
+	queue bool
+	// cnt - count of events after last checkpoint
+	cnt int
+}
+
+func newManifestChanges(cnt int) *manifestChanges {
+	return &manifestChanges{
+		blocks:  make(map[int64]*SimpleQueueBlock),
+		deleted: make(map[int64]struct{}),
+		cnt:     cnt,
+	}
+}
+
+// manifestCheckpointLimit - count of events between checkpoints
+// case < 0 manifest log is not used
+func (q *SimpleQueue) manifestCheckpointLimit() int {
+	if q.ManifestCheckpoint == 0 {
+		return ManifestCheckpointDefault
+	}
+	return q.ManifestCheckpoint
+}
+
+// setBlockChanged - block is added or block metadata is changed
+// need q.mx Locked
+func (q *SimpleQueue) setBlockChanged(block *SimpleQueueBlock) {
+	if q.manifest != nil {
+		q.manifest.blocks[block.ID] = block
+	}
+}
+
+// setBlockDeleted - block is deleted
+// need q.mx Locked
+func (q *SimpleQueue) setBlockDeleted(blockID int64) {
+	if q.manifest != nil {
+		delete(q.manifest.blocks, blockID)
+		q.manifest.deleted[blockID] = struct{}{}
+	}
+}
+
+// setMetaChanged - queue metadata (except blocks) is changed
+// need q.mx Locked
+func (q *SimpleQueue) setMetaChanged() {
+	if q.manifest != nil {
+		q.manifest.queue = true
+	}
+}
+
+// manifestEvents - builds events from changes of metadata after last save
+// current write block is always written (count of messages and last id of block are changed without events)
+// need q.mx Locked and q.mxFileSave Locked
+func (q *SimpleQueue) manifestEvents(changes *manifestChanges) (events []*ManifestEvent, err error) {
+	blocks := make(map[int64]*SimpleQueueBlock, len(changes.blocks)+1)
+	for blockID, block := range changes.blocks {
+		blocks[blockID] = block
+	}
+	if len(q.Blocks) > 0 {
+		block := q.Blocks[len(q.Blocks)-1]
+		if _, ok := changes.deleted[block.ID]; !ok {
+			blocks[block.ID] = block
+		}
+	}
+
+	blockIDs := make([]int64, 0, len(blocks))
+	for blockID := range blocks {
+		blockIDs = append(blockIDs, blockID)
+	}
+	sort.Slice(blockIDs, func(i, j int) bool { return blockIDs[i] < blockIDs[j] })
+
+	for _, blockID := range blockIDs {
+		body, err := json.Marshal(blocks[blockID])
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, &ManifestEvent{Op: ManifestOpBlock, Body: body})
+	}
+
+	deletedIDs := make([]int64, 0, len(changes.deleted))
+	for blockID := range changes.deleted {
+		deletedIDs = append(deletedIDs, blockID)
+	}
+	sort.Slice(deletedIDs, func(i, j int) bool { return deletedIDs[i] < deletedIDs[j] })
+
+	for _, blockID := range deletedIDs {
+		events = append(events, &ManifestEvent{Op: ManifestOpDelete, BlockID: blockID})
+	}
+
+	if changes.queue {
+		body, err := json.Marshal(simpleQueueMeta{SimpleQueue: q})
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, &ManifestEvent{Op: ManifestOpQueue, Body: body})
+	}
+
+	return events, nil
+}
+
+// saveMeta - writes events into manifest log or writes checkpoint (MetaDataFileName)
+// need q.mxFileSave Locked
+func (q *SimpleQueue) saveMeta(ctx context.Context) (err *mft.Error) {
+	if !q.mx.TryLock(ctx) {
+		return GenerateError(10041000)
+	}
+
+	changes := q.manifest
+	appender, canAppend := storage.GetAppender(q.MetaStorage)
+	limit := q.manifestCheckpointLimit()
+	checkpoint := changes == nil || !canAppend || limit < 0 ||
+		changes.cnt+len(changes.blocks)+len(changes.deleted)+1 > limit
+
+	var data []byte
+	var errMarshal error
+	cnt := 0
+	if checkpoint {
+		data, errMarshal = json.MarshalIndent(q, "", "\t")
+	} else {
+		var events []*ManifestEvent
+		events, errMarshal = q.manifestEvents(changes)
+		buf := bytes.NewBuffer(nil)
+		for _, event := range events {
+			if errMarshal != nil {
+				break
+			}
+			q.ManifestSeq++
+			event.Seq = q.ManifestSeq
+			line, er0 := json.Marshal(event)
+			if er0 != nil {
+				errMarshal = er0
+				break
+			}
+			buf.Write(line)
+			buf.WriteByte('\n')
+		}
+		data = buf.Bytes()
+		cnt = changes.cnt + len(events)
+	}
+
+	if errMarshal != nil {
+		q.mx.Unlock()
+		return GenerateErrorE(10041002, errMarshal)
+	}
+
+	// changes after this point are written on next save
+	q.manifest = newManifestChanges(cnt)
+	q.mx.Unlock()
+
+	if checkpoint {
+		err = q.MetaStorage.Save(ctx, MetaDataFileName, data)
+		if err == nil {
+			err = storage.DeleteIfExists(ctx, q.MetaStorage, ManifestFileName)
+			if err != nil {
+				err = GenerateErrorE(10041004, err, ManifestFileName)
+			}
+		} else {
+			err = GenerateErrorE(10041003, err, MetaDataFileName)
+		}
+	} else if len(data) > 0 {
+		err = appender.Append(ctx, ManifestFileName, data)
+		if err != nil {
+			err = GenerateErrorE(10041003, err, ManifestFileName)
+		}
+	}
+
+	if err != nil {
+		// changes are lost so checkpoint is written on next save
+		q.mx.LockF()
+		q.manifest = nil
+		q.mx.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+// loadManifest - replays events from manifest log after checkpoint
+// broken last line (broken write) is ignored
+func (q *SimpleQueue) loadManifest(ctx context.Context) (cnt int, err *mft.Error) {
+	ok, err := q.MetaStorage.Exists(ctx, ManifestFileName)
+	if err != nil {
+		return 0, GenerateErrorE(10041100, err, ManifestFileName)
+	}
+	if !ok {
+		return 0, nil
+	}
+
+	body, err := q.MetaStorage.Get(ctx, ManifestFileName)
+	if err != nil {
+		return 0, GenerateErrorE(10041100, err, ManifestFileName)
+	}
+
+	lines := bytes.Split(body, []byte{'\n'})
+	for i, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+
+		var event ManifestEvent
+		er0 := json.Unmarshal(line, &event)
+		if er0 != nil {
+			if i == len(lines)-1 {
+				// broken last line
+				break
+			}
+			return cnt, GenerateErrorE(10041101, er0, i)
+		}
+
+		if event.Seq <= q.ManifestSeq {
+			continue
+		}
+
+		er0 = q.applyManifestEvent(&event)
+		if er0 != nil {
+			return cnt, GenerateErrorE(10041102, er0, i, event.Op)
+		}
+
+		q.ManifestSeq = event.Seq
+		cnt++
+	}
+
+	return cnt, nil
+}
+
+// applyManifestEvent - applies event to queue metadata
+func (q *SimpleQueue) applyManifestEvent(event *ManifestEvent) (err error) {
+	switch event.Op {
+	case ManifestOpBlock:
+		block := &SimpleQueueBlock{}
+		err = json.Unmarshal(event.Body, block)
+		if err != nil {
+			return err
+		}
+
+		idx := sort.Search(len(q.Blocks), func(i int) bool {
+			return q.Blocks[i].ID >= block.ID
+		})
+		if idx < len(q.Blocks) && q.Blocks[idx].ID == block.ID {
+			q.Blocks[idx] = block
+			return nil
+		}
+		q.Blocks = append(q.Blocks, nil)
+		copy(q.Blocks[idx+1:], q.Blocks[idx:])
+		q.Blocks[idx] = block
+	case ManifestOpDelete:
+		idx := sort.Search(len(q.Blocks), func(i int) bool {
+			return q.Blocks[i].ID >= event.BlockID
+		})
+		if idx < len(q.Blocks) && q.Blocks[idx].ID == event.BlockID {
+			q.Blocks = append(q.Blocks[:idx], q.Blocks[idx+1:]...)
+		}
+	case ManifestOpQueue:
+		meta := &SimpleQueue{}
+		err = json.Unmarshal(event.Body, &simpleQueueMeta{SimpleQueue: meta})
+		if err != nil {
+			return err
+		}
+		q.setMeta(meta)
+	default:
+		return GenerateError(10041103, event.Op)
+	}
+
+	return nil
+}
+
+// setMeta - copy queue metadata (fields saved into MetaDataFileName except blocks and manifest sequence)
+func (q *SimpleQueue) setMeta(meta *SimpleQueue) {
+	q.CntLimit = meta.CntLimit
+	q.TimeLimit = meta.TimeLimit
+	q.LenLimit = meta.LenLimit
+	q.Segments = meta.Segments
+	q.BlockFormat = meta.BlockFormat
+	q.AppendSave = meta.AppendSave
+	q.ManifestCheckpoint = meta.ManifestCheckpoint
+	q.Archives = meta.Archives
+	q.DefaultSaveMode = meta.DefaultSaveMode
+	q.UseDefaultSaveModeForce = meta.UseDefaultSaveModeForce
+}
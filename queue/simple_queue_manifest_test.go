@@ -0,0 +1,158 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/storage"
+	"github.com/myfantasy/mft"
+)
+
+func TestSimpleQueue_Manifest(t *testing.T) {
+	stor := storage.CreateMapSorage()
+	q := CreateSimpleQueue(3, 0, 0, stor, nil, nil, nil)
+
+	ctx := context.Background()
+
+	ids := make([]int64, 0)
+	add := func(cnt int) {
+		for i := 0; i < cnt; i++ {
+			id, err := q.Add(ctx, nil, []byte("text"), 0, 0, "", 0, cn.SaveImmediatelySaveMode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+	}
+
+	add(1)
+
+	checkpoint, err := stor.Get(ctx, MetaDataFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	add(8)
+
+	// changes are written into manifest log
+	{
+		body, err := stor.Get(ctx, MetaDataFileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(body, checkpoint) {
+			t.Errorf("SimpleQueue.Save should not rewrite %v", MetaDataFileName)
+		}
+
+		ok, err := stor.Exists(ctx, ManifestFileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Fatalf("SimpleQueue.Save should write %v", ManifestFileName)
+		}
+	}
+
+	// delete first block
+	{
+		logBefore, err := stor.Get(ctx, ManifestFileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = q.SetDelete(ctx, nil, func(ctx context.Context, i int, len int, q *SimpleQueue, block *SimpleQueueBlock) (needDelete bool, err *mft.Error) {
+			return i == 0, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = q.DeleteBlocks(ctx, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = q.SaveAll(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// only changed blocks are written
+		logAfter, err := stor.Get(ctx, ManifestFileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		deleted := 0
+		for _, line := range bytes.Split(bytes.TrimSpace(logAfter[len(logBefore):]), []byte{'\n'}) {
+			var event ManifestEvent
+			er0 := json.Unmarshal(line, &event)
+			if er0 != nil {
+				t.Fatal(er0)
+			}
+			if event.Op == ManifestOpDelete {
+				deleted++
+			}
+			if event.Op == ManifestOpBlock {
+				var block SimpleQueueBlock
+				er0 = json.Unmarshal(event.Body, &block)
+				if er0 != nil {
+					t.Fatal(er0)
+				}
+				if block.ID == q.Blocks[0].ID {
+					t.Errorf("SimpleQueue.Save should not write event for not changed block")
+				}
+			}
+		}
+		if deleted != 1 {
+			t.Errorf("SimpleQueue.Save should write 1 delete event not %v", deleted)
+		}
+	}
+
+	// broken last line is ignored
+	err = stor.Append(ctx, ManifestFileName, []byte(`{"seq":100000,"op":"blo`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkLoad := func(name string) {
+		q2, err := LoadSimpleQueue(ctx, stor, nil, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(q2.Blocks) != len(q.Blocks) {
+			t.Fatalf("%v: LoadSimpleQueue should load %v blocks not %v", name, len(q.Blocks), len(q2.Blocks))
+		}
+		for i := range q.Blocks {
+			if q2.Blocks[i].ID != q.Blocks[i].ID || q2.Blocks[i].Mark != q.Blocks[i].Mark {
+				t.Errorf("%v: LoadSimpleQueue block %v is different", name, i)
+			}
+		}
+
+		msgs, err := q2.Get(ctx, nil, 0, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(msgs) != len(ids)-3 || msgs[0].ID != ids[3] {
+			t.Errorf("%v: SimpleQueue.Get after load should return %v messages not %v", name, len(ids)-3, len(msgs))
+		}
+	}
+
+	checkLoad("log")
+
+	// checkpoint
+	{
+		q.ManifestCheckpoint = 1
+		add(3)
+
+		body, err := stor.Get(ctx, MetaDataFileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(body, checkpoint) {
+			t.Errorf("SimpleQueue.Save should write checkpoint into %v", MetaDataFileName)
+		}
+	}
+
+	checkLoad("checkpoint")
+}
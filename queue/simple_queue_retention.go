@@ -0,0 +1,190 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/myfantasy/mft"
+)
+
+const (
+	// RetentionReasonMaxAge - all messages in block are older then MaxAge
+	RetentionReasonMaxAge = "max_age"
+	// RetentionReasonMaxBytes - total bytes of queue are more then MaxBytes
+	RetentionReasonMaxBytes = "max_bytes"
+	// RetentionReasonMaxCount - total count of messages in queue is more then MaxCount
+	RetentionReasonMaxCount = "max_count"
+)
+
+// RetentionPolicy - rules to delete old blocks of queue
+// zero value of limit means no limit
+// last (current for write) block is never deleted
+type RetentionPolicy struct {
+	// MaxBytes - max total bytes of messages in queue
+	MaxBytes int64 `json:"max_bytes,omitempty"`
+	// MaxCount - max total count of messages in queue
+	MaxCount int64 `json:"max_count,omitempty"`
+	// MaxAge - max age of messages in queue. For example 3*24*time.Hour
+	MaxAge time.Duration `json:"max_age,omitempty"`
+	// WaitReplicaRead - block is deleted only when every replica subscriber has read past the block
+	WaitReplicaRead bool `json:"wait_replica_read,omitempty"`
+	// WaitArchive - block is deleted only when it is archived
+	WaitArchive bool `json:"wait_archive,omitempty"`
+}
+
+// IsEmpty - policy has no limits
+func (rp RetentionPolicy) IsEmpty() bool {
+	return rp.MaxBytes <= 0 && rp.MaxCount <= 0 && rp.MaxAge <= 0
+}
+
+// RetentionDeleteInfo - info about block marked to delete by retention policy
+type RetentionDeleteInfo struct {
+	BlockID int64     `json:"block_id"`
+	Dt      time.Time `json:"dt"`
+	Len     int       `json:"len"`
+	Cnt     int       `json:"cnt"`
+	LastID  int64     `json:"last_id"`
+	Reasons []string  `json:"reasons"`
+
+	archived bool
+}
+
+// retentionInfo - gets size info of block (block is loaded when count of messages is unknown)
+func (block *SimpleQueueBlock) retentionInfo(ctx context.Context, q *SimpleQueue) (info RetentionDeleteInfo, err *mft.Error) {
+	if !block.mx.RTryLock(ctx) {
+		return info, GenerateError(10037000)
+	}
+
+	if block.Cnt == 0 && block.IsUnload {
+		err = block.load(ctx, q)
+		if err != nil {
+			return info, err
+		}
+	}
+
+	info = RetentionDeleteInfo{
+		BlockID: block.ID,
+		Dt:      block.Dt,
+		Len:     block.Len,
+		Cnt:     block.Cnt,
+		LastID:  block.LastID,
+
+		archived: block.Archived,
+	}
+
+	block.mx.RUnlock()
+
+	return info, nil
+}
+
+// subscriberReplicaReadAll - every replica subscriber has read message with id
+func (q *SimpleQueue) subscriberReplicaReadAll(ctx context.Context, id int64) (ok bool, err *mft.Error) {
+	if !q.Subscribers.mx.RTryLock(ctx) {
+		return false, GenerateError(10037001)
+	}
+	defer q.Subscribers.mx.RUnlock()
+
+	for k := range q.Subscribers.ReplicaSubscribers {
+		v, ok := q.Subscribers.SubscribersInfo[k]
+		if !ok || v.LastID < id {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// SetDeleteByRetention - find and set blocks to delete by retention policy
+// it needs to save q (q.save(ctx)) after done
+// blocks are checked from oldest and checking stops on first block that should be kept
+// blocksCount = 0 - unlimited
+func (q *SimpleQueue) SetDeleteByRetention(ctx context.Context, user cn.CapUser,
+	policy RetentionPolicy, blocksCount int,
+) (deleted []RetentionDeleteInfo, err *mft.Error) {
+	if policy.IsEmpty() {
+		return nil, nil
+	}
+
+	blocks := make([]*SimpleQueueBlock, 0)
+
+	if !q.mx.RTryLock(ctx) {
+		return nil, GenerateError(10037100)
+	}
+
+	for i := 0; i < len(q.Blocks); i++ {
+		if !q.Blocks[i].NeedDelete {
+			blocks = append(blocks, q.Blocks[i])
+		}
+	}
+
+	q.mx.RUnlock()
+
+	infos := make([]RetentionDeleteInfo, 0, len(blocks))
+	var totalBytes, totalCnt int64
+	for _, block := range blocks {
+		info, err := block.retentionInfo(ctx, q)
+		if err != nil {
+			return nil, GenerateErrorE(10037101, err, block.ID)
+		}
+		infos = append(infos, info)
+		totalBytes += int64(info.Len)
+		totalCnt += int64(info.Cnt)
+	}
+
+	dtCheck := time.Now().Add(-policy.MaxAge)
+
+	blocksToDelete := make([]*SimpleQueueBlock, 0)
+
+	// last block is current for write
+	for i := 0; i < len(blocks)-1; i++ {
+		if blocksCount > 0 && len(blocksToDelete) >= blocksCount {
+			break
+		}
+
+		info := infos[i]
+
+		// all messages of block are created before next block
+		if policy.MaxAge > 0 && blocks[i+1].Dt.Before(dtCheck) {
+			info.Reasons = append(info.Reasons, RetentionReasonMaxAge)
+		}
+		if policy.MaxBytes > 0 && totalBytes > policy.MaxBytes {
+			info.Reasons = append(info.Reasons, RetentionReasonMaxBytes)
+		}
+		if policy.MaxCount > 0 && totalCnt > policy.MaxCount {
+			info.Reasons = append(info.Reasons, RetentionReasonMaxCount)
+		}
+
+		if len(info.Reasons) == 0 {
+			break
+		}
+
+		if policy.WaitArchive && !info.archived {
+			break
+		}
+
+		if policy.WaitReplicaRead && info.LastID > 0 {
+			ok, err := q.subscriberReplicaReadAll(ctx, info.LastID)
+			if err != nil {
+				return nil, GenerateErrorE(10037102, err, blocks[i].ID)
+			}
+			if !ok {
+				break
+			}
+		}
+
+		blocksToDelete = append(blocksToDelete, blocks[i])
+		deleted = append(deleted, info)
+		totalBytes -= int64(info.Len)
+		totalCnt -= int64(info.Cnt)
+	}
+
+	for i, block := range blocksToDelete {
+		err = block.setNeedDelete(ctx, q)
+		if err != nil {
+			return deleted[:i], GenerateErrorE(10037103, err, block.ID)
+		}
+	}
+
+	return deleted, nil
+}
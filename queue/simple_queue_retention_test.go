@@ -0,0 +1,100 @@
+package queue
+
+import (
+	"context"
+	"testing"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/storage"
+)
+
+func TestSimpleQueue_SetDeleteByRetention(t *testing.T) {
+	stor := storage.CreateMapSorage()
+	q := CreateSimpleQueue(5, 0, 0, stor, nil, nil, nil)
+
+	ctx := context.Background()
+
+	ids := make([]int64, 0)
+
+	// Add msgs (4 blocks by 5 messages)
+	{
+		for i := 0; i < 20; i++ {
+			id, err := q.Add(ctx, nil, []byte("0123456789"), 0, 0, "", 0, cn.SaveMarkSaveMode)
+			if err != nil {
+				t.Error(err)
+			}
+			ids = append(ids, id)
+		}
+		if len(q.Blocks) != 4 {
+			t.Fatalf("SimpleQueue.Blocks should be 4 not %v", len(q.Blocks))
+		}
+	}
+
+	// Replica subscriber does not read
+	{
+		err := q.SubscriberAddReplicaMember(ctx, nil, "replica")
+		if err != nil {
+			t.Error(err)
+		}
+
+		deleted, err := q.SetDeleteByRetention(ctx, nil, RetentionPolicy{MaxCount: 12, WaitReplicaRead: true}, 0)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(deleted) != 0 {
+			t.Errorf("SimpleQueue.SetDeleteByRetention should wait replica subscriber but deleted %v blocks", len(deleted))
+		}
+	}
+
+	// Replica subscriber reads first block
+	{
+		err := q.SubscriberSetLastRead(ctx, nil, "replica", ids[6], cn.SaveMarkSaveMode)
+		if err != nil {
+			t.Error(err)
+		}
+
+		deleted, err := q.SetDeleteByRetention(ctx, nil, RetentionPolicy{MaxCount: 12, WaitReplicaRead: true}, 0)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(deleted) != 1 {
+			t.Fatalf("SimpleQueue.SetDeleteByRetention should delete 1 block not %v", len(deleted))
+		}
+		if deleted[0].Cnt != 5 || deleted[0].LastID != ids[4] || deleted[0].Reasons[0] != RetentionReasonMaxCount {
+			t.Errorf("SimpleQueue.SetDeleteByRetention wrong report %+v", deleted[0])
+		}
+	}
+
+	// Bytes
+	{
+		deleted, err := q.SetDeleteByRetention(ctx, nil, RetentionPolicy{MaxBytes: 100}, 0)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(deleted) != 1 {
+			t.Fatalf("SimpleQueue.SetDeleteByRetention should delete 1 block not %v", len(deleted))
+		}
+		if deleted[0].Reasons[0] != RetentionReasonMaxBytes {
+			t.Errorf("SimpleQueue.SetDeleteByRetention wrong reason %v", deleted[0].Reasons)
+		}
+
+		err = q.DeleteBlocks(ctx, nil, 0)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(q.Blocks) != 2 {
+			t.Errorf("SimpleQueue.Blocks should be 2 not %v", len(q.Blocks))
+		}
+	}
+
+	// Last block is not deleted
+	{
+		deleted, err := q.SetDeleteByRetention(ctx, nil, RetentionPolicy{MaxCount: 1}, 0)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(deleted) != 1 {
+			t.Errorf("SimpleQueue.SetDeleteByRetention should delete 1 block not %v", len(deleted))
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package queue
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/myfantasy/mft"
+)
+
+// getIDBeforeTime - search id of message that placed just before first message with Dt >= dt
+// when all messages are older then dt returns id of last message
+// when queue is empty returns 0
+func (q *SimpleQueue) getIDBeforeTime(ctx context.Context, dt time.Time) (id int64, err *mft.Error) {
+	blocks := make([]*SimpleQueueBlock, 0)
+
+	if !q.mx.RTryLock(ctx) {
+		return id, GenerateError(10034000)
+	}
+
+	// messages in block are always newer then block
+	idx := sort.Search(len(q.Blocks), func(i int) bool {
+		return q.Blocks[i].Dt.After(dt)
+	})
+
+	if idx > 0 {
+		idx--
+	}
+
+	for i := idx; i < len(q.Blocks); i++ {
+		blocks = append(blocks, q.Blocks[i])
+	}
+
+	q.mx.RUnlock()
+
+	for _, block := range blocks {
+		if !block.mx.RTryLock(ctx) {
+			return id, GenerateError(10034001)
+		}
+
+		if block.NeedDelete {
+			block.mx.RUnlock()
+			continue
+		}
+
+		if block.IsUnload {
+			err = block.load(ctx, q)
+			if err != nil {
+				return id, err
+			}
+		} else {
+			block.LastGet = time.Now()
+		}
+
+		if len(block.Data) == 0 {
+			block.mx.RUnlock()
+			continue
+		}
+
+		idxMsg := sort.Search(len(block.Data), func(i int) bool {
+			return !block.Data[i].Dt.Before(dt)
+		})
+
+		if idxMsg < len(block.Data) {
+			id = block.Data[idxMsg].ID - 1
+			block.mx.RUnlock()
+
+			return id, nil
+		}
+
+		id = block.Data[len(block.Data)-1].ID
+		block.mx.RUnlock()
+	}
+
+	return id, nil
+}
+
+// GetFromTime - gets messages from queue not more then cntLimit count with Dt >= dt
+// returns messages == nil when no elements
+func (q *SimpleQueue) GetFromTime(ctx context.Context, user cn.CapUser, dt time.Time, cntLimit int) (messages []*MessageWithMeta, err *mft.Error) {
+	idStart, err := q.getIDBeforeTime(ctx, dt)
+	if err != nil {
+		return nil, err
+	}
+
+	return q.Get(ctx, user, idStart, cntLimit)
+}
+
+// SubscriberSeekTime - set last read info to position before first message with Dt >= dt
+// subscriber may be moved back or forward
+// when queue is empty subscriber is set before first message (id == 0) and is not removed
+func (q *SimpleQueue) SubscriberSeekTime(ctx context.Context, user cn.CapUser,
+	subscriber string, dt time.Time,
+	saveMode cn.SaveMode) (id int64, err *mft.Error) {
+
+	id, err = q.getIDBeforeTime(ctx, dt)
+	if err != nil {
+		return id, err
+	}
+
+	err = q.subscriberSetLastRead(ctx, user, subscriber, id, saveMode, true)
+	if err != nil {
+		return id, GenerateErrorE(10034100, err, subscriber)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,135 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/capella-pw/queue/cn"
+	"github.com/capella-pw/queue/storage"
+)
+
+func TestSimpleQueue_GetFromTime_and_SubscriberSeekTime(t *testing.T) {
+	stor := storage.CreateMapSorage()
+	q := CreateSimpleQueue(5, 0, 0, stor, nil, nil, nil)
+
+	ctx := context.Background()
+
+	var dtMiddle time.Time
+
+	// Add msgs
+	{
+		for i := 0; i < 20; i++ {
+			if i == 12 {
+				time.Sleep(time.Millisecond * 5)
+				dtMiddle = time.Now()
+				time.Sleep(time.Millisecond * 5)
+			}
+			_, err := q.Add(ctx, nil, []byte("test text"), int64(i)+1, 0, "", 0, cn.SaveMarkSaveMode)
+			if err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	// Get from time
+	{
+		msgs, err := q.GetFromTime(ctx, nil, dtMiddle, 3)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(msgs) != 3 {
+			t.Fatalf("SimpleQueue.GetFromTime should return 3 messages not %v", len(msgs))
+		}
+		if msgs[0].ExternalID != 13 {
+			t.Errorf("SimpleQueue.GetFromTime first external id should be 13 not %v", msgs[0].ExternalID)
+		}
+
+		msgs, err = q.GetFromTime(ctx, nil, time.Now(), 3)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(msgs) != 0 {
+			t.Errorf("SimpleQueue.GetFromTime (now) should return 0 messages not %v", len(msgs))
+		}
+
+		msgs, err = q.GetFromTime(ctx, nil, time.Time{}, 3)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(msgs) != 3 || msgs[0].ExternalID != 1 {
+			t.Errorf("SimpleQueue.GetFromTime (zero) should return messages from first")
+		}
+	}
+
+	// Subscriber seek forward and back
+	{
+		_, err := q.SubscriberSeekTime(ctx, nil, "subscr", dtMiddle, cn.SaveMarkSaveMode)
+		if err != nil {
+			t.Error(err)
+		}
+
+		id, err := q.SubscriberGetLastRead(ctx, nil, "subscr")
+		if err != nil {
+			t.Error(err)
+		}
+
+		msgs, err := q.Get(ctx, nil, id, 1)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(msgs) != 1 || msgs[0].ExternalID != 13 {
+			t.Errorf("SimpleQueue.SubscriberSeekTime should move subscriber before external id 13")
+		}
+
+		idBack, err := q.SubscriberSeekTime(ctx, nil, "subscr", time.Time{}, cn.SaveMarkSaveMode)
+		if err != nil {
+			t.Error(err)
+		}
+		if idBack >= id {
+			t.Errorf("SimpleQueue.SubscriberSeekTime should rewind subscriber %v >= %v", idBack, id)
+		}
+
+		id, err = q.SubscriberGetLastRead(ctx, nil, "subscr")
+		if err != nil {
+			t.Error(err)
+		}
+		if id != idBack {
+			t.Errorf("SimpleQueue.SubscriberGetLastRead should be %v not %v", idBack, id)
+		}
+	}
+}
+
+func TestSimpleQueue_SubscriberSeekTime_empty(t *testing.T) {
+	q := CreateSimpleQueue(5, 0, 0, storage.CreateMapSorage(), nil, nil, nil)
+	ctx := context.Background()
+
+	err := q.SubscriberSetLastRead(ctx, nil, "subscr", 100, cn.SaveMarkSaveMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := q.SubscriberSeekTime(ctx, nil, "subscr", time.Now(), cn.SaveMarkSaveMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 0 {
+		t.Errorf("SimpleQueue.SubscriberSeekTime on empty queue should return 0 not %v", id)
+	}
+
+	v, ok := q.Subscribers.SubscribersInfo["subscr"]
+	if !ok {
+		t.Fatal("SimpleQueue.SubscriberSeekTime on empty queue should not remove subscriber")
+	}
+	if v.LastID != 0 {
+		t.Errorf("SimpleQueue.SubscriberSeekTime on empty queue should set last id 0 not %v", v.LastID)
+	}
+
+	_, err = q.SubscriberSeekTime(ctx, nil, "new_subscr", time.Now(), cn.SaveMarkSaveMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := q.Subscribers.SubscribersInfo["new_subscr"]; !ok {
+		t.Error("SimpleQueue.SubscriberSeekTime should create subscriber")
+	}
+}
@@ -12,6 +12,7 @@ var Errors map[int]string = map[int]string{
 	10000001: "MapSorage: name exists: %v",
 	10000002: "File: error: %v",
 	10000003: "Mkdir error: path: %v",
+	10000004: "Fsync folder error: path: %v",
 
 	10001000: "Cluster.Create: Lock mutex fail wait",
 	10001001: "Cluster.Create: storage type %v is not exists",
@@ -14,11 +14,14 @@ type FileSorage struct {
 	FolderPerm os.FileMode
 	FilePerm   os.FileMode
 	Folder     string
+	// Fsync - sync file and folder after write, rename and delete
+	Fsync bool
 }
 
 // CreateFileSorageParams params for create file storage
 type CreateFileSorageParams struct {
 	Folder string `json:"folder"`
+	Fsync  bool   `json:"fsync,omitempty"`
 }
 
 // CreateFileSorage creates simple FileOnDisk with perms 0760 & 0660
@@ -27,6 +30,7 @@ func CreateFileSorage(ctx context.Context, params CreateFileSorageParams) (*File
 		FolderPerm: 0760,
 		FilePerm:   0660,
 		Folder:     params.Folder,
+		Fsync:      params.Fsync,
 	}
 
 	if len(res.Folder) > 0 && res.Folder[len(res.Folder)-1] == '/' {
@@ -68,11 +72,81 @@ func (s *FileSorage) Get(ctx context.Context, name string) (body []byte, err *mf
 func (s *FileSorage) Save(ctx context.Context, name string, body []byte) *mft.Error {
 	path := filepath.FromSlash(s.Folder + name)
 
-	er0 := ioutil.WriteFile(path, body, s.FilePerm)
-	if er0 == nil {
+	if !s.Fsync {
+		er0 := ioutil.WriteFile(path, body, s.FilePerm)
+		if er0 == nil {
+			return nil
+		}
+		return GenerateError(10000002, er0)
+	}
+
+	return s.write(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, body)
+}
+
+// write - write body into file and sync file (when Fsync) and folder (when file is created)
+func (s *FileSorage) write(path string, flag int, body []byte) *mft.Error {
+	isNew := false
+	if s.Fsync {
+		_, er0 := os.Stat(path)
+		isNew = os.IsNotExist(er0)
+	}
+
+	f, er0 := os.OpenFile(path, flag, s.FilePerm)
+	if er0 != nil {
+		return GenerateError(10000002, er0)
+	}
+
+	_, er0 = f.Write(body)
+	if er0 == nil && s.Fsync {
+		er0 = f.Sync()
+	}
+	if er0 != nil {
+		f.Close()
+		return GenerateError(10000002, er0)
+	}
+
+	er0 = f.Close()
+	if er0 != nil {
+		return GenerateError(10000002, er0)
+	}
+
+	if isNew {
+		return s.syncDir(path)
+	}
+	return nil
+}
+
+// syncDir - sync folder of path (when Fsync)
+func (s *FileSorage) syncDir(path string) *mft.Error {
+	if !s.Fsync {
 		return nil
 	}
-	return GenerateError(10000002, er0)
+
+	dirPath := filepath.Dir(path)
+	d, er0 := os.Open(dirPath)
+	if er0 != nil {
+		return GenerateErrorE(10000004, er0, dirPath)
+	}
+
+	er0 = d.Sync()
+	if er0 != nil {
+		d.Close()
+		return GenerateErrorE(10000004, er0, dirPath)
+	}
+
+	er0 = d.Close()
+	if er0 != nil {
+		return GenerateErrorE(10000004, er0, dirPath)
+	}
+
+	return nil
+}
+
+// Append write data into the end of file
+func (s *FileSorage) Append(ctx context.Context, name string, body []byte) *mft.Error {
+	path := filepath.FromSlash(s.Folder + name)
+
+	return s.write(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, body)
 }
 
 // Delete delete data from storage
@@ -81,7 +155,7 @@ func (s *FileSorage) Delete(ctx context.Context, name string) *mft.Error {
 
 	er0 := os.RemoveAll(path)
 	if er0 == nil {
-		return nil
+		return s.syncDir(path)
 	}
 	return GenerateError(10000002, er0)
 }
@@ -93,7 +167,7 @@ func (s *FileSorage) Rename(ctx context.Context, oldName string, newName string)
 
 	er0 := os.Rename(pathOld, pathNew)
 	if er0 == nil {
-		return nil
+		return s.syncDir(pathNew)
 	}
 	return GenerateError(10000002, er0)
 }
@@ -38,6 +38,9 @@ type Mount struct {
 	CompressAlg   string `json:"compress_alg,omitempty"`
 	FileExtention string `json:"file_extention,omitempty"`
 
+	// Fsync - sync files and folders on write (file providers)
+	Fsync bool `json:"fsync,omitempty"`
+
 	Params map[string]string `json:"params"`
 }
 
@@ -53,12 +56,14 @@ func CreateGenerator(generatorInfo GeneratorInfo, compressor *compress.Generator
 	res.AddStorGenerator(StorageFileType, func(ctx context.Context, params Mount, relativePath string) (Storage, *mft.Error) {
 		cp := CreateFileSorageParams{}
 		cp.Folder = params.HomePath + relativePath
+		cp.Fsync = params.Fsync
 
 		return CreateFileSorage(ctx, cp)
 	})
 	res.AddStorGenerator(StorageFileDoubleSaveType, func(ctx context.Context, params Mount, relativePath string) (Storage, *mft.Error) {
 		cp := CreateFileSorageParams{}
 		cp.Folder = params.HomePath + relativePath
+		cp.Fsync = params.Fsync
 
 		storage, er := CreateFileSorage(ctx, cp)
 
@@ -71,6 +76,7 @@ func CreateGenerator(generatorInfo GeneratorInfo, compressor *compress.Generator
 	res.AddStorGenerator(StorageFileDoubleSaveTypeGZip, func(ctx context.Context, params Mount, relativePath string) (Storage, *mft.Error) {
 		cp := CreateFileSorageParams{}
 		cp.Folder = params.HomePath + relativePath
+		cp.Fsync = params.Fsync
 
 		storage, er := CreateFileSorage(ctx, cp)
 
@@ -53,6 +53,20 @@ func (s *MapSorage) Save(ctx context.Context, name string, body []byte) *mft.Err
 	return nil
 }
 
+// Append write data into the end of file
+func (s *MapSorage) Append(ctx context.Context, name string, body []byte) *mft.Error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	old := s.storage[name]
+	data := make([]byte, 0, len(old)+len(body))
+	data = append(data, old...)
+	data = append(data, body...)
+	s.storage[name] = data
+
+	return nil
+}
+
 // Delete delete data from storage
 func (s *MapSorage) Delete(ctx context.Context, name string) *mft.Error {
 	s.mx.Lock()
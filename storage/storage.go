@@ -36,3 +36,20 @@ func DeleteIfExists(ctx context.Context, st Storage, name string) (err *mft.Erro
 	err = st.Delete(ctx, name)
 	return err
 }
+
+// Appender - storage that can append data to the end of file
+type Appender interface {
+	// Append write data into the end of file (file is created when not exists)
+	Append(ctx context.Context, name string, body []byte) *mft.Error
+}
+
+// GetAppender returns Appender when storage supports append
+// DoubleSaveSorage appends directly into underlying storage
+func GetAppender(st Storage) (appender Appender, ok bool) {
+	if ds, isDs := st.(*DoubleSaveSorage); isDs {
+		return GetAppender(ds.storage)
+	}
+
+	appender, ok = st.(Appender)
+	return appender, ok
+}
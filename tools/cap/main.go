@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/capella-pw/queue/cluster"
@@ -49,6 +51,21 @@ var fCmd = flag.String("cmd", "",
 	q_list - gets queues list
 	q_get - gets messages from queue (requare "name", "qty" and "id")
 		example: ./cap -cmd q_get -name example_queue -qty 10 -id 0
+	q_get_time - gets messages from queue starting at time (requare "name", "qty" and "dt")
+		example: ./cap -cmd q_get_time -name example_queue -qty 10 -dt 2021-06-01T10:00:00+03:00
+	q_get_ids - gets messages from queue by ids (requare "name" and "ids")
+		example: ./cap -cmd q_get_ids -name example_queue -ids 1,2,3
+	q_get_eid - gets message from queue by source and external id (requare "name", "source" and "id")
+		example: ./cap -cmd q_get_eid -name example_queue -source example_source -id 10
+	q_erase - erases messages from queue by ids (requare "name" and "ids"; "reason" is optional)
+		example: ./cap -cmd q_erase -name example_queue -ids 1,2,3 -reason "erase request 42"
+	q_subs_seek_time - moves subscriber to first message at or after time (requare "name", "subscriber", "dt" and "save_mode")
+		example: ./cap -cmd q_subs_seek_time -name example_queue -subscriber example_subscr -dt 2021-06-01T10:00:00+03:00 -save_mode 2
+	q_mirror_translate - translates id of source message into id of mirror queue (requare "name", "source" (mirror source) and "id";
+		when "subscriber" is set last read of subscriber of mirror is set to translated id with "save_mode")
+		example: ./cap -cmd q_mirror_translate -name example_mirror -source mirror:example_queue -id 1624075947165280002 -subscriber example_subscr -save_mode 2
+	q_archive_restore - restores messages from archives of queue (requare "p" or "pf")
+		example: ./cap -cmd q_archive_restore -pf restore_archive.json
 	q_au - queue add unique messages (requare "name", "save_mode", "p" or "pf")
 		example: ./cap -cmd q_au -name example_queue -pf new_messages.json -save_mode 2
 		example: ./cap -cmd q_au -name example_queue2 -pf new_messages2.json -save_mode 2
@@ -60,12 +77,14 @@ var fCmd = flag.String("cmd", "",
 	exc_list - gets external clusters list
 
 	h_add - creates handler
+		example: ./cap -cmd h_add -pf new_archive_handler.json
 		example: ./cap -cmd h_add -pf new_copy_handler.json
 		example: ./cap -cmd h_add -pf new_copy_handler2.json
 		example: ./cap -cmd h_add -pf new_delete_handler.json
 		example: ./cap -cmd h_add -pf new_mark_handler.json
 		example: ./cap -cmd h_add -pf new_regularly_save_handler.json
 		example: ./cap -cmd h_add -pf new_regularly_save_handler2.json
+		example: ./cap -cmd h_add -pf new_retention_handler.json
 		example: ./cap -cmd h_add -pf new_unload_handler.json
 
 	h_drop - drops handler (requare "name")
@@ -76,6 +95,7 @@ var fCmd = flag.String("cmd", "",
 	h_last_error - show handler's last error (requare "name")
 	h_last_complete - show handler's last complete time (requare "name")
 	h_is_started - show handler is started (requare "name")
+	h_last_report - show handler's last report (requare "name"; only for handlers with report like "retention")
 	`)
 
 var fParamsFileName = flag.String("pf", "",
@@ -93,6 +113,21 @@ var fQty = flag.Int("qty", 0,
 var fID = flag.Int64("id", 0,
 	`id of message`)
 
+var fIDs = flag.String("ids", "",
+	`ids of messages separated by comma; example 1,2,3`)
+
+var fSource = flag.String("source", "",
+	`Source of message`)
+
+var fReason = flag.String("reason", "",
+	`Reason of operation`)
+
+var fDt = flag.String("dt", "",
+	`Time in RFC3339 format; example 2021-06-01T10:00:00+03:00`)
+
+var fSubscriber = flag.String("subscriber", "",
+	`Subscriber name`)
+
 var fSaveMode = flag.Int("save_mode", 2,
 	`Save mode
 		0 - NotSave (not mark queue as need changed)
@@ -121,6 +156,32 @@ func GetParams(v interface{}) {
 	}
 }
 
+func GetDt() time.Time {
+	dt, er0 := time.Parse(time.RFC3339, *fDt)
+	if er0 != nil {
+		log.Fatalf("Parse dt `%v` fail: %v\n", *fDt, er0)
+	}
+
+	return dt
+}
+
+func GetIDs() []int64 {
+	var ids []int64
+	for _, v := range strings.Split(*fIDs, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		id, er0 := strconv.ParseInt(v, 10, 64)
+		if er0 != nil {
+			log.Fatalf("Parse id `%v` fail: %v\n", v, er0)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
 func main() {
 	flag.Parse()
 
@@ -300,6 +361,189 @@ func main() {
 		}
 		fmt.Println(string(bt))
 		os.Exit(0)
+	} else if *fCmd == "q_get_time" {
+		var q queue.Queue
+		var exists bool
+		var messages []*queue.MessageWithMeta
+		dt := GetDt()
+		err = cg.FuncDOName(ctx, *fConnectionName,
+			func(ctx context.Context, c *cluster.ExternalAbstractCluster) (err *mft.Error) {
+				q, exists, err = c.GetQueue(ctx, nil, *fName)
+
+				if err != nil {
+					return err
+				}
+				if !exists {
+					return err
+				}
+
+				messages, err = q.GetFromTime(ctx, nil, dt, *fQty)
+				return err
+			})
+		if err != nil {
+			fmt.Printf("Get Queue messages from time `%v` from `%v` error: %v\n", *fName, *fConnectionName, err)
+			os.Exit(1)
+		}
+		if !exists {
+			fmt.Printf("Get Queue messages from time `%v` from `%v` error: queue does not exists\n", *fName, *fConnectionName)
+			os.Exit(1)
+		}
+		bt, er0 := json.MarshalIndent(messages, "", "  ")
+		if er0 != nil {
+			log.Fatalf("Marshal Queue messages from `%v` fail: %v\n", *fConnectionName, er0)
+		}
+		fmt.Println(string(bt))
+		os.Exit(0)
+	} else if *fCmd == "q_get_ids" {
+		var q queue.Queue
+		var exists bool
+		var messages []*queue.MessageWithMeta
+		ids := GetIDs()
+		err = cg.FuncDOName(ctx, *fConnectionName,
+			func(ctx context.Context, c *cluster.ExternalAbstractCluster) (err *mft.Error) {
+				q, exists, err = c.GetQueue(ctx, nil, *fName)
+
+				if err != nil {
+					return err
+				}
+				if !exists {
+					return err
+				}
+
+				messages, err = q.GetByIDs(ctx, nil, ids)
+				return err
+			})
+		if err != nil {
+			fmt.Printf("Get Queue messages by ids `%v` from `%v` error: %v\n", *fName, *fConnectionName, err)
+			os.Exit(1)
+		}
+		if !exists {
+			fmt.Printf("Get Queue messages by ids `%v` from `%v` error: queue does not exists\n", *fName, *fConnectionName)
+			os.Exit(1)
+		}
+		bt, er0 := json.MarshalIndent(messages, "", "  ")
+		if er0 != nil {
+			log.Fatalf("Marshal Queue messages from `%v` fail: %v\n", *fConnectionName, er0)
+		}
+		fmt.Println(string(bt))
+		os.Exit(0)
+	} else if *fCmd == "q_get_eid" {
+		var q queue.Queue
+		var exists bool
+		var msgExists bool
+		var message *queue.MessageWithMeta
+		err = cg.FuncDOName(ctx, *fConnectionName,
+			func(ctx context.Context, c *cluster.ExternalAbstractCluster) (err *mft.Error) {
+				q, exists, err = c.GetQueue(ctx, nil, *fName)
+
+				if err != nil {
+					return err
+				}
+				if !exists {
+					return err
+				}
+
+				message, msgExists, err = q.GetByExternalID(ctx, nil, *fSource, *fID)
+				return err
+			})
+		if err != nil {
+			fmt.Printf("Get Queue message by external id `%v` from `%v` error: %v\n", *fName, *fConnectionName, err)
+			os.Exit(1)
+		}
+		if !exists {
+			fmt.Printf("Get Queue message by external id `%v` from `%v` error: queue does not exists\n", *fName, *fConnectionName)
+			os.Exit(1)
+		}
+		if !msgExists {
+			fmt.Printf("Get Queue message by external id `%v` from `%v` error: message does not exists\n", *fName, *fConnectionName)
+			os.Exit(1)
+		}
+		bt, er0 := json.MarshalIndent(message, "", "  ")
+		if er0 != nil {
+			log.Fatalf("Marshal Queue message from `%v` fail: %v\n", *fConnectionName, er0)
+		}
+		fmt.Println(string(bt))
+		os.Exit(0)
+	} else if *fCmd == "q_erase" {
+		var q queue.Queue
+		var exists bool
+		var erased []*queue.MessageOnlyMeta
+		ids := GetIDs()
+		err = cg.FuncDOName(ctx, *fConnectionName,
+			func(ctx context.Context, c *cluster.ExternalAbstractCluster) (err *mft.Error) {
+				q, exists, err = c.GetQueue(ctx, nil, *fName)
+
+				if err != nil {
+					return err
+				}
+				if !exists {
+					return err
+				}
+
+				erased, err = q.Erase(ctx, nil, ids, *fReason)
+				return err
+			})
+		if err != nil {
+			fmt.Printf("Erase Queue messages `%v` on `%v` error: %v\n", *fName, *fConnectionName, err)
+			os.Exit(1)
+		}
+		if !exists {
+			fmt.Printf("Erase Queue messages `%v` on `%v` error: queue does not exists\n", *fName, *fConnectionName)
+			os.Exit(1)
+		}
+		bt, er0 := json.MarshalIndent(erased, "", "  ")
+		if er0 != nil {
+			log.Fatalf("Marshal erased Queue messages from `%v` fail: %v\n", *fConnectionName, er0)
+		}
+		fmt.Println(string(bt))
+		os.Exit(0)
+	} else if *fCmd == "q_subs_seek_time" {
+		var q queue.Queue
+		var exists bool
+		var id int64
+		dt := GetDt()
+		err = cg.FuncDOName(ctx, *fConnectionName,
+			func(ctx context.Context, c *cluster.ExternalAbstractCluster) (err *mft.Error) {
+				q, exists, err = c.GetQueue(ctx, nil, *fName)
+
+				if err != nil {
+					return err
+				}
+				if !exists {
+					return err
+				}
+
+				id, err = q.SubscriberSeekTime(ctx, nil, *fSubscriber, dt, cn.SaveMode(*fSaveMode))
+				return err
+			})
+		if err != nil {
+			fmt.Printf("Queue `%v` subscriber `%v` seek time on `%v` error: %v\n", *fName, *fSubscriber, *fConnectionName, err)
+			os.Exit(1)
+		}
+		if !exists {
+			fmt.Printf("Queue `%v` subscriber `%v` seek time on `%v` error: queue does not exists\n", *fName, *fSubscriber, *fConnectionName)
+			os.Exit(1)
+		}
+		fmt.Println(id)
+		os.Exit(0)
+	} else if *fCmd == "q_mirror_translate" {
+		var id int64
+		err = cg.FuncDOName(ctx, *fConnectionName,
+			func(ctx context.Context, c *cluster.ExternalAbstractCluster) (err *mft.Error) {
+				q := &cluster.ExternalAbstractQueue{
+					QueueName: *fName,
+					CallFunc:  c.CallFunc,
+				}
+
+				id, err = q.MirrorTranslate(ctx, nil, *fSource, *fID, *fSubscriber, cn.SaveMode(*fSaveMode))
+				return err
+			})
+		if err != nil {
+			fmt.Printf("Queue `%v` mirror translate id %v on `%v` error: %v\n", *fName, *fID, *fConnectionName, err)
+			os.Exit(1)
+		}
+		fmt.Println(id)
+		os.Exit(0)
 	} else if *fCmd == "q_au" {
 		var q queue.Queue
 		var exists bool
@@ -335,6 +579,25 @@ func main() {
 		}
 		fmt.Println(string(bt))
 		os.Exit(0)
+	} else if *fCmd == "q_archive_restore" {
+		var req cluster.ArchiveRestoreRequest
+		var resp cluster.ArchiveRestoreResponce
+		GetParams(&req)
+		err = cg.FuncDOName(ctx, *fConnectionName,
+			func(ctx context.Context, c *cluster.ExternalAbstractCluster) (err *mft.Error) {
+				resp, err = c.RestoreArchive(ctx, nil, req)
+				return err
+			})
+		if err != nil {
+			fmt.Printf("Restore archive of Queue `%v` on `%v` error: %v\n", req.QueueName, *fConnectionName, err)
+			os.Exit(1)
+		}
+		bt, er0 := json.MarshalIndent(resp, "", "  ")
+		if er0 != nil {
+			log.Fatalf("Marshal restore archive result from `%v` fail: %v\n", *fConnectionName, er0)
+		}
+		fmt.Println(string(bt))
+		os.Exit(0)
 	} else if *fCmd == "exc_add" {
 		var ecd cluster.ExternalClusterDescription
 		GetParams(&ecd)
@@ -597,6 +860,39 @@ func main() {
 		}
 		fmt.Println(isStarted)
 		os.Exit(0)
+	} else if *fCmd == "h_last_report" {
+		var handler cluster.Handler
+		var exists bool
+		var report json.RawMessage
+		err = cg.FuncDOName(ctx, *fConnectionName,
+			func(ctx context.Context, c *cluster.ExternalAbstractCluster) (err *mft.Error) {
+				handler, exists, err = c.GetHandler(ctx, nil, *fName)
+
+				if err != nil {
+					return err
+				}
+				if !exists {
+					return err
+				}
+
+				report, err = handler.(cluster.HandlerReporter).LastReport(ctx)
+
+				return err
+			})
+		if err != nil {
+			fmt.Printf("LastReport Handler %v from %v error: %v\n", *fName, *fConnectionName, err)
+			os.Exit(1)
+		}
+		if !exists {
+			fmt.Printf("LastReport Handler %v from %v error: handler does not exists\n", *fName, *fConnectionName)
+			os.Exit(1)
+		}
+		bt, er0 := json.MarshalIndent(report, "", "  ")
+		if er0 != nil {
+			log.Fatalf("Marshal Handler report from `%v` fail: %v\n", *fConnectionName, er0)
+		}
+		fmt.Println(string(bt))
+		os.Exit(0)
 	} else {
 		fmt.Println("No comand")
 	}
@@ -381,7 +381,7 @@ func (s *Source) SetMessagesFromCGG(st *Settings, msgs []queue.MessageJsonBody)
 			func(ids []int64) {
 				log.Tracef("Sended msgs to queue `%v` from `%v` (GROUP) out %v \n", s.QueueName, s.Name, ids)
 			}), func(err *mft.Error) {
-			log.Debug("Sended msgs to queue `%v` from `%v` (GROUP) error %v \n", s.QueueName, s.Name, err)
+			log.Debugf("Sended msgs to queue `%v` from `%v` (GROUP) error %v \n", s.QueueName, s.Name, err)
 		})
 
 	if err != nil {